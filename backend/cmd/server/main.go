@@ -2,21 +2,53 @@ package main
 
 import (
 	"chat-app/internal/auth"
+	"chat-app/internal/compress"
 	"chat-app/internal/config"
 	"chat-app/internal/context"
 	"chat-app/internal/db"
 	"chat-app/internal/handlers"
+	"chat-app/internal/logger"
+	"chat-app/internal/metrics"
+	"chat-app/internal/moderation"
+	"chat-app/internal/rag"
+	"chat-app/internal/tracing"
+	stdcontext "context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// archivePurgeInterval is how often archived conversations past their retention period are purged
+const archivePurgeInterval = time.Hour
+
+// exportPurgeInterval is how often finished exports past their retention period are deleted
+const exportPurgeInterval = time.Hour
+
+// refreshTokenPurgeInterval is how often expired and revoked refresh tokens are deleted
+const refreshTokenPurgeInterval = time.Hour
+
+// shutdownTimeout bounds how long running requests may take to finish once the server is stopped
+const shutdownTimeout = 30 * time.Second
+
+// setAllowedOrigin allows the request's origin to read the response if it is in the CORS allow-list
+func setAllowedOrigin(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && config.IsOriginAllowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Add("Vary", "Origin")
+}
 
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		setAllowedOrigin(w, r)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -27,19 +59,30 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-
 func main() {
+	logger.InstallSanitizer()
+
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Set up trace propagation and export
+	if err := tracing.Init(config.GetTracingConfig()); err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Initialize database
 	log.Printf("Initializing database...")
 	if err := db.InitDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.CloseDB()
+	metrics.RegisterDBPoolGauges(db.PoolStats)
 
 	// Load models configuration
 	log.Printf("Loading models configuration...")
@@ -49,6 +92,57 @@ func main() {
 	}
 	log.Printf("Loaded %d models", len(config.GetAvailableModels()))
 
+	// Reload models configuration on SIGHUP
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	go func() {
+		for range reloadSignals {
+			count, err := config.ReloadModels(modelsPath)
+			if err != nil {
+				log.Printf("SIGHUP: keeping previous models configuration: %v", err)
+				continue
+			}
+			log.Printf("SIGHUP: reloaded %d models", count)
+		}
+	}()
+
+	// Permanently delete archived conversations once their retention period has passed
+	if retention := config.GetArchivedConversationRetention(); retention > 0 {
+		go func() {
+			ticker := time.NewTicker(archivePurgeInterval)
+			defer ticker.Stop()
+			for ; ; <-ticker.C {
+				if err := handlers.PurgeArchivedConversations(retention); err != nil {
+					log.Printf("Warning: failed to purge archived conversations: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Delete finished exports and their files once their retention period has passed
+	if retention := config.GetExportRetention(); retention > 0 {
+		go func() {
+			ticker := time.NewTicker(exportPurgeInterval)
+			defer ticker.Stop()
+			for ; ; <-ticker.C {
+				if err := handlers.PurgeExpiredExports(retention); err != nil {
+					log.Printf("Warning: failed to purge expired exports: %v", err)
+				}
+			}
+		}()
+	}
+
+	// Delete refresh tokens that can no longer be exchanged
+	go func() {
+		ticker := time.NewTicker(refreshTokenPurgeInterval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if _, err := db.DeleteStaleRefreshTokens(); err != nil {
+				log.Printf("Warning: failed to purge refresh tokens: %v", err)
+			}
+		}
+	}()
+
 	// Load War and Peace text
 	log.Printf("Loading War and Peace context...")
 	warAndPeacePath := "warandpeace.txt"
@@ -61,17 +155,45 @@ func main() {
 		log.Fatalf("Failed to seed demo user: %v", err)
 	}
 
+	// Grant admin role to configured users
+	if err := db.PromoteAdmins(config.GetAdminUsernames()); err != nil {
+		log.Fatalf("Failed to promote admin users: %v", err)
+	}
+
+	// Compile content moderation blocklist
+	moderationConfig, err := config.GetModerationConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize content moderation: %v", err)
+	}
+	moderator, err := moderation.NewModerator(moderationConfig.Enabled, moderationConfig.BlockedPatterns)
+	if err != nil {
+		log.Fatalf("Failed to initialize content moderation: %v", err)
+	}
+
+	// Connect to the vector store used for retrieved context
+	var vectorStore rag.VectorStore
+	if ragConfig := config.GetRAGConfig(); ragConfig.Enabled {
+		vectorStore = rag.NewHTTPVectorStore(ragConfig.VectorStoreURL)
+		log.Printf("RAG enabled: vector store %s, top %d passages", ragConfig.VectorStoreURL, ragConfig.TopK)
+	}
+
 	// Create chat handlers
-	chatHandler := handlers.NewChatHandlers()
+	chatHandler := handlers.NewChatHandlers(moderator, vectorStore)
+	chatHandler.ResumeExportJobs()
+	metrics.RegisterStreamGauge(chatHandler.ActiveStreams)
+
+	// Limit how often each user may send chat messages
+	rateLimitConfig := config.GetRateLimitConfig()
+	chatRateLimiter := auth.NewRateLimiter(rateLimitConfig.RequestsPerMinute, rateLimitConfig.BurstSize)
 
 	// Create new ServeMux to use Go 1.22+ routing features for path parameters
 	mux := http.NewServeMux()
 
 	// CORS preflight handler for OPTIONS requests
 	corsHandler := func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		setAllowedOrigin(w, r)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
 		w.WriteHeader(http.StatusOK)
 	}
 
@@ -80,6 +202,10 @@ func main() {
 	mux.HandleFunc("OPTIONS /api/login", corsHandler)
 	mux.HandleFunc("POST /api/register", enableCORS(auth.RegisterHandler))
 	mux.HandleFunc("OPTIONS /api/register", corsHandler)
+	mux.HandleFunc("POST /api/auth/refresh", enableCORS(auth.RefreshHandler))
+	mux.HandleFunc("OPTIONS /api/auth/refresh", corsHandler)
+	mux.HandleFunc("POST /api/auth/logout", enableCORS(auth.LogoutHandler))
+	mux.HandleFunc("OPTIONS /api/auth/logout", corsHandler)
 	mux.HandleFunc("GET /api/health", enableCORS(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -87,24 +213,147 @@ func main() {
 	mux.HandleFunc("OPTIONS /api/health", corsHandler)
 	mux.HandleFunc("GET /api/models", enableCORS(chatHandler.GetModelsHandler))
 	mux.HandleFunc("OPTIONS /api/models", corsHandler)
+	mux.HandleFunc("GET /api/models/{id...}", enableCORS(chatHandler.GetModelHandler))
+	mux.HandleFunc("OPTIONS /api/models/{id...}", corsHandler)
+	mux.HandleFunc("POST /api/webhook/ingest", chatHandler.WebhookIngestHandler)
 
 	// Protected routes - use method-based routing (Go 1.22+ native)
-	mux.HandleFunc("POST /api/chat", enableCORS(auth.AuthMiddleware(chatHandler.ChatHandler)))
+	mux.HandleFunc("POST /api/chat", enableCORS(auth.AuthMiddleware(chatRateLimiter.Middleware(metrics.Middleware(chatHandler.ChatHandler)))))
 	mux.HandleFunc("OPTIONS /api/chat", corsHandler)
-	mux.HandleFunc("POST /api/chat/stream", enableCORS(auth.AuthMiddleware(chatHandler.ChatStreamHandler)))
+	mux.HandleFunc("POST /api/chat/stream", enableCORS(auth.AuthMiddleware(chatRateLimiter.Middleware(metrics.Middleware(chatHandler.ChatStreamHandler)))))
+	mux.HandleFunc("GET /api/users/me/stats", enableCORS(auth.AuthMiddleware(chatHandler.GetUserStatsHandler)))
+	mux.HandleFunc("OPTIONS /api/users/me/stats", corsHandler)
+	mux.HandleFunc("PUT /api/users/me/webhook", enableCORS(auth.AuthMiddleware(chatHandler.UpdateWebhookHandler)))
+	mux.HandleFunc("OPTIONS /api/users/me/webhook", corsHandler)
+	mux.HandleFunc("GET /api/jobs/{id}", enableCORS(auth.AuthMiddleware(chatHandler.GetJobHandler)))
+	mux.HandleFunc("OPTIONS /api/jobs/{id}", corsHandler)
+	mux.HandleFunc("GET /api/jobs/{id}/download", enableCORS(auth.AuthMiddleware(chatHandler.DownloadExportHandler)))
+	mux.HandleFunc("OPTIONS /api/jobs/{id}/download", corsHandler)
 	mux.HandleFunc("OPTIONS /api/chat/stream", corsHandler)
+	// WebSocket alternative to the SSE stream; the handshake is a GET request as required by the protocol
+	mux.HandleFunc("GET /api/chat/ws", enableCORS(auth.WebSocketAuthMiddleware(chatRateLimiter.Middleware(metrics.Middleware(chatHandler.ChatWSHandler)))))
 	mux.HandleFunc("GET /api/conversations", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationsHandler)))
 	mux.HandleFunc("OPTIONS /api/conversations", corsHandler)
+	mux.HandleFunc("GET /api/conversations/recent", enableCORS(auth.AuthMiddleware(chatHandler.GetRecentConversationsHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/recent", corsHandler)
+	mux.HandleFunc("GET /api/conversations/search", enableCORS(auth.AuthMiddleware(chatHandler.SearchConversationsHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/search", corsHandler)
+	mux.HandleFunc("GET /api/conversations/archived", enableCORS(auth.AuthMiddleware(chatHandler.GetArchivedConversationsHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/archived", corsHandler)
 
 	// Protected parameterized routes (Go 1.22+ native path parameters with {id})
 	mux.HandleFunc("GET /api/conversations/{id}/messages", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationMessagesHandler)))
+	mux.HandleFunc("DELETE /api/conversations/{id}/messages", enableCORS(auth.AuthMiddleware(chatHandler.ClearConversationMessagesHandler)))
 	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/messages/search", enableCORS(auth.AuthMiddleware(chatHandler.SearchConversationMessagesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/search", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/messages/count-by-role", enableCORS(auth.AuthMiddleware(chatHandler.GetMessageCountByRoleHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/count-by-role", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/messages/stats", enableCORS(auth.AuthMiddleware(chatHandler.GetMessageStatsHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/stats", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/messages/restore", enableCORS(auth.AuthMiddleware(chatHandler.RestoreConversationMessagesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/restore", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/messages/purge", enableCORS(auth.AuthMiddleware(chatHandler.PurgeConversationMessagesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/purge", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/restore", enableCORS(auth.AuthMiddleware(chatHandler.RestoreConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/restore", corsHandler)
+	mux.HandleFunc("POST /api/conversations/import", enableCORS(auth.AuthMiddleware(chatHandler.ImportConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/import", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/fork", enableCORS(auth.AuthMiddleware(chatHandler.ForkConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/fork", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/export", enableCORS(auth.AuthMiddleware(chatHandler.ExportConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/export", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/export/async", enableCORS(auth.AuthMiddleware(chatHandler.ExportConversationAsyncHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/export/async", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/partial-messages", enableCORS(auth.AuthMiddleware(chatHandler.GetPartialMessagesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/partial-messages", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationHandler)))
 	mux.HandleFunc("DELETE /api/conversations/{id}", enableCORS(auth.AuthMiddleware(chatHandler.DeleteConversationHandler)))
+	mux.HandleFunc("PATCH /api/conversations/{id}", enableCORS(auth.AuthMiddleware(chatHandler.UpdateConversationHandler)))
 	mux.HandleFunc("OPTIONS /api/conversations/{id}", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/star", enableCORS(auth.AuthMiddleware(chatHandler.StarConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/star", corsHandler)
 	mux.HandleFunc("POST /api/conversations/{id}/summarize", enableCORS(auth.AuthMiddleware(chatHandler.SummarizeConversationHandler)))
 	mux.HandleFunc("OPTIONS /api/conversations/{id}/summarize", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/summarize/stream", enableCORS(auth.AuthMiddleware(chatHandler.SummarizeConversationStreamHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summarize/stream", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/cost-projection", enableCORS(auth.AuthMiddleware(chatHandler.GetCostProjectionHandler)))
+	mux.HandleFunc("GET /api/conversations/{id}/cost", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationCostHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/cost", corsHandler)
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/cost-projection", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/timeline", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationTimelineHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/timeline", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/prompt-changes", enableCORS(auth.AuthMiddleware(chatHandler.GetPromptChangesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/prompt-changes", corsHandler)
 	mux.HandleFunc("GET /api/conversations/{id}/summaries", enableCORS(auth.AuthMiddleware(chatHandler.GetConversationSummariesHandler)))
 	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/summaries/merge", enableCORS(auth.AuthMiddleware(chatHandler.MergeSummariesHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries/merge", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/summaries/active", enableCORS(auth.AuthMiddleware(chatHandler.GetActiveSummaryHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries/active", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/summaries/history", enableCORS(auth.AuthMiddleware(chatHandler.GetSummaryHistoryHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries/history", corsHandler)
+	mux.HandleFunc("DELETE /api/conversations/{id}/summaries/{summaryId}", enableCORS(auth.AuthMiddleware(chatHandler.DeleteSummaryHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries/{summaryId}", corsHandler)
+	mux.HandleFunc("GET /api/conversations/{id}/summaries/{summaryId}/diff", enableCORS(auth.AuthMiddleware(chatHandler.GetSummaryDiffHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/summaries/{summaryId}/diff", corsHandler)
+
+	mux.HandleFunc("PATCH /api/conversations/{id}/response-format", enableCORS(auth.AuthMiddleware(chatHandler.UpdateResponseFormatHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/response-format", corsHandler)
+	mux.HandleFunc("POST /api/conversations/{id}/resume", enableCORS(auth.AuthMiddleware(chatHandler.ResumeConversationHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/resume", corsHandler)
+
+	mux.HandleFunc("POST /api/conversations/{id}/title/generate", enableCORS(auth.AuthMiddleware(chatHandler.RegenerateTitleHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/title/generate", corsHandler)
+
+	mux.HandleFunc("POST /api/conversations/{id}/messages/{msgId}/feedback", enableCORS(auth.AuthMiddleware(chatHandler.SubmitFeedbackHandler)))
+	// Serves messages/since/{timestamp}, messages/{msgId}/verify, messages/{msgId}/siblings and messages/{msgId}/raw-prompt (admin only)
+	mux.HandleFunc("GET /api/conversations/{id}/messages/{msgId}/{resource}", enableCORS(auth.AuthMiddleware(chatHandler.GetMessageResourceHandler)))
+	mux.HandleFunc("OPTIONS /api/conversations/{id}/messages/{msgId}/{resource}", corsHandler)
+	mux.HandleFunc("GET /api/messages/search", enableCORS(auth.AuthMiddleware(chatHandler.SearchMessagesHandler)))
+	mux.HandleFunc("OPTIONS /api/messages/search", corsHandler)
+	mux.HandleFunc("GET /api/messages/{id}", enableCORS(auth.AuthMiddleware(chatHandler.GetMessageHandler)))
+	mux.HandleFunc("PATCH /api/messages/{id}", enableCORS(auth.AuthMiddleware(chatHandler.EditMessageHandler)))
+	mux.HandleFunc("OPTIONS /api/messages/{id}", corsHandler)
+	mux.HandleFunc("GET /api/messages/{id}/edits", enableCORS(auth.AuthMiddleware(chatHandler.GetMessageEditsHandler)))
+	mux.HandleFunc("OPTIONS /api/messages/{id}/edits", corsHandler)
+
+	// API keys for programmatic access
+	mux.HandleFunc("POST /api/apikeys", enableCORS(auth.AuthMiddleware(auth.CreateAPIKeyHandler)))
+	mux.HandleFunc("GET /api/apikeys", enableCORS(auth.AuthMiddleware(auth.GetAPIKeysHandler)))
+	mux.HandleFunc("OPTIONS /api/apikeys", corsHandler)
+	mux.HandleFunc("DELETE /api/apikeys/{id}", enableCORS(auth.AuthMiddleware(auth.DeleteAPIKeyHandler)))
+	mux.HandleFunc("OPTIONS /api/apikeys/{id}", corsHandler)
+
+	// Admin routes
+	mux.HandleFunc("GET /api/admin/feedback", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(chatHandler.GetFeedbackHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/feedback", corsHandler)
+	mux.HandleFunc("GET /api/admin/db-pool", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(chatHandler.GetDBPoolHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/db-pool", corsHandler)
+	mux.HandleFunc("GET /api/admin/stream-connections", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(chatHandler.GetStreamConnectionsHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/stream-connections", corsHandler)
+	mux.HandleFunc("GET /api/admin/conversations", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(chatHandler.GetAllConversationsHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/conversations", corsHandler)
+	mux.HandleFunc("POST /api/admin/models/reload", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(chatHandler.ReloadModelsHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/models/reload", corsHandler)
+	mux.HandleFunc("POST /api/admin/users/{id}/impersonate", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(auth.ImpersonateHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/users/{id}/impersonate", corsHandler)
+	mux.HandleFunc("POST /api/admin/impersonation/{sessionId}/end", enableCORS(auth.AuthMiddleware(auth.AdminMiddleware(auth.EndImpersonationHandler))))
+	mux.HandleFunc("OPTIONS /api/admin/impersonation/{sessionId}/end", corsHandler)
+
+	// Prometheus metrics: on a separate internal listener when METRICS_ADDR is set, otherwise for admins only
+	if metricsAddr := config.GetMetricsAddr(); metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", promhttp.Handler())
+		go func() {
+			log.Printf("Metrics endpoint: http://%s/metrics", metricsAddr)
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				log.Fatalf("Metrics server failed to start: %v", err)
+			}
+		}()
+	} else {
+		mux.HandleFunc("GET /metrics", auth.AuthMiddleware(auth.AdminMiddleware(promhttp.Handler().ServeHTTP)))
+	}
 
 	log.Printf("Server starting on port %s", port)
 	log.Printf("Health check: http://localhost:%s/api/health", port)
@@ -112,10 +361,32 @@ func main() {
 	log.Printf("Register endpoint: http://localhost:%s/api/register", port)
 	log.Printf("Chat endpoint: http://localhost:%s/api/chat", port)
 	log.Printf("Chat stream endpoint: http://localhost:%s/api/chat/stream", port)
+	log.Printf("Chat WebSocket endpoint: ws://localhost:%s/api/chat/ws", port)
 	log.Printf("Conversations endpoint: http://localhost:%s/api/conversations", port)
 	log.Printf("Conversation messages endpoint: http://localhost:%s/api/conversations/{id}/messages", port)
 
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: tracing.Middleware(logger.RequestLogger(compress.Middleware(tracing.Route(mux)))),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM stop accepting requests, let running ones finish and flush buffered traces
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, syscall.SIGINT, syscall.SIGTERM)
+	<-stopSignals
+	log.Printf("Shutting down...")
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Warning: server did not shut down cleanly: %v", err)
+	}
+	if err := tracing.Shutdown(ctx); err != nil {
+		log.Printf("Warning: failed to flush traces: %v", err)
 	}
 }
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// APIKeyPrefix marks bearer tokens that are API keys rather than JWTs
+	APIKeyPrefix = "sk-"
+
+	// apiKeyBytes is the amount of randomness in an API key
+	apiKeyBytes = 24
+
+	// maxAPIKeyNameLength caps the length of an API key's name in characters
+	maxAPIKeyNameLength = 100
+)
+
+// apiKeyRateLimiter limits requests per API key, separately from the per-user chat limit
+var apiKeyRateLimiter = sync.OnceValue(func() *RateLimiter {
+	cfg := config.GetRateLimitConfig()
+	return NewRateLimiter(cfg.APIKeyRequestsPerMinute, cfg.APIKeyBurstSize)
+})
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// APIKeyInfo describes an API key without revealing it
+type APIKeyInfo struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	LastUsedAt *string `json:"last_used_at,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+// CreateAPIKeyResponse carries the full key, which is only ever returned on creation
+type CreateAPIKeyResponse struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+type APIKeysResponse struct {
+	APIKeys []APIKeyInfo `json:"api_keys"`
+}
+
+func newAPIKeyInfo(key *db.APIKey) APIKeyInfo {
+	return APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// generateAPIKey returns a new random API key
+func generateAPIKey() (string, error) {
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// authenticateAPIKey serves a request authenticated with an API key, applying the per-key rate limit.
+// The limit is keyed by the key's prefix and applied before the key is checked, so guessing keys
+// cannot be used to spend CPU on bcrypt comparisons.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	reqLog := logger.FromContext(r.Context())
+	prefix := key
+	if len(prefix) > db.APIKeyPrefixLength {
+		prefix = prefix[:db.APIKeyPrefixLength]
+	}
+	if !apiKeyRateLimiter().allow(w, r, prefix, "api key "+prefix) {
+		return
+	}
+
+	apiKey, username, err := db.AuthenticateAPIKey(key)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			reqLog.Printf("[AUTH] Error authenticating api key: %v", err)
+		}
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserContextKey, username)
+	ctx = context.WithValue(ctx, APIKeyContextKey, apiKey.ID)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireSessionAuth rejects requests authenticated with an API key, so a leaked key cannot mint
+// or revoke others, and requests of impersonation sessions, so an admin cannot leave behind a key
+// that outlives the session. It reports whether the request may proceed.
+func requireSessionAuth(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value(APIKeyContextKey).(string); ok {
+		http.Error(w, "API keys cannot manage API keys", http.StatusForbidden)
+		return false
+	}
+	if _, ok := r.Context().Value(ImpersonatorContextKey).(string); ok {
+		http.Error(w, "Impersonation sessions cannot manage API keys", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// CreateAPIKeyHandler creates a named API key for the current user and returns it once.
+// It must be wrapped by AuthMiddleware.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	if !requireSessionAuth(w, r) {
+		return
+	}
+	username := r.Context().Value(UserContextKey).(string)
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Name) > maxAPIKeyNameLength {
+		http.Error(w, "Name is too long", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		reqLog.Printf("[AUTH] Error generating api key: %v", err)
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey, err := db.CreateAPIKey(user.ID, req.Name, key)
+	if err != nil {
+		reqLog.Printf("[AUTH] Error storing api key: %v", err)
+		http.Error(w, "Error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[AUTH] User %s created api key %s (%s)", username, apiKey.ID, apiKey.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{
+		APIKeyInfo: newAPIKeyInfo(apiKey),
+		Key:        key,
+	})
+}
+
+// GetAPIKeysHandler lists the current user's API keys by prefix. It must be wrapped by AuthMiddleware.
+func GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	if !requireSessionAuth(w, r) {
+		return
+	}
+	username := r.Context().Value(UserContextKey).(string)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	keys, err := db.GetAPIKeysByUser(user.ID)
+	if err != nil {
+		reqLog.Printf("[AUTH] Error listing api keys: %v", err)
+		http.Error(w, "Error listing API keys", http.StatusInternalServerError)
+		return
+	}
+
+	infos := make([]APIKeyInfo, 0, len(keys))
+	for i := range keys {
+		infos = append(infos, newAPIKeyInfo(&keys[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIKeysResponse{APIKeys: infos})
+}
+
+// DeleteAPIKeyHandler revokes one of the current user's API keys. It must be wrapped by AuthMiddleware.
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	if !requireSessionAuth(w, r) {
+		return
+	}
+	username := r.Context().Value(UserContextKey).(string)
+	keyID := r.PathValue("id")
+
+	if _, err := uuid.Parse(keyID); err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = db.DeleteAPIKey(user.ID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[AUTH] Error deleting api key: %v", err)
+		http.Error(w, "Error deleting API key", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[AUTH] User %s revoked api key %s", username, keyID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRequireSessionAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctxValues map[contextKey]string
+		want      bool
+	}{
+		{name: "session", ctxValues: map[contextKey]string{UserContextKey: "alice"}, want: true},
+		{name: "api key", ctxValues: map[contextKey]string{UserContextKey: "alice", APIKeyContextKey: "key-id"}},
+		{name: "impersonation session", ctxValues: map[contextKey]string{UserContextKey: "alice", ImpersonatorContextKey: "admin-id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			for key, value := range tt.ctxValues {
+				ctx = context.WithValue(ctx, key, value)
+			}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/keys", nil).WithContext(ctx)
+
+			if got := requireSessionAuth(w, r); got != tt.want {
+				t.Fatalf("requireSessionAuth = %v, want %v", got, tt.want)
+			}
+			if !tt.want && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestImpersonationSessionCannotCreateAPIKeys(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+
+	claims := Claims{
+		Username:       "alice",
+		ImpersonatedBy: "admin-id",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "session-id",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	mock.ExpectQuery(`FROM impersonation_sessions`).
+		WithArgs("session-id", hashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name":"ci"}`))
+	r.Header.Set("Authorization", "Bearer "+token)
+	AuthMiddleware(CreateAPIKeyHandler)(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+	}
+}
+
+func TestAPIKeyRateLimitAppliesBeforeLookup(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	burst := config.GetRateLimitConfig().APIKeyBurstSize
+	key := APIKeyPrefix + "ratelimit" + strings.Repeat("0", 40)
+	prefix := key[:db.APIKeyPrefixLength]
+
+	// Every request within the burst looks the key up; unknown keys are rejected
+	for i := 0; i < burst; i++ {
+		mock.ExpectQuery(`FROM api_keys`).WithArgs(prefix).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+
+	handler := AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("request with an unknown api key was served")
+	})
+	for i := 0; i <= burst; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/conversations", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+		handler(w, r)
+
+		want := http.StatusUnauthorized
+		if i == burst {
+			want = http.StatusTooManyRequests
+		}
+		if w.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package auth
 
 import (
+	"chat-app/internal/config"
 	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -16,10 +18,17 @@ type contextKey string
 
 const UserContextKey contextKey = "user"
 
+// APIKeyContextKey holds the ID of the API key a request was authenticated with, if any
+const APIKeyContextKey contextKey = "api_key"
+
+// ImpersonatorContextKey holds the ID of the admin acting as the user of an impersonation session, if any
+const ImpersonatorContextKey contextKey = "impersonated_by"
+
 var jwtSecret = []byte("your-secret-key-change-in-production")
 
 type Claims struct {
-	Username string `json:"username"`
+	Username       string `json:"username"`
+	ImpersonatedBy string `json:"impersonated_by,omitempty"` // Admin user ID for impersonation tokens
 	jwt.RegisteredClaims
 }
 
@@ -29,7 +38,9 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
 }
 
 type RegisterRequest struct {
@@ -40,14 +51,14 @@ type RegisterRequest struct {
 
 type RegisterResponse struct {
 	Message string `json:"message"`
-	Token   string `json:"token"`
+	LoginResponse
 }
 
 func GenerateToken(username string) (string, error) {
 	claims := Claims{
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.GetAuthConfig().AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -74,6 +85,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 // LoginHandler authenticates user and returns JWT token
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -93,34 +105,35 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user from database
 	user, err := db.GetUserByUsername(req.Username)
 	if err != nil {
-		log.Printf("[AUTH] Login failed for user %s: user not found", req.Username)
+		reqLog.Printf("[AUTH] Login failed for user %s: user not found", req.Username)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	// Verify password
 	if !user.VerifyPassword(req.Password) {
-		log.Printf("[AUTH] Login failed for user %s: invalid password", req.Username)
+		reqLog.Printf("[AUTH] Login failed for user %s: invalid password", req.Username)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT token
-	token, err := GenerateToken(req.Username)
+	// Generate access and refresh tokens
+	tokens, err := issueTokens(user)
 	if err != nil {
-		log.Printf("[AUTH] Error generating token: %v", err)
+		reqLog.Printf("[AUTH] Error generating token: %v", err)
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[AUTH] User %s logged in successfully", req.Username)
+	reqLog.Printf("[AUTH] User %s logged in successfully", req.Username)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(LoginResponse{Token: token})
+	json.NewEncoder(w).Encode(tokens)
 }
 
 // RegisterHandler creates a new user account
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -132,20 +145,25 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Username == "" || req.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+	if err := validation.ValidateUsername(req.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Password) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
+	if err := validation.ValidateEmail(req.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Create user in database
 	user, err := db.CreateUser(req.Username, req.Email, req.Password)
 	if err != nil {
-		log.Printf("[AUTH] Registration failed for user %s: %v", req.Username, err)
+		reqLog.Printf("[AUTH] Registration failed for user %s: %v", req.Username, err)
 		if err.Error() == "username already exists" {
 			http.Error(w, "Username already exists", http.StatusConflict)
 			return
@@ -154,26 +172,27 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := GenerateToken(user.Username)
+	// Generate access and refresh tokens
+	tokens, err := issueTokens(user)
 	if err != nil {
-		log.Printf("[AUTH] Error generating token: %v", err)
+		reqLog.Printf("[AUTH] Error generating token: %v", err)
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[AUTH] User %s registered successfully", user.Username)
+	reqLog.Printf("[AUTH] User %s registered successfully", user.Username)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(RegisterResponse{
-		Message: "User registered successfully",
-		Token:   token,
+		Message:       "User registered successfully",
+		LoginResponse: *tokens,
 	})
 }
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		reqLog := logger.FromContext(r.Context())
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
@@ -186,13 +205,89 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// API keys are opaque tokens, anything else must be a JWT
+		if strings.HasPrefix(bearerToken[1], APIKeyPrefix) {
+			authenticateAPIKey(w, r, bearerToken[1], next)
+			return
+		}
+
 		claims, err := ValidateToken(bearerToken[1])
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
 
+		// Impersonation tokens are only valid while their session has not been ended
+		if claims.ImpersonatedBy != "" {
+			active, err := db.IsImpersonationSessionActive(claims.ID, hashToken(bearerToken[1]))
+			if err != nil || !active {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			reqLog.Printf("[AUDIT] Impersonation session %s: admin %s as user %s: %s %s",
+				claims.ID, claims.ImpersonatedBy, claims.Username, r.Method, r.URL.Path)
+		}
+
 		ctx := context.WithValue(r.Context(), UserContextKey, claims.Username)
+		if claims.ImpersonatedBy != "" {
+			ctx = context.WithValue(ctx, ImpersonatorContextKey, claims.ImpersonatedBy)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// WebSocketProtocol is the WebSocket subprotocol a browser offers together with its token, as in
+// new WebSocket(url, ["bearer", token]), since browsers cannot set an Authorization header on the handshake
+const WebSocketProtocol = "bearer"
+
+// WebSocketAuthMiddleware authenticates a WebSocket handshake like AuthMiddleware. Without an
+// Authorization header the token is taken from the subprotocol offered after WebSocketProtocol.
+func WebSocketAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	authenticated := AuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if token := webSocketProtocolToken(r); token != "" {
+				r = r.Clone(r.Context())
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		authenticated(w, r)
+	}
+}
+
+// webSocketProtocolToken returns the token offered in the Sec-WebSocket-Protocol header, if any
+func webSocketProtocolToken(r *http.Request) string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == WebSocketProtocol {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// AdminMiddleware restricts a route to admin users. It must be wrapped by AuthMiddleware.
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqLog := logger.FromContext(r.Context())
+		username, ok := r.Context().Value(UserContextKey).(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := db.GetUserByUsername(username)
+		if err != nil || !user.IsAdmin {
+			reqLog.Printf("[AUTH] Admin access denied for user %s", username)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"chat-app/internal/testutil"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "invalid body", body: `{"username":`, wantStatus: http.StatusBadRequest},
+		{name: "short username", body: `{"username":"al","email":"alice@example.com","password":"secret123"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid username", body: `{"username":"alice smith","email":"alice@example.com","password":"secret123"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing email", body: `{"username":"alice","password":"secret123"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid email", body: `{"username":"alice","email":"alice@example","password":"secret123"}`, wantStatus: http.StatusBadRequest},
+		{name: "short password", body: `{"username":"alice","email":"alice@example.com","password":"secret1"}`, wantStatus: http.StatusBadRequest},
+		{name: "password without digits", body: `{"username":"alice","email":"alice@example.com","password":"secretpassword"}`, wantStatus: http.StatusBadRequest},
+		// A valid registration reaches the database, which fails here
+		{name: "valid", body: `{"username":"alice","email":"alice@example.com","password":"secret123"}`, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.wantStatus != http.StatusBadRequest {
+				mock.ExpectQuery(`INSERT INTO users \(id, username, email, password_hash\)`).
+					WillReturnError(errors.New("connection refused"))
+			}
+
+			w := httptest.NewRecorder()
+			RegisterHandler(w, httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
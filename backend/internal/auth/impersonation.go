@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// impersonationTTL is the lifetime of a token issued for acting as another user
+const impersonationTTL = 5 * time.Minute
+
+type ImpersonationResponse struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// hashToken returns the hex-encoded SHA-256 of a token; only the hash is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ImpersonateHandler issues a short-lived token that lets an admin act as another user.
+// It must be wrapped by AuthMiddleware and AdminMiddleware.
+func ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(UserContextKey).(string)
+	targetID := r.PathValue("id")
+
+	admin, err := db.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	target, err := db.GetUserByID(targetID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Impersonating admins would allow escalating through their sessions
+	if target.IsAdmin {
+		reqLog.Printf("[AUDIT] Admin %s denied impersonation of admin %s", admin.Username, target.Username)
+		http.Error(w, "Cannot impersonate an admin user", http.StatusForbidden)
+		return
+	}
+
+	sessionID := uuid.New().String()
+	expiresAt := time.Now().Add(impersonationTTL)
+	claims := Claims{
+		Username:       target.Username,
+		ImpersonatedBy: admin.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			Subject:   target.ID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		reqLog.Printf("[AUTH] Error generating impersonation token: %v", err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.CreateImpersonationSession(sessionID, admin.ID, target.ID, hashToken(token), expiresAt); err != nil {
+		reqLog.Printf("[AUTH] Error storing impersonation session: %v", err)
+		http.Error(w, "Error creating impersonation session", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[AUDIT] Admin %s started impersonation session %s as user %s (expires %s)",
+		admin.Username, sessionID, target.Username, expiresAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ImpersonationResponse{
+		Token:     token,
+		SessionID: sessionID,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
+
+// EndImpersonationHandler revokes an impersonation session before its token expires.
+// It must be wrapped by AuthMiddleware and AdminMiddleware.
+func EndImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(UserContextKey).(string)
+	sessionID := r.PathValue("sessionId")
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		http.Error(w, "Impersonation session not found", http.StatusNotFound)
+		return
+	}
+
+	err := db.EndImpersonationSession(sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Impersonation session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[AUTH] Error ending impersonation session: %v", err)
+		http.Error(w, "Error ending impersonation session", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[AUDIT] Admin %s ended impersonation session %s", username, sessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
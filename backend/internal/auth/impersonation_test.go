@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"bytes"
+	"chat-app/internal/testutil"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	adminID  = "11111111-1111-1111-1111-111111111111"
+	targetID = "22222222-2222-2222-2222-222222222222"
+)
+
+// captureLog redirects the standard logger, which request logs fall back to, for the duration of a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	return &logs
+}
+
+// adminRequest builds a request as AuthMiddleware and AdminMiddleware leave it for the admin "root"
+func adminRequest(method, target string, pathValues map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	for name, value := range pathValues {
+		r.SetPathValue(name, value)
+	}
+	return r.WithContext(context.WithValue(r.Context(), UserContextKey, "root"))
+}
+
+// expectUserByID expects a user lookup by ID returning the user "alice"
+func expectUserByID(mock sqlmock.Sqlmock, isAdmin bool) {
+	mock.ExpectQuery(`FROM users WHERE id = \$1`).
+		WithArgs(targetID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "is_admin", "webhook_url", "created_at"}).
+			AddRow(targetID, "alice", "alice@example.com", "hash", isAdmin, "", time.Now()))
+}
+
+// tokenHashArg matches the stored hash of the token the handler returns, once the response is known
+type tokenHashArg struct{ hash *string }
+
+func (a tokenHashArg) Match(v driver.Value) bool {
+	*a.hash, _ = v.(string)
+	return *a.hash != ""
+}
+
+// expiryArg matches an expiry time within a second of want
+type expiryArg struct{ want time.Time }
+
+func (a expiryArg) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	return ok && got.Sub(a.want).Abs() < time.Second
+}
+
+func TestImpersonateHandler(t *testing.T) {
+	path := "/api/admin/users/" + targetID + "/impersonate"
+	pathValues := map[string]string{"id": targetID}
+
+	t.Run("unknown user", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+		mock.ExpectQuery(`FROM users WHERE id = \$1`).WithArgs(targetID).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		w := httptest.NewRecorder()
+		ImpersonateHandler(w, adminRequest(http.MethodPost, path, pathValues))
+
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusNotFound, w.Body.String())
+		}
+	})
+
+	t.Run("admin target", func(t *testing.T) {
+		logs := captureLog(t)
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+		expectUserByID(mock, true)
+
+		w := httptest.NewRecorder()
+		ImpersonateHandler(w, adminRequest(http.MethodPost, path, pathValues))
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+		if !strings.Contains(logs.String(), "[AUDIT] Admin root denied impersonation of admin alice") {
+			t.Errorf("log = %q, want the denied attempt audited", logs.String())
+		}
+	})
+
+	t.Run("token issued", func(t *testing.T) {
+		logs := captureLog(t)
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+		expectUserByID(mock, false)
+		sessionID := &testutil.SameArg{}
+		var storedHash string
+		mock.ExpectExec(`INSERT INTO impersonation_sessions \(id, admin_id, target_user_id, token_hash, expires_at\)`).
+			WithArgs(sessionID, adminID, targetID, tokenHashArg{&storedHash}, expiryArg{time.Now().Add(5 * time.Minute)}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		w := httptest.NewRecorder()
+		ImpersonateHandler(w, adminRequest(http.MethodPost, path, pathValues))
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusCreated, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("unmet expectations: %v", err)
+		}
+		var resp ImpersonationResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+
+		claims, err := ValidateToken(resp.Token)
+		if err != nil {
+			t.Fatalf("issued token is invalid: %v", err)
+		}
+		if claims.Subject != targetID || claims.Username != "alice" || claims.ImpersonatedBy != adminID {
+			t.Errorf("claims = %+v, want sub %s impersonated by %s", claims, targetID, adminID)
+		}
+		// sessionID only matches the ID it was first matched with, the one stored with the session
+		if claims.ID != resp.SessionID || !sessionID.Match(resp.SessionID) {
+			t.Errorf("token ID = %s, session ID = %s, want both to be the stored session ID", claims.ID, resp.SessionID)
+		}
+		if ttl := time.Until(claims.ExpiresAt.Time); ttl > 5*time.Minute || ttl < 4*time.Minute {
+			t.Errorf("token expires in %s, want 5m", ttl)
+		}
+		if storedHash != hashToken(resp.Token) || strings.Contains(storedHash, resp.Token) {
+			t.Errorf("stored hash = %q, want the SHA-256 of the token", storedHash)
+		}
+		if !strings.Contains(logs.String(), "[AUDIT] Admin root started impersonation session "+resp.SessionID+" as user alice") {
+			t.Errorf("log = %q, want the session start audited", logs.String())
+		}
+	})
+}
+
+func TestAuthMiddlewareImpersonationToken(t *testing.T) {
+	sign := func(t *testing.T, expiresIn time.Duration) string {
+		t.Helper()
+		claims := Claims{
+			Username:       "alice",
+			ImpersonatedBy: adminID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "33333333-3333-3333-3333-333333333333",
+				Subject:   targetID,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+		if err != nil {
+			t.Fatalf("error signing token: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name       string
+		expiresIn  time.Duration
+		lookup     bool // whether the session is looked up
+		active     bool
+		wantStatus int
+	}{
+		{name: "active session", expiresIn: time.Minute, lookup: true, active: true, wantStatus: http.StatusOK},
+		{name: "ended or expired session", expiresIn: time.Minute, lookup: true, wantStatus: http.StatusUnauthorized},
+		{name: "expired token", expiresIn: -time.Minute, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			mock := testutil.NewMockDB(t)
+			token := sign(t, tt.expiresIn)
+			if tt.lookup {
+				mock.ExpectQuery(`SELECT 1 FROM impersonation_sessions\s+WHERE id = \$1 AND token_hash = \$2 AND ended_at IS NULL AND expires_at > CURRENT_TIMESTAMP`).
+					WithArgs("33333333-3333-3333-3333-333333333333", hashToken(token)).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.active))
+			}
+
+			var username, impersonator any
+			handler := AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				username = r.Context().Value(UserContextKey)
+				impersonator = r.Context().Value(ImpersonatorContextKey)
+			})
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/conversations", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if username != nil {
+					t.Errorf("request served as %v with a rejected token", username)
+				}
+				return
+			}
+
+			if username != "alice" || impersonator != adminID {
+				t.Errorf("served as %v impersonated by %v, want alice impersonated by %s", username, impersonator, adminID)
+			}
+			if want := "[AUDIT] Impersonation session 33333333-3333-3333-3333-333333333333: admin " + adminID + " as user alice: GET /api/conversations"; !strings.Contains(logs.String(), want) {
+				t.Errorf("log = %q, want the request audited", logs.String())
+			}
+		})
+	}
+}
+
+func TestEndImpersonationHandler(t *testing.T) {
+	const sessionID = "33333333-3333-3333-3333-333333333333"
+	const query = `UPDATE impersonation_sessions SET ended_at = CURRENT_TIMESTAMP WHERE id = \$1 AND ended_at IS NULL`
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		ended      int64 // rows updated, -1 when the session is not looked up
+		wantStatus int
+	}{
+		{name: "invalid session ID", sessionID: "not-a-uuid", ended: -1, wantStatus: http.StatusNotFound},
+		{name: "unknown or already ended", sessionID: sessionID, ended: 0, wantStatus: http.StatusNotFound},
+		{name: "ended", sessionID: sessionID, ended: 1, wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			mock := testutil.NewMockDB(t)
+			if tt.ended >= 0 {
+				mock.ExpectExec(query).WithArgs(tt.sessionID).WillReturnResult(sqlmock.NewResult(0, tt.ended))
+			}
+
+			w := httptest.NewRecorder()
+			r := adminRequest(http.MethodPost, "/api/admin/impersonation/"+tt.sessionID+"/end", map[string]string{"sessionId": tt.sessionID})
+			EndImpersonationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			audited := strings.Contains(logs.String(), "[AUDIT] Admin root ended impersonation session "+sessionID)
+			if audited != (tt.wantStatus == http.StatusNoContent) {
+				t.Errorf("log = %q, want the end audited only when the session was ended", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"chat-app/internal/logger"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimiterCleanupInterval is how often idle user buckets are dropped
+	rateLimiterCleanupInterval = time.Minute
+
+	// rateLimiterIdleTimeout is how long a user's bucket is kept without requests; by then it has refilled
+	rateLimiterIdleTimeout = 10 * time.Minute
+)
+
+// userBucket is a user's token bucket and the time of their last request
+type userBucket struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64 // Unix nanoseconds
+}
+
+// RateLimiter limits how often each user may call the wrapped handlers using a token bucket per user
+type RateLimiter struct {
+	limit   rate.Limit
+	burst   int
+	buckets sync.Map // username or API key ID -> *userBucket
+}
+
+// NewRateLimiter creates a limiter allowing requestsPerMinute requests per user with bursts of burstSize.
+// A requestsPerMinute of 0 or less disables rate limiting.
+func NewRateLimiter(requestsPerMinute, burstSize int) *RateLimiter {
+	rl := &RateLimiter{
+		limit: rate.Limit(float64(requestsPerMinute) / 60),
+		burst: max(burstSize, 1),
+	}
+	if requestsPerMinute > 0 {
+		go rl.cleanup()
+	}
+	return rl
+}
+
+// Middleware rejects requests beyond the user's rate with 429 and a Retry-After header.
+// It must be wrapped by AuthMiddleware.
+func (rl *RateLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	if rl.limit <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := r.Context().Value(UserContextKey).(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !rl.allow(w, r, username, "user "+username) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// allow takes a token from the bucket of key, or writes a 429 response naming subject in the log
+func (rl *RateLimiter) allow(w http.ResponseWriter, r *http.Request, key, subject string) bool {
+	reqLog := logger.FromContext(r.Context())
+	if rl.limit <= 0 {
+		return true
+	}
+
+	reservation := rl.bucket(key).Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		reqLog.Printf("[AUTH] Rate limit exceeded for %s on %s %s", subject, r.Method, r.URL.Path)
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(delay.Seconds()))))
+		http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// bucket returns the token bucket of a user or API key, creating a full one on first use
+func (rl *RateLimiter) bucket(key string) *rate.Limiter {
+	value, ok := rl.buckets.Load(key)
+	if !ok {
+		value, _ = rl.buckets.LoadOrStore(key, &userBucket{limiter: rate.NewLimiter(rl.limit, rl.burst)})
+	}
+	b := value.(*userBucket)
+	b.lastSeen.Store(time.Now().UnixNano())
+	return b.limiter
+}
+
+// cleanup periodically drops the buckets of users who have been idle long enough for them to refill
+func (rl *RateLimiter) cleanup() {
+	ticker := time.NewTicker(rateLimiterCleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cutoff := time.Now().Add(-rateLimiterIdleTimeout).UnixNano()
+		rl.buckets.Range(func(key, value any) bool {
+			if value.(*userBucket).lastSeen.Load() < cutoff {
+				rl.buckets.Delete(key)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// refreshTokenBytes is the amount of randomness in a refresh token
+const refreshTokenBytes = 32
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// generateRefreshToken returns a new random, hex-encoded refresh token
+func generateRefreshToken() (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// issueTokens creates an access token and a stored refresh token for a user
+func issueTokens(user *db.User) (*LoginResponse, error) {
+	cfg := config.GetAuthConfig()
+
+	token, err := GenerateToken(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CreateRefreshToken(user.ID, hashToken(refreshToken), time.Now().Add(cfg.RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new access token. The refresh token is rotated:
+// the presented token is revoked and a new one is returned with the access token.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	cfg := config.GetAuthConfig()
+
+	newRefreshToken, err := generateRefreshToken()
+	if err != nil {
+		reqLog.Printf("[AUTH] Error generating refresh token: %v", err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := db.RotateRefreshToken(hashToken(req.RefreshToken), hashToken(newRefreshToken), time.Now().Add(cfg.RefreshTokenTTL))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			reqLog.Printf("[AUTH] Refresh rejected: unknown, expired or revoked token")
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		reqLog.Printf("[AUTH] Error rotating refresh token: %v", err)
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		reqLog.Printf("[AUTH] Refresh failed: user %s not found: %v", userID, err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := GenerateToken(user.Username)
+	if err != nil {
+		reqLog.Printf("[AUTH] Error generating token: %v", err)
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[AUTH] Refreshed tokens for user %s", user.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{
+		Token:        token,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int(cfg.AccessTokenTTL.Seconds()),
+	})
+}
+
+// LogoutHandler revokes a refresh token so it can no longer be used. Access tokens already
+// issued stay valid until they expire.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.RevokeRefreshToken(hashToken(req.RefreshToken)); err != nil {
+		reqLog.Printf("[AUTH] Error revoking refresh token: %v", err)
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
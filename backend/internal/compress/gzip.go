@@ -0,0 +1,142 @@
+package compress
+
+import (
+	"chat-app/internal/config"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Middleware gzips responses for clients that accept it, using the configured compression level.
+// Server-sent event streams, WebSocket upgrades, partial content and responses that are already
+// encoded are passed through unchanged.
+func Middleware(next http.Handler) http.Handler {
+	level := config.GetGzipLevel()
+	if level == 0 {
+		log.Printf("[HTTP] Response compression disabled")
+		return next
+	}
+
+	writers := &sync.Pool{New: func() any {
+		// The level was validated by config, so NewWriterLevel cannot fail
+		gz, _ := gzip.NewWriterLevel(nil, level)
+		return gz
+	}}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, writers: writers, head: r.Method == http.MethodHead}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding lists gzip without disabling it with q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter decides whether to compress when the response header is written, since
+// only then are the handler's Content-Type and status known
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	writers     *sync.Pool
+	gz          *gzip.Writer // nil while undecided or when passing through
+	head        bool
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		g.ResponseWriter.WriteHeader(status)
+		return
+	}
+	g.wroteHeader = true
+
+	if g.shouldCompress(status) {
+		h := g.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gz := g.writers.Get().(*gzip.Writer)
+		gz.Reset(g.ResponseWriter)
+		g.gz = gz
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+// shouldCompress reports whether a response with the given status and the current headers has a body worth compressing
+func (g *gzipResponseWriter) shouldCompress(status int) bool {
+	if g.head || status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+	h := g.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	return !strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		// Sniff the content type as net/http would, so it describes the uncompressed body
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// Flush sends the data compressed so far, so streamed responses are not held back
+func (g *gzipResponseWriter) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz != nil {
+		if err := g.gz.Flush(); err != nil {
+			return
+		}
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close writes the gzip footer and returns the writer to the pool
+func (g *gzipResponseWriter) close() {
+	if g.gz == nil {
+		return
+	}
+	if err := g.gz.Close(); err != nil {
+		log.Printf("[HTTP] Warning: failed to finish gzip response: %v", err)
+	}
+	g.gz.Reset(nil)
+	g.writers.Put(g.gz)
+	g.gz = nil
+}
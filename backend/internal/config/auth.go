@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// AuthConfig holds the lifetimes of the tokens issued on login
+type AuthConfig struct {
+	AccessTokenTTL  time.Duration // Lifetime of the JWT sent with every request
+	RefreshTokenTTL time.Duration // Lifetime of the token exchanged for a new access token
+}
+
+// GetAuthConfig returns the token lifetimes from environment variables
+func GetAuthConfig() AuthConfig {
+	return AuthConfig{
+		AccessTokenTTL:  time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL: time.Duration(getEnvInt("REFRESH_TOKEN_TTL_HOURS", 7*24)) * time.Hour,
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// CacheConfig holds the in-process query cache settings
+type CacheConfig struct {
+	Enabled          bool
+	ConversationTTL  time.Duration
+	UserTTL          time.Duration
+	ActiveSummaryTTL time.Duration
+}
+
+// GetCacheConfig returns the query cache configuration from environment variables.
+// The cache is in-process, so it should be disabled when running several server instances.
+func GetCacheConfig() CacheConfig {
+	return CacheConfig{
+		Enabled:          os.Getenv("QUERY_CACHE_ENABLED") != "false",
+		ConversationTTL:  time.Duration(getEnvInt("CACHE_CONVERSATION_TTL_SECONDS", 60)) * time.Second,
+		UserTTL:          time.Duration(getEnvInt("CACHE_USER_TTL_SECONDS", 300)) * time.Second,
+		ActiveSummaryTTL: time.Duration(getEnvInt("CACHE_ACTIVE_SUMMARY_TTL_SECONDS", 30)) * time.Second,
+	}
+}
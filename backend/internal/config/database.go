@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+)
+
+// DatabaseConfig holds the PostgreSQL connection settings
+type DatabaseConfig struct {
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	DBName          string
+	SSLMode         string
+	SSLCertPath     string
+	SSLKeyPath      string
+	SSLRootCertPath string
+}
+
+// validSSLModes lists the supported DB_SSLMODE values
+var validSSLModes = map[string]bool{
+	"disable":     true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// GetDatabaseConfig reads the database connection settings from the environment
+func GetDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		Host:            getEnvString("DB_HOST", "localhost"),
+		Port:            getEnvString("DB_PORT", "5432"),
+		User:            getEnvString("DB_USER", "postgres"),
+		Password:        getEnvString("DB_PASSWORD", "postgres"),
+		DBName:          getEnvString("DB_NAME", "chatapp"),
+		SSLMode:         getEnvString("DB_SSLMODE", "disable"),
+		SSLCertPath:     os.Getenv("DB_SSLCERT"),
+		SSLKeyPath:      os.Getenv("DB_SSLKEY"),
+		SSLRootCertPath: os.Getenv("DB_SSLROOTCERT"),
+	}
+}
+
+// Validate checks the SSL mode and, for the verifying modes, that the certificate files exist
+func (c DatabaseConfig) Validate() error {
+	if !validSSLModes[c.SSLMode] {
+		return fmt.Errorf("invalid DB_SSLMODE %q: must be one of disable, require, verify-ca, verify-full", c.SSLMode)
+	}
+
+	if c.SSLMode != "verify-ca" && c.SSLMode != "verify-full" {
+		return nil
+	}
+
+	certPaths := []struct {
+		env  string
+		path string
+	}{
+		{"DB_SSLCERT", c.SSLCertPath},
+		{"DB_SSLKEY", c.SSLKeyPath},
+		{"DB_SSLROOTCERT", c.SSLRootCertPath},
+	}
+	for _, cert := range certPaths {
+		if cert.path == "" {
+			return fmt.Errorf("%s is required when DB_SSLMODE is %s", cert.env, c.SSLMode)
+		}
+		if _, err := os.Stat(cert.path); err != nil {
+			return fmt.Errorf("%s file %q is not accessible: %w", cert.env, cert.path, err)
+		}
+	}
+
+	return nil
+}
+
+// BuildDSN constructs a postgres:// connection URL; user credentials are URL-encoded
+func (c DatabaseConfig) BuildDSN() string {
+	query := url.Values{}
+	query.Set("sslmode", c.SSLMode)
+	if c.SSLCertPath != "" {
+		query.Set("sslcert", c.SSLCertPath)
+	}
+	if c.SSLKeyPath != "" {
+		query.Set("sslkey", c.SSLKeyPath)
+	}
+	if c.SSLRootCertPath != "" {
+		query.Set("sslrootcert", c.SSLRootCertPath)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, c.Port),
+		Path:     "/" + c.DBName,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+// GetDBMaxOpenConns returns the maximum number of open database connections (DB_MAX_OPEN_CONNS, default 25)
+func GetDBMaxOpenConns() int {
+	return getEnvInt("DB_MAX_OPEN_CONNS", 25)
+}
+
+// GetDBMaxIdleConns returns the maximum number of idle database connections (DB_MAX_IDLE_CONNS, default 10)
+func GetDBMaxIdleConns() int {
+	return getEnvInt("DB_MAX_IDLE_CONNS", 10)
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// GetExportDir returns the directory where asynchronous conversation exports are written (EXPORT_DIR, default "exports")
+func GetExportDir() string {
+	return getEnvString("EXPORT_DIR", "exports")
+}
+
+// GetExportRetention returns how long finished export jobs and their files are kept before they are
+// deleted (EXPORT_RETENTION_HOURS, default 24, 0 keeps them forever)
+func GetExportRetention() time.Duration {
+	return time.Duration(getEnvInt("EXPORT_RETENTION_HOURS", 24)) * time.Hour
+}
+
+// GetPublicBaseURL returns the externally reachable base URL of the API used to build links sent to
+// users, e.g. export download URLs (PUBLIC_BASE_URL, default empty which yields relative links)
+func GetPublicBaseURL() string {
+	return strings.TrimSuffix(getEnvString("PUBLIC_BASE_URL", ""), "/")
+}
+
+// GetMaxImportMessages returns the most messages a conversation import may contain (MAX_IMPORT_MESSAGES, default 1000)
+func GetMaxImportMessages() int {
+	return getEnvInt("MAX_IMPORT_MESSAGES", 1000)
+}
+
+// GetMaxImportSize returns the largest conversation import accepted in bytes (MAX_IMPORT_SIZE_BYTES, default 10 MB)
+func GetMaxImportSize() int64 {
+	return int64(getEnvInt("MAX_IMPORT_SIZE_BYTES", 10<<20))
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// GetProviderOrder returns the ordered provider fallback chain used when a request
+// doesn't select a provider (LLM_PROVIDER_ORDER, comma-separated, e.g. "openrouter,genkit")
+func GetProviderOrder() []string {
+	var order []string
+	for _, name := range strings.Split(os.Getenv("LLM_PROVIDER_ORDER"), ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			order = append(order, name)
+		}
+	}
+	return order
+}
+
+// GetSummarizationModel returns the model used for summarization when the request doesn't specify one
+// (SUMMARIZATION_MODEL). "auto" selects the cheapest available model; empty uses the provider default.
+func GetSummarizationModel() string {
+	return strings.TrimSpace(os.Getenv("SUMMARIZATION_MODEL"))
+}
+
+// GetStoreRawPrompts reports whether the full prompt sent to the LLM is stored with each
+// assistant message for debugging (STORE_RAW_PROMPTS, default false)
+func GetStoreRawPrompts() bool {
+	return os.Getenv("STORE_RAW_PROMPTS") == "true"
+}
+
+// GetUpdateTitleOnSummarize reports whether a conversation's title is regenerated from
+// each new summary (UPDATE_TITLE_ON_SUMMARIZE, default false)
+func GetUpdateTitleOnSummarize() bool {
+	return os.Getenv("UPDATE_TITLE_ON_SUMMARIZE") == "true"
+}
+
+// GetSummaryUsageThreshold returns how many times an active summary is used before summarizing
+// again renews it instead of returning it unchanged (SUMMARY_USAGE_THRESHOLD, default 2, minimum 1)
+func GetSummaryUsageThreshold() int {
+	return max(getEnvInt("SUMMARY_USAGE_THRESHOLD", 2), 1)
+}
+
+// GetAutoSummarizeThreshold returns how many messages a conversation must exceed before a summary
+// is created in the background after each response (AUTO_SUMMARIZE_THRESHOLD, default 20, 0 disables)
+func GetAutoSummarizeThreshold() int {
+	return getEnvInt("AUTO_SUMMARIZE_THRESHOLD", 20)
+}
+
+// GetResumeAfterHours returns how long a conversation must be idle before resuming it
+// produces a context-refresher message (RESUME_AFTER_HOURS, default 24)
+func GetResumeAfterHours() int {
+	return getEnvInt("RESUME_AFTER_HOURS", 24)
+}
+
+// GetMaxSummaryLength returns the maximum length of a generated summary in characters
+// (MAX_SUMMARY_LENGTH, default 2000, 0 disables the limit)
+func GetMaxSummaryLength() int {
+	return getEnvInt("MAX_SUMMARY_LENGTH", 2000)
+}
+
+// GetMaxSystemPromptLengthBytes returns the maximum size of a user-supplied system prompt in bytes
+// (MAX_SYSTEM_PROMPT_LENGTH_BYTES, default 16384, 0 disables the limit)
+func GetMaxSystemPromptLengthBytes() int {
+	return getEnvInt("MAX_SYSTEM_PROMPT_LENGTH_BYTES", 16384)
+}
+
+// GetAutoTranslateTitles reports whether generated conversation titles are translated to the
+// language requested by the client's Accept-Language header (AUTO_TRANSLATE_TITLES, default false)
+func GetAutoTranslateTitles() bool {
+	return os.Getenv("AUTO_TRANSLATE_TITLES") == "true"
+}
+
+// GetLLMRequestTimeout returns the timeout of non-streaming LLM API requests
+// (LLM_REQUEST_TIMEOUT_SECONDS, default 60, 0 disables the timeout)
+func GetLLMRequestTimeout() time.Duration {
+	return time.Duration(getEnvInt("LLM_REQUEST_TIMEOUT_SECONDS", 60)) * time.Second
+}
+
+// GetLLMStreamTimeout returns the timeout of streaming LLM API requests, including reading the whole
+// stream (LLM_STREAM_TIMEOUT_SECONDS, default 120, 0 disables the timeout)
+func GetLLMStreamTimeout() time.Duration {
+	return time.Duration(getEnvInt("LLM_STREAM_TIMEOUT_SECONDS", 120)) * time.Second
+}
+
+// GetRateLimitRetries returns how often an LLM request answered with 429 Too Many Requests is retried
+// with exponential backoff (LLM_RATE_LIMIT_RETRIES, default 3, 0 disables retries)
+func GetRateLimitRetries() int {
+	return getEnvInt("LLM_RATE_LIMIT_RETRIES", 3)
+}
@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 )
 
 // Model represents an available LLM model
@@ -12,33 +15,121 @@ type Model struct {
 	Name     string `json:"name"`
 	Provider string `json:"provider"`
 	Tier     string `json:"tier"`
+	// InputPricePerMToken is the prompt price in USD per million tokens (0 means unknown for paid models)
+	InputPricePerMToken float64 `json:"input_price_per_m_token,omitempty"`
+	// OutputPricePerMToken is the completion price in USD per million tokens (0 means unknown for paid models)
+	OutputPricePerMToken float64  `json:"output_price_per_m_token,omitempty"`
+	ContextWindow        int      `json:"context_window,omitempty"` // Maximum tokens per request, 0 if unknown
+	Capabilities         []string `json:"capabilities,omitempty"`   // e.g. "json_mode", "tools", "vision"
+	// Fallbacks lists model IDs tried in order when a request to this model fails
+	Fallbacks []string `json:"fallbacks,omitempty"`
 }
 
-var availableModels []Model
+// SupportsVision reports whether the model accepts image inputs
+func (m Model) SupportsVision() bool {
+	return slices.Contains(m.Capabilities, "vision")
+}
+
+// HasCapability reports whether the model supports a capability. "streaming" is supported by every
+// model and "structured_output" by models with JSON mode or JSON schema support; any other
+// capability must be listed in the model's capabilities.
+func (m Model) HasCapability(capability string) bool {
+	switch capability {
+	case "streaming":
+		return true
+	case "structured_output":
+		return slices.Contains(m.Capabilities, "json_mode") || slices.Contains(m.Capabilities, "json_schema")
+	default:
+		return slices.Contains(m.Capabilities, capability)
+	}
+}
+
+// HasKnownPricing reports whether the model's token prices are known. Free-tier models cost nothing.
+func (m Model) HasKnownPricing() bool {
+	return m.Tier == "free" || m.InputPricePerMToken > 0 || m.OutputPricePerMToken > 0
+}
+
+var (
+	availableModels []Model
+	modelsMu        sync.RWMutex
+)
 
-// LoadModels loads the available models from the config file
+// LoadModels loads the available models from the config file.
+// The file is validated first; on any error the previously loaded models stay in effect.
 func LoadModels(configPath string) error {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(data, &availableModels)
-	if err != nil {
+	var models []Model
+	if err := json.Unmarshal(data, &models); err != nil {
+		return err
+	}
+
+	if err := validateModels(models); err != nil {
 		return err
 	}
 
+	modelsMu.Lock()
+	availableModels = models
+	modelsMu.Unlock()
+
 	return nil
 }
 
+// ReloadModels re-reads the models config file and returns the number of models loaded
+func ReloadModels(configPath string) (int, error) {
+	if err := LoadModels(configPath); err != nil {
+		return 0, fmt.Errorf("error reloading models from %s: %w", configPath, err)
+	}
+	return len(GetAvailableModels()), nil
+}
+
+// validateModels checks that a models list is non-empty and has unique, non-empty IDs
+func validateModels(models []Model) error {
+	if len(models) == 0 {
+		return fmt.Errorf("models config contains no models")
+	}
+
+	seen := make(map[string]bool, len(models))
+	for i, model := range models {
+		if model.ID == "" {
+			return fmt.Errorf("model %d has no id", i)
+		}
+		if seen[model.ID] {
+			return fmt.Errorf("duplicate model id %s", model.ID)
+		}
+		seen[model.ID] = true
+	}
+
+	for _, model := range models {
+		for _, fallback := range model.Fallbacks {
+			if !seen[fallback] || fallback == model.ID {
+				return fmt.Errorf("model %s has invalid fallback %s", model.ID, fallback)
+			}
+		}
+	}
+	return nil
+}
+
+// SetModels replaces the available models without validation, e.g. with fixtures in tests
+func SetModels(models []Model) {
+	modelsMu.Lock()
+	availableModels = models
+	modelsMu.Unlock()
+}
+
 // GetAvailableModels returns the list of available models
 func GetAvailableModels() []Model {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
 	return availableModels
 }
 
 // IsValidModel checks if a model ID is in the list of available models
 func IsValidModel(modelID string) bool {
-	for _, model := range availableModels {
+	for _, model := range GetAvailableModels() {
 		if model.ID == modelID {
 			return true
 		}
@@ -46,6 +137,86 @@ func IsValidModel(modelID string) bool {
 	return false
 }
 
+// GetModelByID returns the available model with the given ID
+func GetModelByID(modelID string) (Model, bool) {
+	for _, model := range GetAvailableModels() {
+		if model.ID == modelID {
+			return model, true
+		}
+	}
+	return Model{}, false
+}
+
+// GetModelChain returns the model followed by its configured fallbacks, without duplicates
+func GetModelChain(modelID string) []string {
+	chain := []string{modelID}
+	model, ok := GetModelByID(modelID)
+	if !ok {
+		return chain
+	}
+	for _, fallback := range model.Fallbacks {
+		if !slices.Contains(chain, fallback) {
+			chain = append(chain, fallback)
+		}
+	}
+	return chain
+}
+
+// knownCapabilities lists the capabilities models can be filtered by
+var knownCapabilities = []string{"streaming", "structured_output", "json_mode", "json_schema", "tools", "vision"}
+
+// IsKnownCapability reports whether a capability is one models can be filtered by
+func IsKnownCapability(capability string) bool {
+	return slices.Contains(knownCapabilities, capability)
+}
+
+// GetModelsByCapability returns the available models supporting a capability such as "vision",
+// "structured_output", "streaming" or "json_schema"
+func GetModelsByCapability(capability string) []Model {
+	var models []Model
+	for _, model := range GetAvailableModels() {
+		if model.HasCapability(capability) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// GetModelsByMinContextWindow returns the available models whose context window is known to hold at least minTokens
+func GetModelsByMinContextWindow(minTokens int) []Model {
+	var models []Model
+	for _, model := range GetAvailableModels() {
+		if model.ContextWindow >= minTokens {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// GetCheapestModel returns the available model with the lowest input price.
+// Free-tier models count as zero cost; paid models without a known price are skipped.
+// Ties are resolved in favour of the model listed first.
+func GetCheapestModel() (Model, error) {
+	models := GetAvailableModels()
+	var cheapest *Model
+	var cheapestPrice float64
+	for i, model := range models {
+		if !model.HasKnownPricing() {
+			continue
+		}
+		price := model.InputPricePerMToken
+		if cheapest == nil || price < cheapestPrice {
+			cheapest = &models[i]
+			cheapestPrice = price
+		}
+	}
+
+	if cheapest == nil {
+		return Model{}, fmt.Errorf("no models with known pricing are available")
+	}
+	return *cheapest, nil
+}
+
 // GetDefaultModelPath returns the default path to the models config file
 func GetDefaultModelPath() string {
 	return filepath.Join("backend", "config", "models.json")
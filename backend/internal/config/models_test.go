@@ -0,0 +1,251 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestGetCheapestModel(t *testing.T) {
+	previous := GetAvailableModels()
+	t.Cleanup(func() { SetModels(previous) })
+
+	tests := []struct {
+		name    string
+		models  []Model
+		wantID  string
+		wantErr bool
+	}{
+		{
+			name: "lowest input price",
+			models: []Model{
+				{ID: "large", InputPricePerMToken: 3},
+				{ID: "small", InputPricePerMToken: 0.15},
+				{ID: "medium", InputPricePerMToken: 1},
+			},
+			wantID: "small",
+		},
+		{
+			name: "free tier counts as zero cost",
+			models: []Model{
+				{ID: "small", InputPricePerMToken: 0.15},
+				{ID: "free", Tier: "free"},
+			},
+			wantID: "free",
+		},
+		{
+			name: "unknown prices are skipped",
+			models: []Model{
+				{ID: "unpriced", Tier: "paid"},
+				{ID: "medium", InputPricePerMToken: 1},
+			},
+			wantID: "medium",
+		},
+		{
+			name: "ties keep the first model",
+			models: []Model{
+				{ID: "first", InputPricePerMToken: 0.5},
+				{ID: "second", InputPricePerMToken: 0.5},
+			},
+			wantID: "first",
+		},
+		{
+			name:    "no known prices",
+			models:  []Model{{ID: "unpriced", Tier: "paid"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetModels(tt.models)
+
+			model, err := GetCheapestModel()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCheapestModel() error = %v, want error %v", err, tt.wantErr)
+			}
+			if model.ID != tt.wantID {
+				t.Errorf("GetCheapestModel() = %q, want %q", model.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+// filterTestModels are models with a mix of capabilities and context windows
+var filterTestModels = []Model{
+	{ID: "vision", ContextWindow: 128000, Capabilities: []string{"vision"}},
+	{ID: "json-mode", ContextWindow: 32000, Capabilities: []string{"json_mode", "tools"}},
+	{ID: "json-schema", ContextWindow: 200000, Capabilities: []string{"json_schema", "vision"}},
+	{ID: "plain", ContextWindow: 8000},
+}
+
+func TestGetModelsByCapability(t *testing.T) {
+	previous := GetAvailableModels()
+	t.Cleanup(func() { SetModels(previous) })
+	SetModels(filterTestModels)
+
+	tests := []struct {
+		capability string
+		want       []string
+	}{
+		{capability: "vision", want: []string{"vision", "json-schema"}},
+		{capability: "structured_output", want: []string{"json-mode", "json-schema"}},
+		{capability: "streaming", want: []string{"vision", "json-mode", "json-schema", "plain"}},
+		{capability: "json_schema", want: []string{"json-schema"}},
+		{capability: "json_mode", want: []string{"json-mode"}},
+		{capability: "tools", want: []string{"json-mode"}},
+		{capability: "telepathy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.capability, func(t *testing.T) {
+			var got []string
+			for _, model := range GetModelsByCapability(tt.capability) {
+				got = append(got, model.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetModelsByCapability(%q) = %v, want %v", tt.capability, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetModelsByMinContextWindow(t *testing.T) {
+	previous := GetAvailableModels()
+	t.Cleanup(func() { SetModels(previous) })
+	SetModels(filterTestModels)
+
+	tests := []struct {
+		minTokens int
+		want      []string
+	}{
+		{minTokens: 0, want: []string{"vision", "json-mode", "json-schema", "plain"}},
+		{minTokens: 32000, want: []string{"vision", "json-mode", "json-schema"}},
+		{minTokens: 128001, want: []string{"json-schema"}},
+		{minTokens: 1000000},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, model := range GetModelsByMinContextWindow(tt.minTokens) {
+			got = append(got, model.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetModelsByMinContextWindow(%d) = %v, want %v", tt.minTokens, got, tt.want)
+		}
+	}
+}
+
+func TestIsKnownCapability(t *testing.T) {
+	for _, capability := range []string{"streaming", "structured_output", "json_mode", "json_schema", "tools", "vision"} {
+		if !IsKnownCapability(capability) {
+			t.Errorf("IsKnownCapability(%q) = false, want true", capability)
+		}
+	}
+	for _, capability := range []string{"", "Vision", "telepathy"} {
+		if IsKnownCapability(capability) {
+			t.Errorf("IsKnownCapability(%q) = true, want false", capability)
+		}
+	}
+}
+
+// writeModelsFile writes a models config file into a temporary directory and returns its path
+func writeModelsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "models.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("error writing models file: %v", err)
+	}
+	return path
+}
+
+// modelIDs returns the IDs of the available models in order
+func modelIDs() []string {
+	var ids []string
+	for _, model := range GetAvailableModels() {
+		ids = append(ids, model.ID)
+	}
+	return ids
+}
+
+func TestReloadModels(t *testing.T) {
+	previous := GetAvailableModels()
+	t.Cleanup(func() { SetModels(previous) })
+
+	t.Run("valid file", func(t *testing.T) {
+		SetModels([]Model{{ID: "old"}})
+		path := writeModelsFile(t, `[{"id":"vendor/a","name":"A"},{"id":"vendor/b","name":"B","fallbacks":["vendor/a"]}]`)
+
+		count, err := ReloadModels(path)
+		if err != nil {
+			t.Fatalf("ReloadModels() error = %v", err)
+		}
+		if count != 2 || !slices.Equal(modelIDs(), []string{"vendor/a", "vendor/b"}) {
+			t.Errorf("ReloadModels() = %d, models %v, want the 2 models of the file", count, modelIDs())
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		content string
+	}{
+		{name: "malformed JSON", content: `[{"id":"vendor/a"`},
+		{name: "no models", content: `[]`},
+		{name: "missing id", content: `[{"name":"A"}]`},
+		{name: "duplicate id", content: `[{"id":"vendor/a"},{"id":"vendor/a"}]`},
+		{name: "unknown fallback", content: `[{"id":"vendor/a","fallbacks":["vendor/missing"]}]`},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			SetModels([]Model{{ID: "old"}})
+
+			if count, err := ReloadModels(writeModelsFile(t, tt.content)); err == nil {
+				t.Fatalf("ReloadModels() = %d, want an error", count)
+			}
+			if ids := modelIDs(); !slices.Equal(ids, []string{"old"}) {
+				t.Errorf("models = %v after a failed reload, want the previous models", ids)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		SetModels([]Model{{ID: "old"}})
+
+		if _, err := ReloadModels(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Fatal("ReloadModels() succeeded, want an error")
+		}
+		if ids := modelIDs(); !slices.Equal(ids, []string{"old"}) {
+			t.Errorf("models = %v after a failed reload, want the previous models", ids)
+		}
+	})
+}
+
+func TestReloadModelsConcurrentReads(t *testing.T) {
+	previous := GetAvailableModels()
+	t.Cleanup(func() { SetModels(previous) })
+	SetModels([]Model{{ID: "vendor/a"}})
+	path := writeModelsFile(t, `[{"id":"vendor/a"},{"id":"vendor/b"}]`)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if _, ok := GetModelByID("vendor/a"); !ok {
+					t.Error("vendor/a missing while models were reloaded")
+					return
+				}
+				IsValidModel("vendor/b")
+			}
+		}()
+	}
+	for range 20 {
+		if _, err := ReloadModels(path); err != nil {
+			t.Errorf("ReloadModels() error = %v", err)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ModerationConfig controls the content moderation pre-filter
+type ModerationConfig struct {
+	Enabled         bool
+	BlockedPatterns []string
+}
+
+// GetModerationConfig reads the moderation settings from the environment.
+// MODERATION_BLOCKED_PATTERNS is a JSON array of regular expressions, so patterns may contain commas
+// (e.g. `["\\bfoo\\b", "x{2,4}"]`).
+func GetModerationConfig() (ModerationConfig, error) {
+	cfg := ModerationConfig{
+		Enabled: os.Getenv("MODERATION_ENABLED") == "true",
+	}
+
+	raw := strings.TrimSpace(os.Getenv("MODERATION_BLOCKED_PATTERNS"))
+	if raw == "" {
+		return cfg, nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal([]byte(raw), &patterns); err != nil {
+		return cfg, fmt.Errorf("MODERATION_BLOCKED_PATTERNS must be a JSON array of strings: %w", err)
+	}
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) != "" {
+			cfg.BlockedPatterns = append(cfg.BlockedPatterns, pattern)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetModerationConfig(t *testing.T) {
+	t.Setenv("MODERATION_ENABLED", "true")
+	t.Setenv("MODERATION_BLOCKED_PATTERNS", `["\\bfoo\\b", "x{2,4}", "  "]`)
+
+	cfg, err := GetModerationConfig()
+	if err != nil {
+		t.Fatalf("GetModerationConfig() error = %v", err)
+	}
+	if want := []string{`\bfoo\b`, `x{2,4}`}; !cfg.Enabled || !slices.Equal(cfg.BlockedPatterns, want) {
+		t.Errorf("config = %+v, want enabled with patterns %q", cfg, want)
+	}
+
+	t.Setenv("MODERATION_BLOCKED_PATTERNS", `foo,bar`)
+	if _, err := GetModerationConfig(); err == nil {
+		t.Error("GetModerationConfig() accepted patterns that are not a JSON array")
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// RAGConfig controls retrieval of context passages from a vector store before each streamed reply
+type RAGConfig struct {
+	Enabled        bool
+	VectorStoreURL string
+	TopK           int
+	MinSimilarity  float64
+}
+
+// GetRAGConfig reads the retrieval settings from the environment. Passages scoring below
+// RAG_MIN_SIMILARITY (default 0) are dropped.
+func GetRAGConfig() RAGConfig {
+	cfg := RAGConfig{
+		Enabled:        os.Getenv("RAG_ENABLED") == "true",
+		VectorStoreURL: os.Getenv("VECTOR_STORE_URL"),
+		TopK:           getEnvInt("RAG_TOP_K", 3),
+	}
+
+	if value, err := strconv.ParseFloat(os.Getenv("RAG_MIN_SIMILARITY"), 64); err == nil {
+		cfg.MinSimilarity = value
+	}
+
+	return cfg
+}
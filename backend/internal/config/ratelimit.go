@@ -0,0 +1,20 @@
+package config
+
+// RateLimitConfig holds the per-user request rate limit of the chat endpoints and the
+// per-key limit of requests authenticated with an API key
+type RateLimitConfig struct {
+	RequestsPerMinute       int // Sustained request rate per user, 0 disables rate limiting
+	BurstSize               int // Requests a user may send at once before the rate applies
+	APIKeyRequestsPerMinute int // Sustained request rate per API key, 0 disables it
+	APIKeyBurstSize         int // Requests an API key may send at once before the rate applies
+}
+
+// GetRateLimitConfig returns the rate limits from environment variables
+func GetRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		RequestsPerMinute:       getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 30),
+		BurstSize:               getEnvInt("RATE_LIMIT_BURST_SIZE", 10),
+		APIKeyRequestsPerMinute: getEnvInt("API_KEY_RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
+		APIKeyBurstSize:         getEnvInt("API_KEY_RATE_LIMIT_BURST_SIZE", 20),
+	}
+}
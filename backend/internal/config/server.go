@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// getEnvInt reads an integer environment variable, returning defaultValue if it is unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	var value int
+	if _, err := fmt.Sscanf(valueStr, "%d", &value); err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvString reads a string environment variable, returning defaultValue if it is unset
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// GetMetricsAddr returns the address of the internal listener serving GET /metrics, e.g. "127.0.0.1:9090"
+// (METRICS_ADDR, default empty which serves metrics on the API port to admins only)
+func GetMetricsAddr() string {
+	return getEnvString("METRICS_ADDR", "")
+}
+
+// GetInFlightWindow returns the window during which an identical stream request is rejected
+// while the first one is still being processed (INFLIGHT_WINDOW_MS, default 500ms, 0 disables)
+func GetInFlightWindow() time.Duration {
+	return time.Duration(getEnvInt("INFLIGHT_WINDOW_MS", 500)) * time.Millisecond
+}
+
+// GetCheckpointChunkInterval returns how many streamed chunks are received between
+// partial message checkpoints (CHECKPOINT_CHUNK_INTERVAL, default 50, 0 disables)
+func GetCheckpointChunkInterval() int {
+	return getEnvInt("CHECKPOINT_CHUNK_INTERVAL", 50)
+}
+
+// GetAdminUsernames returns the users granted the admin role at startup (ADMIN_USERNAMES, comma-separated)
+func GetAdminUsernames() []string {
+	var usernames []string
+	for _, username := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		username = strings.TrimSpace(username)
+		if username != "" {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// GetCORSAllowedOrigins returns the browser origins allowed to call the API and open WebSockets
+// (CORS_ALLOWED_ORIGINS, comma-separated, default "*" which allows any origin)
+func GetCORSAllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(getEnvString("CORS_ALLOWED_ORIGINS", "*"), ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// IsOriginAllowed reports whether origin is in the CORS allow-list
+func IsOriginAllowed(origin string) bool {
+	for _, allowed := range GetCORSAllowedOrigins() {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAttachmentsDir returns the directory where chat message attachments are stored (ATTACHMENTS_DIR, default "attachments")
+func GetAttachmentsDir() string {
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return dir
+	}
+	return "attachments"
+}
+
+// GetDuplicateMessageWindow returns the window during which a user message identical to the
+// previous one in the same conversation is rejected (DUPLICATE_MESSAGE_WINDOW_MS, default 5000ms, 0 disables)
+func GetDuplicateMessageWindow() time.Duration {
+	return time.Duration(getEnvInt("DUPLICATE_MESSAGE_WINDOW_MS", 5000)) * time.Millisecond
+}
+
+// GetMaxConcurrentStreams returns how many chat streams may run at once; further stream
+// requests are rejected with 503 (MAX_CONCURRENT_STREAMS, default 100, 0 disables the limit)
+func GetMaxConcurrentStreams() int {
+	return getEnvInt("MAX_CONCURRENT_STREAMS", 100)
+}
+
+// GetGzipLevel returns the gzip level of compressed responses, from 1 (fastest) to 9 (smallest)
+// (GZIP_LEVEL, default 5, 0 disables compression; out-of-range values use the default)
+func GetGzipLevel() int {
+	level := getEnvInt("GZIP_LEVEL", 5)
+	if level < 0 || level > 9 {
+		return 5
+	}
+	return level
+}
+
+// IsProduction reports whether the server runs in production mode (APP_ENV=production)
+func IsProduction() bool {
+	return getEnvString("APP_ENV", "development") == "production"
+}
+
+// AllowPrivateWebhooks reports whether user webhooks may point at localhost or private addresses,
+// which is only meant for testing webhooks locally (ALLOW_PRIVATE_WEBHOOKS, default false)
+func AllowPrivateWebhooks() bool {
+	return os.Getenv("ALLOW_PRIVATE_WEBHOOKS") == "true"
+}
+
+// GetArchivedConversationRetention returns how long deleted conversations stay archived and restorable
+// before they are purged permanently (ARCHIVED_CONVERSATION_RETENTION_DAYS, default 30, 0 keeps them forever)
+func GetArchivedConversationRetention() time.Duration {
+	return time.Duration(getEnvInt("ARCHIVED_CONVERSATION_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
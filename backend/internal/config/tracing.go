@@ -0,0 +1,15 @@
+package config
+
+// TracingConfig holds the OpenTelemetry tracing settings
+type TracingConfig struct {
+	ServiceName  string // service.name reported with every span
+	OTLPEndpoint string // OTLP/HTTP collector URL, e.g. http://localhost:4318; empty disables export
+}
+
+// GetTracingConfig returns the tracing settings from environment variables
+func GetTracingConfig() TracingConfig {
+	return TracingConfig{
+		ServiceName:  getEnvString("OTEL_SERVICE_NAME", "chat-app"),
+		OTLPEndpoint: getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Validate checks the environment configuration at startup so that misconfiguration is reported
+// up front rather than when a feature is first used. All problems found are returned together.
+func Validate() error {
+	var errs []error
+
+	if os.Getenv("OPENROUTER_API_KEY") == "" {
+		errs = append(errs, errors.New("OPENROUTER_API_KEY is required"))
+	}
+
+	if port := os.Getenv("PORT"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs = append(errs, fmt.Errorf("PORT %q must be a number between 1 and 65535", port))
+		}
+	}
+
+	if err := GetDatabaseConfig().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, format := range []string{"TEXT", "STRUCTURED"} {
+		if err := validateFloatRange("OPENROUTER_"+format+"_TEMPERATURE", 0, 2); err != nil {
+			errs = append(errs, err)
+		}
+		if err := validateFloatRange("OPENROUTER_"+format+"_TOP_P", 0, 1); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if _, err := GetModerationConfig(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if rag := GetRAGConfig(); rag.Enabled {
+		if rag.VectorStoreURL == "" {
+			errs = append(errs, errors.New("VECTOR_STORE_URL is required when RAG_ENABLED is true"))
+		}
+		if rag.TopK < 1 {
+			errs = append(errs, fmt.Errorf("RAG_TOP_K must be at least 1"))
+		}
+	}
+
+	// The attachments directory is created on first upload, but an existing path must be a directory
+	if info, err := os.Stat(GetAttachmentsDir()); err == nil && !info.IsDir() {
+		errs = append(errs, fmt.Errorf("ATTACHMENTS_DIR %q is not a directory", GetAttachmentsDir()))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateFloatRange checks that an optional float environment variable lies within [min, max]
+func validateFloatRange(key string, min, max float64) error {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil || value < min || value > max {
+		return fmt.Errorf("%s %q must be a number between %g and %g", key, valueStr, min, max)
+	}
+	return nil
+}
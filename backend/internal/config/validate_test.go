@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	notADir := filepath.Join(dir, "attachments.txt")
+	if err := os.WriteFile(notADir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// valid is a configuration that passes every rule; each case overrides some of it
+	valid := map[string]string{
+		"OPENROUTER_API_KEY":                "sk-or-test",
+		"PORT":                              "8080",
+		"DB_SSLMODE":                        "disable",
+		"OPENROUTER_TEXT_TEMPERATURE":       "",
+		"OPENROUTER_TEXT_TOP_P":             "",
+		"OPENROUTER_STRUCTURED_TEMPERATURE": "",
+		"OPENROUTER_STRUCTURED_TOP_P":       "",
+		"MODERATION_BLOCKED_PATTERNS":       "",
+		"RAG_ENABLED":                       "",
+		"VECTOR_STORE_URL":                  "",
+		"RAG_TOP_K":                         "",
+		"ATTACHMENTS_DIR":                   filepath.Join(dir, "attachments"),
+	}
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantErrsIn []string // substrings of the expected errors, none when valid
+	}{
+		{name: "valid"},
+		{name: "default port", env: map[string]string{"PORT": ""}},
+		{name: "temperatures in range", env: map[string]string{"OPENROUTER_TEXT_TEMPERATURE": "2", "OPENROUTER_STRUCTURED_TOP_P": "0"}},
+		{name: "existing attachments directory", env: map[string]string{"ATTACHMENTS_DIR": dir}},
+		{name: "RAG configured", env: map[string]string{"RAG_ENABLED": "true", "VECTOR_STORE_URL": "http://vectors:8000", "RAG_TOP_K": "5"}},
+		{name: "missing API key", env: map[string]string{"OPENROUTER_API_KEY": ""}, wantErrsIn: []string{"OPENROUTER_API_KEY is required"}},
+		{name: "non-numeric port", env: map[string]string{"PORT": "http"}, wantErrsIn: []string{`PORT "http"`}},
+		{name: "port out of range", env: map[string]string{"PORT": "65536"}, wantErrsIn: []string{`PORT "65536"`}},
+		{name: "port zero", env: map[string]string{"PORT": "0"}, wantErrsIn: []string{`PORT "0"`}},
+		{name: "invalid SSL mode", env: map[string]string{"DB_SSLMODE": "prefer"}, wantErrsIn: []string{"invalid DB_SSLMODE"}},
+		{
+			name:       "verifying SSL mode without certificates",
+			env:        map[string]string{"DB_SSLMODE": "verify-full", "DB_SSLCERT": "", "DB_SSLKEY": "", "DB_SSLROOTCERT": ""},
+			wantErrsIn: []string{"DB_SSLCERT is required"},
+		},
+		{name: "temperature too high", env: map[string]string{"OPENROUTER_TEXT_TEMPERATURE": "2.5"}, wantErrsIn: []string{"OPENROUTER_TEXT_TEMPERATURE"}},
+		{name: "non-numeric top_p", env: map[string]string{"OPENROUTER_STRUCTURED_TOP_P": "high"}, wantErrsIn: []string{"OPENROUTER_STRUCTURED_TOP_P"}},
+		{name: "top_p too high", env: map[string]string{"OPENROUTER_TEXT_TOP_P": "1.1"}, wantErrsIn: []string{"OPENROUTER_TEXT_TOP_P"}},
+		{name: "invalid moderation patterns", env: map[string]string{"MODERATION_BLOCKED_PATTERNS": "foo,bar"}, wantErrsIn: []string{"MODERATION_BLOCKED_PATTERNS"}},
+		{name: "RAG without vector store", env: map[string]string{"RAG_ENABLED": "true"}, wantErrsIn: []string{"VECTOR_STORE_URL is required"}},
+		{
+			name:       "RAG with no passages",
+			env:        map[string]string{"RAG_ENABLED": "true", "VECTOR_STORE_URL": "http://vectors:8000", "RAG_TOP_K": "0"},
+			wantErrsIn: []string{"RAG_TOP_K must be at least 1"},
+		},
+		{name: "attachments path is a file", env: map[string]string{"ATTACHMENTS_DIR": notADir}, wantErrsIn: []string{"is not a directory"}},
+		{
+			name:       "all problems reported together",
+			env:        map[string]string{"OPENROUTER_API_KEY": "", "PORT": "-1", "OPENROUTER_STRUCTURED_TEMPERATURE": "3"},
+			wantErrsIn: []string{"OPENROUTER_API_KEY is required", `PORT "-1"`, "OPENROUTER_STRUCTURED_TEMPERATURE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range valid {
+				t.Setenv(key, value)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			err := Validate()
+			if len(tt.wantErrsIn) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors containing %q", tt.wantErrsIn)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantErrsIn) {
+				t.Errorf("Validate() reported %d problems (%q), want %d", len(lines), lines, len(tt.wantErrsIn))
+			}
+			for _, want := range tt.wantErrsIn {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
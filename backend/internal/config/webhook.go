@@ -0,0 +1,8 @@
+package config
+
+import "os"
+
+// GetWebhookSecret returns the shared secret used to sign incoming webhook events (WEBHOOK_SECRET)
+func GetWebhookSecret() string {
+	return os.Getenv("WEBHOOK_SECRET")
+}
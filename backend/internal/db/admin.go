@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// AdminConversationFilter narrows down the conversations returned by GetAllConversations.
+// Zero values disable the corresponding filter.
+type AdminConversationFilter struct {
+	UserID         string
+	ResponseFormat string
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	HasSummary     *bool
+	Limit          int
+	Offset         int
+}
+
+// AdminConversation is a conversation together with its owner's username
+type AdminConversation struct {
+	Conversation
+	Username string
+}
+
+// GetAllConversations retrieves conversations across all users, newest activity first.
+// It also returns the total number of matching conversations ignoring limit and offset.
+func GetAllConversations(filter AdminConversationFilter) ([]AdminConversation, int, error) {
+	db := GetDB()
+
+	// Shared by the page and total queries, so the total doesn't depend on the page being non-empty
+	where := `
+	WHERE ($1 = '' OR c.user_id::text = $1)
+	  AND ($2 = '' OR COALESCE(c.response_format, 'text') = $2)
+	  AND ($3::timestamp IS NULL OR c.created_at >= $3)
+	  AND ($4::timestamp IS NULL OR c.created_at <= $4)
+	  AND ($5::boolean IS NULL OR (c.active_summary_id IS NOT NULL) = $5)
+	`
+	args := []any{filter.UserID, filter.ResponseFormat, filter.CreatedAfter, filter.CreatedBefore, filter.HasSummary}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM conversations c`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting conversations: %w", err)
+	}
+
+	query := `
+	SELECT c.id, c.user_id, u.username, c.title, COALESCE(c.response_format, 'text'), COALESCE(c.response_schema, ''),
+		c.active_summary_id, c.starred_at, COALESCE(c.color, ''), c.created_at, c.updated_at
+	FROM conversations c
+	JOIN users u ON u.id = c.user_id` + where + `
+	ORDER BY c.updated_at DESC
+	LIMIT $6 OFFSET $7
+	`
+
+	rows, err := db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []AdminConversation
+	for rows.Next() {
+		var conv AdminConversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Username, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema,
+			&conv.ActiveSummaryID, &conv.StarredAt, &conv.Color, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error querying conversations: %w", err)
+	}
+
+	return conversations, total, nil
+}
@@ -0,0 +1,69 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var adminConversationColumns = []string{"id", "user_id", "username", "title", "response_format", "response_schema",
+	"active_summary_id", "starred_at", "color", "created_at", "updated_at"}
+
+func TestGetAllConversations(t *testing.T) {
+	after := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	withSummary, withoutSummary := true, false
+
+	tests := []struct {
+		name     string
+		filter   db.AdminConversationFilter
+		wantArgs []driver.Value // arguments of the filters, shared by the count and page queries
+	}{
+		{name: "no filters", filter: db.AdminConversationFilter{Limit: 50}, wantArgs: []driver.Value{"", "", nil, nil, nil}},
+		{name: "user", filter: db.AdminConversationFilter{UserID: "u1", Limit: 50}, wantArgs: []driver.Value{"u1", "", nil, nil, nil}},
+		{name: "format", filter: db.AdminConversationFilter{ResponseFormat: "json", Limit: 50}, wantArgs: []driver.Value{"", "json", nil, nil, nil}},
+		{
+			name:     "creation date range",
+			filter:   db.AdminConversationFilter{CreatedAfter: &after, CreatedBefore: &before, Limit: 50},
+			wantArgs: []driver.Value{"", "", after, before, nil},
+		},
+		{name: "with summary", filter: db.AdminConversationFilter{HasSummary: &withSummary, Limit: 50}, wantArgs: []driver.Value{"", "", nil, nil, true}},
+		{name: "without summary", filter: db.AdminConversationFilter{HasSummary: &withoutSummary, Limit: 50}, wantArgs: []driver.Value{"", "", nil, nil, false}},
+		{
+			name: "all filters with a page offset",
+			filter: db.AdminConversationFilter{UserID: "u1", ResponseFormat: "xml", CreatedAfter: &after, CreatedBefore: &before,
+				HasSummary: &withSummary, Limit: 10, Offset: 20},
+			wantArgs: []driver.Value{"u1", "xml", after, before, true},
+		},
+	}
+
+	const where = `WHERE \(\$1 = '' OR c.user_id::text = \$1\)\s+AND \(\$2 = '' OR COALESCE\(c.response_format, 'text'\) = \$2\)\s+` +
+		`AND \(\$3::timestamp IS NULL OR c.created_at >= \$3\)\s+AND \(\$4::timestamp IS NULL OR c.created_at <= \$4\)\s+` +
+		`AND \(\$5::boolean IS NULL OR \(c.active_summary_id IS NOT NULL\) = \$5\)`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			now := time.Now()
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM conversations c\s+` + where).
+				WithArgs(tt.wantArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+			mock.ExpectQuery(`FROM conversations c\s+JOIN users u ON u.id = c.user_id\s+` + where + `\s+ORDER BY c.updated_at DESC\s+LIMIT \$6 OFFSET \$7`).
+				WithArgs(append(tt.wantArgs, tt.filter.Limit, tt.filter.Offset)...).
+				WillReturnRows(sqlmock.NewRows(adminConversationColumns).
+					AddRow("c1", "u1", "alice", "Trip", "json", "", nil, nil, "", now, now))
+
+			conversations, total, err := db.GetAllConversations(tt.filter)
+			if err != nil {
+				t.Fatalf("GetAllConversations() error = %v", err)
+			}
+			if total != 42 || len(conversations) != 1 || conversations[0].Username != "alice" {
+				t.Errorf("GetAllConversations() = %+v, %d, want alice's conversation of 42", conversations, total)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIKeyPrefixLength is the number of leading characters of a key stored in clear to find it
+const APIKeyPrefixLength = 11
+
+// APIKey is a named key a user created for programmatic access. The key itself is never stored.
+type APIKey struct {
+	ID         string
+	UserID     string
+	Name       string
+	Prefix     string
+	LastUsedAt *string
+	CreatedAt  string
+}
+
+// CreateAPIKey stores a bcrypt hash of a new API key under the given name
+func CreateAPIKey(userID, name, key string) (*APIKey, error) {
+	db := GetDB()
+
+	keyHash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing api key: %w", err)
+	}
+
+	apiKey := &APIKey{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Name:   name,
+		Prefix: key[:APIKeyPrefixLength],
+	}
+
+	query := `
+	INSERT INTO api_keys (id, user_id, name, key_prefix, key_hash)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING created_at
+	`
+
+	if err := db.QueryRow(query, apiKey.ID, userID, name, apiKey.Prefix, string(keyHash)).Scan(&apiKey.CreatedAt); err != nil {
+		return nil, fmt.Errorf("error creating api key: %w", err)
+	}
+
+	log.Printf("[DB] Created api key %s for user %s", apiKey.ID, userID)
+	return apiKey, nil
+}
+
+// GetAPIKeysByUser returns a user's API keys, newest first
+func GetAPIKeysByUser(userID string) ([]APIKey, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id, user_id, name, key_prefix, last_used_at, created_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY created_at DESC
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var lastUsedAt sql.NullString
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &lastUsedAt, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.String
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of a user's API keys. It returns sql.ErrNoRows if the user has no such key.
+func DeleteAPIKey(userID, keyID string) error {
+	db := GetDB()
+
+	result, err := db.Exec(`DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting api key: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking deleted api key: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[DB] Deleted api key %s of user %s", keyID, userID)
+	return nil
+}
+
+// AuthenticateAPIKey finds the API key matching a presented key and records its use.
+// It returns the key and its owner's username, or sql.ErrNoRows if no key matches.
+func AuthenticateAPIKey(key string) (*APIKey, string, error) {
+	if len(key) <= APIKeyPrefixLength {
+		return nil, "", sql.ErrNoRows
+	}
+
+	db := GetDB()
+
+	query := `
+	SELECT k.id, k.user_id, k.name, k.key_prefix, k.key_hash, k.created_at, u.username
+	FROM api_keys k
+	JOIN users u ON u.id = k.user_id
+	WHERE k.key_prefix = $1
+	`
+
+	rows, err := db.Query(query, key[:APIKeyPrefixLength])
+	if err != nil {
+		return nil, "", fmt.Errorf("error querying api keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var apiKey APIKey
+		var keyHash, username string
+		if err := rows.Scan(&apiKey.ID, &apiKey.UserID, &apiKey.Name, &apiKey.Prefix, &keyHash, &apiKey.CreatedAt, &username); err != nil {
+			return nil, "", fmt.Errorf("error scanning api key: %w", err)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(keyHash), []byte(key)) != nil {
+			continue
+		}
+
+		if _, err := db.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`, apiKey.ID); err != nil {
+			log.Printf("[DB] Warning: failed to record use of api key %s: %v", apiKey.ID, err)
+		}
+		return &apiKey, username, nil
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	return nil, "", sql.ErrNoRows
+}
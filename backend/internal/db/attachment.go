@@ -0,0 +1,81 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment represents a file uploaded alongside a message
+type Attachment struct {
+	ID          string
+	MessageID   string
+	Filename    string
+	ContentType string
+	SizeBytes   int64
+	StorageKey  string // Path relative to the attachments directory
+	CreatedAt   time.Time
+}
+
+// CreateAttachment records the metadata of a stored attachment
+func CreateAttachment(messageID, filename, contentType string, sizeBytes int64, storageKey string) (*Attachment, error) {
+	db := GetDB()
+
+	attachment := Attachment{
+		ID:          uuid.New().String(),
+		MessageID:   messageID,
+		Filename:    filename,
+		ContentType: contentType,
+		SizeBytes:   sizeBytes,
+		StorageKey:  storageKey,
+	}
+
+	query := `
+	INSERT INTO message_attachments (id, message_id, filename, content_type, size_bytes, storage_key)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at
+	`
+
+	err := db.QueryRow(query, attachment.ID, messageID, filename, contentType, sizeBytes, storageKey).Scan(&attachment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error creating attachment: %w", err)
+	}
+
+	log.Printf("[DB] Created attachment %s (%s, %d bytes) for message %s", attachment.ID, filename, sizeBytes, messageID)
+	return &attachment, nil
+}
+
+// GetAttachmentsByConversation retrieves the attachments of all messages in a conversation, keyed by message ID
+func GetAttachmentsByConversation(conversationID string) (map[string][]Attachment, error) {
+	db := GetDB()
+
+	query := `
+	SELECT a.id, a.message_id, a.filename, COALESCE(a.content_type, ''), a.size_bytes, a.storage_key, a.created_at
+	FROM message_attachments a
+	JOIN messages m ON m.id = a.message_id
+	WHERE m.conversation_id = $1
+	ORDER BY a.created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := make(map[string][]Attachment)
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.Filename, &a.ContentType, &a.SizeBytes, &a.StorageKey, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning attachment: %w", err)
+		}
+		attachments[a.MessageID] = append(attachments[a.MessageID], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying attachments: %w", err)
+	}
+
+	return attachments, nil
+}
@@ -0,0 +1,46 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var attachmentColumns = []string{"id", "message_id", "filename", "content_type", "size_bytes", "storage_key", "created_at"}
+
+func TestGetAttachmentsByConversation(t *testing.T) {
+	t.Run("grouped by message", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM message_attachments a\s+JOIN messages m ON m.id = a.message_id\s+WHERE m.conversation_id = \$1`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(attachmentColumns).
+				AddRow("a1", "m1", "one.txt", "text/plain", 3, "c1/a1.txt", time.Now()).
+				AddRow("a2", "m1", "two.txt", "", 4, "c1/a2.txt", time.Now()).
+				AddRow("a3", "m2", "three.txt", "", 5, "c1/a3.txt", time.Now()))
+
+		attachments, err := db.GetAttachmentsByConversation("c1")
+		if err != nil {
+			t.Fatalf("GetAttachmentsByConversation() error = %v", err)
+		}
+		if len(attachments["m1"]) != 2 || len(attachments["m2"]) != 1 {
+			t.Errorf("attachments = %+v, want two for m1 and one for m2", attachments)
+		}
+	})
+
+	t.Run("iteration error", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM message_attachments`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(attachmentColumns).
+				AddRow("a1", "m1", "one.txt", "", 3, "c1/a1.txt", time.Now()).
+				RowError(0, errors.New("connection reset")))
+
+		if attachments, err := db.GetAttachmentsByConversation("c1"); err == nil {
+			t.Fatalf("GetAttachmentsByConversation() = %v, want the iteration error", attachments)
+		}
+	})
+}
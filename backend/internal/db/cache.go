@@ -0,0 +1,63 @@
+package db
+
+import (
+	"chat-app/internal/config"
+	"sync"
+	"time"
+)
+
+// ttlCache is a concurrency-safe in-process cache whose entries expire after a fixed time
+type ttlCache[T any] struct {
+	entries sync.Map // key -> cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+func (c *ttlCache[T]) get(key string) (T, bool) {
+	if v, ok := c.entries.Load(key); ok {
+		if entry := v.(cacheEntry[T]); time.Now().Before(entry.expiresAt) {
+			return entry.value, true
+		}
+		c.entries.Delete(key)
+	}
+	var zero T
+	return zero, false
+}
+
+func (c *ttlCache[T]) set(key string, value T, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.entries.Store(key, cacheEntry[T]{value: value, expiresAt: time.Now().Add(ttl)})
+}
+
+func (c *ttlCache[T]) delete(key string) {
+	c.entries.Delete(key)
+}
+
+var (
+	conversationCache ttlCache[Conversation] // conversation ID -> conversation
+	userCache         ttlCache[User]         // username -> user
+)
+
+// invalidateConversation drops a conversation from the cache after its row changed
+func invalidateConversation(convID string) {
+	conversationCache.delete(convID)
+}
+
+// invalidateUser drops a user from the cache after its row changed
+func invalidateUser(username string) {
+	userCache.delete(username)
+}
+
+// cacheConfig returns the cache settings, or nil if caching is disabled
+func cacheConfig() *config.CacheConfig {
+	cfg := config.GetCacheConfig()
+	if !cfg.Enabled {
+		return nil
+	}
+	return &cfg
+}
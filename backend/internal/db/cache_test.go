@@ -0,0 +1,131 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newCachedMockDB is testutil.NewMockDB with the query cache enabled and emptied for the given keys
+func newCachedMockDB(t *testing.T, convID, username string) sqlmock.Sqlmock {
+	t.Helper()
+	mock := testutil.NewMockDB(t)
+	t.Setenv("QUERY_CACHE_ENABLED", "true")
+	db.InvalidateConversation(convID)
+	db.InvalidateUser(username)
+	t.Cleanup(func() {
+		db.InvalidateConversation(convID)
+		db.InvalidateUser(username)
+	})
+	return mock
+}
+
+func TestGetConversationCached(t *testing.T) {
+	const convID = "33333333-3333-3333-3333-333333333333"
+
+	t.Run("cache hit", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1", Title: "Notes"})
+
+		// Only one query is expected, so the second lookup must come from the cache
+		for range 2 {
+			conv, err := db.GetConversation(convID)
+			if err != nil || conv.Title != "Notes" {
+				t.Fatalf("GetConversation() = %+v, %v, want Notes", conv, err)
+			}
+		}
+	})
+
+	t.Run("returned copy does not alter the cache", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1", Title: "Notes"})
+
+		conv, _ := db.GetConversation(convID)
+		conv.Title = "Changed"
+		if again, _ := db.GetConversation(convID); again.Title != "Notes" {
+			t.Errorf("cached title = %q, want Notes", again.Title)
+		}
+	})
+
+	t.Run("invalidated by a write", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1", Title: "Notes"})
+		mock.ExpectExec(`UPDATE conversations SET title = \$1, title_generated_at = CURRENT_TIMESTAMP WHERE id = \$2`).
+			WithArgs("Renamed", convID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1", Title: "Renamed"})
+
+		db.GetConversation(convID)
+		if err := db.UpdateConversationTitle(convID, "Renamed"); err != nil {
+			t.Fatalf("UpdateConversationTitle() error = %v", err)
+		}
+		if conv, err := db.GetConversation(convID); err != nil || conv.Title != "Renamed" {
+			t.Errorf("GetConversation() after the update = %+v, %v, want Renamed", conv, err)
+		}
+	})
+
+	t.Run("missing conversation not cached", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectNoConversation(mock, convID)
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+
+		if _, err := db.GetConversation(convID); err == nil {
+			t.Fatal("GetConversation() found a missing conversation")
+		}
+		if _, err := db.GetConversation(convID); err != nil {
+			t.Errorf("GetConversation() error = %v, want the created conversation", err)
+		}
+	})
+
+	for _, env := range []struct{ name, key, value string }{
+		{name: "disabled", key: "QUERY_CACHE_ENABLED", value: "false"},
+		{name: "zero TTL", key: "CACHE_CONVERSATION_TTL_SECONDS", value: "0"},
+	} {
+		t.Run(env.name, func(t *testing.T) {
+			mock := newCachedMockDB(t, convID, "")
+			t.Setenv(env.key, env.value)
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+
+			for range 2 {
+				if _, err := db.GetConversation(convID); err != nil {
+					t.Fatalf("GetConversation() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetUserByUsernameCached(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	t.Run("cache hit", func(t *testing.T) {
+		mock := newCachedMockDB(t, "", "alice")
+		testutil.ExpectUser(mock, userID, "alice")
+
+		for range 2 {
+			if user, err := db.GetUserByUsername("alice"); err != nil || user.ID != userID {
+				t.Fatalf("GetUserByUsername() = %+v, %v, want %s", user, err, userID)
+			}
+		}
+	})
+
+	t.Run("invalidated by a write", func(t *testing.T) {
+		mock := newCachedMockDB(t, "", "alice")
+		testutil.ExpectUser(mock, userID, "alice")
+		mock.ExpectExec(`UPDATE users SET webhook_url = NULLIF\(\$1, ''\) WHERE username = \$2`).
+			WithArgs("https://hooks.example.com", "alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		testutil.ExpectUser(mock, userID, "alice")
+
+		db.GetUserByUsername("alice")
+		if err := db.UpdateUserWebhookURL("alice", "https://hooks.example.com"); err != nil {
+			t.Fatalf("UpdateUserWebhookURL() error = %v", err)
+		}
+		if _, err := db.GetUserByUsername("alice"); err != nil {
+			t.Errorf("GetUserByUsername() after the update error = %v", err)
+		}
+	})
+}
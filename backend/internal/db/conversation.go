@@ -2,23 +2,36 @@ package db
 
 import (
 	"chat-app/internal/llm"
+	"chat-app/internal/metrics"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Conversation represents a conversation in the database
 type Conversation struct {
-	ID              string
-	UserID          string
-	Title           string
-	ResponseFormat  string
-	ResponseSchema  string
-	ActiveSummaryID *string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID               string
+	UserID           string
+	Title            string
+	ResponseFormat   string
+	ResponseSchema   string
+	ActiveSummaryID  *string
+	StarredAt        *time.Time // Personal bookmark, independent of updated_at
+	TitleGeneratedAt *time.Time // Last LLM title regeneration, used for the regeneration cooldown
+	Color            string     // Hex UI hint (#rrggbb), empty when the client picks its own
+	ArchivedAt       *time.Time // Set when the conversation was deleted; it is purged after the retention period
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
 }
 
 // ConversationSummary represents a summary of conversation messages
@@ -31,6 +44,26 @@ type ConversationSummary struct {
 	CreatedAt               time.Time
 }
 
+// ConversationStats represents aggregate message statistics for a conversation
+type ConversationStats struct {
+	MessageCount          int
+	UserMessageCount      int
+	AssistantMessageCount int
+	PromptTokens          int
+	CompletionTokens      int
+	TotalTokens           int
+	TotalCost             float64
+	CostedMessageCount    int      // Messages with a known cost, the denominator for average cost
+	AvgResponseTimeMs     *float64 // nil if no assistant message has a measured response time
+}
+
+// ConversationWithStats combines a conversation with its aggregate message statistics
+type ConversationWithStats struct {
+	Conversation
+	ConversationStats
+	MessageCountByRole map[string]int
+}
+
 // Message represents a message in a conversation
 type Message struct {
 	ID               string
@@ -39,19 +72,27 @@ type Message struct {
 	Content          string
 	Model            string
 	Temperature      *float64
-	Provider         string   // LLM provider used (openrouter, genkit)
+	Seed             *int
+	Provider         string // LLM provider used (openrouter, genkit)
 	GenerationID     string
 	PromptTokens     *int
 	CompletionTokens *int
 	TotalTokens      *int
 	TotalCost        *float64
-	Latency          *int // Time to first token in milliseconds
-	GenerationTime   *int // Total generation time in milliseconds
+	InputCostUSD     *float64   // Part of TotalCost spent on prompt tokens, nil when the model's pricing is unknown
+	OutputCostUSD    *float64   // Part of TotalCost spent on completion tokens
+	Latency          *int       // Time to first token in milliseconds
+	GenerationTime   *int       // Total generation time in milliseconds
+	ResponseTimeMs   *int       // End-to-end time measured by the server
+	ParentMessageID  *string    // Message this one branches from, nil for the main thread
+	Partial          bool       // True while a streamed response is still being checkpointed
+	SystemPromptHash string     // SHA-256 of the system prompt an assistant reply was generated with
+	EditedAt         *time.Time // Last time the user edited the content, nil if never edited
 	CreatedAt        time.Time
 }
 
 // CreateConversation creates a new conversation for a user
-func CreateConversation(userID string, title string, responseFormat string, responseSchema string) (*Conversation, error) {
+func CreateConversation(userID string, title string, responseFormat string, responseSchema string, color string) (*Conversation, error) {
 	db := GetDB()
 
 	convID := uuid.New().String()
@@ -63,12 +104,12 @@ func CreateConversation(userID string, title string, responseFormat string, resp
 	}
 
 	query := `
-	INSERT INTO conversations (id, user_id, title, response_format, response_schema)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO conversations (id, user_id, title, response_format, response_schema, color)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
 	RETURNING id, created_at, updated_at
 	`
 
-	err := db.QueryRow(query, convID, userID, title, responseFormat, responseSchema).Scan(&convID, &createdAt, &updatedAt)
+	err := db.QueryRow(query, convID, userID, title, responseFormat, responseSchema, color).Scan(&convID, &createdAt, &updatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("error creating conversation: %w", err)
 	}
@@ -81,32 +122,1206 @@ func CreateConversation(userID string, title string, responseFormat string, resp
 		Title:          title,
 		ResponseFormat: responseFormat,
 		ResponseSchema: responseSchema,
+		Color:          color,
 		CreatedAt:      createdAt,
 		UpdatedAt:      updatedAt,
 	}, nil
 }
 
-// GetConversationsByUser retrieves all conversations for a user
-func GetConversationsByUser(userID string) ([]Conversation, error) {
+// MaxConversationsPageSize caps the number of conversations returned by GetConversationsByUser
+const MaxConversationsPageSize = 100
+
+// ConversationCursor identifies the last conversation of a page. The ID breaks ties between
+// conversations updated at the same time.
+type ConversationCursor struct {
+	UpdatedAt time.Time
+	ID        string
+}
+
+// GetConversationsByUser retrieves a page of a user's conversations, most recently updated first, optionally
+// only starred ones. before is the last conversation of the previous page; nil returns the first page.
+func GetConversationsByUser(userID string, starredOnly bool, limit int, before *ConversationCursor) ([]Conversation, error) {
+	defer metrics.ObserveDBQuery("get_conversations", time.Now())
+	db := GetDB()
+
+	if limit <= 0 || limit > MaxConversationsPageSize {
+		limit = MaxConversationsPageSize
+	}
+
+	query := `
+	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), starred_at, COALESCE(color, ''), created_at, updated_at
+	FROM conversations
+	WHERE user_id = $1 AND archived_at IS NULL AND (NOT $2 OR starred_at IS NOT NULL)
+	  AND ($3::timestamp IS NULL OR (updated_at, id) < ($3, $4::uuid))
+	ORDER BY updated_at DESC, id DESC
+	LIMIT $5
+	`
+
+	var beforeUpdatedAt *time.Time
+	var beforeID *string
+	if before != nil {
+		beforeUpdatedAt, beforeID = &before.UpdatedAt, &before.ID
+	}
+
+	rows, err := db.Query(query, userID, starredOnly, beforeUpdatedAt, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var conv Conversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.StarredAt, &conv.Color, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying conversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// SearchConversationsByUser finds a user's conversations whose title or messages match query, most relevant first.
+// Title matches weigh more than message matches. An empty query lists all conversations by latest activity.
+// It also returns the total number of matching conversations ignoring limit and offset.
+func SearchConversationsByUser(userID, query string, limit, offset int) ([]Conversation, int, error) {
+	defer metrics.ObserveDBQuery("search_conversations", time.Now())
+	db := GetDB()
+
+	// The ranked matches are shared by the page and total queries, so the total doesn't depend on
+	// the page being non-empty
+	ranked := `
+	WITH q AS (SELECT plainto_tsquery('simple', $2) AS query),
+	matches AS (
+		SELECT c.id, 2 * ts_rank(to_tsvector('simple', c.title), q.query) AS rank
+		FROM conversations c, q
+		WHERE c.user_id = $1 AND c.archived_at IS NULL AND to_tsvector('simple', c.title) @@ q.query
+		UNION ALL
+		SELECT m.conversation_id, ts_rank(to_tsvector('simple', m.content), q.query)
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id, q
+		WHERE c.user_id = $1 AND c.archived_at IS NULL AND m.deleted_at IS NULL AND to_tsvector('simple', m.content) @@ q.query
+	),
+	ranked AS (
+		SELECT id, SUM(rank) AS rank FROM matches GROUP BY id
+	)
+	`
+	countQuery := ranked + `SELECT COUNT(*) FROM ranked`
+	sqlQuery := ranked + `
+	SELECT c.id, c.user_id, c.title, COALESCE(c.response_format, 'text'), COALESCE(c.response_schema, ''),
+		c.active_summary_id, c.starred_at, COALESCE(c.color, ''), c.created_at, c.updated_at
+	FROM ranked r
+	JOIN conversations c ON c.id = r.id
+	ORDER BY r.rank DESC, c.updated_at DESC
+	LIMIT $3 OFFSET $4
+	`
+	countArgs := []any{userID, query}
+
+	if strings.TrimSpace(query) == "" {
+		countQuery = `SELECT COUNT(*) FROM conversations WHERE user_id = $1 AND archived_at IS NULL`
+		sqlQuery = `
+		SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''),
+			active_summary_id, starred_at, COALESCE(color, ''), created_at, updated_at
+		FROM conversations
+		WHERE user_id = $1 AND archived_at IS NULL
+		ORDER BY updated_at DESC
+		LIMIT $2 OFFSET $3
+		`
+		countArgs = []any{userID}
+	}
+
+	var total int
+	if err := db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting conversations: %w", err)
+	}
+
+	rows, err := db.Query(sqlQuery, append(countArgs, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var conv Conversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema,
+			&conv.ActiveSummaryID, &conv.StarredAt, &conv.Color, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error searching conversations: %w", err)
+	}
+
+	return conversations, total, nil
+}
+
+// recentConversationsLimit caps the number of conversations returned by GetRecentConversations
+const recentConversationsLimit = 10
+
+// GetRecentConversations retrieves a user's most recently updated conversations since the given time
+func GetRecentConversations(userID string, since time.Time) ([]Conversation, error) {
 	db := GetDB()
 
 	query := `
-	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), created_at, updated_at
+	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), starred_at, COALESCE(color, ''), created_at, updated_at
 	FROM conversations
-	WHERE user_id = $1
+	WHERE user_id = $1 AND archived_at IS NULL AND updated_at > $2
 	ORDER BY updated_at DESC
+	LIMIT $3
+	`
+
+	rows, err := db.Query(query, userID, since, recentConversationsLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying recent conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var conv Conversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.StarredAt, &conv.Color, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying recent conversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// GetConversation retrieves a specific conversation, served from the query cache when enabled.
+// Archived conversations are reported as not found.
+func GetConversation(convID string) (*Conversation, error) {
+	conv, err := GetConversationIncludingArchived(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conv.ArchivedAt != nil {
+		return nil, fmt.Errorf("error retrieving conversation: %w", sql.ErrNoRows)
+	}
+	return conv, nil
+}
+
+// GetConversationIncludingArchived retrieves a conversation whether or not it is archived, for the
+// operations that act on archived conversations such as restoring them
+func GetConversationIncludingArchived(convID string) (*Conversation, error) {
+	cache := cacheConfig()
+	if cache != nil {
+		if conv, ok := conversationCache.get(convID); ok {
+			return &conv, nil
+		}
+	}
+
+	defer metrics.ObserveDBQuery("get_conversation", time.Now())
+	db := GetDB()
+
+	var conv Conversation
+	query := `
+	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), active_summary_id, starred_at, title_generated_at, COALESCE(color, ''), archived_at, created_at, updated_at
+	FROM conversations
+	WHERE id = $1
+	`
+
+	err := db.QueryRow(query, convID).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.ActiveSummaryID, &conv.StarredAt, &conv.TitleGeneratedAt, &conv.Color, &conv.ArchivedAt, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving conversation: %w", err)
+	}
+
+	if cache != nil {
+		conversationCache.set(convID, conv, cache.ConversationTTL)
+	}
+	return &conv, nil
+}
+
+// ConversationUpdate holds the conversation fields to change; nil fields are left unchanged
+type ConversationUpdate struct {
+	Title          *string
+	ResponseFormat *string
+	ResponseSchema *string
+	Color          *string // Empty string clears the color
+	// DiscardActiveSummary deletes the active summary in the same transaction, e.g. because it was
+	// generated for a different response format
+	DiscardActiveSummary bool
+}
+
+// UpdateConversation applies a partial update to a conversation and touches its updated_at timestamp
+func UpdateConversation(convID string, updates ConversationUpdate) error {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	sets := []string{"updated_at = CURRENT_TIMESTAMP"}
+	var args []any
+	// set adds an assignment whose "?" is replaced by the value's positional parameter
+	set := func(assignment string, value any) {
+		args = append(args, value)
+		sets = append(sets, strings.Replace(assignment, "?", fmt.Sprintf("$%d", len(args)), 1))
+	}
+	if updates.Title != nil {
+		set("title = ?", *updates.Title)
+	}
+	if updates.ResponseFormat != nil {
+		set("response_format = ?", *updates.ResponseFormat)
+	}
+	if updates.ResponseSchema != nil {
+		set("response_schema = ?", *updates.ResponseSchema)
+	}
+	if updates.Color != nil {
+		set("color = NULLIF(?, '')", *updates.Color)
+	}
+	args = append(args, convID)
+
+	query := fmt.Sprintf(`UPDATE conversations SET %s WHERE id = $%d`, strings.Join(sets, ", "), len(args))
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating conversation: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+
+	if updates.DiscardActiveSummary {
+		if err := deleteActiveSummary(tx, convID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	invalidateConversation(convID)
+
+	log.Printf("[DB] Updated conversation %s", convID)
+	return nil
+}
+
+// GetConversationWithStats retrieves a conversation together with its aggregate message statistics in one query
+func GetConversationWithStats(convID string) (*ConversationWithStats, error) {
+	db := GetDB()
+
+	var conv ConversationWithStats
+	var countByRoleJSON []byte
+	query := `
+	SELECT c.id, c.user_id, c.title, COALESCE(c.response_format, 'text'), COALESCE(c.response_schema, ''), c.active_summary_id, c.starred_at, COALESCE(c.color, ''), c.created_at, c.updated_at,
+	       COALESCE(s.message_count, 0), COALESCE(s.user_message_count, 0), COALESCE(s.assistant_message_count, 0),
+	       COALESCE(s.prompt_tokens, 0), COALESCE(s.completion_tokens, 0), COALESCE(s.total_tokens, 0), COALESCE(s.total_cost, 0),
+	       COALESCE(s.costed_message_count, 0), s.avg_response_time_ms,
+	       (SELECT COALESCE(json_object_agg(r.role, r.count), '{}')
+	        FROM (SELECT role, COUNT(*) AS count FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL GROUP BY role) r)
+	FROM conversations c
+	LEFT JOIN (
+		SELECT conversation_id,
+		       COUNT(*) AS message_count,
+		       COUNT(*) FILTER (WHERE role = 'user') AS user_message_count,
+		       COUNT(*) FILTER (WHERE role = 'assistant') AS assistant_message_count,
+		       SUM(prompt_tokens) AS prompt_tokens,
+		       SUM(completion_tokens) AS completion_tokens,
+		       SUM(total_tokens) AS total_tokens,
+		       SUM(total_cost) AS total_cost,
+		       COUNT(total_cost) AS costed_message_count,
+		       AVG(response_time_ms) AS avg_response_time_ms
+		FROM messages
+		WHERE conversation_id = $1 AND deleted_at IS NULL
+		GROUP BY conversation_id
+	) s ON s.conversation_id = c.id
+	WHERE c.id = $1 AND c.archived_at IS NULL
+	`
+
+	err := db.QueryRow(query, convID).Scan(
+		&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.ActiveSummaryID, &conv.StarredAt, &conv.Color, &conv.CreatedAt, &conv.UpdatedAt,
+		&conv.MessageCount, &conv.UserMessageCount, &conv.AssistantMessageCount,
+		&conv.PromptTokens, &conv.CompletionTokens, &conv.TotalTokens, &conv.TotalCost,
+		&conv.CostedMessageCount, &conv.AvgResponseTimeMs,
+		&countByRoleJSON,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving conversation with stats: %w", err)
+	}
+
+	conv.MessageCountByRole = make(map[string]int)
+	if err := json.Unmarshal(countByRoleJSON, &conv.MessageCountByRole); err != nil {
+		return nil, fmt.Errorf("error decoding message counts by role: %w", err)
+	}
+
+	return &conv, nil
+}
+
+// GetRecentMessageCosts returns the costs of a conversation's most recent assistant messages with a known cost, newest first
+func GetRecentMessageCosts(convID string, limit int) ([]float64, error) {
+	db := GetDB()
+
+	query := `
+	SELECT total_cost
+	FROM messages
+	WHERE conversation_id = $1 AND role = 'assistant' AND total_cost IS NOT NULL AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT $2
+	`
+
+	rows, err := db.Query(query, convID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message costs: %w", err)
+	}
+	defer rows.Close()
+
+	var costs []float64
+	for rows.Next() {
+		var cost float64
+		if err := rows.Scan(&cost); err != nil {
+			return nil, fmt.Errorf("error scanning message cost: %w", err)
+		}
+		costs = append(costs, cost)
+	}
+
+	return costs, rows.Err()
+}
+
+// CostBreakdown sums the message costs of a conversation
+type CostBreakdown struct {
+	TotalCost      float64 // Total cost of all messages
+	InputCostUSD   float64 // Prompt cost of the messages whose cost is split
+	OutputCostUSD  float64 // Completion cost of the messages whose cost is split
+	SplitTotalCost float64 // Total cost of the messages whose cost is split
+}
+
+// GetConversationCostBreakdown sums a conversation's total, input and output message costs
+func GetConversationCostBreakdown(convID string) (*CostBreakdown, error) {
+	db := GetDB()
+
+	query := `
+	SELECT COALESCE(SUM(total_cost), 0),
+	       COALESCE(SUM(input_cost_usd) FILTER (WHERE split), 0),
+	       COALESCE(SUM(output_cost_usd) FILTER (WHERE split), 0),
+	       COALESCE(SUM(total_cost) FILTER (WHERE split), 0)
+	FROM (
+		SELECT total_cost, input_cost_usd, output_cost_usd,
+		       total_cost IS NOT NULL AND input_cost_usd IS NOT NULL AND output_cost_usd IS NOT NULL AS split
+		FROM messages
+		WHERE conversation_id = $1 AND deleted_at IS NULL
+	) m
+	`
+
+	var breakdown CostBreakdown
+	err := db.QueryRow(query, convID).Scan(&breakdown.TotalCost, &breakdown.InputCostUSD, &breakdown.OutputCostUSD, &breakdown.SplitTotalCost)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving conversation cost: %w", err)
+	}
+
+	return &breakdown, nil
+}
+
+// CountMessages returns the number of complete messages in a conversation
+func CountMessages(conversationID string) (int, error) {
+	db := GetDB()
+
+	var count int
+	query := `SELECT COUNT(*) FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE`
+	if err := db.QueryRow(query, conversationID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetMessageCountByRole counts the messages of a conversation grouped by role
+func GetMessageCountByRole(convID string) (map[string]int, error) {
+	db := GetDB()
+
+	query := `SELECT role, COUNT(*) FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL GROUP BY role`
+
+	rows, err := db.Query(query, convID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting messages by role: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var role string
+		var count int
+		if err := rows.Scan(&role, &count); err != nil {
+			return nil, fmt.Errorf("error scanning message count: %w", err)
+		}
+		counts[role] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error counting messages by role: %w", err)
+	}
+
+	return counts, nil
+}
+
+// AddMessage adds a message to a conversation. parentMessageID links it to the message it replies to
+// in a branch discussion; an empty ID leaves it on the main thread.
+func AddMessage(conversationID string, role, content, model string, temperature *float64, seed *int, provider string, generationID string, promptTokens, completionTokens, totalTokens *int, totalCost, inputCost, outputCost *float64, latency, generationTime, responseTimeMs *int, parentMessageID string) (*Message, error) {
+	defer metrics.ObserveDBQuery("add_message", time.Now())
+	db := GetDB()
+
+	msgID := uuid.New().String()
+	var createdAt time.Time
+
+	query := `
+	INSERT INTO messages (id, conversation_id, role, content, model, temperature, seed, provider, generation_id, prompt_tokens, completion_tokens, total_tokens, total_cost, input_cost_usd, output_cost_usd, latency, generation_time, response_time_ms, parent_message_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, NULLIF($19, '')::uuid)
+	RETURNING id, created_at
+	`
+
+	err := db.QueryRow(query, msgID, conversationID, role, content, model, temperature, seed, provider, generationID, promptTokens, completionTokens, totalTokens, totalCost, inputCost, outputCost, latency, generationTime, responseTimeMs, parentMessageID).Scan(&msgID, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("error adding message: %w", err)
+	}
+
+	// Update conversation updated_at timestamp
+	updateQuery := `UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := db.Exec(updateQuery, conversationID); err != nil {
+		log.Printf("[DB] Warning: error updating conversation timestamp: %v", err)
+	}
+	invalidateConversation(conversationID)
+
+	tempStr := "nil"
+	if temperature != nil {
+		tempStr = fmt.Sprintf("%.2f", *temperature)
+	}
+	tokensStr := "nil"
+	if totalTokens != nil {
+		tokensStr = fmt.Sprintf("%d", *totalTokens)
+	}
+	costStr := "nil"
+	if totalCost != nil {
+		costStr = fmt.Sprintf("$%.6f", *totalCost)
+	}
+	latencyStr := "nil"
+	if latency != nil {
+		latencyStr = fmt.Sprintf("%dms", *latency)
+	}
+	genTimeStr := "nil"
+	if generationTime != nil {
+		genTimeStr = fmt.Sprintf("%dms", *generationTime)
+	}
+	providerStr := provider
+	if providerStr == "" {
+		providerStr = "unknown"
+	}
+	var parent *string
+	if parentMessageID != "" {
+		parent = &parentMessageID
+	}
+
+	log.Printf("[DB] Added message to conversation %s with provider %s, model %s, temperature %s, tokens %s, cost %s, latency %s, generation_time %s", conversationID, providerStr, model, tempStr, tokensStr, costStr, latencyStr, genTimeStr)
+
+	return &Message{
+		ID:               msgID,
+		ConversationID:   conversationID,
+		Role:             role,
+		Content:          content,
+		Model:            model,
+		Temperature:      temperature,
+		Seed:             seed,
+		Provider:         provider,
+		GenerationID:     generationID,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      totalTokens,
+		TotalCost:        totalCost,
+		InputCostUSD:     inputCost,
+		OutputCostUSD:    outputCost,
+		Latency:          latency,
+		GenerationTime:   generationTime,
+		ResponseTimeMs:   responseTimeMs,
+		ParentMessageID:  parent,
+		CreatedAt:        createdAt,
+	}, nil
+}
+
+// DeleteMessage permanently deletes a message and its attachment records. It undoes AddMessage when
+// the rest of the message, such as its attachments, could not be saved.
+func DeleteMessage(messageID string) error {
+	db := GetDB()
+
+	if _, err := db.Exec(`DELETE FROM messages WHERE id = $1`, messageID); err != nil {
+		return fmt.Errorf("error deleting message: %w", err)
+	}
+
+	log.Printf("[DB] Deleted message %s", messageID)
+	return nil
+}
+
+// UpsertPartialMessage checkpoints the content of a message that is still being streamed
+func UpsertPartialMessage(msgID, conversationID, role, partialContent string) error {
+	db := GetDB()
+
+	query := `
+	INSERT INTO messages (id, conversation_id, role, content, partial)
+	VALUES ($1, $2, $3, $4, TRUE)
+	ON CONFLICT (id) DO UPDATE SET content = EXCLUDED.content
+	`
+
+	if _, err := db.Exec(query, msgID, conversationID, role, partialContent); err != nil {
+		return fmt.Errorf("error checkpointing partial message: %w", err)
+	}
+
+	log.Printf("[DB] Checkpointed partial message %s (%d bytes)", msgID, len(partialContent))
+	return nil
+}
+
+// FinalizeMessage stores the complete content and metadata of a checkpointed message and clears its partial flag
+func FinalizeMessage(msgID string, finalContent string, model string, temperature *float64, seed *int, provider string, generationID string, promptTokens, completionTokens, totalTokens *int, totalCost, inputCost, outputCost *float64, latency, generationTime, responseTimeMs *int) error {
+	defer metrics.ObserveDBQuery("finalize_message", time.Now())
+	db := GetDB()
+
+	query := `
+	UPDATE messages
+	SET content = $2, model = $3, temperature = $4, seed = $5, provider = $6, generation_id = $7, prompt_tokens = $8,
+	    completion_tokens = $9, total_tokens = $10, total_cost = $11, input_cost_usd = $12, output_cost_usd = $13, latency = $14,
+	    generation_time = $15, response_time_ms = $16, partial = FALSE
+	WHERE id = $1
+	RETURNING conversation_id
+	`
+
+	var conversationID string
+	err := db.QueryRow(query, msgID, finalContent, model, temperature, seed, provider, generationID, promptTokens, completionTokens, totalTokens, totalCost, inputCost, outputCost, latency, generationTime, responseTimeMs).Scan(&conversationID)
+	if err != nil {
+		return fmt.Errorf("error finalizing message: %w", err)
+	}
+
+	// Update conversation updated_at timestamp
+	updateQuery := `UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := db.Exec(updateQuery, conversationID); err != nil {
+		log.Printf("[DB] Warning: error updating conversation timestamp: %v", err)
+	}
+	invalidateConversation(conversationID)
+
+	log.Printf("[DB] Finalized message %s in conversation %s", msgID, conversationID)
+	return nil
+}
+
+// GetPartialMessages retrieves messages whose streaming never completed (e.g. interrupted by a restart)
+func GetPartialMessages(conversationID string) ([]Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND partial = TRUE AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying partial messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// GetConversationMessages retrieves all messages from a conversation in LLM format.
+// Partial checkpoints of responses still being streamed are not part of the history.
+func GetConversationMessages(conversationID string) ([]llm.Message, error) {
+	defer metrics.ObserveDBQuery("get_conversation_messages", time.Now())
+	db := GetDB()
+
+	query := `
+	SELECT role, content
+	FROM messages
+	WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []llm.Message
+	for rows.Next() {
+		var role, content string
+		if err := rows.Scan(&role, &content); err != nil {
+			return nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		messages = append(messages, llm.Message{
+			Role:    role,
+			Content: content,
+		})
+	}
+
+	return messages, nil
+}
+
+// GetConversationMessagesWithDetails retrieves all messages with full details for frontend display
+func GetConversationMessagesWithDetails(conversationID string) ([]Message, error) {
+	defer metrics.ObserveDBQuery("get_conversation_messages_with_details", time.Now())
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// GetMessagesAfterTimestamp retrieves the messages of a conversation created after the given time, oldest first
+func GetMessagesAfterTimestamp(conversationID string, since time.Time) ([]Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages after timestamp: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// SearchMessages finds a conversation's messages containing query (case-insensitive), oldest first
+func SearchMessages(conversationID, query string, limit int) ([]Message, error) {
+	db := GetDB()
+
+	// Escape LIKE wildcards so the query is matched literally
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+
+	sqlQuery := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND content ILIKE $2 AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	LIMIT $3
+	`
+
+	rows, err := db.Query(sqlQuery, conversationID, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// HeadlineStartSel and HeadlineStopSel delimit the matched words in a MessageSearchResult headline.
+// They are private-use characters, so unlike HTML tags they cannot be confused with message text.
+const (
+	HeadlineStartSel = "\uE000"
+	HeadlineStopSel  = "\uE001"
+)
+
+// headlineOptions limits a search headline to one fragment of the message around its best match
+var headlineOptions = "StartSel=" + HeadlineStartSel + ", StopSel=" + HeadlineStopSel + ", MaxFragments=1, MaxWords=20, MinWords=10"
+
+// MessageSearchResult is a message matching a search together with the conversation it belongs to
+type MessageSearchResult struct {
+	Message
+	Conversation Conversation
+	Headline     string // Excerpt of the message with matched words between HeadlineStartSel and HeadlineStopSel
+}
+
+// SearchUserMessages runs a full-text search over the messages of a user's non-archived conversations,
+// optionally limited to one conversation, and returns a page of matches ordered by relevance
+func SearchUserMessages(userID, query string, conversationID *string, limit, offset int) ([]MessageSearchResult, error) {
+	defer metrics.ObserveDBQuery("search_user_messages", time.Now())
+	db := GetDB()
+
+	sqlQuery := `
+	SELECT ` + messageDetailsColumns + `,
+	       ts_headline('simple', translate(content, $6, ''), plainto_tsquery('simple', $2), $7)
+	FROM (
+		SELECT m.*, ts_rank(to_tsvector('simple', m.content), q.query) AS rank
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id, plainto_tsquery('simple', $2) AS q(query)
+		WHERE c.user_id = $1 AND c.archived_at IS NULL AND m.deleted_at IS NULL
+		  AND ($3::uuid IS NULL OR m.conversation_id = $3)
+		  AND to_tsvector('simple', m.content) @@ q.query
+	) matched
+	ORDER BY rank DESC, created_at DESC
+	LIMIT $4 OFFSET $5
+	`
+
+	// The delimiters are stripped from the content so only ts_headline can introduce them
+	rows, err := db.Query(sqlQuery, userID, query, conversationID, limit, offset,
+		HeadlineStartSel+HeadlineStopSel, headlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []MessageSearchResult
+	for rows.Next() {
+		var result MessageSearchResult
+		if err := rows.Scan(append(messageDetailsFields(&result.Message), &result.Headline)...); err != nil {
+			return nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+	rows.Close()
+
+	conversations := make(map[string]*Conversation)
+	for i := range results {
+		convID := results[i].ConversationID
+		conv, ok := conversations[convID]
+		if !ok {
+			conv, err = GetConversation(convID)
+			if err != nil {
+				return nil, err
+			}
+			conversations[convID] = conv
+		}
+		results[i].Conversation = *conv
+	}
+
+	return results, nil
+}
+
+// GetMessage retrieves a single message with full details
+func GetMessage(messageID string) (*Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	rows, err := db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessageDetails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &messages[0], nil
+}
+
+// GetMessagesBetween retrieves complete messages with full details after one message (exclusive) up to another (inclusive).
+// A nil afterMessageID starts from the beginning of the conversation, a nil upToMessageID runs to its end.
+func GetMessagesBetween(conversationID string, afterMessageID, upToMessageID *string) ([]Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE
+	  AND ($2::uuid IS NULL OR created_at > (SELECT created_at FROM messages WHERE id = $2))
+	  AND ($3::uuid IS NULL OR created_at <= (SELECT created_at FROM messages WHERE id = $3))
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID, afterMessageID, upToMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages between: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// messageDetailsColumns lists the message columns scanned by scanMessageDetails
+const messageDetailsColumns = `id, conversation_id, role, content, COALESCE(model, ''), temperature, seed, COALESCE(provider, ''),
+	       COALESCE(generation_id, ''), prompt_tokens, completion_tokens, total_tokens, total_cost, input_cost_usd, output_cost_usd, latency, generation_time,
+	       response_time_ms, parent_message_id, COALESCE(partial, FALSE), COALESCE(system_prompt_hash, ''), edited_at, created_at`
+
+// messageDetailsFields returns the scan destinations in msg for messageDetailsColumns
+func messageDetailsFields(msg *Message) []any {
+	return []any{&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.Model, &msg.Temperature, &msg.Seed, &msg.Provider,
+		&msg.GenerationID, &msg.PromptTokens, &msg.CompletionTokens, &msg.TotalTokens, &msg.TotalCost, &msg.InputCostUSD, &msg.OutputCostUSD, &msg.Latency, &msg.GenerationTime,
+		&msg.ResponseTimeMs, &msg.ParentMessageID, &msg.Partial, &msg.SystemPromptHash, &msg.EditedAt, &msg.CreatedAt}
+}
+
+// scanMessageDetails scans rows selected with messageDetailsColumns into messages
+func scanMessageDetails(rows *sql.Rows) ([]Message, error) {
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(messageDetailsFields(&msg)...); err != nil {
+			return nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// ErrNotAssistantMessage is returned when an operation that requires an assistant message is given another role
+var ErrNotAssistantMessage = errors.New("message is not an assistant message")
+
+// GetMessageSiblings returns the assistant messages answering the same user turn as the given assistant
+// message, i.e. those created between the preceding user message and the next one, oldest first
+func GetMessageSiblings(msgID string) ([]Message, error) {
+	message, err := GetMessage(msgID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Role != "assistant" {
+		return nil, ErrNotAssistantMessage
+	}
+
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND role = 'assistant' AND deleted_at IS NULL
+	  AND created_at > COALESCE((SELECT MAX(created_at) FROM messages WHERE conversation_id = $1 AND role = 'user' AND deleted_at IS NULL AND created_at < $2), '-infinity'::timestamp)
+	  AND created_at < COALESCE((SELECT MIN(created_at) FROM messages WHERE conversation_id = $1 AND role = 'user' AND deleted_at IS NULL AND created_at > $2), 'infinity'::timestamp)
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, message.ConversationID, message.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message siblings: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// GetLastMessageByConversation retrieves the latest message with the given role in a conversation,
+// or nil if there is none
+func GetLastMessageByConversation(conversationID, role string) (*Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND role = $2 AND deleted_at IS NULL
+	ORDER BY created_at DESC
+	LIMIT 1
+	`
+
+	rows, err := db.Query(query, conversationID, role)
+	if err != nil {
+		return nil, fmt.Errorf("error querying last message: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessageDetails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	return &messages[0], nil
+}
+
+// GetChildMessages retrieves the direct replies to a message within a conversation
+func GetChildMessages(conversationID, parentMessageID string) ([]Message, error) {
+	db := GetDB()
+
+	query := `
+	SELECT ` + messageDetailsColumns + `
+	FROM messages
+	WHERE conversation_id = $1 AND parent_message_id = $2 AND deleted_at IS NULL
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, conversationID, parentMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying child messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessageDetails(rows)
+}
+
+// SetMessageRawPrompt stores the exact prompt messages that were sent to the LLM for a message
+func SetMessageRawPrompt(msgID string, prompt []llm.Message) error {
+	db := GetDB()
+
+	promptJSON, err := json.Marshal(prompt)
+	if err != nil {
+		return fmt.Errorf("error encoding raw prompt: %w", err)
+	}
+
+	if _, err := db.Exec(`UPDATE messages SET full_prompt = $1 WHERE id = $2`, string(promptJSON), msgID); err != nil {
+		return fmt.Errorf("error storing raw prompt: %w", err)
+	}
+	return nil
+}
+
+// ContentHash returns the hex-encoded SHA-256 of message content
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetMessageContentHash records the checksum of a message's content as sent to the client
+func SetMessageContentHash(msgID, hash string) error {
+	db := GetDB()
+
+	if _, err := db.Exec(`UPDATE messages SET content_hash = $1 WHERE id = $2`, hash, msgID); err != nil {
+		return fmt.Errorf("error storing content hash: %w", err)
+	}
+	return nil
+}
+
+// SetMessageSystemPromptHash records the hash of the system prompt an assistant message was generated with
+func SetMessageSystemPromptHash(msgID, hash string) error {
+	db := GetDB()
+
+	if _, err := db.Exec(`UPDATE messages SET system_prompt_hash = $1 WHERE id = $2`, hash, msgID); err != nil {
+		return fmt.Errorf("error storing system prompt hash: %w", err)
+	}
+	return nil
+}
+
+// GetSystemPromptChangePoints returns the IDs of the messages whose system prompt hash differs from
+// that of the previous hashed message in the conversation, oldest first
+func GetSystemPromptChangePoints(convID string) ([]string, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id FROM (
+		SELECT id, created_at, system_prompt_hash,
+		       LAG(system_prompt_hash) OVER (ORDER BY created_at) AS previous_hash
+		FROM messages
+		WHERE conversation_id = $1 AND system_prompt_hash IS NOT NULL AND deleted_at IS NULL
+	) hashed
+	WHERE previous_hash IS NOT NULL AND previous_hash <> system_prompt_hash
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query, convID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying system prompt changes: %w", err)
+	}
+	defer rows.Close()
+
+	msgIDs := []string{}
+	for rows.Next() {
+		var msgID string
+		if err := rows.Scan(&msgID); err != nil {
+			return nil, fmt.Errorf("error scanning message ID: %w", err)
+		}
+		msgIDs = append(msgIDs, msgID)
+	}
+
+	return msgIDs, rows.Err()
+}
+
+// VerifyMessageIntegrity recomputes a message's content hash and compares it with the stored one.
+// It returns sql.ErrNoRows if the message has no stored hash.
+func VerifyMessageIntegrity(msgID string) (bool, error) {
+	db := GetDB()
+
+	var content string
+	var storedHash sql.NullString
+	if err := db.QueryRow(`SELECT content, content_hash FROM messages WHERE id = $1`, msgID).Scan(&content, &storedHash); err != nil {
+		return false, err
+	}
+	if !storedHash.Valid {
+		return false, sql.ErrNoRows
+	}
+
+	return ContentHash(content) == storedHash.String, nil
+}
+
+// GetMessageRawPrompt retrieves the prompt messages stored for a message.
+// It returns sql.ErrNoRows if the message has no stored prompt.
+func GetMessageRawPrompt(msgID string) ([]llm.Message, error) {
+	db := GetDB()
+
+	var promptJSON sql.NullString
+	if err := db.QueryRow(`SELECT full_prompt FROM messages WHERE id = $1`, msgID).Scan(&promptJSON); err != nil {
+		return nil, err
+	}
+	if !promptJSON.Valid {
+		return nil, sql.ErrNoRows
+	}
+
+	var prompt []llm.Message
+	if err := json.Unmarshal([]byte(promptJSON.String), &prompt); err != nil {
+		return nil, fmt.Errorf("error decoding raw prompt: %w", err)
+	}
+	return prompt, nil
+}
+
+// SetConversationStarred stars or unstars a user's conversation without touching updated_at.
+// Starring an already starred conversation keeps its original starred_at.
+func SetConversationStarred(convID, userID string, starred bool) error {
+	db := GetDB()
+
+	query := `
+	UPDATE conversations
+	SET starred_at = CASE WHEN $3 THEN COALESCE(starred_at, CURRENT_TIMESTAMP) ELSE NULL END
+	WHERE id = $1 AND user_id = $2
+	`
+	result, err := db.Exec(query, convID, userID, starred)
+	if err != nil {
+		return fmt.Errorf("error updating starred state: %w", err)
+	}
+	invalidateConversation(convID)
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+
+	log.Printf("[DB] Set starred=%t for conversation: %s", starred, convID)
+	return nil
+}
+
+// UpdateConversationFormat changes a conversation's response format and schema and, in the same transaction,
+// deletes its active summary, which was written for the previous format. The conversation's reference is
+// cleared by the foreign key, so later requests use the full history until a new summary is created.
+func UpdateConversationFormat(convID, format, schema string) error {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE conversations SET response_format = $1, response_schema = $2 WHERE id = $3`
+	result, err := tx.Exec(query, format, schema, convID)
+	if err != nil {
+		return fmt.Errorf("error updating conversation format: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+
+	if err := deleteActiveSummary(tx, convID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	invalidateConversation(convID)
+
+	log.Printf("[DB] Updated format for conversation %s to %s", convID, format)
+	return nil
+}
+
+// deleteActiveSummary deletes a conversation's active summary with db, which may be a transaction.
+// The conversation's reference is cleared by the foreign key.
+func deleteActiveSummary(db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, convID string) error {
+	query := `DELETE FROM conversation_summaries WHERE id = (SELECT active_summary_id FROM conversations WHERE id = $1)`
+	result, err := db.Exec(query, convID)
+	if err != nil {
+		return fmt.Errorf("error deleting active summary: %w", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		log.Printf("[DB] Deleted active summary for conversation %s", convID)
+	}
+	return nil
+}
+
+// UpdateConversationTitle replaces a conversation's title and records when it was generated
+func UpdateConversationTitle(convID, title string) error {
+	db := GetDB()
+
+	query := `UPDATE conversations SET title = $1, title_generated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := db.Exec(query, title, convID)
+	if err != nil {
+		return fmt.Errorf("error updating conversation title: %w", err)
+	}
+	invalidateConversation(convID)
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+
+	log.Printf("[DB] Updated title for conversation %s: %s", convID, title)
+	return nil
+}
+
+// DeleteConversation archives a conversation. It disappears from the user's conversation lists and can be
+// brought back with RestoreConversation until PurgeArchivedConversations deletes it permanently.
+func DeleteConversation(convID string) error {
+	db := GetDB()
+
+	query := `UPDATE conversations SET archived_at = NOW() WHERE id = $1 AND archived_at IS NULL`
+	_, err := db.Exec(query, convID)
+	if err != nil {
+		return fmt.Errorf("error archiving conversation: %w", err)
+	}
+	invalidateConversation(convID)
+
+	log.Printf("[DB] Archived conversation: %s", convID)
+	return nil
+}
+
+// RestoreConversation brings back an archived conversation
+func RestoreConversation(convID string) error {
+	db := GetDB()
+
+	query := `UPDATE conversations SET archived_at = NULL WHERE id = $1 AND archived_at IS NOT NULL`
+	result, err := db.Exec(query, convID)
+	if err != nil {
+		return fmt.Errorf("error restoring conversation: %w", err)
+	}
+	invalidateConversation(convID)
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("conversation not archived")
+	}
+
+	log.Printf("[DB] Restored conversation: %s", convID)
+	return nil
+}
+
+// GetArchivedConversationsByUser retrieves a user's archived conversations, most recently archived first
+func GetArchivedConversationsByUser(userID string) ([]Conversation, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), starred_at, COALESCE(color, ''), archived_at, created_at, updated_at
+	FROM conversations
+	WHERE user_id = $1 AND archived_at IS NOT NULL
+	ORDER BY archived_at DESC
 	`
 
 	rows, err := db.Query(query, userID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying conversations: %w", err)
+		return nil, fmt.Errorf("error querying archived conversations: %w", err)
 	}
 	defer rows.Close()
 
 	var conversations []Conversation
 	for rows.Next() {
 		var conv Conversation
-		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.StarredAt, &conv.Color, &conv.ArchivedAt, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("error scanning conversation: %w", err)
 		}
 		conversations = append(conversations, conv)
@@ -115,169 +1330,166 @@ func GetConversationsByUser(userID string) ([]Conversation, error) {
 	return conversations, nil
 }
 
-// GetConversation retrieves a specific conversation
-func GetConversation(convID string) (*Conversation, error) {
+// PurgeArchivedConversations permanently deletes conversations archived longer than olderThan ago,
+// together with their messages and export jobs. It returns the IDs of the deleted conversations and
+// the export files of their jobs.
+func PurgeArchivedConversations(olderThan time.Duration) ([]string, []string, error) {
 	db := GetDB()
 
-	var conv Conversation
+	// Sub-statements share one snapshot, so the export jobs removed by the cascade are still visible
 	query := `
-	SELECT id, user_id, title, COALESCE(response_format, 'text'), COALESCE(response_schema, ''), active_summary_id, created_at, updated_at
-	FROM conversations
-	WHERE id = $1
+	WITH purged AS (
+		DELETE FROM conversations
+		WHERE archived_at IS NOT NULL AND archived_at < NOW() - make_interval(secs => $1)
+		RETURNING id
+	)
+	SELECT p.id, COALESCE(e.file_path, '')
+	FROM purged p
+	LEFT JOIN export_jobs e ON e.conversation_id = p.id
 	`
 
-	err := db.QueryRow(query, convID).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.ResponseFormat, &conv.ResponseSchema, &conv.ActiveSummaryID, &conv.CreatedAt, &conv.UpdatedAt)
+	rows, err := db.Query(query, olderThan.Seconds())
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving conversation: %w", err)
+		return nil, nil, fmt.Errorf("error purging archived conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var purged, exportFiles []string
+	for rows.Next() {
+		var convID, filePath string
+		if err := rows.Scan(&convID, &filePath); err != nil {
+			return purged, exportFiles, fmt.Errorf("error scanning purged conversation: %w", err)
+		}
+		if !slices.Contains(purged, convID) {
+			invalidateConversation(convID)
+			purged = append(purged, convID)
+		}
+		if filePath != "" {
+			exportFiles = append(exportFiles, filePath)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return purged, exportFiles, fmt.Errorf("error purging archived conversations: %w", err)
 	}
 
-	return &conv, nil
+	if len(purged) > 0 {
+		log.Printf("[DB] Purged %d archived conversations", len(purged))
+	}
+	return purged, exportFiles, nil
 }
 
-// AddMessage adds a message to a conversation
-func AddMessage(conversationID string, role, content, model string, temperature *float64, provider string, generationID string, promptTokens, completionTokens, totalTokens *int, totalCost *float64, latency, generationTime *int) (*Message, error) {
+// ClearConversationMessages soft-deletes all messages of a conversation and deletes its summaries while
+// keeping the conversation itself. Cleared messages can be brought back with RestoreConversationMessages.
+// It returns the number of cleared messages and deleted summaries.
+func ClearConversationMessages(convID string) (int64, int64, error) {
 	db := GetDB()
 
-	msgID := uuid.New().String()
-	var createdAt time.Time
-
-	query := `
-	INSERT INTO messages (id, conversation_id, role, content, model, temperature, provider, generation_id, prompt_tokens, completion_tokens, total_tokens, total_cost, latency, generation_time)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-	RETURNING id, created_at
-	`
-
-	err := db.QueryRow(query, msgID, conversationID, role, content, model, temperature, provider, generationID, promptTokens, completionTokens, totalTokens, totalCost, latency, generationTime).Scan(&msgID, &createdAt)
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("error adding message: %w", err)
+		return 0, 0, fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Update conversation updated_at timestamp
-	updateQuery := `UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`
-	if _, err := db.Exec(updateQuery, conversationID); err != nil {
-		log.Printf("[DB] Warning: error updating conversation timestamp: %v", err)
+	if _, err := tx.Exec(`UPDATE conversations SET active_summary_id = NULL WHERE id = $1`, convID); err != nil {
+		return 0, 0, fmt.Errorf("error resetting active summary: %w", err)
 	}
 
-	tempStr := "nil"
-	if temperature != nil {
-		tempStr = fmt.Sprintf("%.2f", *temperature)
-	}
-	tokensStr := "nil"
-	if totalTokens != nil {
-		tokensStr = fmt.Sprintf("%d", *totalTokens)
+	result, err := tx.Exec(`DELETE FROM conversation_summaries WHERE conversation_id = $1`, convID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error deleting summaries: %w", err)
 	}
-	costStr := "nil"
-	if totalCost != nil {
-		costStr = fmt.Sprintf("$%.6f", *totalCost)
+	clearedSummaries, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error counting deleted summaries: %w", err)
 	}
-	latencyStr := "nil"
-	if latency != nil {
-		latencyStr = fmt.Sprintf("%dms", *latency)
+
+	result, err = tx.Exec(`UPDATE messages SET deleted_at = NOW() WHERE conversation_id = $1 AND deleted_at IS NULL`, convID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error clearing messages: %w", err)
 	}
-	genTimeStr := "nil"
-	if generationTime != nil {
-		genTimeStr = fmt.Sprintf("%dms", *generationTime)
+	clearedMessages, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error counting cleared messages: %w", err)
 	}
-	providerStr := provider
-	if providerStr == "" {
-		providerStr = "unknown"
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("error committing transaction: %w", err)
 	}
-	log.Printf("[DB] Added message to conversation %s with provider %s, model %s, temperature %s, tokens %s, cost %s, latency %s, generation_time %s", conversationID, providerStr, model, tempStr, tokensStr, costStr, latencyStr, genTimeStr)
+	invalidateConversation(convID)
 
-	return &Message{
-		ID:               msgID,
-		ConversationID:   conversationID,
-		Role:             role,
-		Content:          content,
-		Model:            model,
-		Temperature:      temperature,
-		Provider:         provider,
-		GenerationID:     generationID,
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      totalTokens,
-		TotalCost:        totalCost,
-		Latency:          latency,
-		GenerationTime:   generationTime,
-		CreatedAt:        createdAt,
-	}, nil
+	log.Printf("[DB] Cleared %d messages and %d summaries from conversation %s", clearedMessages, clearedSummaries, convID)
+	return clearedMessages, clearedSummaries, nil
 }
 
-// GetConversationMessages retrieves all messages from a conversation in LLM format
-func GetConversationMessages(conversationID string) ([]llm.Message, error) {
+// RestoreConversationMessages brings back the soft-deleted messages of a conversation and returns how many were restored
+func RestoreConversationMessages(convID string) (int64, error) {
 	db := GetDB()
 
-	query := `
-	SELECT role, content
-	FROM messages
-	WHERE conversation_id = $1
-	ORDER BY created_at ASC
-	`
-
-	rows, err := db.Query(query, conversationID)
+	result, err := db.Exec(`UPDATE messages SET deleted_at = NULL WHERE conversation_id = $1 AND deleted_at IS NOT NULL`, convID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying messages: %w", err)
+		return 0, fmt.Errorf("error restoring messages: %w", err)
 	}
-	defer rows.Close()
-
-	var messages []llm.Message
-	for rows.Next() {
-		var role, content string
-		if err := rows.Scan(&role, &content); err != nil {
-			return nil, fmt.Errorf("error scanning message: %w", err)
-		}
-		messages = append(messages, llm.Message{
-			Role:    role,
-			Content: content,
-		})
+	restored, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error counting restored messages: %w", err)
 	}
+	invalidateConversation(convID)
 
-	return messages, nil
+	log.Printf("[DB] Restored %d messages in conversation %s", restored, convID)
+	return restored, nil
 }
 
-// GetConversationMessagesWithDetails retrieves all messages with full details for frontend display
-func GetConversationMessagesWithDetails(conversationID string) ([]Message, error) {
+// PurgeConversation permanently deletes the soft-deleted messages of a conversation, together with
+// their feedback and attachment records. It returns how many messages were removed and the storage
+// keys of their attachments, whose files the caller removes.
+func PurgeConversation(convID string) (int64, []string, error) {
 	db := GetDB()
 
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-	SELECT id, conversation_id, role, content, COALESCE(model, ''), temperature, COALESCE(provider, ''),
-	       COALESCE(generation_id, ''), prompt_tokens, completion_tokens, total_tokens, total_cost, latency, generation_time, created_at
-	FROM messages
-	WHERE conversation_id = $1
-	ORDER BY created_at ASC
+	SELECT a.storage_key
+	FROM message_attachments a
+	JOIN messages m ON m.id = a.message_id
+	WHERE m.conversation_id = $1 AND m.deleted_at IS NOT NULL
 	`
-
-	rows, err := db.Query(query, conversationID)
+	rows, err := tx.Query(query, convID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying messages: %w", err)
+		return 0, nil, fmt.Errorf("error querying purged attachments: %w", err)
 	}
-	defer rows.Close()
-
-	var messages []Message
+	var storageKeys []string
 	for rows.Next() {
-		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.Model, &msg.Temperature, &msg.Provider,
-			&msg.GenerationID, &msg.PromptTokens, &msg.CompletionTokens, &msg.TotalTokens, &msg.TotalCost, &msg.Latency, &msg.GenerationTime, &msg.CreatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning message: %w", err)
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("error scanning purged attachment: %w", err)
 		}
-		messages = append(messages, msg)
+		storageKeys = append(storageKeys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("error querying purged attachments: %w", err)
 	}
 
-	return messages, nil
-}
-
-// DeleteConversation deletes a conversation and all its messages
-func DeleteConversation(convID string) error {
-	db := GetDB()
-
-	query := `DELETE FROM conversations WHERE id = $1`
-	_, err := db.Exec(query, convID)
+	result, err := tx.Exec(`DELETE FROM messages WHERE conversation_id = $1 AND deleted_at IS NOT NULL`, convID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error purging messages: %w", err)
+	}
+	purged, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error deleting conversation: %w", err)
+		return 0, nil, fmt.Errorf("error counting purged messages: %w", err)
 	}
 
-	log.Printf("[DB] Deleted conversation: %s", convID)
-	return nil
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	log.Printf("[DB] Purged %d deleted messages from conversation %s", purged, convID)
+	return purged, storageKeys, nil
 }
 
 // CreateSummary creates a new conversation summary
@@ -310,17 +1522,109 @@ func CreateSummary(conversationID string, summaryContent string, summarizedUpToM
 	}, nil
 }
 
-// GetActiveSummary retrieves the most recent summary for a conversation
+// TransactionalSummarize creates a summary and makes it the conversation's active summary in a single
+// transaction, so the conversation never points at a summary that was not saved
+func TransactionalSummarize(convID string, summaryContent string, lastMsgID *string) (*ConversationSummary, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary := ConversationSummary{
+		ID:                      uuid.New().String(),
+		ConversationID:          convID,
+		SummaryContent:          summaryContent,
+		SummarizedUpToMessageID: lastMsgID,
+	}
+
+	query := `
+	INSERT INTO conversation_summaries (id, conversation_id, summary_content, summarized_up_to_message_id, usage_count)
+	VALUES ($1, $2, $3, $4, 0)
+	RETURNING created_at
+	`
+
+	if err := tx.QueryRow(query, summary.ID, convID, summaryContent, lastMsgID).Scan(&summary.CreatedAt); err != nil {
+		return nil, fmt.Errorf("error creating summary: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE conversations SET active_summary_id = $1 WHERE id = $2`, summary.ID, convID); err != nil {
+		return nil, fmt.Errorf("error updating active summary: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	invalidateConversation(convID)
+
+	log.Printf("[DB] Created summary %s and made it active for conversation %s", summary.ID, convID)
+	return &summary, nil
+}
+
+// MergeSummaries stores a summary merged from sourceIDs in one transaction. The conversation's active
+// summary is switched to the merged one only if it was one of the sources, and the sources are deleted
+// if deleteSources is set.
+func MergeSummaries(convID string, summaryContent string, lastMsgID *string, sourceIDs []string, deleteSources bool) (*ConversationSummary, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary := ConversationSummary{
+		ID:                      uuid.New().String(),
+		ConversationID:          convID,
+		SummaryContent:          summaryContent,
+		SummarizedUpToMessageID: lastMsgID,
+	}
+
+	query := `
+	INSERT INTO conversation_summaries (id, conversation_id, summary_content, summarized_up_to_message_id, usage_count)
+	VALUES ($1, $2, $3, $4, 0)
+	RETURNING created_at
+	`
+
+	if err := tx.QueryRow(query, summary.ID, convID, summaryContent, lastMsgID).Scan(&summary.CreatedAt); err != nil {
+		return nil, fmt.Errorf("error creating summary: %w", err)
+	}
+
+	updateQuery := `UPDATE conversations SET active_summary_id = $1 WHERE id = $2 AND active_summary_id = ANY($3)`
+	if _, err := tx.Exec(updateQuery, summary.ID, convID, pq.Array(sourceIDs)); err != nil {
+		return nil, fmt.Errorf("error updating active summary: %w", err)
+	}
+
+	if deleteSources {
+		deleteQuery := `DELETE FROM conversation_summaries WHERE conversation_id = $1 AND id = ANY($2)`
+		if _, err := tx.Exec(deleteQuery, convID, pq.Array(sourceIDs)); err != nil {
+			return nil, fmt.Errorf("error deleting merged summaries: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	invalidateConversation(convID)
+
+	log.Printf("[DB] Merged %d summaries into %s for conversation %s", len(sourceIDs), summary.ID, convID)
+	return &summary, nil
+}
+
+// GetActiveSummary retrieves the summary referenced by the conversation's active_summary_id.
+// It returns sql.ErrNoRows when none is active, e.g. after the active summary was deleted.
 func GetActiveSummary(conversationID string) (*ConversationSummary, error) {
+	defer metrics.ObserveDBQuery("get_active_summary", time.Now())
 	db := GetDB()
 
 	var summary ConversationSummary
 	query := `
-	SELECT id, conversation_id, summary_content, summarized_up_to_message_id, usage_count, created_at
-	FROM conversation_summaries
-	WHERE conversation_id = $1
-	ORDER BY created_at DESC
-	LIMIT 1
+	SELECT s.id, s.conversation_id, s.summary_content, s.summarized_up_to_message_id, s.usage_count, s.created_at
+	FROM conversations c
+	JOIN conversation_summaries s ON s.id = c.active_summary_id
+	WHERE c.id = $1
 	`
 
 	err := db.QueryRow(query, conversationID).Scan(
@@ -335,12 +1639,79 @@ func GetActiveSummary(conversationID string) (*ConversationSummary, error) {
 		return nil, err // Return nil if no summary exists
 	}
 
-	log.Printf("[DB] Retrieved most recent summary %s (created: %s, usage_count: %d) for conversation %s",
+	log.Printf("[DB] Retrieved active summary %s (created: %s, usage_count: %d) for conversation %s",
 		summary.ID, summary.CreatedAt.Format(time.RFC3339), summary.UsageCount, conversationID)
 
 	return &summary, nil
 }
 
+// BatchGetActiveSummaries retrieves the active summary of each given conversation in one query.
+// Conversations without an active summary are absent from the result.
+func BatchGetActiveSummaries(conversationIDs []string) (map[string]*ConversationSummary, error) {
+	summaries := make(map[string]*ConversationSummary)
+	if len(conversationIDs) == 0 {
+		return summaries, nil
+	}
+
+	db := GetDB()
+
+	query := `
+	SELECT s.id, s.conversation_id, s.summary_content, s.summarized_up_to_message_id, s.usage_count, s.created_at
+	FROM conversations c
+	JOIN conversation_summaries s ON s.id = c.active_summary_id
+	WHERE c.id = ANY($1)
+	`
+
+	rows, err := db.Query(query, pq.Array(conversationIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error querying active summaries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary ConversationSummary
+		if err := rows.Scan(
+			&summary.ID,
+			&summary.ConversationID,
+			&summary.SummaryContent,
+			&summary.SummarizedUpToMessageID,
+			&summary.UsageCount,
+			&summary.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning summary: %w", err)
+		}
+		summaries[summary.ConversationID] = &summary
+	}
+
+	return summaries, rows.Err()
+}
+
+// GetSummary retrieves a summary by ID
+func GetSummary(summaryID string) (*ConversationSummary, error) {
+	db := GetDB()
+
+	var summary ConversationSummary
+	query := `
+	SELECT id, conversation_id, summary_content, summarized_up_to_message_id, usage_count, created_at
+	FROM conversation_summaries
+	WHERE id = $1
+	`
+
+	err := db.QueryRow(query, summaryID).Scan(
+		&summary.ID,
+		&summary.ConversationID,
+		&summary.SummaryContent,
+		&summary.SummarizedUpToMessageID,
+		&summary.UsageCount,
+		&summary.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving summary: %w", err)
+	}
+
+	return &summary, nil
+}
+
 // GetAllSummaries retrieves all summaries for a conversation in chronological order
 func GetAllSummaries(conversationID string) ([]ConversationSummary, error) {
 	db := GetDB()
@@ -378,6 +1749,62 @@ func GetAllSummaries(conversationID string) ([]ConversationSummary, error) {
 	return summaries, nil
 }
 
+// SummaryWithMessages pairs a summary with the messages it newly covered
+type SummaryWithMessages struct {
+	Summary  ConversationSummary
+	Messages []llm.Message
+}
+
+// GetConversationSummaryHistory returns every summary of a conversation, oldest first, with the messages
+// after the previous summary's cut-off up to and including its own. Concatenating the message groups
+// reconstructs the conversation up to the latest summary.
+func GetConversationSummaryHistory(conversationID string) ([]SummaryWithMessages, error) {
+	summaries, err := GetAllSummaries(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]SummaryWithMessages, 0, len(summaries))
+	var previousUpTo *string
+	for _, summary := range summaries {
+		entry := SummaryWithMessages{Summary: summary, Messages: []llm.Message{}}
+
+		// A summary without a cut-off message covers nothing new
+		if summary.SummarizedUpToMessageID != nil {
+			messages, err := GetMessagesBetween(conversationID, previousUpTo, summary.SummarizedUpToMessageID)
+			if err != nil {
+				return nil, err
+			}
+			for _, msg := range messages {
+				entry.Messages = append(entry.Messages, llm.Message{Role: msg.Role, Content: msg.Content})
+			}
+			previousUpTo = summary.SummarizedUpToMessageID
+		}
+
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// DeleteSummaries deletes the given summaries of a conversation; a conversation referencing one of them
+// as its active summary has the reference cleared by the foreign key
+func DeleteSummaries(conversationID string, summaryIDs []string) error {
+	db := GetDB()
+
+	query := `DELETE FROM conversation_summaries WHERE conversation_id = $1 AND id = ANY($2)`
+	result, err := db.Exec(query, conversationID, pq.Array(summaryIDs))
+	if err != nil {
+		return fmt.Errorf("error deleting summaries: %w", err)
+	}
+	invalidateConversation(conversationID)
+
+	if rows, err := result.RowsAffected(); err == nil {
+		log.Printf("[DB] Deleted %d summaries for conversation %s", rows, conversationID)
+	}
+	return nil
+}
+
 // UpdateConversationActiveSummary updates the active summary for a conversation
 func UpdateConversationActiveSummary(conversationID string, summaryID string) error {
 	db := GetDB()
@@ -387,6 +1814,7 @@ func UpdateConversationActiveSummary(conversationID string, summaryID string) er
 	if err != nil {
 		return fmt.Errorf("error updating active summary: %w", err)
 	}
+	invalidateConversation(conversationID)
 
 	log.Printf("[DB] Updated active summary for conversation %s to %s", conversationID, summaryID)
 	return nil
@@ -406,14 +1834,15 @@ func IncrementSummaryUsageCount(summaryID string) error {
 	return nil
 }
 
-// GetMessagesAfterMessage retrieves all messages after a specific message ID in a conversation
+// GetMessagesAfterMessage retrieves all complete messages after a specific message ID in a conversation
 func GetMessagesAfterMessage(conversationID string, afterMessageID string) ([]llm.Message, error) {
+	defer metrics.ObserveDBQuery("get_messages_after_message", time.Now())
 	db := GetDB()
 
 	query := `
 	SELECT role, content
 	FROM messages
-	WHERE conversation_id = $1 AND created_at > (
+	WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE AND created_at > (
 		SELECT created_at FROM messages WHERE id = $2
 	)
 	ORDER BY created_at ASC
@@ -440,7 +1869,7 @@ func GetMessagesAfterMessage(conversationID string, afterMessageID string) ([]ll
 	return messages, nil
 }
 
-// GetLastMessageID retrieves the ID of the last message in a conversation
+// GetLastMessageID retrieves the ID of the last complete message in a conversation
 func GetLastMessageID(conversationID string) (*string, error) {
 	db := GetDB()
 
@@ -448,7 +1877,7 @@ func GetLastMessageID(conversationID string) (*string, error) {
 	query := `
 	SELECT id
 	FROM messages
-	WHERE conversation_id = $1
+	WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE
 	ORDER BY created_at DESC
 	LIMIT 1
 	`
@@ -464,3 +1893,18 @@ func GetLastMessageID(conversationID string) (*string, error) {
 	return &messageID, nil
 }
 
+// GetLastMessageTime returns when the latest message of a conversation was created, or nil if it has none
+func GetLastMessageTime(conversationID string) (*time.Time, error) {
+	db := GetDB()
+
+	var createdAt sql.NullTime
+	query := `SELECT MAX(created_at) FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL`
+	if err := db.QueryRow(query, conversationID).Scan(&createdAt); err != nil {
+		return nil, fmt.Errorf("error getting last message time: %w", err)
+	}
+	if !createdAt.Valid {
+		return nil, nil
+	}
+
+	return &createdAt.Time, nil
+}
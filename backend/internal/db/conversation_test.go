@@ -0,0 +1,1096 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"cmp"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var recentConversationColumns = []string{"id", "user_id", "title", "response_format", "response_schema", "starred_at", "color", "created_at", "updated_at"}
+
+func TestGetRecentConversations(t *testing.T) {
+	since := time.Now().Add(-time.Hour)
+
+	t.Run("newest first", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		now := time.Now()
+		mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1 AND archived_at IS NULL AND updated_at > \$2\s+ORDER BY updated_at DESC\s+LIMIT \$3`).
+			WithArgs("u1", since, 10).
+			WillReturnRows(sqlmock.NewRows(recentConversationColumns).
+				AddRow("c2", "u1", "Second", "text", "", nil, "", now, now).
+				AddRow("c1", "u1", "First", "json", "{}", now, "#ff5733", now, now.Add(-time.Minute)))
+
+		conversations, err := db.GetRecentConversations("u1", since)
+		if err != nil {
+			t.Fatalf("GetRecentConversations() error = %v", err)
+		}
+		if len(conversations) != 2 || conversations[0].ID != "c2" || conversations[1].Color != "#ff5733" {
+			t.Errorf("conversations = %+v", conversations)
+		}
+	})
+
+	t.Run("iteration error", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		now := time.Now()
+		mock.ExpectQuery(`FROM conversations`).
+			WithArgs("u1", since, 10).
+			WillReturnRows(sqlmock.NewRows(recentConversationColumns).
+				AddRow("c1", "u1", "First", "text", "", nil, "", now, now).
+				RowError(0, errors.New("connection reset")))
+
+		if conversations, err := db.GetRecentConversations("u1", since); err == nil {
+			t.Fatalf("GetRecentConversations() = %v, want the iteration error", conversations)
+		}
+	})
+}
+
+var conversationWithStatsColumns = []string{"id", "user_id", "title", "response_format", "response_schema", "active_summary_id", "starred_at", "color", "created_at", "updated_at",
+	"message_count", "user_message_count", "assistant_message_count", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost",
+	"costed_message_count", "avg_response_time_ms", "count_by_role"}
+
+func TestGetConversationWithStats(t *testing.T) {
+	now := time.Now()
+
+	t.Run("no messages", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		// The aggregates are coalesced in SQL, so a conversation without messages scans as zeros
+		mock.ExpectQuery(`COALESCE\(s.message_count, 0\).*FROM conversations c\s+LEFT JOIN \(.*WHERE conversation_id = \$1 AND deleted_at IS NULL\s+GROUP BY conversation_id\s+\) s ON s.conversation_id = c.id\s+WHERE c.id = \$1 AND c.archived_at IS NULL`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(conversationWithStatsColumns).
+				AddRow("c1", "u1", "Empty", "text", "", nil, nil, "", now, now, 0, 0, 0, 0, 0, 0, 0.0, 0, nil, []byte(`{}`)))
+
+		conv, err := db.GetConversationWithStats("c1")
+		if err != nil {
+			t.Fatalf("GetConversationWithStats() error = %v", err)
+		}
+		if conv.ConversationStats != (db.ConversationStats{}) {
+			t.Errorf("stats = %+v, want zero values", conv.ConversationStats)
+		}
+		if conv.MessageCountByRole == nil || len(conv.MessageCountByRole) != 0 {
+			t.Errorf("counts by role = %v, want an empty map", conv.MessageCountByRole)
+		}
+	})
+
+	t.Run("several messages", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM conversations c\s+LEFT JOIN`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(conversationWithStatsColumns).
+				AddRow("c1", "u1", "Busy", "text", "", nil, nil, "", now, now, 4, 2, 2, 30, 50, 80, 0.004, 2, 850.5, []byte(`{"user":2,"assistant":2}`)))
+
+		conv, err := db.GetConversationWithStats("c1")
+		if err != nil {
+			t.Fatalf("GetConversationWithStats() error = %v", err)
+		}
+		if conv.MessageCount != 4 || conv.UserMessageCount != 2 || conv.AssistantMessageCount != 2 ||
+			conv.PromptTokens != 30 || conv.CompletionTokens != 50 || conv.TotalTokens != 80 || conv.TotalCost != 0.004 {
+			t.Errorf("stats = %+v", conv.ConversationStats)
+		}
+		if conv.AvgResponseTimeMs == nil || *conv.AvgResponseTimeMs != 850.5 {
+			t.Errorf("average response time = %v, want 850.5", conv.AvgResponseTimeMs)
+		}
+		if conv.MessageCountByRole["user"] != 2 || conv.MessageCountByRole["assistant"] != 2 {
+			t.Errorf("counts by role = %v", conv.MessageCountByRole)
+		}
+	})
+
+	t.Run("missing conversation", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM conversations c\s+LEFT JOIN`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(conversationWithStatsColumns))
+
+		if conv, err := db.GetConversationWithStats("c1"); err == nil {
+			t.Fatalf("GetConversationWithStats() = %+v, want an error", conv)
+		}
+	})
+}
+
+func TestGetPartialMessages(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND partial = TRUE AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+		WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow("m1", "c1", "assistant", "Half an ans")...))
+
+	messages, err := db.GetPartialMessages("c1")
+	if err != nil {
+		t.Fatalf("GetPartialMessages() error = %v", err)
+	}
+	if len(messages) != 1 || messages[0].Content != "Half an ans" {
+		t.Errorf("messages = %+v", messages)
+	}
+}
+
+func TestGetConversationMessagesSkipsPartial(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`SELECT role, content\s+FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL AND partial IS NOT TRUE`).
+		WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "content"}).AddRow("user", "hi"))
+
+	if _, err := db.GetConversationMessages("c1"); err != nil {
+		t.Fatalf("GetConversationMessages() error = %v", err)
+	}
+}
+
+func TestSetConversationStarred(t *testing.T) {
+	// Starring keeps an existing starred_at, so repeated stars are idempotent, and only starred_at is set,
+	// so starring never changes the conversation's position in the updated_at ordering
+	const starQuery = `UPDATE conversations\s+SET starred_at = CASE WHEN \$3 THEN COALESCE\(starred_at, CURRENT_TIMESTAMP\) ELSE NULL END\s+WHERE id = \$1 AND user_id = \$2\s*$`
+
+	tests := []struct {
+		name    string
+		starred bool
+		rows    int64
+		wantErr bool
+	}{
+		{name: "star", starred: true, rows: 1},
+		{name: "unstar", starred: false, rows: 1},
+		{name: "not the user's conversation", starred: true, rows: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectExec(starQuery).
+				WithArgs("c1", "u1", tt.starred).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			if err := db.SetConversationStarred("c1", "u1", tt.starred); (err != nil) != tt.wantErr {
+				t.Errorf("SetConversationStarred() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("starring twice", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		for range 2 {
+			mock.ExpectExec(starQuery).
+				WithArgs("c1", "u1", true).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+
+		for range 2 {
+			if err := db.SetConversationStarred("c1", "u1", true); err != nil {
+				t.Fatalf("SetConversationStarred() error = %v", err)
+			}
+		}
+	})
+}
+
+func TestGetConversationsByUserStarredFilter(t *testing.T) {
+	now := time.Now()
+
+	for _, starredOnly := range []bool{false, true} {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`WHERE user_id = \$1 AND archived_at IS NULL AND \(NOT \$2 OR starred_at IS NOT NULL\)`).
+			WithArgs("u1", starredOnly, nil, nil, 5).
+			WillReturnRows(sqlmock.NewRows(recentConversationColumns).
+				AddRow("c1", "u1", "Bookmarked", "text", "", now, "", now, now))
+
+		conversations, err := db.GetConversationsByUser("u1", starredOnly, 5, nil)
+		if err != nil {
+			t.Fatalf("GetConversationsByUser(starredOnly=%t) error = %v", starredOnly, err)
+		}
+		if len(conversations) != 1 || conversations[0].StarredAt == nil {
+			t.Errorf("GetConversationsByUser(starredOnly=%t) = %+v, want the starred conversation", starredOnly, conversations)
+		}
+	}
+}
+
+func TestGetMessageCountByRole(t *testing.T) {
+	tests := []struct {
+		name string
+		rows *sqlmock.Rows
+		want map[string]int
+	}{
+		{
+			name: "only user messages",
+			rows: sqlmock.NewRows([]string{"role", "count"}).AddRow("user", 3),
+			want: map[string]int{"user": 3},
+		},
+		{
+			name: "user and assistant messages",
+			rows: sqlmock.NewRows([]string{"role", "count"}).AddRow("user", 10).AddRow("assistant", 9),
+			want: map[string]int{"user": 10, "assistant": 9},
+		},
+		{
+			name: "no messages",
+			rows: sqlmock.NewRows([]string{"role", "count"}),
+			want: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectQuery(`SELECT role, COUNT\(\*\) FROM messages WHERE conversation_id = \$1 AND deleted_at IS NULL GROUP BY role`).
+				WithArgs("c1").
+				WillReturnRows(tt.rows)
+
+			counts, err := db.GetMessageCountByRole("c1")
+			if err != nil {
+				t.Fatalf("GetMessageCountByRole() error = %v", err)
+			}
+			if counts == nil || !maps.Equal(counts, tt.want) {
+				t.Errorf("GetMessageCountByRole() = %#v, want %#v", counts, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMessageRawPrompt(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectExec(`UPDATE messages SET full_prompt = \$1 WHERE id = \$2`).
+		WithArgs(`[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]`, "m1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	prompt := []llm.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}
+	if err := db.SetMessageRawPrompt("m1", prompt); err != nil {
+		t.Fatalf("SetMessageRawPrompt() error = %v", err)
+	}
+}
+
+func TestGetMessageRawPrompt(t *testing.T) {
+	const query = `SELECT full_prompt FROM messages WHERE id = \$1`
+
+	t.Run("stored", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(query).
+			WithArgs("m1").
+			WillReturnRows(sqlmock.NewRows([]string{"full_prompt"}).
+				AddRow(`[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]`))
+
+		prompt, err := db.GetMessageRawPrompt("m1")
+		if err != nil {
+			t.Fatalf("GetMessageRawPrompt() error = %v", err)
+		}
+		want := []llm.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}}
+		if !slices.EqualFunc(prompt, want, func(a, b llm.Message) bool { return a.Role == b.Role && a.Content == b.Content }) {
+			t.Errorf("GetMessageRawPrompt() = %+v, want %+v", prompt, want)
+		}
+	})
+
+	t.Run("not stored", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(query).
+			WithArgs("m1").
+			WillReturnRows(sqlmock.NewRows([]string{"full_prompt"}).AddRow(nil))
+
+		if _, err := db.GetMessageRawPrompt("m1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetMessageRawPrompt() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("missing message", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(query).
+			WithArgs("m1").
+			WillReturnRows(sqlmock.NewRows([]string{"full_prompt"}))
+
+		if _, err := db.GetMessageRawPrompt("m1"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetMessageRawPrompt() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestUpdateConversationFormat(t *testing.T) {
+	const (
+		updateQuery = `UPDATE conversations SET response_format = \$1, response_schema = \$2 WHERE id = \$3`
+		deleteQuery = `DELETE FROM conversation_summaries WHERE id = \(SELECT active_summary_id FROM conversations WHERE id = \$1\)`
+	)
+
+	t.Run("format changed and active summary deleted", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(updateQuery).
+			WithArgs("json", `{"type":"object"}`, "c1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(deleteQuery).
+			WithArgs("c1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := db.UpdateConversationFormat("c1", "json", `{"type":"object"}`); err != nil {
+			t.Fatalf("UpdateConversationFormat() error = %v", err)
+		}
+	})
+
+	t.Run("missing conversation", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(updateQuery).
+			WithArgs("text", "", "c1").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := db.UpdateConversationFormat("c1", "text", ""); err == nil {
+			t.Fatal("UpdateConversationFormat() succeeded, want an error")
+		}
+	})
+
+	t.Run("summary deletion fails", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(updateQuery).
+			WithArgs("text", "", "c1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(deleteQuery).
+			WithArgs("c1").
+			WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if err := db.UpdateConversationFormat("c1", "text", ""); err == nil {
+			t.Fatal("UpdateConversationFormat() succeeded, want an error")
+		}
+	})
+}
+
+func TestAddMessageParent(t *testing.T) {
+	for _, parentID := range []string{"", "m0"} {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`INSERT INTO messages \(.*, parent_message_id\)\s+VALUES \(.*, NULLIF\(\$19, ''\)::uuid\)`).
+			WithArgs(sqlmock.AnyArg(), "c1", "user", "hi", "", nil, nil, "", "", nil, nil, nil, nil, nil, nil, nil, nil, nil, parentID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("m1", time.Now()))
+		mock.ExpectExec(`UPDATE conversations SET updated_at`).WithArgs("c1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		msg, err := db.AddMessage("c1", "user", "hi", "", nil, nil, "", "", nil, nil, nil, nil, nil, nil, nil, nil, nil, parentID)
+		if err != nil {
+			t.Fatalf("AddMessage(parent %q) error = %v", parentID, err)
+		}
+		if got := msg.ParentMessageID; (got == nil) != (parentID == "") || (got != nil && *got != parentID) {
+			t.Errorf("AddMessage(parent %q) parent = %v", parentID, got)
+		}
+	}
+}
+
+func TestAddMessageCostSplit(t *testing.T) {
+	total, input, output := 0.0105, 0.003, 0.0075
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`INSERT INTO messages \(.*, total_cost, input_cost_usd, output_cost_usd, latency, .*\)`).
+		WithArgs(sqlmock.AnyArg(), "c1", "assistant", "hi", "vendor/a", nil, nil, "", "gen-1", nil, nil, nil, total, input, output, nil, nil, nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("m1", time.Now()))
+	mock.ExpectExec(`UPDATE conversations SET updated_at`).WithArgs("c1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	msg, err := db.AddMessage("c1", "assistant", "hi", "vendor/a", nil, nil, "", "gen-1", nil, nil, nil, &total, &input, &output, nil, nil, nil, "")
+	if err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if *msg.InputCostUSD != input || *msg.OutputCostUSD != output {
+		t.Errorf("AddMessage() split = %v, %v, want %v, %v", *msg.InputCostUSD, *msg.OutputCostUSD, input, output)
+	}
+}
+
+func TestFinalizeMessageCostSplit(t *testing.T) {
+	total, input, output := 0.0105, 0.003, 0.0075
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`UPDATE messages\s+SET .* total_cost = \$11, input_cost_usd = \$12, output_cost_usd = \$13, .* partial = FALSE\s+WHERE id = \$1`).
+		WithArgs("m1", "hi", "vendor/a", nil, nil, "", "gen-1", nil, nil, nil, total, input, output, nil, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"conversation_id"}).AddRow("c1"))
+	mock.ExpectExec(`UPDATE conversations SET updated_at`).WithArgs("c1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.FinalizeMessage("m1", "hi", "vendor/a", nil, nil, "", "gen-1", nil, nil, nil, &total, &input, &output, nil, nil, nil); err != nil {
+		t.Fatalf("FinalizeMessage() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetConversationCostBreakdown(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	// Input and output are only summed over messages whose cost is split, and compared to their own total
+	mock.ExpectQuery(`SELECT COALESCE\(SUM\(total_cost\), 0\),\s+COALESCE\(SUM\(input_cost_usd\) FILTER \(WHERE split\), 0\),\s+` +
+		`COALESCE\(SUM\(output_cost_usd\) FILTER \(WHERE split\), 0\),\s+COALESCE\(SUM\(total_cost\) FILTER \(WHERE split\), 0\)\s+FROM \(\s+` +
+		`SELECT total_cost, input_cost_usd, output_cost_usd,\s+total_cost IS NOT NULL AND input_cost_usd IS NOT NULL AND output_cost_usd IS NOT NULL AS split\s+` +
+		`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL\s+\) m`).
+		WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"total", "input", "output", "split_total"}).AddRow(0.02, 0.003, 0.0075, 0.0105))
+
+	breakdown, err := db.GetConversationCostBreakdown("c1")
+	if err != nil {
+		t.Fatalf("GetConversationCostBreakdown() error = %v", err)
+	}
+	want := db.CostBreakdown{TotalCost: 0.02, InputCostUSD: 0.003, OutputCostUSD: 0.0075, SplitTotalCost: 0.0105}
+	if *breakdown != want {
+		t.Errorf("GetConversationCostBreakdown() = %+v, want %+v", *breakdown, want)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{content: "", want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{content: "hello", want: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	}
+
+	for _, tt := range tests {
+		if got := db.ContentHash(tt.content); got != tt.want {
+			t.Errorf("ContentHash(%q) = %s, want %s", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestSetMessageContentHash(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectExec(`UPDATE messages SET content_hash = \$1 WHERE id = \$2`).
+		WithArgs(db.ContentHash("hello"), "m1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.SetMessageContentHash("m1", db.ContentHash("hello")); err != nil {
+		t.Fatalf("SetMessageContentHash() error = %v", err)
+	}
+}
+
+func TestVerifyMessageIntegrity(t *testing.T) {
+	const query = `SELECT content, content_hash FROM messages WHERE id = \$1`
+	columns := []string{"content", "content_hash"}
+
+	tests := []struct {
+		name      string
+		rows      *sqlmock.Rows
+		wantValid bool
+		wantErr   error
+	}{
+		{name: "matching content", rows: sqlmock.NewRows(columns).AddRow("hello", db.ContentHash("hello")), wantValid: true},
+		{name: "modified content", rows: sqlmock.NewRows(columns).AddRow("hello!", db.ContentHash("hello"))},
+		{name: "no stored hash", rows: sqlmock.NewRows(columns).AddRow("hello", nil), wantErr: sql.ErrNoRows},
+		{name: "missing message", rows: sqlmock.NewRows(columns), wantErr: sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectQuery(query).WithArgs("m1").WillReturnRows(tt.rows)
+
+			valid, err := db.VerifyMessageIntegrity("m1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyMessageIntegrity() error = %v, want %v", err, tt.wantErr)
+			}
+			if valid != tt.wantValid {
+				t.Errorf("VerifyMessageIntegrity() = %v, want %v", valid, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestGetConversationSummaryHistory(t *testing.T) {
+	summaryColumns := []string{"id", "conversation_id", "summary_content", "summarized_up_to_message_id", "usage_count", "created_at"}
+	betweenQuery := `FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL AND partial IS NOT TRUE\s+` +
+		`AND \(\$2::uuid IS NULL OR created_at > \(SELECT created_at FROM messages WHERE id = \$2\)\)\s+` +
+		`AND \(\$3::uuid IS NULL OR created_at <= \(SELECT created_at FROM messages WHERE id = \$3\)\)`
+
+	// Ten alternating messages m1..m10, of which the database returns the window asked for
+	var ids []string
+	for i := 1; i <= 10; i++ {
+		ids = append(ids, fmt.Sprintf("m%d", i))
+	}
+	window := func(from, to int) *sqlmock.Rows {
+		rows := sqlmock.NewRows(testutil.MessageColumns)
+		for i := from; i <= to; i++ {
+			role := "user"
+			if i%2 == 0 {
+				role = "assistant"
+			}
+			rows.AddRow(testutil.MessageRow(ids[i-1], "c1", role, fmt.Sprintf("content %d", i))...)
+		}
+		return rows
+	}
+
+	t.Run("three summaries", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		now := time.Now()
+		mock.ExpectQuery(`FROM conversation_summaries\s+WHERE conversation_id = \$1\s+ORDER BY created_at ASC`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(summaryColumns).
+				AddRow("s1", "c1", "Up to m3.", "m3", 0, now.Add(-3*time.Minute)).
+				AddRow("s2", "c1", "Up to m6.", "m6", 0, now.Add(-2*time.Minute)).
+				AddRow("s3", "c1", "Up to m10.", "m10", 2, now.Add(-time.Minute)))
+		mock.ExpectQuery(betweenQuery).WithArgs("c1", nil, "m3").WillReturnRows(window(1, 3))
+		mock.ExpectQuery(betweenQuery).WithArgs("c1", "m3", "m6").WillReturnRows(window(4, 6))
+		mock.ExpectQuery(betweenQuery).WithArgs("c1", "m6", "m10").WillReturnRows(window(7, 10))
+
+		history, err := db.GetConversationSummaryHistory("c1")
+		if err != nil {
+			t.Fatalf("GetConversationSummaryHistory() error = %v", err)
+		}
+
+		want := []struct {
+			summaryID string
+			contents  []string
+		}{
+			{"s1", []string{"content 1", "content 2", "content 3"}},
+			{"s2", []string{"content 4", "content 5", "content 6"}},
+			{"s3", []string{"content 7", "content 8", "content 9", "content 10"}},
+		}
+		if len(history) != len(want) {
+			t.Fatalf("got %d summaries, want %d", len(history), len(want))
+		}
+		for i, entry := range history {
+			var contents []string
+			for _, msg := range entry.Messages {
+				contents = append(contents, msg.Content)
+			}
+			if entry.Summary.ID != want[i].summaryID || !slices.Equal(contents, want[i].contents) {
+				t.Errorf("entry %d = %s with %q, want %s with %q", i, entry.Summary.ID, contents, want[i].summaryID, want[i].contents)
+			}
+		}
+		if role := history[2].Messages[3].Role; role != "assistant" {
+			t.Errorf("role of m10 = %q, want assistant", role)
+		}
+	})
+
+	t.Run("summary without a cut-off message", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		now := time.Now()
+		mock.ExpectQuery(`FROM conversation_summaries`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows(summaryColumns).
+				AddRow("s1", "c1", "Imported.", nil, 0, now.Add(-2*time.Minute)).
+				AddRow("s2", "c1", "Up to m2.", "m2", 0, now.Add(-time.Minute)))
+		mock.ExpectQuery(betweenQuery).WithArgs("c1", nil, "m2").WillReturnRows(window(1, 2))
+
+		history, err := db.GetConversationSummaryHistory("c1")
+		if err != nil {
+			t.Fatalf("GetConversationSummaryHistory() error = %v", err)
+		}
+		if len(history) != 2 || history[0].Messages == nil || len(history[0].Messages) != 0 || len(history[1].Messages) != 2 {
+			t.Errorf("history = %+v, want no messages for s1 and m1, m2 for s2", history)
+		}
+	})
+
+	t.Run("no summaries", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM conversation_summaries`).WithArgs("c1").WillReturnRows(sqlmock.NewRows(summaryColumns))
+
+		history, err := db.GetConversationSummaryHistory("c1")
+		if err != nil || len(history) != 0 {
+			t.Errorf("GetConversationSummaryHistory() = %+v, %v, want an empty history", history, err)
+		}
+	})
+}
+
+func TestGetMessageSiblings(t *testing.T) {
+	const siblingsQuery = `FROM messages\s+WHERE conversation_id = \$1 AND role = 'assistant' AND deleted_at IS NULL\s+` +
+		`AND created_at > COALESCE\(\(SELECT MAX\(created_at\) FROM messages WHERE conversation_id = \$1 AND role = 'user' AND deleted_at IS NULL AND created_at < \$2\), '-infinity'::timestamp\)\s+` +
+		`AND created_at < COALESCE\(\(SELECT MIN\(created_at\) FROM messages WHERE conversation_id = \$1 AND role = 'user' AND deleted_at IS NULL AND created_at > \$2\), 'infinity'::timestamp\)\s+` +
+		`ORDER BY created_at ASC`
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// expectLookup expects the lookup of m2, the message whose siblings are asked for
+	expectLookup := func(mock sqlmock.Sqlmock, role string) {
+		row := testutil.MessageRow("m2", "c1", role, "answer")
+		row[len(row)-1] = createdAt
+		mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+			WithArgs("m2").
+			WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(row...))
+	}
+
+	tests := []struct {
+		name     string
+		siblings []string
+	}{
+		{name: "no regeneration", siblings: []string{"m2"}},
+		{name: "one regeneration", siblings: []string{"m2", "m3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			expectLookup(mock, "assistant")
+			rows := sqlmock.NewRows(testutil.MessageColumns)
+			for _, id := range tt.siblings {
+				rows.AddRow(testutil.MessageRow(id, "c1", "assistant", "answer "+id)...)
+			}
+			mock.ExpectQuery(siblingsQuery).WithArgs("c1", createdAt).WillReturnRows(rows)
+
+			siblings, err := db.GetMessageSiblings("m2")
+			if err != nil {
+				t.Fatalf("GetMessageSiblings() error = %v", err)
+			}
+			var ids []string
+			for _, msg := range siblings {
+				ids = append(ids, msg.ID)
+			}
+			if !slices.Equal(ids, tt.siblings) {
+				t.Errorf("GetMessageSiblings() = %q, want %q", ids, tt.siblings)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("user message", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		expectLookup(mock, "user")
+
+		if _, err := db.GetMessageSiblings("m2"); !errors.Is(err, db.ErrNotAssistantMessage) {
+			t.Fatalf("GetMessageSiblings() error = %v, want %v", err, db.ErrNotAssistantMessage)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+func TestMergeSummaries(t *testing.T) {
+	const insertQuery = `INSERT INTO conversation_summaries \(id, conversation_id, summary_content, summarized_up_to_message_id, usage_count\)\s+VALUES \(\$1, \$2, \$3, \$4, 0\)\s+RETURNING created_at`
+	sources := []string{"s1", "s2"}
+	lastMsgID := "m6"
+
+	for _, deleteSources := range []bool{false, true} {
+		t.Run(fmt.Sprintf("delete sources %v", deleteSources), func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			summaryID := &testutil.SameArg{}
+			mock.ExpectBegin()
+			mock.ExpectQuery(insertQuery).
+				WithArgs(summaryID, "c1", "Merged.", lastMsgID).
+				WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+			// Only a conversation whose active summary was merged points at the new one
+			mock.ExpectExec(`UPDATE conversations SET active_summary_id = \$1 WHERE id = \$2 AND active_summary_id = ANY\(\$3\)`).
+				WithArgs(summaryID, "c1", pq.Array(sources)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			if deleteSources {
+				mock.ExpectExec(`DELETE FROM conversation_summaries WHERE conversation_id = \$1 AND id = ANY\(\$2\)`).
+					WithArgs("c1", pq.Array(sources)).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			}
+			mock.ExpectCommit()
+
+			summary, err := db.MergeSummaries("c1", "Merged.", &lastMsgID, sources, deleteSources)
+			if err != nil {
+				t.Fatalf("MergeSummaries() error = %v", err)
+			}
+			if !summaryID.Match(summary.ID) || summary.SummaryContent != "Merged." || *summary.SummarizedUpToMessageID != lastMsgID {
+				t.Errorf("MergeSummaries() = %+v, want the stored summary up to %s", summary, lastMsgID)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("failed delete rolls back", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM conversation_summaries`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, err := db.MergeSummaries("c1", "Merged.", &lastMsgID, sources, true); err == nil {
+			t.Fatal("MergeSummaries() succeeded with a failed delete")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+// crashingConverter converts statement arguments like the default converter but panics at the
+// crashAt-th one, simulating a server crash in the middle of a transaction
+type crashingConverter struct {
+	converted, crashAt int
+}
+
+func (c *crashingConverter) ConvertValue(v any) (driver.Value, error) {
+	c.converted++
+	if c.converted == c.crashAt {
+		panic("simulated crash")
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestTransactionalSummarize(t *testing.T) {
+	const (
+		convID      = "33333333-3333-3333-3333-333333333333"
+		insertQuery = `INSERT INTO conversation_summaries \(id, conversation_id, summary_content, summarized_up_to_message_id, usage_count\)\s+VALUES \(\$1, \$2, \$3, \$4, 0\)\s+RETURNING created_at`
+	)
+	lastMsgID := "m6"
+
+	t.Run("committed", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+		testutil.ExpectSummarySaved(mock, convID, "Summary.", lastMsgID)
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+
+		db.GetConversation(convID)
+		summary, err := db.TransactionalSummarize(convID, "Summary.", &lastMsgID)
+		if err != nil {
+			t.Fatalf("TransactionalSummarize() error = %v", err)
+		}
+		if summary.ID == "" || summary.ConversationID != convID || summary.SummaryContent != "Summary." || *summary.SummarizedUpToMessageID != lastMsgID {
+			t.Errorf("TransactionalSummarize() = %+v, want the stored summary up to %s", summary, lastMsgID)
+		}
+		// The cached conversation still points at the previous summary, so it is read again
+		db.GetConversation(convID)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("failed update rolls back the summary", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, err := db.TransactionalSummarize(convID, "Summary.", &lastMsgID); err == nil {
+			t.Fatal("TransactionalSummarize() succeeded with a failed update")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("crash between the statements rolls back", func(t *testing.T) {
+		// The insert has 4 arguments, so the crash happens on the active summary update
+		conn, mock, err := sqlmock.New(sqlmock.ValueConverterOption(&crashingConverter{crashAt: 5}))
+		if err != nil {
+			t.Fatalf("error creating mock database: %v", err)
+		}
+		previous := db.GetDB()
+		db.SetDB(conn)
+		t.Cleanup(func() {
+			db.SetDB(previous)
+			conn.Close()
+		})
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		mock.ExpectRollback()
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("TransactionalSummarize() did not reach the simulated crash")
+				}
+			}()
+			db.TransactionalSummarize(convID, "Summary.", &lastMsgID)
+		}()
+		// The summary insert is rolled back and nothing is committed
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+func TestBatchGetActiveSummaries(t *testing.T) {
+	summaryColumns := []string{"id", "conversation_id", "summary_content", "summarized_up_to_message_id", "usage_count", "created_at"}
+
+	t.Run("no conversations", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+
+		summaries, err := db.BatchGetActiveSummaries(nil)
+		if err != nil || len(summaries) != 0 {
+			t.Fatalf("BatchGetActiveSummaries(nil) = %v, %v, want an empty map", summaries, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("one query for all conversations", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM conversations c\s+JOIN conversation_summaries s ON s.id = c.active_summary_id\s+WHERE c.id = ANY\(\$1\)`).
+			WithArgs(pq.Array([]string{"c1", "c2", "c3"})).
+			WillReturnRows(sqlmock.NewRows(summaryColumns).
+				AddRow("s1", "c1", "First.", "m1", 0, time.Now()).
+				AddRow("s3", "c3", "Third.", "m3", 1, time.Now()))
+
+		summaries, err := db.BatchGetActiveSummaries([]string{"c1", "c2", "c3"})
+		if err != nil {
+			t.Fatalf("BatchGetActiveSummaries() error = %v", err)
+		}
+		if len(summaries) != 2 || summaries["c1"].ID != "s1" || summaries["c3"].ID != "s3" {
+			t.Errorf("BatchGetActiveSummaries() = %v, want s1 for c1 and s3 for c3", summaries)
+		}
+		if _, ok := summaries["c2"]; ok {
+			t.Error("conversation without an active summary is in the result")
+		}
+	})
+}
+
+func TestClearConversationMessages(t *testing.T) {
+	t.Run("messages and summaries cleared", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id = NULL WHERE id = \$1`).
+			WithArgs("c1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM conversation_summaries WHERE conversation_id = \$1`).
+			WithArgs("c1").
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE messages SET deleted_at = NOW\(\) WHERE conversation_id = \$1 AND deleted_at IS NULL`).
+			WithArgs("c1").
+			WillReturnResult(sqlmock.NewResult(0, 42))
+		mock.ExpectCommit()
+
+		messages, summaries, err := db.ClearConversationMessages("c1")
+		if err != nil {
+			t.Fatalf("ClearConversationMessages() error = %v", err)
+		}
+		if messages != 42 || summaries != 3 {
+			t.Errorf("ClearConversationMessages() = %d messages, %d summaries, want 42 and 3", messages, summaries)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id = NULL`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM conversation_summaries`).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE messages SET deleted_at`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, _, err := db.ClearConversationMessages("c1"); err == nil {
+			t.Fatal("ClearConversationMessages() succeeded with a failed message update")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+func TestSetMessageSystemPromptHash(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectExec(`UPDATE messages SET system_prompt_hash = \$1 WHERE id = \$2`).
+		WithArgs(db.ContentHash("Be brief."), "m1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.SetMessageSystemPromptHash("m1", db.ContentHash("Be brief.")); err != nil {
+		t.Fatalf("SetMessageSystemPromptHash() error = %v", err)
+	}
+}
+
+func TestGetSystemPromptChangePoints(t *testing.T) {
+	const query = `SELECT id FROM \(\s+SELECT id, created_at, system_prompt_hash,\s+LAG\(system_prompt_hash\) OVER \(ORDER BY created_at\) AS previous_hash\s+FROM messages\s+` +
+		`WHERE conversation_id = \$1 AND system_prompt_hash IS NOT NULL AND deleted_at IS NULL\s+\) hashed\s+` +
+		`WHERE previous_hash IS NOT NULL AND previous_hash <> system_prompt_hash\s+ORDER BY created_at ASC`
+
+	tests := []struct {
+		name string
+		ids  []string
+	}{
+		{name: "no changes", ids: []string{}},
+		{name: "several changes", ids: []string{"m3", "m7"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			rows := sqlmock.NewRows([]string{"id"})
+			for _, id := range tt.ids {
+				rows.AddRow(id)
+			}
+			mock.ExpectQuery(query).WithArgs("c1").WillReturnRows(rows)
+
+			got, err := db.GetSystemPromptChangePoints("c1")
+			if err != nil {
+				t.Fatalf("GetSystemPromptChangePoints() error = %v", err)
+			}
+			if got == nil || !slices.Equal(got, tt.ids) {
+				t.Errorf("GetSystemPromptChangePoints() = %#v, want %#v", got, tt.ids)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestSoftDeletedMessagesFiltered(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		rows  *sqlmock.Rows
+		call  func() error
+	}{
+		{
+			name:  "GetConversationMessages",
+			query: `SELECT role, content\s+FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL`,
+			rows:  sqlmock.NewRows([]string{"role", "content"}),
+			call:  func() error { _, err := db.GetConversationMessages("c1"); return err },
+		},
+		{
+			name:  "GetConversationMessagesWithDetails",
+			query: `FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL\s+ORDER BY created_at ASC`,
+			rows:  sqlmock.NewRows(testutil.MessageColumns),
+			call:  func() error { _, err := db.GetConversationMessagesWithDetails("c1"); return err },
+		},
+		{
+			name:  "GetMessageCountByRole",
+			query: `SELECT role, COUNT\(\*\) FROM messages WHERE conversation_id = \$1 AND deleted_at IS NULL GROUP BY role`,
+			rows:  sqlmock.NewRows([]string{"role", "count"}),
+			call:  func() error { _, err := db.GetMessageCountByRole("c1"); return err },
+		},
+		{
+			name:  "GetLastMessageID",
+			query: `SELECT id\s+FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL AND partial IS NOT TRUE\s+ORDER BY created_at DESC\s+LIMIT 1`,
+			rows:  sqlmock.NewRows([]string{"id"}).AddRow("m1"),
+			call:  func() error { _, err := db.GetLastMessageID("c1"); return err },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectQuery(tt.query).WithArgs("c1").WillReturnRows(tt.rows)
+
+			if err := tt.call(); err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	// A cleared message can no longer be looked up by ID
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`FROM messages\s+WHERE id = \$1 AND deleted_at IS NULL`).
+		WithArgs("m1").
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns))
+	if msg, err := db.GetMessage("m1"); err == nil {
+		t.Errorf("GetMessage() = %+v, want an error for a cleared message", msg)
+	}
+}
+
+func TestRestoreConversationMessages(t *testing.T) {
+	const convID = "33333333-3333-3333-3333-333333333333"
+
+	t.Run("restored", func(t *testing.T) {
+		mock := newCachedMockDB(t, convID, "")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+		mock.ExpectExec(`UPDATE messages SET deleted_at = NULL WHERE conversation_id = \$1 AND deleted_at IS NOT NULL`).
+			WithArgs(convID).
+			WillReturnResult(sqlmock.NewResult(0, 42))
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "u1"})
+
+		db.GetConversation(convID)
+		restored, err := db.RestoreConversationMessages(convID)
+		if err != nil {
+			t.Fatalf("RestoreConversationMessages() error = %v", err)
+		}
+		if restored != 42 {
+			t.Errorf("RestoreConversationMessages() = %d, want 42", restored)
+		}
+		// The cached conversation was invalidated, so it is read again
+		db.GetConversation(convID)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectExec(`UPDATE messages SET deleted_at = NULL`).WillReturnError(errors.New("connection reset"))
+
+		if _, err := db.RestoreConversationMessages(convID); err == nil {
+			t.Error("RestoreConversationMessages() succeeded with a failed update")
+		}
+	})
+}
+
+func TestPurgeConversation(t *testing.T) {
+	t.Run("purged", func(t *testing.T) {
+		// Only cleared messages are deleted; their feedback and attachment rows go with them through
+		// ON DELETE CASCADE, so the attachment storage keys are read first
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT a.storage_key\s+FROM message_attachments a\s+JOIN messages m ON m.id = a.message_id\s+WHERE m.conversation_id = \$1 AND m.deleted_at IS NOT NULL`).
+			WithArgs("c1").
+			WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("c1/a.txt").AddRow("c1/b.png"))
+		mock.ExpectExec(`DELETE FROM messages WHERE conversation_id = \$1 AND deleted_at IS NOT NULL`).
+			WithArgs("c1").
+			WillReturnResult(sqlmock.NewResult(0, 7))
+		mock.ExpectCommit()
+
+		purged, storageKeys, err := db.PurgeConversation("c1")
+		if err != nil {
+			t.Fatalf("PurgeConversation() error = %v", err)
+		}
+		if purged != 7 || !slices.Equal(storageKeys, []string{"c1/a.txt", "c1/b.png"}) {
+			t.Errorf("PurgeConversation() = %d, %q, want 7 and both storage keys", purged, storageKeys)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("failure rolls back", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT a.storage_key`).WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("c1/a.txt"))
+		mock.ExpectExec(`DELETE FROM messages`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		if _, storageKeys, err := db.PurgeConversation("c1"); err == nil || storageKeys != nil {
+			t.Errorf("PurgeConversation() = %q, %v, want an error and no files to remove", storageKeys, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+}
+
+func TestCreateConversationColor(t *testing.T) {
+	for _, color := range []string{"#ff5733", ""} {
+		t.Run(cmp.Or(color, "no color"), func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			now := time.Now()
+			// An empty color is stored as NULL
+			mock.ExpectQuery(`INSERT INTO conversations \(id, user_id, title, response_format, response_schema, color\)\s+VALUES \(\$1, \$2, \$3, \$4, \$5, NULLIF\(\$6, ''\)\)`).
+				WithArgs(sqlmock.AnyArg(), "u1", "Trip", "text", "", color).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("c1", now, now))
+
+			conv, err := db.CreateConversation("u1", "Trip", "", "", color)
+			if err != nil {
+				t.Fatalf("CreateConversation() error = %v", err)
+			}
+			if conv.Color != color {
+				t.Errorf("color = %q, want %q", conv.Color, color)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateConversationColor(t *testing.T) {
+	for _, color := range []string{"#ff5733", ""} {
+		t.Run(cmp.Or(color, "cleared"), func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE conversations SET updated_at = CURRENT_TIMESTAMP, color = NULLIF\(\$1, ''\) WHERE id = \$2`).
+				WithArgs(color, "c1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			if err := db.UpdateConversation("c1", db.ConversationUpdate{Color: &color}); err != nil {
+				t.Fatalf("UpdateConversation() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Export job statuses
+const (
+	ExportJobPending  = "pending"
+	ExportJobRunning  = "running"
+	ExportJobComplete = "complete"
+	ExportJobFailed   = "failed"
+)
+
+// ExportJob is a background export of a conversation
+type ExportJob struct {
+	ID             string
+	UserID         string
+	ConversationID string
+	Status         string
+	FilePath       string // Location of the export file once complete
+	Error          string // Failure reason when the job failed
+	CreatedAt      time.Time
+	CompletedAt    *time.Time
+}
+
+// CreateExportJob records a pending export of a conversation
+func CreateExportJob(userID, convID string) (*ExportJob, error) {
+	db := GetDB()
+
+	job := ExportJob{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		ConversationID: convID,
+		Status:         ExportJobPending,
+	}
+
+	query := `
+	INSERT INTO export_jobs (id, user_id, conversation_id, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at
+	`
+
+	if err := db.QueryRow(query, job.ID, userID, convID, job.Status).Scan(&job.CreatedAt); err != nil {
+		return nil, fmt.Errorf("error creating export job: %w", err)
+	}
+
+	log.Printf("[DB] Created export job %s for conversation %s", job.ID, convID)
+	return &job, nil
+}
+
+// GetExportJob retrieves an export job by ID
+func GetExportJob(jobID string) (*ExportJob, error) {
+	db := GetDB()
+
+	var job ExportJob
+	query := `
+	SELECT id, user_id, conversation_id, status, COALESCE(file_path, ''), COALESCE(error, ''), created_at, completed_at
+	FROM export_jobs
+	WHERE id = $1
+	`
+
+	err := db.QueryRow(query, jobID).Scan(
+		&job.ID, &job.UserID, &job.ConversationID, &job.Status, &job.FilePath, &job.Error, &job.CreatedAt, &job.CompletedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("export job not found")
+		}
+		return nil, fmt.Errorf("error retrieving export job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// UpdateExportJobStatus moves an export job to a new status. Completed and failed jobs get their completion time set.
+func UpdateExportJobStatus(jobID, status, filePath, errMsg string) error {
+	db := GetDB()
+
+	query := `
+	UPDATE export_jobs
+	SET status = $1,
+	    file_path = NULLIF($2, ''),
+	    error = NULLIF($3, ''),
+	    completed_at = CASE WHEN $1 IN ('complete', 'failed') THEN CURRENT_TIMESTAMP END
+	WHERE id = $4
+	`
+
+	if _, err := db.Exec(query, status, filePath, errMsg, jobID); err != nil {
+		return fmt.Errorf("error updating export job: %w", err)
+	}
+
+	log.Printf("[DB] Export job %s is %s", jobID, status)
+	return nil
+}
+
+// GetUnfinishedExportJobs returns the pending and running export jobs, oldest first. Jobs left in these
+// states by a previous server process were never completed.
+func GetUnfinishedExportJobs() ([]ExportJob, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id, user_id, conversation_id, status, COALESCE(file_path, ''), COALESCE(error, ''), created_at, completed_at
+	FROM export_jobs
+	WHERE status IN ('pending', 'running')
+	ORDER BY created_at ASC
+	`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving unfinished export jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ExportJob
+	for rows.Next() {
+		var job ExportJob
+		if err := rows.Scan(&job.ID, &job.UserID, &job.ConversationID, &job.Status, &job.FilePath, &job.Error, &job.CreatedAt, &job.CompletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning export job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving unfinished export jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// DeleteExpiredExportJobs deletes export jobs that finished more than olderThan ago and returns the
+// paths of the export files they produced
+func DeleteExpiredExportJobs(olderThan time.Duration) ([]string, error) {
+	db := GetDB()
+
+	query := `
+	DELETE FROM export_jobs
+	WHERE completed_at IS NOT NULL AND completed_at < NOW() - make_interval(secs => $1)
+	RETURNING COALESCE(file_path, '')
+	`
+
+	rows, err := db.Query(query, olderThan.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error deleting expired export jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var deleted int
+	var filePaths []string
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			return filePaths, fmt.Errorf("error scanning expired export job: %w", err)
+		}
+		deleted++
+		if filePath != "" {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return filePaths, fmt.Errorf("error deleting expired export jobs: %w", err)
+	}
+
+	if deleted > 0 {
+		log.Printf("[DB] Deleted %d expired export jobs", deleted)
+	}
+	return filePaths, nil
+}
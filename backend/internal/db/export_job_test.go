@@ -0,0 +1,121 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var exportJobColumns = []string{"id", "user_id", "conversation_id", "status", "file_path", "error", "created_at", "completed_at"}
+
+func TestCreateExportJob(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	createdAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO export_jobs \(id, user_id, conversation_id, status\)\s+VALUES \(\$1, \$2, \$3, \$4\)\s+RETURNING created_at`).
+		WithArgs(sqlmock.AnyArg(), "u1", "c1", db.ExportJobPending).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+
+	job, err := db.CreateExportJob("u1", "c1")
+	if err != nil {
+		t.Fatalf("CreateExportJob() error = %v", err)
+	}
+	if job.ID == "" || job.UserID != "u1" || job.ConversationID != "c1" || job.Status != db.ExportJobPending || !job.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreateExportJob() = %+v, want a pending job", job)
+	}
+}
+
+func TestGetExportJob(t *testing.T) {
+	t.Run("found", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		completedAt := time.Date(2026, 3, 1, 10, 1, 0, 0, time.UTC)
+		mock.ExpectQuery(`SELECT id, user_id, conversation_id, status, COALESCE\(file_path, ''\), COALESCE\(error, ''\), created_at, completed_at\s+FROM export_jobs\s+WHERE id = \$1`).
+			WithArgs("j1").
+			WillReturnRows(sqlmock.NewRows(exportJobColumns).
+				AddRow("j1", "u1", "c1", db.ExportJobComplete, "/exports/j1.json", "", completedAt.Add(-time.Minute), completedAt))
+
+		job, err := db.GetExportJob("j1")
+		if err != nil {
+			t.Fatalf("GetExportJob() error = %v", err)
+		}
+		if job.Status != db.ExportJobComplete || job.FilePath != "/exports/j1.json" || job.CompletedAt == nil || !job.CompletedAt.Equal(completedAt) {
+			t.Errorf("GetExportJob() = %+v", job)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`FROM export_jobs`).WithArgs("j1").WillReturnRows(sqlmock.NewRows(exportJobColumns))
+
+		if _, err := db.GetExportJob("j1"); err == nil || err.Error() != "export job not found" {
+			t.Errorf("GetExportJob() error = %v, want export job not found", err)
+		}
+	})
+}
+
+func TestUpdateExportJobStatus(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	// Only finished jobs get a completion time
+	mock.ExpectExec(`UPDATE export_jobs\s+SET status = \$1,\s+file_path = NULLIF\(\$2, ''\),\s+error = NULLIF\(\$3, ''\),\s+`+
+		`completed_at = CASE WHEN \$1 IN \('complete', 'failed'\) THEN CURRENT_TIMESTAMP END\s+WHERE id = \$4`).
+		WithArgs(db.ExportJobFailed, "", "export failed", "j1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.UpdateExportJobStatus("j1", db.ExportJobFailed, "", "export failed"); err != nil {
+		t.Fatalf("UpdateExportJobStatus() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetUnfinishedExportJobs(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	createdAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM export_jobs\s+WHERE status IN \('pending', 'running'\)\s+ORDER BY created_at ASC`).
+		WillReturnRows(sqlmock.NewRows(exportJobColumns).
+			AddRow("j1", "u1", "c1", db.ExportJobRunning, "", "", createdAt, nil).
+			AddRow("j2", "u1", "c2", db.ExportJobPending, "", "", createdAt.Add(time.Second), nil))
+
+	jobs, err := db.GetUnfinishedExportJobs()
+	if err != nil {
+		t.Fatalf("GetUnfinishedExportJobs() error = %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != "j1" || jobs[1].ID != "j2" {
+		t.Errorf("GetUnfinishedExportJobs() = %+v, want j1 and j2", jobs)
+	}
+}
+
+func TestDeleteExpiredExportJobs(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`DELETE FROM export_jobs\s+WHERE completed_at IS NOT NULL AND completed_at < NOW\(\) - make_interval\(secs => \$1\)\s+RETURNING COALESCE\(file_path, ''\)`).
+		WithArgs(float64(86400)).
+		WillReturnRows(sqlmock.NewRows([]string{"file_path"}).AddRow("/exports/j1.json").AddRow("").AddRow("/exports/j3.json"))
+
+	filePaths, err := db.DeleteExpiredExportJobs(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("DeleteExpiredExportJobs() error = %v", err)
+	}
+	// Failed jobs have no file
+	if want := []string{"/exports/j1.json", "/exports/j3.json"}; !slices.Equal(filePaths, want) {
+		t.Errorf("DeleteExpiredExportJobs() = %v, want %v", filePaths, want)
+	}
+}
+
+func TestUpdateUserWebhookURL(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	// An empty URL removes the webhook
+	mock.ExpectExec(`UPDATE users SET webhook_url = NULLIF\(\$1, ''\) WHERE username = \$2`).
+		WithArgs("", "alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := db.UpdateUserWebhookURL("alice", ""); err != nil {
+		t.Fatalf("UpdateUserWebhookURL() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
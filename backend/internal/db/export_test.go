@@ -0,0 +1,7 @@
+package db
+
+// Exported for the db_test package, which cannot reach the caches otherwise
+var (
+	InvalidateConversation = invalidateConversation
+	InvalidateUser         = invalidateUser
+)
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageFeedback represents a user's free-text feedback on a message
+type MessageFeedback struct {
+	ID           string
+	MessageID    string
+	UserID       string
+	Rating       int
+	Comment      string
+	FeedbackType string
+	CreatedAt    time.Time
+}
+
+// FeedbackFilter narrows down the feedback returned by GetFeedback
+type FeedbackFilter struct {
+	FeedbackType string
+	From         *time.Time
+	To           *time.Time
+}
+
+// UpsertMessageFeedback stores a user's feedback on a message, replacing any previous feedback by that user
+func UpsertMessageFeedback(messageID, userID string, rating int, comment, feedbackType string) (*MessageFeedback, error) {
+	db := GetDB()
+
+	feedback := MessageFeedback{
+		MessageID:    messageID,
+		UserID:       userID,
+		Rating:       rating,
+		Comment:      comment,
+		FeedbackType: feedbackType,
+	}
+
+	query := `
+	INSERT INTO message_feedback (id, message_id, user_id, rating, comment, feedback_type)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (message_id, user_id) DO UPDATE
+	SET rating = EXCLUDED.rating, comment = EXCLUDED.comment, feedback_type = EXCLUDED.feedback_type, created_at = CURRENT_TIMESTAMP
+	RETURNING id, created_at
+	`
+
+	err := db.QueryRow(query, uuid.New().String(), messageID, userID, rating, comment, feedbackType).Scan(&feedback.ID, &feedback.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving feedback: %w", err)
+	}
+
+	log.Printf("[DB] Saved %s feedback (rating %d) for message %s from user %s", feedbackType, rating, messageID, userID)
+	return &feedback, nil
+}
+
+// GetUserFeedbackForConversation retrieves a user's feedback on the messages of a conversation, keyed by message ID
+func GetUserFeedbackForConversation(conversationID, userID string) (map[string]MessageFeedback, error) {
+	db := GetDB()
+
+	query := `
+	SELECT f.id, f.message_id, f.user_id, f.rating, COALESCE(f.comment, ''), f.feedback_type, f.created_at
+	FROM message_feedback f
+	JOIN messages m ON m.id = f.message_id
+	WHERE m.conversation_id = $1 AND f.user_id = $2
+	`
+
+	rows, err := db.Query(query, conversationID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying feedback: %w", err)
+	}
+	defer rows.Close()
+
+	feedback := make(map[string]MessageFeedback)
+	for rows.Next() {
+		var f MessageFeedback
+		if err := rows.Scan(&f.ID, &f.MessageID, &f.UserID, &f.Rating, &f.Comment, &f.FeedbackType, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning feedback: %w", err)
+		}
+		feedback[f.MessageID] = f
+	}
+
+	return feedback, nil
+}
+
+// GetFeedback retrieves feedback across all users, newest first
+func GetFeedback(filter FeedbackFilter) ([]MessageFeedback, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id, message_id, user_id, rating, COALESCE(comment, ''), feedback_type, created_at
+	FROM message_feedback
+	WHERE ($1 = '' OR feedback_type = $1)
+	  AND ($2::timestamp IS NULL OR created_at >= $2)
+	  AND ($3::timestamp IS NULL OR created_at <= $3)
+	ORDER BY created_at DESC
+	`
+
+	rows, err := db.Query(query, filter.FeedbackType, filter.From, filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("error querying feedback: %w", err)
+	}
+	defer rows.Close()
+
+	var feedback []MessageFeedback
+	for rows.Next() {
+		var f MessageFeedback
+		if err := rows.Scan(&f.ID, &f.MessageID, &f.UserID, &f.Rating, &f.Comment, &f.FeedbackType, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning feedback: %w", err)
+		}
+		feedback = append(feedback, f)
+	}
+
+	return feedback, nil
+}
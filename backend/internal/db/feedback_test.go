@@ -0,0 +1,66 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var feedbackColumns = []string{"id", "message_id", "user_id", "rating", "comment", "feedback_type", "created_at"}
+
+func TestUpsertMessageFeedback(t *testing.T) {
+	mock := testutil.NewMockDB(t)
+	// A second submission by the same user replaces the first instead of adding a record
+	for _, rating := range []int{2, 5} {
+		mock.ExpectQuery(`INSERT INTO message_feedback \(id, message_id, user_id, rating, comment, feedback_type\)\s+VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\)\s+ON CONFLICT \(message_id, user_id\) DO UPDATE\s+SET rating = EXCLUDED.rating, comment = EXCLUDED.comment, feedback_type = EXCLUDED.feedback_type`).
+			WithArgs(sqlmock.AnyArg(), "m1", "u1", rating, "Needs sources", "incorrect").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("f1", time.Now()))
+	}
+
+	for _, rating := range []int{2, 5} {
+		feedback, err := db.UpsertMessageFeedback("m1", "u1", rating, "Needs sources", "incorrect")
+		if err != nil {
+			t.Fatalf("UpsertMessageFeedback() error = %v", err)
+		}
+		if feedback.ID != "f1" || feedback.Rating != rating || feedback.FeedbackType != "incorrect" {
+			t.Errorf("feedback = %+v, want f1 rated %d", feedback, rating)
+		}
+	}
+}
+
+func TestGetFeedback(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name     string
+		filter   db.FeedbackFilter
+		wantArgs []driver.Value
+	}{
+		{name: "no filter", wantArgs: []driver.Value{"", nil, nil}},
+		{name: "type and date range", filter: db.FeedbackFilter{FeedbackType: "harmful", From: &from, To: &to}, wantArgs: []driver.Value{"harmful", from, to}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectQuery(`FROM message_feedback\s+WHERE \(\$1 = '' OR feedback_type = \$1\)\s+AND \(\$2::timestamp IS NULL OR created_at >= \$2\)\s+AND \(\$3::timestamp IS NULL OR created_at <= \$3\)\s+ORDER BY created_at DESC`).
+				WithArgs(tt.wantArgs...).
+				WillReturnRows(sqlmock.NewRows(feedbackColumns).
+					AddRow("f2", "m2", "u2", 1, "", "harmful", to).
+					AddRow("f1", "m1", "u1", 2, "Wrong", "harmful", from))
+
+			feedback, err := db.GetFeedback(tt.filter)
+			if err != nil {
+				t.Fatalf("GetFeedback() error = %v", err)
+			}
+			if len(feedback) != 2 || feedback[0].ID != "f2" || feedback[1].Comment != "Wrong" {
+				t.Errorf("feedback = %+v", feedback)
+			}
+		})
+	}
+}
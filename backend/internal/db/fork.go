@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// ForkTitlePrefix is prepended to the title of a forked conversation
+const ForkTitlePrefix = "Fork of: "
+
+// ErrForkMessageNotFound is returned when the message to fork from is not part of the source conversation
+var ErrForkMessageNotFound = errors.New("message not found in conversation")
+
+// forkedMessageColumns are copied unchanged from the source messages; id, conversation_id and
+// parent_message_id are assigned by ForkConversation
+const forkedMessageColumns = `role, content, model, temperature, seed, provider, generation_id, prompt_tokens, completion_tokens, total_tokens,
+	total_cost, input_cost_usd, output_cost_usd, latency, generation_time, response_time_ms, partial, full_prompt, content_hash,
+	system_prompt_hash, edited_at, created_at`
+
+// ForkConversation creates a conversation for userID holding copies of the source conversation's
+// complete messages up to and including upToMessageID. The fork inherits the response format, schema and color,
+// and since copied messages keep their system prompt hashes, system prompt change markers carry over.
+// Everything is copied in one transaction.
+func ForkConversation(sourceConvID, upToMessageID, userID string) (*Conversation, error) {
+	source, err := GetConversation(sourceConvID)
+	if err != nil {
+		return nil, err
+	}
+
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT id, parent_message_id
+	FROM messages
+	WHERE conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE
+	  AND created_at <= (SELECT created_at FROM messages WHERE id = $2 AND conversation_id = $1 AND deleted_at IS NULL AND partial IS NOT TRUE)
+	ORDER BY created_at ASC
+	`
+	rows, err := tx.Query(query, sourceConvID, upToMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages to fork: %w", err)
+	}
+
+	type sourceMessage struct {
+		id       string
+		parentID *string
+	}
+	var messages []sourceMessage
+	for rows.Next() {
+		var msg sourceMessage
+		if err := rows.Scan(&msg.id, &msg.parentID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning message to fork: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating messages to fork: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, ErrForkMessageNotFound
+	}
+
+	title := ForkTitlePrefix + source.Title
+	if runes := []rune(title); len(runes) > 100 {
+		title = string(runes[:100])
+	}
+
+	conv := &Conversation{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Title:          title,
+		ResponseFormat: source.ResponseFormat,
+		ResponseSchema: source.ResponseSchema,
+		Color:          source.Color,
+	}
+
+	query = `
+	INSERT INTO conversations (id, user_id, title, response_format, response_schema, color)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+	RETURNING created_at, updated_at
+	`
+	if err := tx.QueryRow(query, conv.ID, userID, title, conv.ResponseFormat, conv.ResponseSchema, conv.Color).Scan(&conv.CreatedAt, &conv.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("error creating conversation: %w", err)
+	}
+
+	query = `
+	INSERT INTO messages (id, conversation_id, parent_message_id, ` + forkedMessageColumns + `)
+	SELECT $1, $2, $3, ` + forkedMessageColumns + `
+	FROM messages
+	WHERE id = $4
+	`
+	newIDs := make(map[string]string, len(messages))
+	for _, msg := range messages {
+		newID := uuid.New().String()
+		newIDs[msg.id] = newID
+
+		// Branch links are kept when the parent was copied too
+		var parentID *string
+		if msg.parentID != nil {
+			if id, ok := newIDs[*msg.parentID]; ok {
+				parentID = &id
+			}
+		}
+
+		if _, err := tx.Exec(query, newID, conv.ID, parentID, msg.id); err != nil {
+			return nil, fmt.Errorf("error copying message %s: %w", msg.id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	log.Printf("[DB] Forked conversation %s at message %s into %s with %d messages", sourceConvID, upToMessageID, conv.ID, len(messages))
+	return conv, nil
+}
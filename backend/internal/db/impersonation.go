@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CreateImpersonationSession records a token issued to an admin for acting as another user
+func CreateImpersonationSession(sessionID, adminID, targetUserID, tokenHash string, expiresAt time.Time) error {
+	db := GetDB()
+
+	query := `
+	INSERT INTO impersonation_sessions (id, admin_id, target_user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	if _, err := db.Exec(query, sessionID, adminID, targetUserID, tokenHash, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("error creating impersonation session: %w", err)
+	}
+
+	log.Printf("[DB] Created impersonation session %s (admin: %s, target: %s)", sessionID, adminID, targetUserID)
+	return nil
+}
+
+// IsImpersonationSessionActive reports whether a session exists for the token, has not expired and has not been ended
+func IsImpersonationSessionActive(sessionID, tokenHash string) (bool, error) {
+	db := GetDB()
+
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM impersonation_sessions
+		WHERE id = $1 AND token_hash = $2 AND ended_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	)
+	`
+
+	var active bool
+	if err := db.QueryRow(query, sessionID, tokenHash).Scan(&active); err != nil {
+		return false, fmt.Errorf("error checking impersonation session: %w", err)
+	}
+	return active, nil
+}
+
+// EndImpersonationSession revokes an impersonation session before it expires.
+// It returns sql.ErrNoRows if the session does not exist or has already ended.
+func EndImpersonationSession(sessionID string) error {
+	db := GetDB()
+
+	result, err := db.Exec(`UPDATE impersonation_sessions SET ended_at = CURRENT_TIMESTAMP WHERE id = $1 AND ended_at IS NULL`, sessionID)
+	if err != nil {
+		return fmt.Errorf("error ending impersonation session: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[DB] Ended impersonation session %s", sessionID)
+	return nil
+}
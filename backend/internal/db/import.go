@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImportedMessage is a message of an imported conversation. SourceID and ParentSourceID are the IDs
+// from the exporting system; they are only used to link replies and are replaced by new IDs.
+type ImportedMessage struct {
+	SourceID       string
+	ParentSourceID string
+	Role           string
+	Content        string
+	Model          string
+	CreatedAt      time.Time // Zero when unknown
+}
+
+// ImportConversation creates a conversation for userID with the given messages in one transaction,
+// so a failed import leaves nothing behind. Messages keep their order and original timestamps where
+// known; usage and cost data is not imported.
+func ImportConversation(userID, title, responseFormat, responseSchema, color string, messages []ImportedMessage) (*Conversation, error) {
+	db := GetDB()
+
+	if responseFormat == "" {
+		responseFormat = "text"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	conv := &Conversation{
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Title:          title,
+		ResponseFormat: responseFormat,
+		ResponseSchema: responseSchema,
+		Color:          color,
+	}
+
+	query := `
+	INSERT INTO conversations (id, user_id, title, response_format, response_schema, color)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+	RETURNING created_at, updated_at
+	`
+	if err := tx.QueryRow(query, conv.ID, userID, title, responseFormat, responseSchema, color).Scan(&conv.CreatedAt, &conv.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("error creating conversation: %w", err)
+	}
+
+	// Messages are ordered by created_at, so timestamps must strictly increase
+	newIDs := make(map[string]string, len(messages))
+	var previous time.Time
+	for i, msg := range messages {
+		createdAt := msg.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = conv.CreatedAt.Add(time.Duration(i-len(messages)) * time.Millisecond)
+		}
+		if !createdAt.After(previous) {
+			createdAt = previous.Add(time.Microsecond)
+		}
+		previous = createdAt
+
+		msgID := uuid.New().String()
+		if msg.SourceID != "" {
+			newIDs[msg.SourceID] = msgID
+		}
+
+		// Parents are only linked when they appear earlier in the import
+		var parentID *string
+		if id, ok := newIDs[msg.ParentSourceID]; ok && msg.ParentSourceID != "" {
+			parentID = &id
+		}
+
+		query := `
+		INSERT INTO messages (id, conversation_id, role, content, model, parent_message_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+		if _, err := tx.Exec(query, msgID, conv.ID, msg.Role, msg.Content, msg.Model, parentID, createdAt.UTC()); err != nil {
+			return nil, fmt.Errorf("error importing message %d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	log.Printf("[DB] Imported conversation %s with %d messages for user %s", conv.ID, len(messages), userID)
+	return conv, nil
+}
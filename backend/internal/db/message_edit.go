@@ -0,0 +1,104 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageEdit records the content a message had before one of its edits
+type MessageEdit struct {
+	ID              string
+	MessageID       string
+	PreviousContent string
+	EditedAt        time.Time
+}
+
+// EditMessage replaces the content of a message, keeping the previous content in message_edits.
+// An active summary covering the message no longer matches the conversation and is deleted.
+func EditMessage(messageID, newContent string) (*Message, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the message so concurrent edits are recorded one after the other
+	var previousContent, convID string
+	err = tx.QueryRow(`SELECT content, conversation_id FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, messageID).Scan(&previousContent, &convID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving message: %w", err)
+	}
+
+	query := `
+	INSERT INTO message_edits (id, message_id, previous_content, edited_at)
+	VALUES ($1, $2, $3, NOW())
+	`
+	if _, err := tx.Exec(query, uuid.New().String(), messageID, previousContent); err != nil {
+		return nil, fmt.Errorf("error recording message edit: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE messages SET content = $1, edited_at = NOW() WHERE id = $2`, newContent, messageID); err != nil {
+		return nil, fmt.Errorf("error updating message: %w", err)
+	}
+
+	// The active summary covers the message if it was summarized up to the message or a later one
+	summaryQuery := `
+	DELETE FROM conversation_summaries s
+	USING conversations c, messages up_to, messages edited
+	WHERE c.id = $1 AND s.id = c.active_summary_id
+	  AND up_to.id = s.summarized_up_to_message_id
+	  AND edited.id = $2 AND up_to.created_at >= edited.created_at
+	`
+	result, err := tx.Exec(summaryQuery, convID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting outdated summary: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		invalidateConversation(convID)
+		log.Printf("[DB] Deleted active summary of conversation %s covering edited message %s", convID, messageID)
+	}
+	log.Printf("[DB] Edited message %s", messageID)
+	return GetMessage(messageID)
+}
+
+// GetMessageEdits retrieves the edit history of a message, oldest first
+func GetMessageEdits(messageID string) ([]MessageEdit, error) {
+	db := GetDB()
+
+	query := `
+	SELECT id, message_id, previous_content, edited_at
+	FROM message_edits
+	WHERE message_id = $1
+	ORDER BY edited_at ASC
+	`
+
+	rows, err := db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying message edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []MessageEdit
+	for rows.Next() {
+		var edit MessageEdit
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.PreviousContent, &edit.EditedAt); err != nil {
+			return nil, fmt.Errorf("error scanning message edit: %w", err)
+		}
+		edits = append(edits, edit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying message edits: %w", err)
+	}
+
+	return edits, nil
+}
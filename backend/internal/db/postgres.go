@@ -1,10 +1,10 @@
 package db
 
 import (
+	"chat-app/internal/config"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
 	"sync"
 
 	_ "github.com/lib/pq"
@@ -20,19 +20,30 @@ func GetDB() *sql.DB {
 	return instance
 }
 
+// SetDB replaces the database connection, e.g. with a mock in tests
+func SetDB(conn *sql.DB) {
+	instance = conn
+}
+
 // InitDB initializes the database connection and creates tables
 func InitDB() error {
 	var err error
 	once.Do(func() {
-		dsn := getDSN()
-		log.Printf("[DB] Connecting to PostgreSQL: %s", dsn)
+		dbConfig := config.GetDatabaseConfig()
+		if err = dbConfig.Validate(); err != nil {
+			err = fmt.Errorf("invalid database configuration: %w", err)
+			return
+		}
+		log.Printf("[DB] Connecting to PostgreSQL: %s:%s/%s (sslmode=%s)", dbConfig.Host, dbConfig.Port, dbConfig.DBName, dbConfig.SSLMode)
 
-		instance, err = sql.Open("postgres", dsn)
+		instance, err = sql.Open("postgres", dbConfig.BuildDSN())
 		if err != nil {
 			err = fmt.Errorf("error opening database: %w", err)
 			return
 		}
 
+		ConfigurePool(instance)
+
 		// Test the connection
 		if err = instance.Ping(); err != nil {
 			err = fmt.Errorf("error connecting to database: %w", err)
@@ -53,6 +64,17 @@ func InitDB() error {
 	return err
 }
 
+// ConfigurePool sizes a connection pool from DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS
+func ConfigurePool(conn *sql.DB) {
+	conn.SetMaxOpenConns(config.GetDBMaxOpenConns())
+	conn.SetMaxIdleConns(config.GetDBMaxIdleConns())
+}
+
+// PoolStats returns the current connection pool statistics
+func PoolStats() sql.DBStats {
+	return instance.Stats()
+}
+
 // CloseDB closes the database connection
 func CloseDB() error {
 	if instance != nil {
@@ -61,42 +83,6 @@ func CloseDB() error {
 	return nil
 }
 
-// getDSN constructs the PostgreSQL connection string
-func getDSN() string {
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "5432"
-	}
-
-	user := os.Getenv("DB_USER")
-	if user == "" {
-		user = "postgres"
-	}
-
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "postgres"
-	}
-
-	database := os.Getenv("DB_NAME")
-	if database == "" {
-		database = "chatapp"
-	}
-
-	sslMode := os.Getenv("DB_SSLMODE")
-	if sslMode == "" {
-		sslMode = "disable"
-	}
-
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, database, sslMode)
-}
-
 // createTables creates the necessary database tables
 func createTables() error {
 	db := GetDB()
@@ -206,6 +192,16 @@ func createTables() error {
 		return fmt.Errorf("error altering messages table for provider: %w", err)
 	}
 
+	// Add partial column for streaming checkpoints if it doesn't exist
+	alterMessagesPartialSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS partial BOOLEAN DEFAULT FALSE;
+	`
+
+	if _, err := db.Exec(alterMessagesPartialSQL); err != nil {
+		return fmt.Errorf("error altering messages table for partial: %w", err)
+	}
+
 	// Create conversation_summaries table
 	summariesTableSQL := `
 	CREATE TABLE IF NOT EXISTS conversation_summaries (
@@ -233,5 +229,293 @@ func createTables() error {
 		return fmt.Errorf("error altering conversations table for active_summary_id: %w", err)
 	}
 
+	// Add starred_at column to conversations table if it doesn't exist
+	alterConversationsStarredSQL := `
+	ALTER TABLE conversations
+	ADD COLUMN IF NOT EXISTS starred_at TIMESTAMP;
+	`
+
+	if _, err := db.Exec(alterConversationsStarredSQL); err != nil {
+		return fmt.Errorf("error altering conversations table for starred_at: %w", err)
+	}
+
+	// Add is_admin column to users table if it doesn't exist
+	alterUsersAdminSQL := `
+	ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS is_admin BOOLEAN DEFAULT FALSE;
+	`
+
+	if _, err := db.Exec(alterUsersAdminSQL); err != nil {
+		return fmt.Errorf("error altering users table for is_admin: %w", err)
+	}
+
+	// Create message_feedback table (one feedback record per user per message)
+	feedbackTableSQL := `
+	CREATE TABLE IF NOT EXISTS message_feedback (
+		id UUID PRIMARY KEY,
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+		comment TEXT,
+		feedback_type VARCHAR(20) NOT NULL CHECK (feedback_type IN ('helpful', 'harmful', 'incorrect', 'other')),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (message_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_feedback_created_at ON message_feedback(created_at);
+	`
+
+	if _, err := db.Exec(feedbackTableSQL); err != nil {
+		return fmt.Errorf("error creating message_feedback table: %w", err)
+	}
+
+	// Add title_generated_at column to conversations table if it doesn't exist
+	alterTitleGeneratedSQL := `
+	ALTER TABLE conversations
+	ADD COLUMN IF NOT EXISTS title_generated_at TIMESTAMP;
+	`
+
+	if _, err := db.Exec(alterTitleGeneratedSQL); err != nil {
+		return fmt.Errorf("error altering conversations table for title_generated_at: %w", err)
+	}
+
+	// Create message_attachments table
+	attachmentsTableSQL := `
+	CREATE TABLE IF NOT EXISTS message_attachments (
+		id UUID PRIMARY KEY,
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		filename VARCHAR(255) NOT NULL,
+		content_type VARCHAR(255),
+		size_bytes BIGINT NOT NULL,
+		storage_key TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_attachments_message_id ON message_attachments(message_id);
+	`
+
+	if _, err := db.Exec(attachmentsTableSQL); err != nil {
+		return fmt.Errorf("error creating message_attachments table: %w", err)
+	}
+
+	// Add full_prompt column to messages table if it doesn't exist (JSON array of prompt messages)
+	alterMessagesPromptSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS full_prompt TEXT;
+	`
+
+	if _, err := db.Exec(alterMessagesPromptSQL); err != nil {
+		return fmt.Errorf("error altering messages table for full_prompt: %w", err)
+	}
+
+	// Add seed column to messages table if it doesn't exist
+	alterMessagesSeedSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS seed INTEGER;
+	`
+
+	if _, err := db.Exec(alterMessagesSeedSQL); err != nil {
+		return fmt.Errorf("error altering messages table for seed: %w", err)
+	}
+
+	// Index for recent-conversation lookups by user ordered by activity
+	recentIndexSQL := `
+	CREATE INDEX IF NOT EXISTS idx_conversations_user_updated_at ON conversations(user_id, updated_at DESC);
+	`
+
+	if _, err := db.Exec(recentIndexSQL); err != nil {
+		return fmt.Errorf("error creating conversations updated_at index: %w", err)
+	}
+
+	// Add response_time_ms column to messages table if it doesn't exist
+	alterMessagesResponseTimeSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS response_time_ms INTEGER;
+	`
+
+	if _, err := db.Exec(alterMessagesResponseTimeSQL); err != nil {
+		return fmt.Errorf("error altering messages table for response_time_ms: %w", err)
+	}
+
+	// Add parent_message_id column to messages table if it doesn't exist (message threading)
+	alterMessagesParentSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS parent_message_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+	CREATE INDEX IF NOT EXISTS idx_messages_parent_message_id ON messages(parent_message_id);
+	`
+
+	if _, err := db.Exec(alterMessagesParentSQL); err != nil {
+		return fmt.Errorf("error altering messages table for parent_message_id: %w", err)
+	}
+
+	// Add content_hash column to messages table if it doesn't exist (SHA-256 of the streamed response)
+	alterMessagesContentHashSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+	`
+
+	if _, err := db.Exec(alterMessagesContentHashSQL); err != nil {
+		return fmt.Errorf("error altering messages table for content_hash: %w", err)
+	}
+
+	// Create impersonation_sessions table (admin-issued short-lived tokens acting as another user)
+	createImpersonationSessionsTableSQL := `
+	CREATE TABLE IF NOT EXISTS impersonation_sessions (
+		id UUID PRIMARY KEY,
+		admin_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		ended_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	if _, err := db.Exec(createImpersonationSessionsTableSQL); err != nil {
+		return fmt.Errorf("error creating impersonation_sessions table: %w", err)
+	}
+
+	// Add system_prompt_hash column to messages table if it doesn't exist (SHA-256 of the system prompt used for a reply)
+	alterMessagesSystemPromptHashSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS system_prompt_hash VARCHAR(64);
+	`
+
+	if _, err := db.Exec(alterMessagesSystemPromptHashSQL); err != nil {
+		return fmt.Errorf("error altering messages table for system_prompt_hash: %w", err)
+	}
+
+	// Add deleted_at column to messages table if it doesn't exist (soft delete, NULL while the message is visible)
+	alterMessagesDeletedAtSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	`
+
+	if _, err := db.Exec(alterMessagesDeletedAtSQL); err != nil {
+		return fmt.Errorf("error altering messages table for deleted_at: %w", err)
+	}
+
+	// Add color column to conversations table if it doesn't exist (hex UI hint such as #ff5733)
+	alterConversationsColorSQL := `
+	ALTER TABLE conversations
+	ADD COLUMN IF NOT EXISTS color VARCHAR(7);
+	`
+
+	if _, err := db.Exec(alterConversationsColorSQL); err != nil {
+		return fmt.Errorf("error altering conversations table for color: %w", err)
+	}
+
+	// Add webhook_url column to users table if it doesn't exist (notified when background jobs finish)
+	alterUsersWebhookURLSQL := `
+	ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS webhook_url TEXT;
+	`
+
+	if _, err := db.Exec(alterUsersWebhookURLSQL); err != nil {
+		return fmt.Errorf("error altering users table for webhook_url: %w", err)
+	}
+
+	// Create export_jobs table (asynchronous conversation exports)
+	createExportJobsTableSQL := `
+	CREATE TABLE IF NOT EXISTS export_jobs (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		file_path TEXT,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs(user_id);
+	`
+
+	if _, err := db.Exec(createExportJobsTableSQL); err != nil {
+		return fmt.Errorf("error creating export_jobs table: %w", err)
+	}
+
+	// Add input_cost_usd and output_cost_usd columns to messages table if they don't exist (total_cost split by token type)
+	alterMessagesCostSplitSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS input_cost_usd NUMERIC(10,8),
+	ADD COLUMN IF NOT EXISTS output_cost_usd NUMERIC(10,8);
+	`
+
+	if _, err := db.Exec(alterMessagesCostSplitSQL); err != nil {
+		return fmt.Errorf("error altering messages table for cost split: %w", err)
+	}
+
+	// Create full-text indexes for conversation search over titles and message content
+	createSearchIndexesSQL := `
+	CREATE INDEX IF NOT EXISTS idx_conversations_title_fts ON conversations USING GIN (to_tsvector('simple', title));
+	CREATE INDEX IF NOT EXISTS idx_messages_content_fts ON messages USING GIN (to_tsvector('simple', content));
+	`
+
+	if _, err := db.Exec(createSearchIndexesSQL); err != nil {
+		return fmt.Errorf("error creating full-text search indexes: %w", err)
+	}
+
+	// Add archived_at column to conversations table if it doesn't exist (soft delete, NULL while the conversation is active)
+	alterConversationsArchivedAtSQL := `
+	ALTER TABLE conversations
+	ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS idx_conversations_archived_at ON conversations(archived_at) WHERE archived_at IS NOT NULL;
+	`
+
+	if _, err := db.Exec(alterConversationsArchivedAtSQL); err != nil {
+		return fmt.Errorf("error altering conversations table for archived_at: %w", err)
+	}
+
+	// Add edited_at column to messages table and create message_edits table keeping the content replaced by each edit
+	createMessageEditsSQL := `
+	ALTER TABLE messages
+	ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id UUID PRIMARY KEY,
+		message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		previous_content TEXT NOT NULL,
+		edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id);
+	`
+
+	if _, err := db.Exec(createMessageEditsSQL); err != nil {
+		return fmt.Errorf("error creating message_edits table: %w", err)
+	}
+
+	// Create refresh_tokens table; only a hash of each token is stored
+	createRefreshTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+	`
+
+	if _, err := db.Exec(createRefreshTokensTableSQL); err != nil {
+		return fmt.Errorf("error creating refresh_tokens table: %w", err)
+	}
+
+	// Create api_keys table; keys are stored as bcrypt hashes and looked up by their prefix
+	createAPIKeysTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id UUID PRIMARY KEY,
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		key_prefix VARCHAR(16) NOT NULL,
+		key_hash VARCHAR(255) NOT NULL,
+		last_used_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_key_prefix ON api_keys(key_prefix);
+	`
+
+	if _, err := db.Exec(createAPIKeysTableSQL); err != nil {
+		return fmt.Errorf("error creating api_keys table: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateRefreshToken stores the hash of a new refresh token for a user
+func CreateRefreshToken(userID, tokenHash string, expiresAt time.Time) error {
+	db := GetDB()
+
+	query := `
+	INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	if _, err := db.Exec(query, uuid.New().String(), userID, tokenHash, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("error creating refresh token: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken revokes a valid refresh token and stores its replacement in one transaction.
+// It returns the ID of the token's user, or sql.ErrNoRows if the token is unknown, expired or revoked.
+func RotateRefreshToken(oldTokenHash, newTokenHash string, expiresAt time.Time) (string, error) {
+	db := GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+	WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	RETURNING user_id
+	`
+
+	var userID string
+	if err := tx.QueryRow(query, oldTokenHash).Scan(&userID); err != nil {
+		return "", err
+	}
+
+	query = `
+	INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.Exec(query, uuid.New().String(), userID, newTokenHash, expiresAt.UTC()); err != nil {
+		return "", fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	log.Printf("[DB] Rotated refresh token for user %s", userID)
+	return userID, nil
+}
+
+// RevokeRefreshToken invalidates a refresh token. Unknown or already revoked tokens are ignored.
+func RevokeRefreshToken(tokenHash string) error {
+	db := GetDB()
+
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE token_hash = $1 AND revoked_at IS NULL`
+	if _, err := db.Exec(query, tokenHash); err != nil {
+		return fmt.Errorf("error revoking refresh token: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleRefreshTokens deletes expired and revoked refresh tokens, which can no longer be used.
+// It returns the number of tokens deleted.
+func DeleteStaleRefreshTokens() (int64, error) {
+	db := GetDB()
+
+	query := `DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP OR revoked_at IS NOT NULL`
+	result, err := db.Exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting stale refresh tokens: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting stale refresh tokens: %w", err)
+	}
+	if deleted > 0 {
+		log.Printf("[DB] Deleted %d expired or revoked refresh tokens", deleted)
+	}
+	return deleted, nil
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"chat-app/internal/metrics"
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -15,6 +17,8 @@ type User struct {
 	Username     string
 	Email        string
 	PasswordHash string
+	IsAdmin      bool
+	WebhookURL   string // Notified when background jobs such as exports finish, empty when unset
 	CreatedAt    string
 }
 
@@ -55,14 +59,43 @@ func CreateUser(username, email, password string) (*User, error) {
 	}, nil
 }
 
-// GetUserByUsername retrieves a user by username
+// GetUserByUsername retrieves a user by username, served from the query cache when enabled
 func GetUserByUsername(username string) (*User, error) {
+	cache := cacheConfig()
+	if cache != nil {
+		if user, ok := userCache.get(username); ok {
+			return &user, nil
+		}
+	}
+
+	defer metrics.ObserveDBQuery("get_user_by_username", time.Now())
+	db := GetDB()
+
+	var user User
+	query := `SELECT id, username, email, password_hash, COALESCE(is_admin, FALSE), COALESCE(webhook_url, ''), created_at FROM users WHERE username = $1`
+
+	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.IsAdmin, &user.WebhookURL, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+
+	if cache != nil {
+		userCache.set(username, user, cache.UserTTL)
+	}
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func GetUserByID(userID string) (*User, error) {
 	db := GetDB()
 
 	var user User
-	query := `SELECT id, username, email, password_hash, created_at FROM users WHERE username = $1`
+	query := `SELECT id, username, email, password_hash, COALESCE(is_admin, FALSE), COALESCE(webhook_url, ''), created_at FROM users WHERE id = $1`
 
-	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt)
+	err := db.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.IsAdmin, &user.WebhookURL, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found")
@@ -73,6 +106,20 @@ func GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// UpdateUserWebhookURL sets the webhook URL of a user; an empty URL removes it
+func UpdateUserWebhookURL(username, webhookURL string) error {
+	db := GetDB()
+
+	query := `UPDATE users SET webhook_url = NULLIF($1, '') WHERE username = $2`
+	if _, err := db.Exec(query, webhookURL, username); err != nil {
+		return fmt.Errorf("error updating webhook URL: %w", err)
+	}
+	invalidateUser(username)
+
+	log.Printf("[DB] Updated webhook URL for user %s", username)
+	return nil
+}
+
 // VerifyPassword checks if the provided password matches the user's hashed password
 func (u *User) VerifyPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
@@ -97,3 +144,149 @@ func SeedDemoUser() error {
 	log.Printf("[DB] Demo user seeded successfully")
 	return nil
 }
+
+// PromoteAdmins grants the admin role to the given usernames
+func PromoteAdmins(usernames []string) error {
+	db := GetDB()
+
+	for _, username := range usernames {
+		result, err := db.Exec(`UPDATE users SET is_admin = TRUE WHERE username = $1`, username)
+		if err != nil {
+			return fmt.Errorf("error promoting admin %s: %w", username, err)
+		}
+		invalidateUser(username)
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			log.Printf("[DB] Warning: admin user %s does not exist", username)
+			continue
+		}
+		log.Printf("[DB] Granted admin role to user: %s", username)
+	}
+
+	return nil
+}
+
+// UserStats holds aggregate usage figures for a single user
+type UserStats struct {
+	TotalConversations    int
+	TotalMessages         int
+	UserMessages          int
+	AssistantMessages     int
+	PromptTokens          int
+	CompletionTokens      int
+	TotalTokensUsed       int
+	TotalCostUSD          float64
+	AvgConversationLength float64
+	FavoriteModel         string // Most used model in assistant messages, ties broken alphabetically
+	ByModel               []ModelUsage
+	CreatedAt             time.Time
+}
+
+// ModelUsage holds the usage of one model across a user's assistant messages
+type ModelUsage struct {
+	Model            string
+	Messages         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+}
+
+// GetUserStats aggregates conversation, message, token and cost totals for a user, counting only
+// conversations and messages created at or after since (zero for all time). Usage per model is
+// ordered by cost, highest first.
+func GetUserStats(userID string, since time.Time) (*UserStats, error) {
+	defer metrics.ObserveDBQuery("get_user_stats", time.Now())
+	db := GetDB()
+
+	var sinceParam *time.Time
+	if !since.IsZero() {
+		utc := since.UTC()
+		sinceParam = &utc
+	}
+
+	query := `
+	WITH user_conversations AS (
+		SELECT id, created_at FROM conversations WHERE user_id = $1 AND archived_at IS NULL
+	),
+	user_messages AS (
+		SELECT m.conversation_id, m.role, m.model, m.prompt_tokens, m.completion_tokens, m.total_tokens, m.total_cost
+		FROM messages m
+		JOIN user_conversations c ON c.id = m.conversation_id
+		WHERE m.deleted_at IS NULL AND ($2::timestamp IS NULL OR m.created_at >= $2)
+	),
+	favorite_model AS (
+		SELECT model
+		FROM user_messages
+		WHERE role = 'assistant' AND model IS NOT NULL AND model <> ''
+		GROUP BY model
+		ORDER BY COUNT(*) DESC, model ASC
+		LIMIT 1
+	)
+	SELECT (SELECT COUNT(*) FROM user_conversations WHERE $2::timestamp IS NULL OR created_at >= $2),
+	       totals.conversations_with_messages, totals.messages, totals.user_messages, totals.assistant_messages,
+	       totals.prompt_tokens, totals.completion_tokens, totals.total_tokens, totals.total_cost,
+	       COALESCE((SELECT model FROM favorite_model), ''),
+	       u.created_at
+	FROM users u,
+	     (SELECT COUNT(DISTINCT conversation_id) AS conversations_with_messages,
+	             COUNT(*) AS messages,
+	             COUNT(*) FILTER (WHERE role = 'user') AS user_messages,
+	             COUNT(*) FILTER (WHERE role = 'assistant') AS assistant_messages,
+	             COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+	             COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+	             COALESCE(SUM(total_tokens), 0) AS total_tokens,
+	             COALESCE(SUM(total_cost), 0) AS total_cost
+	      FROM user_messages) totals
+	WHERE u.id = $1
+	`
+
+	var stats UserStats
+	var conversationsWithMessages int
+	err := db.QueryRow(query, userID, sinceParam).Scan(
+		&stats.TotalConversations, &conversationsWithMessages, &stats.TotalMessages, &stats.UserMessages, &stats.AssistantMessages,
+		&stats.PromptTokens, &stats.CompletionTokens, &stats.TotalTokensUsed, &stats.TotalCostUSD,
+		&stats.FavoriteModel, &stats.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("error retrieving user stats: %w", err)
+	}
+
+	// Averaged over the conversations the counted messages belong to, so a since filter doesn't
+	// compare recent messages against conversations created in the window only
+	if conversationsWithMessages > 0 {
+		stats.AvgConversationLength = float64(stats.TotalMessages) / float64(conversationsWithMessages)
+	}
+
+	query = `
+	SELECT m.model, COUNT(*), COALESCE(SUM(m.prompt_tokens), 0), COALESCE(SUM(m.completion_tokens), 0),
+	       COALESCE(SUM(m.total_tokens), 0), COALESCE(SUM(m.total_cost), 0)
+	FROM messages m
+	JOIN conversations c ON c.id = m.conversation_id
+	WHERE c.user_id = $1 AND c.archived_at IS NULL AND m.role = 'assistant' AND m.model IS NOT NULL AND m.model <> ''
+	  AND m.deleted_at IS NULL AND ($2::timestamp IS NULL OR m.created_at >= $2)
+	GROUP BY m.model
+	ORDER BY 6 DESC, m.model ASC
+	`
+
+	rows, err := db.Query(query, userID, sinceParam)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving user usage by model: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var usage ModelUsage
+		if err := rows.Scan(&usage.Model, &usage.Messages, &usage.PromptTokens, &usage.CompletionTokens, &usage.TotalTokens, &usage.CostUSD); err != nil {
+			return nil, fmt.Errorf("error scanning model usage: %w", err)
+		}
+		stats.ByModel = append(stats.ByModel, usage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating model usage: %w", err)
+	}
+
+	return &stats, nil
+}
@@ -0,0 +1,93 @@
+package db_test
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var userStatsColumns = []string{"conversations", "conversations_with_messages", "messages", "user_messages", "assistant_messages",
+	"prompt_tokens", "completion_tokens", "total_tokens", "total_cost", "favorite_model", "created_at"}
+
+var modelUsageColumns = []string{"model", "count", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost"}
+
+func TestGetUserStats(t *testing.T) {
+	createdAt := time.Date(2025, 12, 1, 9, 0, 0, 0, time.UTC)
+
+	t.Run("all time", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		// Favorite model ties are broken alphabetically in SQL; soft-deleted messages and archived
+		// conversations are not counted
+		mock.ExpectQuery(`WITH user_conversations AS \(\s+SELECT id, created_at FROM conversations WHERE user_id = \$1 AND archived_at IS NULL\s+\),`+
+			`\s+user_messages AS \(.*WHERE m.deleted_at IS NULL AND \(\$2::timestamp IS NULL OR m.created_at >= \$2\)\s+\),`+
+			`\s+favorite_model AS \(.*WHERE role = 'assistant' AND model IS NOT NULL AND model <> ''\s+GROUP BY model\s+ORDER BY COUNT\(\*\) DESC, model ASC\s+LIMIT 1\s+\)`).
+			WithArgs("u1", nil).
+			WillReturnRows(sqlmock.NewRows(userStatsColumns).AddRow(3, 2, 10, 5, 5, 600, 400, 1000, 0.25, "vendor/a", createdAt))
+		mock.ExpectQuery(`FROM messages m\s+JOIN conversations c ON c.id = m.conversation_id\s+`+
+			`WHERE c.user_id = \$1 AND c.archived_at IS NULL AND m.role = 'assistant' .*GROUP BY m.model\s+ORDER BY 6 DESC, m.model ASC`).
+			WithArgs("u1", nil).
+			WillReturnRows(sqlmock.NewRows(modelUsageColumns).
+				AddRow("vendor/b", 2, 400, 100, 500, 0.2).
+				AddRow("vendor/a", 3, 200, 300, 500, 0.05))
+
+		stats, err := db.GetUserStats("u1", time.Time{})
+		if err != nil {
+			t.Fatalf("GetUserStats() error = %v", err)
+		}
+		if stats.TotalConversations != 3 || stats.TotalMessages != 10 || stats.UserMessages != 5 || stats.AssistantMessages != 5 ||
+			stats.PromptTokens != 600 || stats.CompletionTokens != 400 || stats.TotalTokensUsed != 1000 || stats.TotalCostUSD != 0.25 ||
+			stats.FavoriteModel != "vendor/a" || !stats.CreatedAt.Equal(createdAt) {
+			t.Errorf("GetUserStats() = %+v", stats)
+		}
+		// Averaged over the 2 conversations that have messages
+		if stats.AvgConversationLength != 5 {
+			t.Errorf("average conversation length = %v, want 5", stats.AvgConversationLength)
+		}
+		want := []db.ModelUsage{
+			{Model: "vendor/b", Messages: 2, PromptTokens: 400, CompletionTokens: 100, TotalTokens: 500, CostUSD: 0.2},
+			{Model: "vendor/a", Messages: 3, PromptTokens: 200, CompletionTokens: 300, TotalTokens: 500, CostUSD: 0.05},
+		}
+		if !slices.Equal(stats.ByModel, want) {
+			t.Errorf("usage by model = %+v, want %+v", stats.ByModel, want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("since a date", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		since := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+		mock.ExpectQuery(`WITH user_conversations AS`).
+			WithArgs("u1", since.UTC()).
+			WillReturnRows(sqlmock.NewRows(userStatsColumns).AddRow(0, 0, 0, 0, 0, 0, 0, 0, 0, "", createdAt))
+		mock.ExpectQuery(`GROUP BY m.model`).
+			WithArgs("u1", since.UTC()).
+			WillReturnRows(sqlmock.NewRows(modelUsageColumns))
+
+		stats, err := db.GetUserStats("u1", since)
+		if err != nil {
+			t.Fatalf("GetUserStats() error = %v", err)
+		}
+		if stats.AvgConversationLength != 0 || stats.FavoriteModel != "" || stats.ByModel != nil {
+			t.Errorf("GetUserStats() = %+v, want empty stats without a division by zero", stats)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		mock.ExpectQuery(`WITH user_conversations AS`).WillReturnError(sql.ErrNoRows)
+
+		if _, err := db.GetUserStats("u1", time.Time{}); err == nil || err.Error() != "user not found" {
+			t.Errorf("GetUserStats() error = %v, want user not found", err)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type DBPoolResponse struct {
+	Open           int   `json:"open"`
+	InUse          int   `json:"in_use"`
+	Idle           int   `json:"idle"`
+	WaitCount      int64 `json:"wait_count"`
+	WaitDurationMs int64 `json:"wait_duration_ms"`
+	MaxOpen        int   `json:"max_open"`
+	MaxIdle        int   `json:"max_idle"`
+}
+
+// GetDBPoolHandler returns the database connection pool statistics
+func (ch *ChatHandlers) GetDBPoolHandler(w http.ResponseWriter, r *http.Request) {
+	stats := db.PoolStats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DBPoolResponse{
+		Open:           stats.OpenConnections,
+		InUse:          stats.InUse,
+		Idle:           stats.Idle,
+		WaitCount:      stats.WaitCount,
+		WaitDurationMs: stats.WaitDuration.Milliseconds(),
+		MaxOpen:        stats.MaxOpenConnections,
+		MaxIdle:        config.GetDBMaxIdleConns(),
+	})
+}
+
+const (
+	// defaultAdminPageSize is the number of conversations returned when no limit is given
+	defaultAdminPageSize = 50
+	// maxAdminPageSize caps the limit query parameter
+	maxAdminPageSize = 200
+)
+
+type AdminConversationInfo struct {
+	ConversationInfo
+	Username string `json:"username"`
+}
+
+type AdminConversationsResponse struct {
+	Conversations []AdminConversationInfo `json:"conversations"`
+	Total         int                     `json:"total"`
+}
+
+// parseAdminConversationFilter reads the admin conversation filters from the query string
+func parseAdminConversationFilter(query url.Values) (db.AdminConversationFilter, error) {
+	filter := db.AdminConversationFilter{
+		UserID:         query.Get("user_id"),
+		ResponseFormat: query.Get("format"),
+		Limit:          defaultAdminPageSize,
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{{"created_after", &filter.CreatedAfter}, {"created_before", &filter.CreatedBefore}} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid '%s' date, expected RFC3339", param.name)
+			}
+			*param.dest = &t
+		}
+	}
+
+	if value := query.Get("has_summary"); value != "" {
+		hasSummary, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'has_summary', expected true or false")
+		}
+		filter.HasSummary = &hasSummary
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAdminPageSize {
+			return filter, fmt.Errorf("'limit' must be between 1 and %d", maxAdminPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("'offset' must be a non-negative integer")
+		}
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// GetAllConversationsHandler lists conversations across all users with optional filters
+func (ch *ChatHandlers) GetAllConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Admin conversations request from user: %s", username)
+
+	filter, err := parseAdminConversationFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conversations, total, err := db.GetAllConversations(filter)
+	if err != nil {
+		reqLog.Printf("[ADMIN] Error getting conversations: %v", err)
+		http.Error(w, "Error retrieving conversations", http.StatusInternalServerError)
+		return
+	}
+
+	convIDs := make([]string, 0, len(conversations))
+	for _, conv := range conversations {
+		if conv.ActiveSummaryID != nil {
+			convIDs = append(convIDs, conv.ID)
+		}
+	}
+	summaries, err := db.BatchGetActiveSummaries(convIDs)
+	if err != nil {
+		reqLog.Printf("[ADMIN] Warning: failed to load active summaries: %v", err)
+	}
+
+	convInfos := make([]AdminConversationInfo, 0, len(conversations))
+	for _, conv := range conversations {
+		var summarizedUpToMsgID *string
+		if summary, ok := summaries[conv.ID]; ok {
+			summarizedUpToMsgID = summary.SummarizedUpToMessageID
+		}
+
+		convInfos = append(convInfos, AdminConversationInfo{
+			ConversationInfo: newConversationInfo(&conv.Conversation, summarizedUpToMsgID),
+			Username:         conv.Username,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminConversationsResponse{
+		Conversations: convInfos,
+		Total:         total,
+	})
+}
+
+type RawPromptResponse struct {
+	PromptMessages []llm.Message `json:"prompt_messages"`
+}
+
+// storeRawPrompt records the exact prompt sent to the LLM for an assistant message when enabled
+func storeRawPrompt(reqLog *log.Logger, msgID string, history []llm.Message, customSystemPrompt string) {
+	if !config.GetStoreRawPrompts() {
+		return
+	}
+	if err := db.SetMessageRawPrompt(msgID, llm.BuildPromptMessages(history, customSystemPrompt)); err != nil {
+		reqLog.Printf("[CHAT] Warning: failed to store raw prompt: %v", err)
+	}
+}
+
+// GetRawPromptHandler returns the exact prompt that was sent to the LLM for an assistant message
+func (ch *ChatHandlers) GetRawPromptHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	msgID := r.PathValue("msgId")
+	reqLog.Printf("Admin raw prompt request from user: %s for message: %s", username, msgID)
+
+	message, err := db.GetMessage(msgID)
+	if err != nil || message.ConversationID != convID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	prompt, err := db.GetMessageRawPrompt(msgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No raw prompt stored for this message", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[ADMIN] Error getting raw prompt: %v", err)
+		http.Error(w, "Error retrieving raw prompt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RawPromptResponse{PromptMessages: prompt})
+}
+
+type ModelsReloadResponse struct {
+	ModelsLoaded int `json:"models_loaded"`
+}
+
+// ReloadModelsHandler re-reads the models config file; the previous models stay in effect if it is invalid
+func (ch *ChatHandlers) ReloadModelsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Admin models reload request from user: %s", username)
+
+	count, err := config.ReloadModels(config.GetDefaultModelPath())
+	if err != nil {
+		reqLog.Printf("[ADMIN] Error reloading models: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqLog.Printf("[ADMIN] Reloaded %d models", count)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelsReloadResponse{ModelsLoaded: count})
+}
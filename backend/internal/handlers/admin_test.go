@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetDBPoolHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxOpen     string
+		maxIdle     string
+		wantMaxOpen int
+		wantMaxIdle int
+	}{
+		{name: "defaults", wantMaxOpen: 25, wantMaxIdle: 10},
+		{name: "configured sizes", maxOpen: "7", maxIdle: "3", wantMaxOpen: 7, wantMaxIdle: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_MAX_OPEN_CONNS", tt.maxOpen)
+			t.Setenv("DB_MAX_IDLE_CONNS", tt.maxIdle)
+			testutil.NewMockDB(t)
+			db.ConfigurePool(db.GetDB())
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetDBPoolHandler(w, newAuthedRequest(http.MethodGet, "/api/admin/db-pool", nil, "admin", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp DBPoolResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.MaxOpen != tt.wantMaxOpen || resp.MaxIdle != tt.wantMaxIdle {
+				t.Errorf("max_open = %d, max_idle = %d, want %d and %d", resp.MaxOpen, resp.MaxIdle, tt.wantMaxOpen, tt.wantMaxIdle)
+			}
+			if resp.InUse+resp.Idle != resp.Open {
+				t.Errorf("in_use %d + idle %d != open %d", resp.InUse, resp.Idle, resp.Open)
+			}
+		})
+	}
+}
+
+func TestParseAdminConversationFilter(t *testing.T) {
+	for _, query := range []string{
+		"created_after=yesterday",
+		"created_before=2026-01-01",
+		"has_summary=maybe",
+		"limit=0",
+		"limit=201",
+		"offset=-1",
+		"offset=first",
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseAdminConversationFilter(values); err == nil {
+			t.Errorf("parseAdminConversationFilter(%q) succeeded, want an error", query)
+		}
+	}
+
+	values, _ := url.ParseQuery("user_id=u1&format=json&created_after=2026-01-01T00:00:00Z&has_summary=false&limit=10&offset=20")
+	filter, err := parseAdminConversationFilter(values)
+	if err != nil {
+		t.Fatalf("parseAdminConversationFilter() error = %v", err)
+	}
+	if filter.UserID != "u1" || filter.ResponseFormat != "json" || filter.CreatedAfter == nil || filter.CreatedBefore != nil ||
+		filter.HasSummary == nil || *filter.HasSummary || filter.Limit != 10 || filter.Offset != 20 {
+		t.Errorf("filter = %+v", filter)
+	}
+}
+
+func TestGetAllConversationsHandler(t *testing.T) {
+	const adminID = "99999999-9999-9999-9999-999999999999"
+	handler := auth.AdminMiddleware((&ChatHandlers{}).GetAllConversationsHandler)
+
+	t.Run("non-admin", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, "11111111-1111-1111-1111-111111111111", "alice")
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, "/api/admin/conversations", nil, "alice", nil))
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+		}
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, "/api/admin/conversations?limit=0", nil, "root", nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+		now := time.Now()
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM conversations c`).
+			WithArgs("", "json", nil, nil, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(`JOIN users u ON u.id = c.user_id`).
+			WithArgs("", "json", nil, nil, nil, defaultAdminPageSize, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "username", "title", "response_format", "response_schema",
+				"active_summary_id", "starred_at", "color", "created_at", "updated_at"}).
+				AddRow("c1", "u1", "alice", "Trip", "json", "", nil, nil, "", now, now).
+				AddRow("c2", "u2", "bob", "Recipes", "json", "", nil, nil, "", now, now))
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, "/api/admin/conversations?format=json", nil, "root", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp AdminConversationsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if resp.Total != 3 || len(resp.Conversations) != 2 || resp.Conversations[0].Username != "alice" || resp.Conversations[1].Username != "bob" {
+			t.Errorf("response = %+v, want alice's and bob's conversations of 3", resp)
+		}
+	})
+}
+
+func TestStoreRawPrompt(t *testing.T) {
+	t.Setenv("OPENROUTER_SYSTEM_PROMPT", "Be brief.")
+	history := []llm.Message{{Role: "user", Content: "hi"}}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("STORE_RAW_PROMPTS", "")
+		testutil.NewMockDB(t)
+
+		// Any statement would fail against the mock and log a warning
+		var logs bytes.Buffer
+		storeRawPrompt(log.New(&logs, "", 0), "m1", history, "Answer in French.")
+		if logs.Len() != 0 {
+			t.Errorf("log = %q, want nothing stored", logs.String())
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv("STORE_RAW_PROMPTS", "true")
+		mock := testutil.NewMockDB(t)
+		mock.ExpectExec(`UPDATE messages SET full_prompt = \$1 WHERE id = \$2`).
+			WithArgs(`[{"role":"system","content":"Be brief.\n\nAnswer in French."},{"role":"user","content":"hi"}]`, "m1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var logs bytes.Buffer
+		storeRawPrompt(log.New(&logs, "", 0), "m1", history, "Answer in French.")
+		if logs.Len() != 0 {
+			t.Errorf("log = %q, want the prompt stored", logs.String())
+		}
+	})
+}
+
+func TestGetRawPromptHandler(t *testing.T) {
+	const (
+		adminID = "99999999-9999-9999-9999-999999999999"
+		convID  = "33333333-3333-3333-3333-333333333333"
+		msgID   = "44444444-4444-4444-4444-444444444444"
+	)
+	handler := auth.AdminMiddleware((&ChatHandlers{}).GetRawPromptHandler)
+	pathValues := map[string]string{"id": convID, "msgId": msgID}
+	target := "/api/admin/conversations/" + convID + "/messages/" + msgID + "/raw-prompt"
+	expectRawPrompt := func(mock sqlmock.Sqlmock, prompt any) {
+		mock.ExpectQuery(`SELECT full_prompt FROM messages WHERE id = \$1`).
+			WithArgs(msgID).
+			WillReturnRows(sqlmock.NewRows([]string{"full_prompt"}).AddRow(prompt))
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantPrompt []llm.Message
+	}{
+		{
+			name:     "non-admin",
+			username: "alice",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, "11111111-1111-1111-1111-111111111111", "alice")
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "message in another conversation",
+			username: "root",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectAdmin(mock, adminID, "root")
+				testutil.ExpectMessage(mock, msgID, "55555555-5555-5555-5555-555555555555", "assistant", "Hello")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:     "no raw prompt stored",
+			username: "root",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectAdmin(mock, adminID, "root")
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "Hello")
+				expectRawPrompt(mock, nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:     "stored",
+			username: "root",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectAdmin(mock, adminID, "root")
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "Hello")
+				expectRawPrompt(mock, `[{"role":"system","content":"Be brief."},{"role":"user","content":"hi"}]`)
+			},
+			wantStatus: http.StatusOK,
+			wantPrompt: []llm.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "hi"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodGet, target, nil, tt.username, pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantPrompt == nil {
+				return
+			}
+			var resp RawPromptResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if len(resp.PromptMessages) != len(tt.wantPrompt) {
+				t.Fatalf("prompt_messages = %+v, want %+v", resp.PromptMessages, tt.wantPrompt)
+			}
+			for i, msg := range resp.PromptMessages {
+				if msg.Role != tt.wantPrompt[i].Role || msg.Content != tt.wantPrompt[i].Content {
+					t.Errorf("prompt_messages[%d] = %+v, want %+v", i, msg, tt.wantPrompt[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReloadModelsHandler(t *testing.T) {
+	const adminID = "99999999-9999-9999-9999-999999999999"
+	handler := auth.AdminMiddleware((&ChatHandlers{}).ReloadModelsHandler)
+	setTestModels(t, []config.Model{{ID: "vendor/old"}})
+
+	// The models file is read from backend/config relative to the working directory
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "backend", "config"), 0o755); err != nil {
+		t.Fatalf("error creating config directory: %v", err)
+	}
+	writeModels := func(t *testing.T, content string) {
+		if err := os.WriteFile(config.GetDefaultModelPath(), []byte(content), 0o600); err != nil {
+			t.Fatalf("error writing models file: %v", err)
+		}
+	}
+
+	t.Run("non-admin", func(t *testing.T) {
+		writeModels(t, `[{"id":"vendor/new"}]`)
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, "11111111-1111-1111-1111-111111111111", "alice")
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodPost, "/api/admin/models/reload", nil, "alice", nil))
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusForbidden, w.Body.String())
+		}
+		if _, ok := config.GetModelByID("vendor/old"); !ok {
+			t.Error("models reloaded for a non-admin")
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		writeModels(t, `[{"id":"vendor/new"},{"id":"vendor/new"}]`)
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodPost, "/api/admin/models/reload", nil, "root", nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+		}
+		if _, ok := config.GetModelByID("vendor/old"); !ok {
+			t.Error("previous models replaced by an invalid file")
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		writeModels(t, `[{"id":"vendor/new"},{"id":"vendor/other"}]`)
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectAdmin(mock, adminID, "root")
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodPost, "/api/admin/models/reload", nil, "root", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp ModelsReloadResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if resp.ModelsLoaded != 2 {
+			t.Errorf("models_loaded = %d, want 2", resp.ModelsLoaded)
+		}
+		if _, ok := config.GetModelByID("vendor/new"); !ok {
+			t.Error("vendor/new not available after the reload")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxAttachments is the maximum number of files per chat message
+	MaxAttachments = 5
+	// MaxAttachmentSize is the maximum size of a single attachment in bytes
+	MaxAttachmentSize = 10 << 20
+	// multipartMemory is how much of a multipart form is buffered in memory before spilling to disk
+	multipartMemory = 32 << 20
+)
+
+// AttachmentUpload is a file received with a chat message, not yet stored
+type AttachmentUpload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+type AttachmentInfo struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	SizeBytes   int64  `json:"size_bytes"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// newAttachmentInfo converts a database attachment to its response format
+func newAttachmentInfo(a *db.Attachment) AttachmentInfo {
+	return AttachmentInfo{
+		ID:          a.ID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		SizeBytes:   a.SizeBytes,
+		CreatedAt:   a.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// isMultipartRequest reports whether the request body is multipart/form-data
+func isMultipartRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// parseMultipartChatRequest reads a chat request and its file attachments from a multipart form
+func parseMultipartChatRequest(w http.ResponseWriter, r *http.Request) (*ChatRequest, error) {
+	// Allow for the maximum attachment payload plus the text fields
+	r.Body = http.MaxBytesReader(w, r.Body, MaxAttachments*MaxAttachmentSize+(1<<20))
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		return nil, fmt.Errorf("invalid multipart form: %w", err)
+	}
+
+	form := r.MultipartForm
+	req := &ChatRequest{
+		Message:         r.FormValue("message"),
+		ConversationID:  r.FormValue("conversation_id"),
+		SystemPrompt:    r.FormValue("system_prompt"),
+		ResponseFormat:  r.FormValue("response_format"),
+		ResponseSchema:  r.FormValue("response_schema"),
+		Model:           r.FormValue("model"),
+		Provider:        r.FormValue("provider"),
+		ParentMessageID: r.FormValue("parent_message_id"),
+		Color:           r.FormValue("color"),
+		StopSequences:   form.Value["stop_sequences"],
+	}
+
+	if value := r.FormValue("temperature"); value != "" {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid temperature")
+		}
+		req.Temperature = &temperature
+	}
+
+	if value := r.FormValue("seed"); value != "" {
+		seed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed")
+		}
+		req.Seed = &seed
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **float64
+	}{{"presence_penalty", &req.PresencePenalty}, {"frequency_penalty", &req.FrequencyPenalty}} {
+		if value := r.FormValue(param.name); value != "" {
+			penalty, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", param.name)
+			}
+			*param.dest = &penalty
+		}
+	}
+
+	files := form.File["file"]
+	if len(files) > MaxAttachments {
+		return nil, fmt.Errorf("at most %d files are allowed", MaxAttachments)
+	}
+
+	for _, header := range files {
+		if header.Size > MaxAttachmentSize {
+			return nil, fmt.Errorf("file %s exceeds the %d MB limit", header.Filename, MaxAttachmentSize>>20)
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", header.Filename, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(file, MaxAttachmentSize+1))
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", header.Filename, err)
+		}
+		if len(data) > MaxAttachmentSize {
+			return nil, fmt.Errorf("file %s exceeds the %d MB limit", header.Filename, MaxAttachmentSize>>20)
+		}
+
+		req.Attachments = append(req.Attachments, AttachmentUpload{
+			Filename:    filepath.Base(header.Filename),
+			ContentType: header.Header.Get("Content-Type"),
+			Data:        data,
+		})
+	}
+
+	return req, nil
+}
+
+// saveAttachments writes uploaded files under the attachments directory and records their metadata
+func saveAttachments(conversationID, messageID string, uploads []AttachmentUpload) ([]db.Attachment, error) {
+	baseDir := config.GetAttachmentsDir()
+
+	var saved []db.Attachment
+	for _, upload := range uploads {
+		// Never use the client filename in the path; keep only its extension
+		storageKey := filepath.Join(conversationID, uuid.New().String()+filepath.Ext(upload.Filename))
+		fullPath := filepath.Join(baseDir, storageKey)
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return saved, fmt.Errorf("error creating attachments directory: %w", err)
+		}
+		if err := os.WriteFile(fullPath, upload.Data, 0o644); err != nil {
+			return saved, fmt.Errorf("error writing attachment %s: %w", upload.Filename, err)
+		}
+
+		attachment, err := db.CreateAttachment(messageID, upload.Filename, upload.ContentType, int64(len(upload.Data)), storageKey)
+		if err != nil {
+			os.Remove(fullPath)
+			return saved, err
+		}
+		saved = append(saved, *attachment)
+	}
+
+	return saved, nil
+}
+
+// discardMessage deletes a user message whose attachments could not all be saved, together with
+// the attachments that were, so no message is left without its files
+func discardMessage(reqLog *log.Logger, messageID string, saved []db.Attachment) {
+	if err := db.DeleteMessage(messageID); err != nil {
+		reqLog.Printf("[CHAT] Warning: failed to delete message %s: %v", messageID, err)
+	}
+
+	storageKeys := make([]string, 0, len(saved))
+	for _, attachment := range saved {
+		storageKeys = append(storageKeys, attachment.StorageKey)
+	}
+	removeAttachmentFiles(reqLog, storageKeys)
+}
+
+// removeAttachmentFiles deletes the stored files of attachments whose records were removed
+func removeAttachmentFiles(reqLog *log.Logger, storageKeys []string) {
+	baseDir := config.GetAttachmentsDir()
+	for _, key := range storageKeys {
+		if err := os.Remove(filepath.Join(baseDir, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			reqLog.Printf("[CHAT] Warning: failed to remove attachment file %s: %v", key, err)
+		}
+	}
+}
+
+// PurgeArchivedConversations permanently deletes conversations archived longer than olderThan ago
+// and removes their attachment and export files
+func PurgeArchivedConversations(olderThan time.Duration) error {
+	purged, exportFiles, err := db.PurgeArchivedConversations(olderThan)
+
+	// Files of conversations deleted before an error are removed all the same
+	baseDir := config.GetAttachmentsDir()
+	for _, convID := range purged {
+		if err := os.RemoveAll(filepath.Join(baseDir, convID)); err != nil {
+			log.Printf("[CHAT] Warning: failed to remove attachments of purged conversation %s: %v", convID, err)
+		}
+	}
+	removeExportFiles(exportFiles)
+
+	return err
+}
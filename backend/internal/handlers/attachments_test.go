@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newMultipartChatRequest builds a multipart chat request with the given form fields and files (name -> content)
+func newMultipartChatRequest(t *testing.T, fields map[string]string, files map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	for filename, content := range files {
+		part, err := form.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatalf("error creating form file: %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	r := newAuthedRequest(http.MethodPost, "/api/chat", &body, "alice", nil)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestParseMultipartChatRequest(t *testing.T) {
+	t.Run("fields and files", func(t *testing.T) {
+		r := newMultipartChatRequest(t,
+			map[string]string{"message": "describe this", "conversation_id": "c1", "temperature": "0.5", "seed": "7",
+				"presence_penalty": "0.5", "frequency_penalty": "-1"},
+			map[string]string{"../../notes.txt": "hello"})
+
+		req, err := parseMultipartChatRequest(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatalf("parseMultipartChatRequest() error = %v", err)
+		}
+		if req.Message != "describe this" || req.ConversationID != "c1" || *req.Temperature != 0.5 || *req.Seed != 7 ||
+			*req.PresencePenalty != 0.5 || *req.FrequencyPenalty != -1 {
+			t.Errorf("request = %+v, want the form fields", req)
+		}
+		if len(req.Attachments) != 1 || req.Attachments[0].Filename != "notes.txt" || string(req.Attachments[0].Data) != "hello" {
+			t.Errorf("attachments = %+v, want notes.txt without its directory", req.Attachments)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+		files  map[string]string
+	}{
+		{name: "invalid temperature", fields: map[string]string{"message": "hi", "temperature": "warm"}},
+		{name: "invalid seed", fields: map[string]string{"message": "hi", "seed": "x"}},
+		{name: "invalid presence penalty", fields: map[string]string{"message": "hi", "presence_penalty": "high"}},
+		{name: "invalid frequency penalty", fields: map[string]string{"message": "hi", "frequency_penalty": "1,5"}},
+		{
+			name:   "too many files",
+			fields: map[string]string{"message": "hi"},
+			files:  map[string]string{"1": "a", "2": "b", "3": "c", "4": "d", "5": "e", "6": "f"},
+		},
+		{
+			name:   "oversized file",
+			fields: map[string]string{"message": "hi"},
+			files:  map[string]string{"big.bin": strings.Repeat("a", MaxAttachmentSize+1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMultipartChatRequest(t, tt.fields, tt.files)
+			if _, err := parseMultipartChatRequest(httptest.NewRecorder(), r); err == nil {
+				t.Fatal("parseMultipartChatRequest() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestChatHandlerAttachments(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	files := map[string]string{"notes.txt": "hello"}
+
+	t.Run("other user's conversation", func(t *testing.T) {
+		t.Setenv("ATTACHMENTS_DIR", t.TempDir())
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, conv.UserID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: conv.ID, UserID: "someone-else"})
+
+		w := httptest.NewRecorder()
+		r := newMultipartChatRequest(t, map[string]string{"message": "hi", "conversation_id": conv.ID}, files)
+		(&ChatHandlers{}).ChatHandler(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("stored with the message", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("ATTACHMENTS_DIR", dir)
+		mock := testutil.NewMockDB(t)
+		expectMessageStart(t, mock, conv)
+		mock.ExpectQuery(`INSERT INTO message_attachments`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "notes.txt", sqlmock.AnyArg(), int64(5), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		testutil.ExpectHistory(mock, conv.ID, "hi")
+		expectReplyStored(t, mock, conv.ID)
+
+		w := httptest.NewRecorder()
+		r := newMultipartChatRequest(t, map[string]string{"message": "hi", "conversation_id": conv.ID}, files)
+		(&ChatHandlers{fallbackProvider: &stubProvider{response: "got it"}}).ChatHandler(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		stored, _ := filepath.Glob(filepath.Join(dir, conv.ID, "*.txt"))
+		if len(stored) != 1 {
+			t.Errorf("stored files = %v, want one", stored)
+		}
+	})
+
+	t.Run("message removed when attachments fail", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("ATTACHMENTS_DIR", dir)
+		mock := testutil.NewMockDB(t)
+		expectMessageStart(t, mock, conv)
+		mock.ExpectQuery(`INSERT INTO message_attachments`).WillReturnError(errors.New("disk quota"))
+		mock.ExpectExec(`DELETE FROM messages WHERE id = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		provider := &stubProvider{response: "got it"}
+		w := httptest.NewRecorder()
+		r := newMultipartChatRequest(t, map[string]string{"message": "hi", "conversation_id": conv.ID}, files)
+		(&ChatHandlers{fallbackProvider: provider}).ChatHandler(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+		if provider.calls != 0 {
+			t.Error("provider was called after the attachments failed")
+		}
+		entries, _ := os.ReadDir(filepath.Join(dir, conv.ID))
+		if len(entries) != 0 {
+			t.Errorf("attachment files left behind: %v", entries)
+		}
+	})
+}
+
+func TestNewAttachmentInfoFormatsCreatedAt(t *testing.T) {
+	info := newAttachmentInfo(&db.Attachment{ID: "a1", CreatedAt: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)})
+	if info.CreatedAt != "2026-03-01T10:00:00Z" {
+		t.Errorf("created_at = %q, want RFC 3339", info.CreatedAt)
+	}
+}
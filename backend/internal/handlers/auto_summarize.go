@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"context"
+	"log"
+)
+
+// maybeAutoSummarize starts a background summarization once a conversation has grown past the
+// configured threshold and its active summary is due for renewal. Failures are only logged.
+func (ch *ChatHandlers) maybeAutoSummarize(reqLog *log.Logger, convID string) {
+	threshold := config.GetAutoSummarizeThreshold()
+	if threshold <= 0 {
+		return
+	}
+
+	count, err := db.CountMessages(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Warning: failed to count messages for auto-summarization: %v", err)
+		return
+	}
+	if count <= threshold {
+		return
+	}
+
+	// One background summarization per conversation at a time
+	if _, running := ch.autoSummarizing.LoadOrStore(convID, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer ch.autoSummarizing.Delete(convID)
+		// The summarization outlives the request that triggered it
+		if err := ch.autoSummarize(context.Background(), reqLog, convID); err != nil {
+			reqLog.Printf("[SUMMARIZE] Auto-summarization failed: %v", err)
+		}
+	}()
+}
+
+// autoSummarize creates a new active summary for a conversation with the default summarizer and
+// model, unless its active summary is not yet due for renewal
+func (ch *ChatHandlers) autoSummarize(ctx context.Context, reqLog *log.Logger, convID string) error {
+	input, err := prepareSummarization(reqLog, convID)
+	if err != nil {
+		return err
+	}
+	if input.current != nil {
+		return nil
+	}
+
+	provider := ch.getSummarizer("")
+	model := selectSummarizationModel(reqLog, "")
+	prompt := getSummarizationPrompt()
+
+	reqLog.Printf("[SUMMARIZE] Auto-summarizing conversation %s (%d messages)", convID, len(input.messages))
+	summaryContent, err := provider.ChatForSummarization(ctx, input.messages, prompt, model, nil)
+	if err != nil {
+		return err
+	}
+	summaryContent = enforceSummaryLength(ctx, reqLog, provider, input.messages, prompt, model, nil, summaryContent)
+
+	if _, err := saveSummary(provider, convID, summaryContent, input.lastMessageID); err != nil {
+		return err
+	}
+	reqLog.Printf("[SUMMARIZE] Auto-summarized conversation %s", convID)
+	return nil
+}
@@ -6,26 +6,91 @@ import (
 	"chat-app/internal/context"
 	"chat-app/internal/db"
 	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"chat-app/internal/metrics"
+	"chat-app/internal/moderation"
+	"chat-app/internal/rag"
+	"chat-app/internal/tracing"
+	"chat-app/internal/validation"
+	stdcontext "context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ChatRequest struct {
-	Message             string        `json:"message,omitempty"`
-	Messages            []llm.Message `json:"messages,omitempty"`
-	ConversationID      string        `json:"conversation_id,omitempty"`
-	SystemPrompt        string        `json:"system_prompt,omitempty"`
-	ResponseFormat      string        `json:"response_format,omitempty"`
-	ResponseSchema      string        `json:"response_schema,omitempty"`
-	Model               string        `json:"model,omitempty"`
-	Temperature         *float64      `json:"temperature,omitempty"`
-	Provider            string        `json:"provider,omitempty"`               // "openrouter" or "genkit"
-	UseWarAndPeace      bool          `json:"use_war_and_peace,omitempty"`      // Append War and Peace to system prompt
-	WarAndPeacePercent  int           `json:"war_and_peace_percent,omitempty"`  // Percentage of War and Peace to include (1-100)
+	Message            string        `json:"message,omitempty"`
+	Messages           []llm.Message `json:"messages,omitempty"`
+	ConversationID     string        `json:"conversation_id,omitempty"`
+	SystemPrompt       string        `json:"system_prompt,omitempty"`
+	ResponseFormat     string        `json:"response_format,omitempty"`
+	ResponseSchema     string        `json:"response_schema,omitempty"`
+	Model              string        `json:"model,omitempty"`
+	Temperature        *float64      `json:"temperature,omitempty"`
+	Provider           string        `json:"provider,omitempty"`              // "openrouter" or "genkit"
+	UseWarAndPeace     bool          `json:"use_war_and_peace,omitempty"`     // Append War and Peace to system prompt
+	WarAndPeacePercent int           `json:"war_and_peace_percent,omitempty"` // Percentage of War and Peace to include (1-100)
+	StopSequences      []string      `json:"stop_sequences,omitempty"`        // Custom stop tokens (max 4)
+	Seed               *int          `json:"seed,omitempty"`                  // Seed for reproducible outputs (if the model supports it)
+	PresencePenalty    *float64      `json:"presence_penalty,omitempty"`      // -2 to 2, positive values favour new topics
+	FrequencyPenalty   *float64      `json:"frequency_penalty,omitempty"`     // -2 to 2, positive values discourage repetition
+	ParentMessageID    string        `json:"parent_message_id,omitempty"`     // Message this one replies to in a branch discussion
+	FlushMode          string        `json:"flush_mode,omitempty"`            // Streaming granularity: "token" (default), "sentence" or "paragraph"
+	Color              string        `json:"color,omitempty"`                 // UI color hint for a new conversation, e.g. "#ff5733"
+
+	ProviderSpecificConfig json.RawMessage `json:"provider_specific_config,omitempty"` // Extra OpenRouter request fields, e.g. {"reasoning":{...}}
+	ImageURLs              []string        `json:"image_urls,omitempty"`               // Images sent with the message to a vision model
+
+	Attachments []AttachmentUpload `json:"-"` // Files sent via multipart/form-data
+}
+
+// isStateless reports whether the request carries its own history instead of a single message
+func (req *ChatRequest) isStateless() bool {
+	return req.Message == "" && len(req.Messages) > 0
+}
+
+// userMessage returns the new user message of the request
+func (req *ChatRequest) userMessage() string {
+	if req.isStateless() {
+		return req.Messages[len(req.Messages)-1].Content
+	}
+	return req.Message
+}
+
+// moderatedContents returns the request text to run through moderation: the message, or every
+// message of a client-supplied history, since all of its turns are written by the client and reach the LLM
+func (req *ChatRequest) moderatedContents() []string {
+	if !req.isStateless() {
+		return []string{req.Message}
+	}
+	contents := make([]string, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		contents = append(contents, msg.Content)
+	}
+	return contents
+}
+
+// chatOptions returns the optional generation parameters of the request
+func (req *ChatRequest) chatOptions() *llm.ChatOptions {
+	return &llm.ChatOptions{
+		Stop:             req.StopSequences,
+		Seed:             req.Seed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		ProviderConfig:   req.ProviderSpecificConfig,
+	}
 }
 
 type ChatResponse struct {
@@ -41,12 +106,33 @@ type ConversationInfo struct {
 	ResponseFormat          string  `json:"response_format"`
 	ResponseSchema          string  `json:"response_schema"`
 	SummarizedUpToMessageID *string `json:"summarized_up_to_message_id,omitempty"`
+	Starred                 bool    `json:"starred"`
+	Color                   string  `json:"color"`                 // Hex UI hint, empty when the client picks its own
+	ArchivedAt              *string `json:"archived_at,omitempty"` // Set while the conversation is deleted but restorable
 	CreatedAt               string  `json:"created_at"`
 	UpdatedAt               string  `json:"updated_at"`
 }
 
+type ConversationStatsData struct {
+	MessageCount          int            `json:"message_count"`
+	UserMessageCount      int            `json:"user_message_count"`
+	AssistantMessageCount int            `json:"assistant_message_count"`
+	PromptTokens          int            `json:"prompt_tokens"`
+	CompletionTokens      int            `json:"completion_tokens"`
+	TotalTokens           int            `json:"total_tokens"`
+	TotalCost             float64        `json:"total_cost"`
+	AvgResponseTimeMs     *float64       `json:"avg_response_time_ms,omitempty"`
+	MessageCountByRole    map[string]int `json:"message_count_by_role"`
+}
+
+type ConversationWithStatsResponse struct {
+	ConversationInfo
+	Stats ConversationStatsData `json:"stats"`
+}
+
 type ConversationsResponse struct {
 	Conversations []ConversationInfo `json:"conversations"`
+	NextCursor    string             `json:"next_cursor,omitempty"` // Pass as ?before= to fetch the next page; empty on the last page
 }
 
 type MessageData struct {
@@ -55,19 +141,51 @@ type MessageData struct {
 	Content          string   `json:"content"`
 	Model            string   `json:"model,omitempty"`
 	Temperature      *float64 `json:"temperature,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
 	PromptTokens     *int     `json:"prompt_tokens,omitempty"`
 	CompletionTokens *int     `json:"completion_tokens,omitempty"`
 	TotalTokens      *int     `json:"total_tokens,omitempty"`
 	TotalCost        *float64 `json:"total_cost,omitempty"`
+	InputCostUSD     *float64 `json:"input_cost_usd,omitempty"`
+	OutputCostUSD    *float64 `json:"output_cost_usd,omitempty"`
 	Latency          *int     `json:"latency,omitempty"`
 	GenerationTime   *int     `json:"generation_time,omitempty"`
-	CreatedAt        string   `json:"created_at"`
+	ResponseTimeMs   *int     `json:"response_time_ms,omitempty"`
+	ParentMessageID  *string  `json:"parent_message_id,omitempty"`
+	Partial          bool     `json:"partial,omitempty"`
+	EditedAt         *string  `json:"edited_at,omitempty"` // Set once the user has edited the message
+	// SystemPromptChanged is set when the reply was generated with a different system prompt than the previous one
+	SystemPromptChanged bool             `json:"system_prompt_changed,omitempty"`
+	UserFeedback        *FeedbackData    `json:"user_feedback,omitempty"`
+	Attachments         []AttachmentInfo `json:"attachments,omitempty"`
+	CreatedAt           string           `json:"created_at"`
 }
 
 type MessagesResponse struct {
 	Messages []MessageData `json:"messages"`
 }
 
+type StarRequest struct {
+	Starred *bool `json:"starred,omitempty"`
+}
+
+type StarResponse struct {
+	Starred bool `json:"starred"`
+}
+
+// UpdateConversationRequest holds the conversation fields that can be patched; nil fields are left unchanged
+type UpdateConversationRequest struct {
+	Title          *string `json:"title"`
+	ResponseFormat *string `json:"response_format"`
+	ResponseSchema *string `json:"response_schema"` // Ignored for text conversations
+	Color          *string `json:"color"`           // Empty string clears the color
+}
+
+type UpdateFormatRequest struct {
+	ResponseFormat string `json:"response_format"`
+	ResponseSchema string `json:"response_schema"`
+}
+
 type DeleteResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
@@ -80,13 +198,14 @@ type ModelsResponse struct {
 type SummarizeRequest struct {
 	Model       string   `json:"model,omitempty"`
 	Temperature *float64 `json:"temperature,omitempty"`
+	Provider    string   `json:"provider,omitempty"`
 }
 
 type SummarizeResponse struct {
-	Summary              string `json:"summary"`
-	SummarizedUpToMsgID  string `json:"summarized_up_to_message_id,omitempty"`
-	ConversationID       string `json:"conversation_id"`
-	Error                string `json:"error,omitempty"`
+	Summary             string `json:"summary"`
+	SummarizedUpToMsgID string `json:"summarized_up_to_message_id,omitempty"`
+	ConversationID      string `json:"conversation_id"`
+	Error               string `json:"error,omitempty"`
 }
 
 type SummaryData struct {
@@ -101,56 +220,275 @@ type SummariesResponse struct {
 	Summaries []SummaryData `json:"summaries"`
 }
 
-type ChatHandlers struct{}
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"` // Correlation ID for clients to quote when reporting the error
+}
+
+type ChatHandlers struct {
+	inFlight         *InFlightTracker
+	moderator        *moderation.Moderator
+	vectorStore      rag.VectorStore // nil when retrieval is disabled
+	streamSlots      chan struct{}   // semaphore limiting concurrent streams, nil when unlimited
+	fallbackProvider llm.LLMProvider // used when a request doesn't select a provider
+	exports          *JobRunner      // background conversation exports
+	autoSummarizing  sync.Map        // conversation IDs with a background summarization running
+}
+
+func NewChatHandlers(moderator *moderation.Moderator, vectorStore rag.VectorStore) *ChatHandlers {
+	ch := &ChatHandlers{
+		inFlight:    NewInFlightTracker(config.GetInFlightWindow()),
+		moderator:   moderator,
+		vectorStore: vectorStore,
+		exports:     NewJobRunner(config.GetExportDir()),
+	}
+
+	if maxStreams := config.GetMaxConcurrentStreams(); maxStreams > 0 {
+		ch.streamSlots = make(chan struct{}, maxStreams)
+	}
+
+	// Build the provider fallback chain if one is configured
+	if order := config.GetProviderOrder(); len(order) > 0 {
+		chain, err := llm.NewProviderChain(order)
+		if err != nil {
+			log.Printf("[CHAT] Warning: failed to build provider chain %v, using default provider: %v", order, err)
+		} else {
+			ch.fallbackProvider = chain
+		}
+	}
+
+	return ch
+}
+
+// getProvider returns the provider selected by the request, or the fallback chain if none was selected
+func (ch *ChatHandlers) getProvider(provider string) llm.LLMProvider {
+	if provider == "" && ch.fallbackProvider != nil {
+		return ch.fallbackProvider
+	}
+	return llm.GetProviderFromString(provider)
+}
+
+// getSummarizer returns the named provider, or the fallback provider when none is named, if it
+// supports summarization without the default system prompt, falling back to OpenRouter otherwise
+func (ch *ChatHandlers) getSummarizer(provider string) llm.Summarizer {
+	if provider != "" {
+		if summarizer, ok := llm.GetProviderFromString(provider).(llm.Summarizer); ok {
+			return summarizer
+		}
+	} else if summarizer, ok := ch.fallbackProvider.(llm.Summarizer); ok {
+		return summarizer
+	}
+	return llm.NewOpenRouterProvider()
+}
+
+// checkModeration rejects messages matching the moderation blocklist. It returns false if a response was written.
+func (ch *ChatHandlers) checkModeration(reqLog *log.Logger, w http.ResponseWriter, username, message string) bool {
+	blocked, triggers, err := ch.moderator.Check(message)
+	if err != nil {
+		reqLog.Printf("[MODERATION] Error checking message: %v", err)
+		http.Error(w, "Error checking message", http.StatusInternalServerError)
+		return false
+	}
+	if blocked {
+		// Triggering patterns are only logged, never returned to the client
+		reqLog.Printf("[MODERATION] Blocked message from user %s, triggers: %v", username, triggers)
+		writeErrorCode(w, http.StatusBadRequest, "CONTENT_MODERATED")
+		return false
+	}
+	return true
+}
+
+// writeErrorCode writes a JSON error response with a machine-readable code and the
+// request's correlation ID, which RequestLogger has already set as a response header
+func writeErrorCode(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		RequestID: w.Header().Get(logger.RequestIDHeader),
+	})
+}
+
+// chatError is returned by sendMessage and carries the HTTP response to send
+type chatError struct {
+	Status  int
+	Message string // plain-text error message
+	Code    string // machine-readable error code, sent as an ErrorResponse
+	LLMErr  error  // LLM failure, sent as a ChatResponse error
+}
+
+func (e *chatError) Error() string {
+	if e.LLMErr != nil {
+		return e.LLMErr.Error()
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return e.Message
+}
+
+// writeChatError writes the HTTP response for an error returned by sendMessage
+func writeChatError(w http.ResponseWriter, err error) {
+	var chatErr *chatError
+	if !errors.As(err, &chatErr) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
-func NewChatHandlers() *ChatHandlers {
-	return &ChatHandlers{}
+	switch {
+	case chatErr.LLMErr != nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(chatErr.Status)
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: chatErr.LLMErr.Error(),
+		})
+	case chatErr.Code != "":
+		writeErrorCode(w, chatErr.Status, chatErr.Code)
+	default:
+		http.Error(w, chatErr.Message, chatErr.Status)
+	}
 }
 
 // ChatHandler is the REST endpoint for chat
 func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	username := r.Context().Value(auth.UserContextKey).(string)
-	log.Printf("Chat request from user: %s", username)
+	reqLog.Printf("Chat request from user: %s", username)
 
 	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if isMultipartRequest(r) {
+		multipartReq, err := parseMultipartChatRequest(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req = *multipartReq
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if req.Message == "" {
+	if req.isStateless() {
+		if err := validation.ValidateChatHistory(req.Messages); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if req.Message == "" {
 		http.Error(w, "Message cannot be empty", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[CHAT] User input: %s", req.Message)
+	if err := validation.ValidateStopSequences(req.StopSequences); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidateSeed(req.Seed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// War and Peace context is appended later, only the user-supplied prompt is limited
+	if err := validation.ValidateSystemPromptLength(req.SystemPrompt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidatePresencePenalty(req.PresencePenalty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidateFrequencyPenalty(req.FrequencyPenalty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Color != "" {
+		if err := validation.ValidateColor(req.Color); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validation.ValidateProviderConfig(req.ProviderSpecificConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !ch.checkImageSupport(reqLog, w, &req) {
+		return
+	}
+
+	if err := validation.ValidateResponseSchema(req.ResponseFormat, req.ResponseSchema); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reqLog.Printf("[CHAT] User input: %s", req.userMessage())
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[CHAT] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
+	resp, err := ch.sendMessage(r.Context(), user.ID, &req)
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// sendMessage stores a user message, gets the LLM response with the full conversation
+// history and stores it. It is shared by the REST chat endpoint and webhook ingestion.
+// Requests carrying their own history are answered from that history; they are only
+// stored when a conversation ID is given.
+func (ch *ChatHandlers) sendMessage(ctx stdcontext.Context, userID string, req *ChatRequest) (resp *ChatResponse, err error) {
+	ctx, span := tracing.Start(ctx, "chat.send_message")
+	defer func() { tracing.End(span, err) }()
+
+	ctx = logger.WithField(ctx, "user_id", userID)
+	reqLog := logger.FromContext(ctx)
+
+	for _, content := range req.moderatedContents() {
+		blocked, triggers, err := ch.moderator.Check(content)
+		if err != nil {
+			reqLog.Printf("[MODERATION] Error checking message: %v", err)
+			return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error checking message"}
+		}
+		if blocked {
+			// Triggering patterns are only logged, never returned to the client
+			reqLog.Printf("[MODERATION] Blocked message from user %s, triggers: %v", userID, triggers)
+			return nil, &chatError{Status: http.StatusBadRequest, Code: "CONTENT_MODERATED"}
+		}
+	}
+
+	if req.isStateless() && req.ConversationID == "" {
+		return ch.sendStatelessMessage(ctx, reqLog, req)
+	}
+
 	// Get or create conversation
 	var conversation *db.Conversation
 	if req.ConversationID != "" {
 		conversation, err = db.GetConversation(req.ConversationID)
 		if err != nil {
-			log.Printf("[CHAT] Error getting conversation: %v", err)
-			http.Error(w, "Conversation not found", http.StatusNotFound)
-			return
+			reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+			return nil, &chatError{Status: http.StatusNotFound, Message: "Conversation not found"}
 		}
 		// Verify user owns this conversation
-		if conversation.UserID != user.ID {
-			http.Error(w, "Unauthorized", http.StatusForbidden)
-			return
+		if conversation.UserID != userID {
+			return nil, &chatError{Status: http.StatusForbidden, Message: "Unauthorized"}
 		}
 	} else {
 		// Create new conversation with first message as title and specified format
@@ -160,75 +498,155 @@ func (ch *ChatHandlers) ChatHandler(w http.ResponseWriter, r *http.Request) {
 		if len(runes) > 100 {
 			title = string(runes[:100])
 		}
-		conversation, err = db.CreateConversation(user.ID, title, req.ResponseFormat, req.ResponseSchema)
+		conversation, err = db.CreateConversation(userID, title, req.ResponseFormat, req.ResponseSchema, req.Color)
 		if err != nil {
-			log.Printf("[CHAT] Error creating conversation: %v", err)
-			http.Error(w, "Error creating conversation", http.StatusInternalServerError)
-			return
+			reqLog.Printf("[CHAT] Error creating conversation: %v", err)
+			return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error creating conversation"}
 		}
 	}
 
+	ctx = logger.WithField(ctx, "conversation_id", conversation.ID)
+	reqLog = logger.FromContext(ctx)
+	span.SetAttributes(attribute.String("chat.conversation_id", conversation.ID))
+
 	// Validate model if provided
 	model := req.Model
 	if model != "" && !config.IsValidModel(model) {
-		http.Error(w, "Invalid model specified", http.StatusBadRequest)
-		return
+		return nil, &chatError{Status: http.StatusBadRequest, Message: "Invalid model specified"}
 	}
 
-	// Add user message to database (user messages don't have a model, temperature, provider, or usage data)
-	if _, err := db.AddMessage(conversation.ID, "user", req.Message, "", nil, "", "", nil, nil, nil, nil, nil, nil); err != nil {
-		log.Printf("[CHAT] Error adding user message: %v", err)
-		http.Error(w, "Error saving message", http.StatusInternalServerError)
-		return
+	if err := validateParentMessage(conversation.ID, req.ParentMessageID); err != nil {
+		return nil, &chatError{Status: http.StatusBadRequest, Message: err.Error()}
 	}
 
-	// Get conversation history
-	currentHistory, err := db.GetConversationMessages(conversation.ID)
+	if duplicate, err := isDuplicateMessage(conversation.ID, req.userMessage()); err != nil {
+		reqLog.Printf("[CHAT] Warning: duplicate message check failed: %v", err)
+	} else if duplicate {
+		reqLog.Printf("[CHAT] Duplicate message rejected in conversation %s", conversation.ID)
+		return nil, &chatError{Status: http.StatusConflict, Code: "DUPLICATE_MESSAGE"}
+	}
+
+	// Add user message to database (user messages don't have a model, temperature, provider, or usage data)
+	startedAt := time.Now()
+	userMsg, err := db.AddMessage(conversation.ID, "user", req.userMessage(), "", nil, nil, "", "", nil, nil, nil, nil, nil, nil, nil, nil, nil, req.ParentMessageID)
 	if err != nil {
-		log.Printf("[CHAT] Error getting conversation history: %v", err)
-		http.Error(w, "Error retrieving conversation history", http.StatusInternalServerError)
-		return
+		reqLog.Printf("[CHAT] Error adding user message: %v", err)
+		return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error saving message"}
+	}
+
+	if len(req.Attachments) > 0 {
+		if saved, err := saveAttachments(conversation.ID, userMsg.ID, req.Attachments); err != nil {
+			reqLog.Printf("[CHAT] Error saving attachments: %v", err)
+			discardMessage(reqLog, userMsg.ID, saved)
+			return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error saving attachments"}
+		}
+		reqLog.Printf("[CHAT] Saved %d attachments for message %s", len(req.Attachments), userMsg.ID)
+	}
+
+	// Get conversation history (a client-supplied history replaces the stored one)
+	currentHistory := req.Messages
+	if !req.isStateless() {
+		currentHistory, err = db.GetConversationMessages(conversation.ID)
+		if err != nil {
+			reqLog.Printf("[CHAT] Error getting conversation history: %v", err)
+			return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error retrieving conversation history"}
+		}
 	}
 
-	log.Printf("[CHAT] Conversation history length: %d messages", len(currentHistory))
+	attachImages(currentHistory, req.ImageURLs)
+	reqLog.Printf("[CHAT] Conversation history length: %d messages", len(currentHistory))
 
 	// Get LLM provider based on request
-	provider := llm.GetProviderFromString(req.Provider)
-	log.Printf("[CHAT] Using provider: %T", provider)
+	provider := ch.getProvider(req.Provider)
+	reqLog.Printf("[CHAT] Using provider: %T", provider)
+
+	systemPrompt := ch.withRetrievedContext(reqLog, req.SystemPrompt, req.userMessage())
 
 	// Get response with full conversation history
-	response, err := provider.ChatWithHistory(currentHistory, req.SystemPrompt, conversation.ResponseFormat, model, req.Temperature)
+	response, usedModel, err := chatWithFallback(ctx, reqLog, provider, currentHistory, systemPrompt, conversation.ResponseFormat, model, req.Temperature, req.chatOptions())
 	if err != nil {
-		log.Printf("[CHAT] Error from LLM: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: err.Error(),
-		})
-		return
+		reqLog.Printf("[CHAT] Error from LLM: %v", err)
+		return nil, &chatError{Status: http.StatusInternalServerError, LLMErr: err}
 	}
+	span.SetAttributes(attribute.String("llm.model", usedModel))
 
-	log.Printf("[CHAT] LLM response: %s", response)
-
-	// Determine which model was actually used
-	usedModel := model
-	if usedModel == "" {
-		usedModel = provider.GetDefaultModel()
-	}
+	reqLog.Printf("[CHAT] LLM response: %s", response)
 
 	// Add assistant response to database with model, temperature, and provider (no usage data for non-streaming)
-	if _, err := db.AddMessage(conversation.ID, "assistant", response, usedModel, req.Temperature, req.Provider, "", nil, nil, nil, nil, nil, nil); err != nil {
-		log.Printf("[CHAT] Error adding assistant message: %v", err)
-		http.Error(w, "Error saving response", http.StatusInternalServerError)
-		return
+	responseTimeMs := int(time.Since(startedAt).Milliseconds())
+	assistantMsg, err := db.AddMessage(conversation.ID, "assistant", response, usedModel, req.Temperature, req.Seed, req.Provider, "", nil, nil, nil, nil, nil, nil, nil, nil, &responseTimeMs, "")
+	if err != nil {
+		reqLog.Printf("[CHAT] Error adding assistant message: %v", err)
+		return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error saving response"}
 	}
+	metrics.RecordLLMUsage(usedModel, assistantMsg.PromptTokens, assistantMsg.CompletionTokens, assistantMsg.TotalCost)
+	storeRawPrompt(reqLog, assistantMsg.ID, currentHistory, systemPrompt)
+	storeSystemPromptHash(reqLog, assistantMsg.ID, req.SystemPrompt)
+	ch.maybeAutoSummarize(reqLog, conversation.ID)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ChatResponse{
+	return &ChatResponse{
 		Response:       response,
 		ConversationID: conversation.ID,
 		Model:          usedModel,
-	})
+	}, nil
+}
+
+// isDuplicateMessage reports whether content repeats the conversation's last user message
+// within the configured duplicate window (typically a client resending the same request)
+func isDuplicateMessage(conversationID, content string) (bool, error) {
+	window := config.GetDuplicateMessageWindow()
+	if window <= 0 {
+		return false, nil
+	}
+
+	last, err := db.GetLastMessageByConversation(conversationID, "user")
+	if err != nil || last == nil {
+		return false, err
+	}
+
+	return last.Content == content && time.Since(last.CreatedAt) < window, nil
+}
+
+// validateParentMessage checks that a referenced parent message belongs to the conversation
+func validateParentMessage(conversationID, parentMessageID string) error {
+	if parentMessageID == "" {
+		return nil
+	}
+	parent, err := db.GetMessage(parentMessageID)
+	if err != nil || parent.ConversationID != conversationID {
+		return fmt.Errorf("parent message not found in this conversation")
+	}
+	return nil
+}
+
+// sendStatelessMessage answers a request from its own history without touching the database
+func (ch *ChatHandlers) sendStatelessMessage(ctx stdcontext.Context, reqLog *log.Logger, req *ChatRequest) (*ChatResponse, error) {
+	model := req.Model
+	if model != "" && !config.IsValidModel(model) {
+		return nil, &chatError{Status: http.StatusBadRequest, Message: "Invalid model specified"}
+	}
+
+	format := req.ResponseFormat
+	if format == "" {
+		format = "text"
+	}
+
+	provider := ch.getProvider(req.Provider)
+	reqLog.Printf("[CHAT] Stateless request with %d messages using provider: %T", len(req.Messages), provider)
+
+	systemPrompt := ch.withRetrievedContext(reqLog, req.SystemPrompt, req.userMessage())
+	attachImages(req.Messages, req.ImageURLs)
+
+	response, usedModel, err := chatWithFallback(ctx, reqLog, provider, req.Messages, systemPrompt, format, model, req.Temperature, req.chatOptions())
+	if err != nil {
+		reqLog.Printf("[CHAT] Error from LLM: %v", err)
+		return nil, &chatError{Status: http.StatusInternalServerError, LLMErr: err}
+	}
+
+	return &ChatResponse{
+		Response: response,
+		Model:    usedModel,
+	}, nil
 }
 
 // ChatStreamHandler is the SSE endpoint for streaming chat responses
@@ -239,7 +657,9 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	username := r.Context().Value(auth.UserContextKey).(string)
-	log.Printf("Chat stream request from user: %s", username)
+	ctx := r.Context()
+	reqLog := logger.FromContext(ctx)
+	reqLog.Printf("Chat stream request from user: %s", username)
 
 	var req ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -252,22 +672,99 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	log.Printf("[CHAT] User input (stream): %s", req.Message)
+	if err := validation.ValidateStopSequences(req.StopSequences); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidateSeed(req.Seed); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// War and Peace context is appended later, only the user-supplied prompt is limited
+	if err := validation.ValidateSystemPromptLength(req.SystemPrompt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidatePresencePenalty(req.PresencePenalty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidateFrequencyPenalty(req.FrequencyPenalty); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Color != "" {
+		if err := validation.ValidateColor(req.Color); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := validation.ValidateProviderConfig(req.ProviderSpecificConfig); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !ch.checkImageSupport(reqLog, w, &req) {
+		return
+	}
+
+	if err := validation.ValidateResponseSchema(req.ResponseFormat, req.ResponseSchema); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batcher, err := llm.NewChunkBatcher(req.FlushMode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Each stream holds an upstream LLM connection, so their number is capped
+	releaseSlot, ok := ch.acquireStreamSlot()
+	if !ok {
+		reqLog.Printf("[CHAT] Stream request from user %s rejected: %d streams already active", username, cap(ch.streamSlots))
+		writeErrorCode(w, http.StatusServiceUnavailable, "TOO_MANY_STREAMS")
+		return
+	}
+	defer releaseSlot()
+
+	reqLog.Printf("[CHAT] User input (stream): %s", req.Message)
+
+	if !ch.checkModeration(reqLog, w, username, req.Message) {
+		return
+	}
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[CHAT] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	ctx = logger.WithField(ctx, "user_id", user.ID)
+	reqLog = logger.FromContext(ctx)
+
+	// Reject identical requests that are already being streamed (e.g. double-clicked send)
+	release, ok := ch.inFlight.Begin(inFlightKey(user.ID, req.Message))
+	if !ok {
+		reqLog.Printf("[CHAT] Duplicate stream request from user %s rejected", username)
+		writeErrorCode(w, http.StatusConflict, "REQUEST_IN_FLIGHT")
+		return
+	}
+	defer release()
 
 	// Get or create conversation
 	var conversation *db.Conversation
 	if req.ConversationID != "" {
 		conversation, err = db.GetConversation(req.ConversationID)
 		if err != nil {
-			log.Printf("[CHAT] Error getting conversation: %v", err)
+			reqLog.Printf("[CHAT] Error getting conversation: %v", err)
 			http.Error(w, "Conversation not found", http.StatusNotFound)
 			return
 		}
@@ -284,14 +781,20 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 		if len(runes) > 100 {
 			title = string(runes[:100])
 		}
-		conversation, err = db.CreateConversation(user.ID, title, req.ResponseFormat, req.ResponseSchema)
+		conversation, err = db.CreateConversation(user.ID, title, req.ResponseFormat, req.ResponseSchema, req.Color)
 		if err != nil {
-			log.Printf("[CHAT] Error creating conversation: %v", err)
+			reqLog.Printf("[CHAT] Error creating conversation: %v", err)
 			http.Error(w, "Error creating conversation", http.StatusInternalServerError)
 			return
 		}
 	}
 
+	ctx = logger.WithField(ctx, "conversation_id", conversation.ID)
+	reqLog = logger.FromContext(ctx)
+
+	// Keep the conversation from being cleared while its reply is streamed
+	defer ch.inFlight.BeginConversation(conversation.ID)()
+
 	// Validate model if provided
 	model := req.Model
 	if model != "" && !config.IsValidModel(model) {
@@ -299,63 +802,78 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := validateParentMessage(conversation.ID, req.ParentMessageID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if duplicate, err := isDuplicateMessage(conversation.ID, req.Message); err != nil {
+		reqLog.Printf("[CHAT] Warning: duplicate message check failed: %v", err)
+	} else if duplicate {
+		reqLog.Printf("[CHAT] Duplicate message rejected in conversation %s", conversation.ID)
+		writeErrorCode(w, http.StatusConflict, "DUPLICATE_MESSAGE")
+		return
+	}
+
 	// Add user message to database (user messages don't have a model, temperature, provider, or usage data)
-	if _, err := db.AddMessage(conversation.ID, "user", req.Message, "", nil, "", "", nil, nil, nil, nil, nil, nil); err != nil {
-		log.Printf("[CHAT] Error adding user message: %v", err)
+	startedAt := time.Now()
+	if _, err := db.AddMessage(conversation.ID, "user", req.Message, "", nil, nil, "", "", nil, nil, nil, nil, nil, nil, nil, nil, nil, req.ParentMessageID); err != nil {
+		reqLog.Printf("[CHAT] Error adding user message: %v", err)
 		http.Error(w, "Error saving message", http.StatusInternalServerError)
 		return
 	}
 
 	// Check if there's an active summary for this conversation
-	activeSummary, err := db.GetActiveSummary(conversation.ID)
+	activeSummary, err := getActiveSummaryCached(conversation.ID)
 	var currentHistory []llm.Message
 
 	if err == nil && activeSummary != nil {
 		// Active summary exists - use it instead of full history
-		log.Printf("[CHAT] Using active summary (usage count: %d)", activeSummary.UsageCount)
+		reqLog.Printf("[CHAT] Using active summary (usage count: %d)", activeSummary.UsageCount)
 
 		// Get messages after the summarized point
 		if activeSummary.SummarizedUpToMessageID != nil {
 			newMessages, err := db.GetMessagesAfterMessage(conversation.ID, *activeSummary.SummarizedUpToMessageID)
 			if err != nil {
-				log.Printf("[CHAT] Error getting messages after summary: %v", err)
+				reqLog.Printf("[CHAT] Error getting messages after summary: %v", err)
 				http.Error(w, "Error retrieving conversation history", http.StatusInternalServerError)
 				return
 			}
 			currentHistory = newMessages
-			log.Printf("[CHAT] Using summary + %d new messages", len(newMessages))
+			reqLog.Printf("[CHAT] Using summary + %d new messages", len(newMessages))
 		} else {
 			// No messages after summary (shouldn't happen, but handle gracefully)
 			currentHistory = []llm.Message{}
-			log.Printf("[CHAT] Using summary with no new messages")
+			reqLog.Printf("[CHAT] Using summary with no new messages")
 		}
 
 		// Increment summary usage count
 		if err := db.IncrementSummaryUsageCount(activeSummary.ID); err != nil {
-			log.Printf("[CHAT] Warning: failed to increment summary usage count: %v", err)
+			reqLog.Printf("[CHAT] Warning: failed to increment summary usage count: %v", err)
 		}
 	} else {
 		// No active summary - use full conversation history
 		currentHistory, err = db.GetConversationMessages(conversation.ID)
 		if err != nil {
-			log.Printf("[CHAT] Error getting conversation history: %v", err)
+			reqLog.Printf("[CHAT] Error getting conversation history: %v", err)
 			http.Error(w, "Error retrieving conversation history", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("[CHAT] Using full conversation history: %d messages", len(currentHistory))
+		reqLog.Printf("[CHAT] Using full conversation history: %d messages", len(currentHistory))
 	}
+	attachImages(currentHistory, req.ImageURLs)
 
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 		return
 	}
+	stream := newChatStreamWriter(w, r, flusher)
 
 	// Build the system prompt based on conversation's response format (stored in DB)
 	// If there's an active summary, combine it with the user's custom prompt
@@ -372,7 +890,7 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 			// For text format, combine summary with user's custom system prompt
 			effectiveSystemPrompt = summaryContext + req.SystemPrompt
 		}
-		log.Printf("[CHAT] Using summary as context with user prompt")
+		reqLog.Printf("[CHAT] Using summary as context with user prompt")
 	} else if conversation.ResponseFormat == "json" && conversation.ResponseSchema != "" {
 		effectiveSystemPrompt = fmt.Sprintf("You must respond ONLY with valid JSON that matches this exact schema. Do not include any explanatory text, markdown formatting, or code blocks - just the raw JSON.\n\nSchema:\n%s\n\nRemember: Your entire response must be valid JSON matching this schema.", conversation.ResponseSchema)
 	} else if conversation.ResponseFormat == "xml" && conversation.ResponseSchema != "" {
@@ -400,50 +918,43 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 			textToAppend := warAndPeaceText[:charsToInclude]
 
 			effectiveSystemPrompt = effectiveSystemPrompt + "\n\nContext (War and Peace by Leo Tolstoy):\n" + textToAppend
-			log.Printf("[CHAT] Appended War and Peace context: %d%% (%.2f MB of %.2f MB)",
+			reqLog.Printf("[CHAT] Appended War and Peace context: %d%% (%.2f MB of %.2f MB)",
 				percent,
 				float64(len(textToAppend))/1024/1024,
 				float64(totalChars)/1024/1024)
 		} else {
-			log.Printf("[CHAT] Warning: War and Peace text not loaded")
+			reqLog.Printf("[CHAT] Warning: War and Peace text not loaded")
 		}
 	}
 
-	log.Printf("[CHAT] Using conversation format: %s", conversation.ResponseFormat)
+	effectiveSystemPrompt = ch.withRetrievedContext(reqLog, effectiveSystemPrompt, req.Message)
+
+	reqLog.Printf("[CHAT] Using conversation format: %s", conversation.ResponseFormat)
 
 	// Get LLM provider based on request
-	provider := llm.GetProviderFromString(req.Provider)
-	log.Printf("[CHAT] Using provider for streaming: %T", provider)
+	provider := ch.getProvider(req.Provider)
+	reqLog.Printf("[CHAT] Using provider for streaming: %T", provider)
 
 	// Get streaming response from LLM
-	chunks, err := provider.ChatWithHistoryStream(currentHistory, effectiveSystemPrompt, conversation.ResponseFormat, model, req.Temperature)
+	chunks, usedModel, err := streamWithFallback(r.Context(), reqLog, provider, currentHistory, effectiveSystemPrompt, conversation.ResponseFormat, model, req.Temperature, req.chatOptions())
 	if err != nil {
-		log.Printf("[CHAT] Error from LLM stream: %v", err)
-		fmt.Fprintf(w, "data: {\"error\": \"%s\"}\n\n", err.Error())
+		reqLog.Printf("[CHAT] Error from LLM stream: %v", err)
+		stream.send(sseEventError, errorFrameData(err.Error()))
 		return
 	}
 
-	// Determine which model was actually used
-	usedModel := model
-	if usedModel == "" {
-		usedModel = provider.GetDefaultModel()
-	}
-
 	// Send conversation ID as first event
-	fmt.Fprintf(w, "data: CONV_ID:%s\n\n", conversation.ID)
-	flusher.Flush()
-	log.Printf("[CHAT] Sent conversation ID: %s", conversation.ID)
+	stream.send(sseEventConvID, conversation.ID)
+	reqLog.Printf("[CHAT] Sent conversation ID: %s", conversation.ID)
 
 	// Send model as second event
-	fmt.Fprintf(w, "data: MODEL:%s\n\n", usedModel)
-	flusher.Flush()
-	log.Printf("[CHAT] Sent model: %s", usedModel)
+	stream.send(sseEventModel, usedModel)
+	reqLog.Printf("[CHAT] Sent model: %s", usedModel)
 
 	// Send temperature as third event
 	if req.Temperature != nil {
-		fmt.Fprintf(w, "data: TEMPERATURE:%.2f\n\n", *req.Temperature)
-		flusher.Flush()
-		log.Printf("[CHAT] Sent temperature: %.2f", *req.Temperature)
+		stream.send(sseEventTemperature, fmt.Sprintf("%.2f", *req.Temperature))
+		reqLog.Printf("[CHAT] Sent temperature: %.2f", *req.Temperature)
 	}
 
 	// Buffer to accumulate the full response and metadata
@@ -451,8 +962,24 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 	var generationID string
 	var usage *llm.ResponseUsage
 
-	// Stream chunks to client using SSE format
-	for streamChunk := range chunks {
+	// Periodically checkpoint the partial response so it survives a crash mid-stream
+	assistantMsgID := uuid.New().String()
+	checkpointInterval := config.GetCheckpointChunkInterval()
+	chunkCount := 0
+	checkpointed := false
+
+	// Stream chunks to client using SSE format, stopping early if the client disconnects
+	for {
+		var streamChunk llm.StreamChunk
+		var ok bool
+		select {
+		case streamChunk, ok = <-chunks:
+		case <-r.Context().Done():
+		}
+		if !ok {
+			break
+		}
+
 		if streamChunk.Metadata != nil {
 			// Capture metadata from final chunk
 			if streamChunk.Metadata.GenerationID != "" {
@@ -464,24 +991,55 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 		} else if streamChunk.Content != "" {
 			// Stream content chunk
 			fullResponse += streamChunk.Content
-			// Escape newlines in chunk for SSE format
-			escapedChunk := strings.ReplaceAll(streamChunk.Content, "\n", "\\n")
-			// Send chunk as SSE event
-			fmt.Fprintf(w, "data: %s\n\n", escapedChunk)
-			flusher.Flush()
-			log.Printf("[CHAT] Sent chunk: %q", streamChunk.Content)
+			chunkCount++
+			if checkpointInterval > 0 && chunkCount%checkpointInterval == 0 {
+				if err := db.UpsertPartialMessage(assistantMsgID, conversation.ID, "assistant", fullResponse); err != nil {
+					reqLog.Printf("[CHAT] Warning: failed to checkpoint partial response: %v", err)
+				} else {
+					checkpointed = true
+				}
+			}
+			// Send buffered segments according to the requested flush mode
+			segments, err := batcher.Add(streamChunk.Content)
+			if err != nil {
+				reqLog.Printf("[CHAT] Warning: %v", err)
+			}
+			for _, segment := range segments {
+				sendStreamSegment(stream, reqLog, segment)
+			}
+		}
+	}
+	metrics.AddStreamChunks(chunkCount)
+
+	// Send any text still held back by the batcher
+	if r.Context().Err() == nil {
+		if rest := batcher.Flush(); rest != "" {
+			sendStreamSegment(stream, reqLog, rest)
+		}
+	}
+
+	// The client went away: keep what was generated so far as a partial message rather than a complete one
+	if err := r.Context().Err(); err != nil {
+		reqLog.Printf("[CHAT] Warning: client disconnected mid-stream after %d chunks: %v", chunkCount, err)
+		if fullResponse != "" {
+			if err := db.UpsertPartialMessage(assistantMsgID, conversation.ID, "assistant", fullResponse); err != nil {
+				reqLog.Printf("[CHAT] Warning: failed to save partial response: %v", err)
+			}
 		}
+		return
 	}
 
 	// Fetch cost information from OpenRouter if generation ID is available
-	var totalCost *float64
+	var totalCost, inputCost, outputCost *float64
 	var promptTokens, completionTokens, totalTokens *int
 	var latency, generationTime *int
 
 	if generationID != "" {
-		log.Printf("[CHAT] Fetching generation cost for ID: %s", generationID)
+		reqLog.Printf("[CHAT] Fetching generation cost for ID: %s", generationID)
 		if genData, err := provider.FetchGenerationCost(generationID); err == nil {
 			totalCost = &genData.TotalCost
+			inputCost = genData.InputCostUSD
+			outputCost = genData.OutputCostUSD
 			// Use native tokens instead of regular tokens
 			promptTokens = &genData.NativeTokensPrompt
 			completionTokens = &genData.NativeTokensCompletion
@@ -491,12 +1049,11 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 			generationTime = &genData.GenerationTime
 
 			// Send usage data via SSE
-			fmt.Fprintf(w, "data: USAGE:{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d,\"total_cost\":%.6f,\"latency\":%d,\"generation_time\":%d}\n\n",
-				*promptTokens, *completionTokens, *totalTokens, *totalCost, *latency, *generationTime)
-			flusher.Flush()
-			log.Printf("[CHAT] Sent usage data: tokens=%d, cost=$%.6f, latency=%dms, generation_time=%dms", *totalTokens, *totalCost, *latency, *generationTime)
+			stream.send(sseEventUsage, fmt.Sprintf("{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d,\"total_cost\":%.6f,\"latency\":%d,\"generation_time\":%d}",
+				*promptTokens, *completionTokens, *totalTokens, *totalCost, *latency, *generationTime))
+			reqLog.Printf("[CHAT] Sent usage data: tokens=%d, cost=$%.6f, latency=%dms, generation_time=%dms", *totalTokens, *totalCost, *latency, *generationTime)
 		} else {
-			log.Printf("[CHAT] Error fetching generation cost: %v", err)
+			reqLog.Printf("[CHAT] Error fetching generation cost: %v", err)
 			// Fallback to usage data from streaming response if available
 			if usage != nil {
 				promptTokens = &usage.PromptTokens
@@ -504,10 +1061,9 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 				totalTokens = &usage.TotalTokens
 
 				// Send usage data without cost via SSE
-				fmt.Fprintf(w, "data: USAGE:{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}\n\n",
-					*promptTokens, *completionTokens, *totalTokens)
-				flusher.Flush()
-				log.Printf("[CHAT] Sent usage data (no cost): tokens=%d", *totalTokens)
+				stream.send(sseEventUsage, fmt.Sprintf("{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}",
+					*promptTokens, *completionTokens, *totalTokens))
+				reqLog.Printf("[CHAT] Sent usage data (no cost): tokens=%d", *totalTokens)
 			}
 		}
 	} else if usage != nil {
@@ -517,70 +1073,198 @@ func (ch *ChatHandlers) ChatStreamHandler(w http.ResponseWriter, r *http.Request
 		totalTokens = &usage.TotalTokens
 
 		// Send usage data without cost via SSE
-		fmt.Fprintf(w, "data: USAGE:{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}\n\n",
-			*promptTokens, *completionTokens, *totalTokens)
-		flusher.Flush()
-		log.Printf("[CHAT] Sent usage data (no cost): tokens=%d", *totalTokens)
+		stream.send(sseEventUsage, fmt.Sprintf("{\"prompt_tokens\":%d,\"completion_tokens\":%d,\"total_tokens\":%d}",
+			*promptTokens, *completionTokens, *totalTokens))
+		reqLog.Printf("[CHAT] Sent usage data (no cost): tokens=%d", *totalTokens)
 	}
+	metrics.RecordLLMUsage(usedModel, promptTokens, completionTokens, totalCost)
 
 	// Add assistant response to database after streaming completes
-	if fullResponse != "" {
-		if _, err := db.AddMessage(conversation.ID, "assistant", fullResponse, usedModel, req.Temperature, req.Provider,
-			generationID, promptTokens, completionTokens, totalTokens, totalCost, latency, generationTime); err != nil {
-			log.Printf("[CHAT] Error adding assistant message: %v", err)
+	responseTimeMs := int(time.Since(startedAt).Milliseconds())
+	var savedMsgID string
+	if fullResponse != "" && checkpointed {
+		if err := db.FinalizeMessage(assistantMsgID, fullResponse, usedModel, req.Temperature, req.Seed, req.Provider,
+			generationID, promptTokens, completionTokens, totalTokens, totalCost, inputCost, outputCost, latency, generationTime, &responseTimeMs); err != nil {
+			reqLog.Printf("[CHAT] Error finalizing assistant message: %v", err)
+		} else {
+			savedMsgID = assistantMsgID
+			storeRawPrompt(reqLog, assistantMsgID, currentHistory, effectiveSystemPrompt)
+			storeSystemPromptHash(reqLog, assistantMsgID, req.SystemPrompt)
+		}
+		reqLog.Printf("[CHAT] Full LLM response: %s", fullResponse)
+	} else if fullResponse != "" {
+		if assistantMsg, err := db.AddMessage(conversation.ID, "assistant", fullResponse, usedModel, req.Temperature, req.Seed, req.Provider,
+			generationID, promptTokens, completionTokens, totalTokens, totalCost, inputCost, outputCost, latency, generationTime, &responseTimeMs, ""); err != nil {
+			reqLog.Printf("[CHAT] Error adding assistant message: %v", err)
+		} else {
+			savedMsgID = assistantMsg.ID
+			storeRawPrompt(reqLog, assistantMsg.ID, currentHistory, effectiveSystemPrompt)
+			storeSystemPromptHash(reqLog, assistantMsg.ID, req.SystemPrompt)
 		}
-		log.Printf("[CHAT] Full LLM response: %s", fullResponse)
+		reqLog.Printf("[CHAT] Full LLM response: %s", fullResponse)
+	}
+	if savedMsgID != "" {
+		ch.maybeAutoSummarize(reqLog, conversation.ID)
 	}
 
-	// Send completion marker
-	fmt.Fprintf(w, "data: [DONE]\n\n")
-	flusher.Flush()
-}
+	// Send a checksum of the full response so the client can detect corrupted content
+	if fullResponse != "" {
+		checksum := db.ContentHash(fullResponse)
+		if savedMsgID != "" {
+			if err := db.SetMessageContentHash(savedMsgID, checksum); err != nil {
+				reqLog.Printf("[CHAT] Warning: failed to store content hash: %v", err)
+			}
+		}
+		stream.send(sseEventChecksum, checksum)
+	}
+
+	// Send completion marker
+	stream.send(sseEventDone, "[DONE]")
+}
+
+// sendStreamSegment writes a piece of the response as a content frame
+func sendStreamSegment(stream chatStreamWriter, reqLog *log.Logger, segment string) {
+	stream.send(sseEventContent, segment)
+	reqLog.Printf("[CHAT] Sent chunk: %q", segment)
+}
+
+// defaultConversationsPageSize is the page size of GetConversationsHandler when no limit is given
+const defaultConversationsPageSize = 50
 
-// GetConversationsHandler returns all conversations for the authenticated user
+// GetConversationsHandler returns a page of the authenticated user's conversations, most recently updated first.
+// Pages are selected with the ?limit= and ?before= cursor parameters.
 func (ch *ChatHandlers) GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	username := r.Context().Value(auth.UserContextKey).(string)
-	log.Printf("Get conversations request from user: %s", username)
+	reqLog.Printf("Get conversations request from user: %s", username)
+
+	limit := defaultConversationsPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 1 || l > db.MaxConversationsPageSize {
+			http.Error(w, fmt.Sprintf("'limit' must be between 1 and %d", db.MaxConversationsPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	var before *db.ConversationCursor
+	if value := r.URL.Query().Get("before"); value != "" {
+		cursor, err := parseConversationCursor(value)
+		if err != nil {
+			http.Error(w, "invalid 'before' cursor, pass the next_cursor of the previous page", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[CHAT] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	// Get all conversations for user
-	conversations, err := db.GetConversationsByUser(user.ID)
+	// Get a page of conversations for user, optionally only starred ones
+	starredOnly := r.URL.Query().Get("starred") == "true"
+	conversations, err := db.GetConversationsByUser(user.ID, starredOnly, limit, before)
 	if err != nil {
-		log.Printf("[CHAT] Error getting conversations: %v", err)
+		reqLog.Printf("[CHAT] Error getting conversations: %v", err)
 		http.Error(w, "Error retrieving conversations", http.StatusInternalServerError)
 		return
 	}
 
-	// Convert to response format
+	// A full page may be followed by more conversations
+	var nextCursor string
+	if len(conversations) == limit {
+		nextCursor = formatConversationCursor(conversations[len(conversations)-1])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConversationsResponse{
+		Conversations: newConversationInfoList(reqLog, conversations),
+		NextCursor:    nextCursor,
+	})
+}
+
+// formatConversationCursor encodes the position after a conversation as "<updated_at RFC3339>_<id>"
+func formatConversationCursor(conv db.Conversation) string {
+	return conv.UpdatedAt.Format(time.RFC3339Nano) + "_" + conv.ID
+}
+
+// parseConversationCursor decodes a cursor produced by formatConversationCursor
+func parseConversationCursor(value string) (*db.ConversationCursor, error) {
+	updatedAt, id, ok := strings.Cut(value, "_")
+	if !ok {
+		return nil, fmt.Errorf("cursor has no conversation ID")
+	}
+	t, err := time.Parse(time.RFC3339Nano, updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := uuid.Validate(id); err != nil {
+		return nil, err
+	}
+	return &db.ConversationCursor{UpdatedAt: t, ID: id}, nil
+}
+
+// newConversationInfoList converts database conversations to their response format,
+// loading the active summaries of all conversations in one query
+func newConversationInfoList(reqLog *log.Logger, conversations []db.Conversation) []ConversationInfo {
+	convIDs := make([]string, 0, len(conversations))
+	for _, conv := range conversations {
+		convIDs = append(convIDs, conv.ID)
+	}
+	summaries, err := db.BatchGetActiveSummaries(convIDs)
+	if err != nil {
+		reqLog.Printf("[CHAT] Warning: failed to load active summaries: %v", err)
+	}
+
 	convInfos := make([]ConversationInfo, 0, len(conversations))
 	for _, conv := range conversations {
-		// Get active summary for this conversation if it exists
 		var summarizedUpToMsgID *string
-		if summary, err := db.GetActiveSummary(conv.ID); err == nil && summary != nil {
+		if summary, ok := summaries[conv.ID]; ok {
 			summarizedUpToMsgID = summary.SummarizedUpToMessageID
 		}
 
-		convInfos = append(convInfos, ConversationInfo{
-			ID:                      conv.ID,
-			Title:                   conv.Title,
-			ResponseFormat:          conv.ResponseFormat,
-			ResponseSchema:          conv.ResponseSchema,
-			SummarizedUpToMessageID: summarizedUpToMsgID,
-			CreatedAt:               conv.CreatedAt.String(),
-			UpdatedAt:               conv.UpdatedAt.String(),
-		})
+		convInfos = append(convInfos, newConversationInfo(&conv, summarizedUpToMsgID))
+	}
+	return convInfos
+}
+
+// recentConversationsWindow is how far back GetRecentConversationsHandler looks for activity
+const recentConversationsWindow = 7 * 24 * time.Hour
+
+// GetRecentConversationsHandler returns the user's most recently active conversations for the sidebar
+func (ch *ChatHandlers) GetRecentConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Get recent conversations request from user: %s", username)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversations, err := db.GetRecentConversations(user.ID, time.Now().Add(-recentConversationsWindow))
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting recent conversations: %v", err)
+		http.Error(w, "Error retrieving conversations", http.StatusInternalServerError)
+		return
+	}
+
+	convInfos := make([]ConversationInfo, 0, len(conversations))
+	for _, conv := range conversations {
+		convInfos = append(convInfos, newConversationInfo(&conv, nil))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -589,16 +1273,91 @@ func (ch *ChatHandlers) GetConversationsHandler(w http.ResponseWriter, r *http.R
 	})
 }
 
+// newConversationInfo converts a database conversation to its response format
+func newConversationInfo(conv *db.Conversation, summarizedUpToMsgID *string) ConversationInfo {
+	var archivedAt *string
+	if conv.ArchivedAt != nil {
+		t := conv.ArchivedAt.String()
+		archivedAt = &t
+	}
+
+	return ConversationInfo{
+		ID:                      conv.ID,
+		Title:                   conv.Title,
+		ResponseFormat:          conv.ResponseFormat,
+		ResponseSchema:          conv.ResponseSchema,
+		SummarizedUpToMessageID: summarizedUpToMsgID,
+		Starred:                 conv.StarredAt != nil,
+		Color:                   conv.Color,
+		ArchivedAt:              archivedAt,
+		CreatedAt:               conv.CreatedAt.String(),
+		UpdatedAt:               conv.UpdatedAt.String(),
+	}
+}
+
+// GetConversationHandler returns a single conversation together with its aggregate message stats
+func (ch *ChatHandlers) GetConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get conversation request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation with stats and verify ownership
+	conversation, err := db.GetConversationWithStats(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Get active summary for this conversation if it exists
+	var summarizedUpToMsgID *string
+	if summary, err := db.GetActiveSummary(convID); err == nil && summary != nil {
+		summarizedUpToMsgID = summary.SummarizedUpToMessageID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConversationWithStatsResponse{
+		ConversationInfo: newConversationInfo(&conversation.Conversation, summarizedUpToMsgID),
+		Stats: ConversationStatsData{
+			MessageCount:          conversation.MessageCount,
+			UserMessageCount:      conversation.UserMessageCount,
+			AssistantMessageCount: conversation.AssistantMessageCount,
+			PromptTokens:          conversation.PromptTokens,
+			CompletionTokens:      conversation.CompletionTokens,
+			TotalTokens:           conversation.TotalTokens,
+			TotalCost:             conversation.TotalCost,
+			AvgResponseTimeMs:     conversation.AvgResponseTimeMs,
+			MessageCountByRole:    conversation.MessageCountByRole,
+		},
+	})
+}
+
 // GetConversationMessagesHandler returns all messages from a specific conversation
 func (ch *ChatHandlers) GetConversationMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	username := r.Context().Value(auth.UserContextKey).(string)
 	convID := r.PathValue("id")
-	log.Printf("Get conversation messages request from user: %s for conversation: %s", username, convID)
+	reqLog.Printf("Get conversation messages request from user: %s for conversation: %s", username, convID)
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[CHAT] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
@@ -606,7 +1365,7 @@ func (ch *ChatHandlers) GetConversationMessagesHandler(w http.ResponseWriter, r
 	// Get conversation and verify ownership
 	conversation, err := db.GetConversation(convID)
 	if err != nil {
-		log.Printf("[CHAT] Error getting conversation: %v", err)
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
@@ -617,31 +1376,46 @@ func (ch *ChatHandlers) GetConversationMessagesHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Get messages for conversation
-	messages, err := db.GetConversationMessagesWithDetails(convID)
+	// Get messages for conversation, or only the direct replies to a message
+	var messages []db.Message
+	if parentID := r.URL.Query().Get("parent_id"); parentID != "" {
+		if _, err := uuid.Parse(parentID); err != nil {
+			http.Error(w, "Invalid parent_id", http.StatusBadRequest)
+			return
+		}
+		messages, err = db.GetChildMessages(convID, parentID)
+	} else {
+		messages, err = db.GetConversationMessagesWithDetails(convID)
+	}
 	if err != nil {
-		log.Printf("[CHAT] Error getting messages: %v", err)
+		reqLog.Printf("[CHAT] Error getting messages: %v", err)
 		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
 		return
 	}
 
 	// Convert to response format
-	msgData := make([]MessageData, 0, len(messages))
-	for _, msg := range messages {
-		msgData = append(msgData, MessageData{
-			ID:               msg.ID,
-			Role:             msg.Role,
-			Content:          msg.Content,
-			Model:            msg.Model,
-			Temperature:      msg.Temperature,
-			PromptTokens:     msg.PromptTokens,
-			CompletionTokens: msg.CompletionTokens,
-			TotalTokens:      msg.TotalTokens,
-			TotalCost:        msg.TotalCost,
-			Latency:          msg.Latency,
-			GenerationTime:   msg.GenerationTime,
-			CreatedAt:        msg.CreatedAt.String(),
-		})
+	msgData := newMessageDataList(messages)
+
+	// Attach the requesting user's feedback to each message
+	if feedback, err := db.GetUserFeedbackForConversation(convID, user.ID); err == nil {
+		for i := range msgData {
+			if f, ok := feedback[msgData[i].ID]; ok {
+				msgData[i].UserFeedback = newFeedbackData(&f)
+			}
+		}
+	} else {
+		reqLog.Printf("[CHAT] Warning: failed to load message feedback: %v", err)
+	}
+
+	// Attach uploaded file metadata to each message
+	if attachments, err := db.GetAttachmentsByConversation(convID); err == nil {
+		for i := range msgData {
+			for _, a := range attachments[msgData[i].ID] {
+				msgData[i].Attachments = append(msgData[i].Attachments, newAttachmentInfo(&a))
+			}
+		}
+	} else {
+		reqLog.Printf("[CHAT] Warning: failed to load message attachments: %v", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -650,16 +1424,64 @@ func (ch *ChatHandlers) GetConversationMessagesHandler(w http.ResponseWriter, r
 	})
 }
 
-// DeleteConversationHandler deletes a specific conversation
+// newMessageData converts a database message to its response format
+func newMessageData(msg *db.Message) MessageData {
+	var editedAt *string
+	if msg.EditedAt != nil {
+		t := msg.EditedAt.String()
+		editedAt = &t
+	}
+
+	return MessageData{
+		ID:               msg.ID,
+		Role:             msg.Role,
+		Content:          msg.Content,
+		Model:            msg.Model,
+		Temperature:      msg.Temperature,
+		Seed:             msg.Seed,
+		PromptTokens:     msg.PromptTokens,
+		CompletionTokens: msg.CompletionTokens,
+		TotalTokens:      msg.TotalTokens,
+		TotalCost:        msg.TotalCost,
+		InputCostUSD:     msg.InputCostUSD,
+		OutputCostUSD:    msg.OutputCostUSD,
+		Latency:          msg.Latency,
+		GenerationTime:   msg.GenerationTime,
+		ResponseTimeMs:   msg.ResponseTimeMs,
+		ParentMessageID:  msg.ParentMessageID,
+		Partial:          msg.Partial,
+		EditedAt:         editedAt,
+		CreatedAt:        msg.CreatedAt.String(),
+	}
+}
+
+// newMessageDataList converts database messages to their response format, flagging the
+// messages whose system prompt differs from that of the previous reply
+func newMessageDataList(messages []db.Message) []MessageData {
+	msgData := make([]MessageData, 0, len(messages))
+	previousHash := ""
+	for i := range messages {
+		data := newMessageData(&messages[i])
+		if hash := messages[i].SystemPromptHash; hash != "" {
+			data.SystemPromptChanged = previousHash != "" && hash != previousHash
+			previousHash = hash
+		}
+		msgData = append(msgData, data)
+	}
+	return msgData
+}
+
+// DeleteConversationHandler archives a specific conversation; it can be restored until the retention period ends
 func (ch *ChatHandlers) DeleteConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	username := r.Context().Value(auth.UserContextKey).(string)
 	convID := r.PathValue("id")
-	log.Printf("Delete conversation request from user: %s for conversation: %s", username, convID)
+	reqLog.Printf("Delete conversation request from user: %s for conversation: %s", username, convID)
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[CHAT] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
@@ -667,7 +1489,7 @@ func (ch *ChatHandlers) DeleteConversationHandler(w http.ResponseWriter, r *http
 	// Get conversation and verify ownership
 	conversation, err := db.GetConversation(convID)
 	if err != nil {
-		log.Printf("[CHAT] Error getting conversation: %v", err)
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
@@ -680,10 +1502,11 @@ func (ch *ChatHandlers) DeleteConversationHandler(w http.ResponseWriter, r *http
 
 	// Delete the conversation
 	if err := db.DeleteConversation(convID); err != nil {
-		log.Printf("[CHAT] Error deleting conversation: %v", err)
+		reqLog.Printf("[CHAT] Error deleting conversation: %v", err)
 		http.Error(w, "Error deleting conversation", http.StatusInternalServerError)
 		return
 	}
+	invalidateActiveSummaryCache(convID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(DeleteResponse{
@@ -692,248 +1515,810 @@ func (ch *ChatHandlers) DeleteConversationHandler(w http.ResponseWriter, r *http
 	})
 }
 
-// GetModelsHandler returns the list of available models
-func (ch *ChatHandlers) GetModelsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	models := config.GetAvailableModels()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ModelsResponse{
-		Models: models,
-	})
-}
-
-// SummarizeConversationHandler creates a summary of the conversation
-func (ch *ChatHandlers) SummarizeConversationHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
+// RestoreConversationHandler brings back an archived conversation
+func (ch *ChatHandlers) RestoreConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	username := r.Context().Value(auth.UserContextKey).(string)
 	convID := r.PathValue("id")
-	log.Printf("Summarize conversation request from user: %s for conversation: %s", username, convID)
-
-	var req SummarizeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Empty body is acceptable, use defaults
-		req.Model = ""
-		req.Temperature = nil
-	}
+	reqLog.Printf("Restore conversation request from user: %s for conversation: %s", username, convID)
 
 	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[SUMMARIZE] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	// Get conversation and verify ownership
-	conversation, err := db.GetConversation(convID)
+	// Archived conversations are looked up too, since they are the ones being restored
+	conversation, err := db.GetConversationIncludingArchived(convID)
 	if err != nil {
-		log.Printf("[SUMMARIZE] Error getting conversation: %v", err)
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
 
-	// Verify user owns this conversation
 	if conversation.UserID != user.ID {
 		http.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	// Check if there's an existing active summary
-	activeSummary, err := db.GetActiveSummary(convID)
-	var messagesToSummarize []llm.Message
-	var lastMessageID *string
-
-	if err != nil || activeSummary == nil {
-		// No active summary exists - summarize all messages
-		log.Printf("[SUMMARIZE] No active summary found, summarizing all messages")
-		messagesToSummarize, err = db.GetConversationMessages(convID)
-		if err != nil {
-			log.Printf("[SUMMARIZE] Error getting conversation messages: %v", err)
-			http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
-			return
-		}
+	if conversation.ArchivedAt == nil {
+		http.Error(w, "Conversation is not archived", http.StatusConflict)
+		return
+	}
 
-		// Get the last message ID
-		lastMessageID, err = db.GetLastMessageID(convID)
-		if err != nil {
-			log.Printf("[SUMMARIZE] Error getting last message ID: %v", err)
-			http.Error(w, "Error retrieving last message", http.StatusInternalServerError)
-			return
-		}
-	} else if activeSummary.UsageCount >= 2 {
-		// Summary has been used 2+ times - create new summary from old summary + new messages
-		log.Printf("[SUMMARIZE] Active summary used %d times, creating new summary", activeSummary.UsageCount)
+	if err := db.RestoreConversation(convID); err != nil {
+		reqLog.Printf("[CHAT] Error restoring conversation: %v", err)
+		http.Error(w, "Error restoring conversation", http.StatusInternalServerError)
+		return
+	}
+	conversation.ArchivedAt = nil
 
-		// Start with the old summary as a "system" message
-		messagesToSummarize = []llm.Message{
-			{Role: "assistant", Content: fmt.Sprintf("Previous summary:\n%s", activeSummary.SummaryContent)},
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newConversationInfo(conversation, nil))
+}
 
-		// Get messages after the last summarized message
-		if activeSummary.SummarizedUpToMessageID != nil {
-			newMessages, err := db.GetMessagesAfterMessage(convID, *activeSummary.SummarizedUpToMessageID)
-			if err != nil {
-				log.Printf("[SUMMARIZE] Error getting messages after last summarized: %v", err)
-				http.Error(w, "Error retrieving new messages", http.StatusInternalServerError)
-				return
-			}
-			messagesToSummarize = append(messagesToSummarize, newMessages...)
-		}
+// GetArchivedConversationsHandler returns the authenticated user's archived conversations
+func (ch *ChatHandlers) GetArchivedConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Get archived conversations request from user: %s", username)
 
-		// Get the last message ID
-		lastMessageID, err = db.GetLastMessageID(convID)
-		if err != nil {
-			log.Printf("[SUMMARIZE] Error getting last message ID: %v", err)
-			http.Error(w, "Error retrieving last message", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// Summary exists but hasn't been used enough yet - don't create new summary
-		log.Printf("[SUMMARIZE] Active summary exists with usage count %d, not creating new summary", activeSummary.UsageCount)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(SummarizeResponse{
-			Summary:             activeSummary.SummaryContent,
-			SummarizedUpToMsgID: *activeSummary.SummarizedUpToMessageID,
-			ConversationID:      convID,
-		})
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	// Validate model if provided
-	model := req.Model
-	if model != "" && !config.IsValidModel(model) {
-		http.Error(w, "Invalid model specified", http.StatusBadRequest)
+	conversations, err := db.GetArchivedConversationsByUser(user.ID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting archived conversations: %v", err)
+		http.Error(w, "Error retrieving conversations", http.StatusInternalServerError)
 		return
 	}
 
-	// Get LLM provider (always use openrouter for summarization)
-	provider := llm.NewOpenRouterProvider()
+	convInfos := make([]ConversationInfo, 0, len(conversations))
+	for _, conv := range conversations {
+		convInfos = append(convInfos, newConversationInfo(&conv, nil))
+	}
 
-	// Build summarization system prompt
-	summarizationPrompt := os.Getenv("OPENROUTER_SUMMARIZATION_PROMPT")
-	if summarizationPrompt == "" {
-		summarizationPrompt = `You are a conversation summarizer. Your task is to create a concise, comprehensive summary of the conversation that captures:
-1. The main topics discussed
-2. Key questions asked and answers provided
-3. Important decisions or conclusions reached
-4. Any action items or next steps mentioned
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConversationsResponse{
+		Conversations: convInfos,
+	})
+}
 
-Format the summary in a clear, structured way that can be used as context for continuing the conversation. Keep the summary focused and avoid unnecessary details while preserving essential information.`
-	}
+type ClearMessagesResponse struct {
+	ClearedMessages  int64 `json:"cleared_messages"`
+	ClearedSummaries int64 `json:"cleared_summaries"`
+}
+
+// ClearConversationMessagesHandler removes all messages and summaries of a conversation but keeps its settings.
+// Messages are soft-deleted and can be restored until they are purged.
+func (ch *ChatHandlers) ClearConversationMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Clear messages request from user: %s for conversation: %s", username, convID)
 
-	// Add the original system prompt from conversation format if it exists
-	if conversation.ResponseFormat == "text" {
-		// For text format, we should preserve any custom system prompt that was used
-		// However, we don't store the original system prompt, so we'll just use the summarization prompt
-		summarizationPrompt = summarizationPrompt
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
 	}
 
-	// Call LLM to generate summary (using ChatForSummarization to avoid default system prompt)
-	log.Printf("[SUMMARIZE] Calling LLM to generate summary with %d messages", len(messagesToSummarize))
-	summaryContent, err := provider.ChatForSummarization(messagesToSummarize, summarizationPrompt, model, req.Temperature)
+	conversation, err := db.GetConversation(convID)
 	if err != nil {
-		log.Printf("[SUMMARIZE] Error from LLM: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(SummarizeResponse{
-			Error: err.Error(),
-		})
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
 
-	log.Printf("[SUMMARIZE] Generated summary: %s", summaryContent)
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
 
-	// Create new summary in database
-	summary, err := db.CreateSummary(convID, summaryContent, lastMessageID)
-	if err != nil {
-		log.Printf("[SUMMARIZE] Error creating summary: %v", err)
-		http.Error(w, "Error saving summary", http.StatusInternalServerError)
+	// Clearing mid-stream would leave the reply without its user message
+	if ch.inFlight.IsConversationActive(convID) {
+		writeErrorCode(w, http.StatusConflict, "STREAM_IN_PROGRESS")
 		return
 	}
 
-	// Update conversation to use this new summary
-	if err := db.UpdateConversationActiveSummary(convID, summary.ID); err != nil {
-		log.Printf("[SUMMARIZE] Error updating active summary: %v", err)
-		http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+	clearedMessages, clearedSummaries, err := db.ClearConversationMessages(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error clearing messages: %v", err)
+		http.Error(w, "Error clearing messages", http.StatusInternalServerError)
 		return
 	}
+	invalidateActiveSummaryCache(convID)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SummarizeResponse{
-		Summary:             summaryContent,
-		SummarizedUpToMsgID: *lastMessageID,
-		ConversationID:      convID,
+	json.NewEncoder(w).Encode(ClearMessagesResponse{
+		ClearedMessages:  clearedMessages,
+		ClearedSummaries: clearedSummaries,
 	})
 }
 
-// GetConversationSummariesHandler retrieves all summaries for a conversation
-func (ch *ChatHandlers) GetConversationSummariesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+type RestoreMessagesResponse struct {
+	RestoredMessages int64 `json:"restored_messages"`
+}
+
+type PurgeMessagesResponse struct {
+	PurgedMessages int64 `json:"purged_messages"`
+}
 
+// RestoreConversationMessagesHandler brings back the messages removed by clearing a conversation
+func (ch *ChatHandlers) RestoreConversationMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
 	username := r.Context().Value(auth.UserContextKey).(string)
 	convID := r.PathValue("id")
-	log.Printf("Get summaries request from user: %s for conversation: %s", username, convID)
+	reqLog.Printf("Restore messages request from user: %s for conversation: %s", username, convID)
 
-	// Get user from database
 	user, err := db.GetUserByUsername(username)
 	if err != nil {
-		log.Printf("[SUMMARIES] Error getting user: %v", err)
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	// Get conversation and verify ownership
 	conversation, err := db.GetConversation(convID)
 	if err != nil {
-		log.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
 		http.Error(w, "Conversation not found", http.StatusNotFound)
 		return
 	}
 
-	// Verify user owns this conversation
 	if conversation.UserID != user.ID {
 		http.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	// Get all summaries for conversation
-	summaries, err := db.GetAllSummaries(convID)
+	restored, err := db.RestoreConversationMessages(convID)
 	if err != nil {
-		log.Printf("[SUMMARIES] Error getting summaries: %v", err)
-		http.Error(w, "Error retrieving summaries", http.StatusInternalServerError)
+		reqLog.Printf("[CHAT] Error restoring messages: %v", err)
+		http.Error(w, "Error restoring messages", http.StatusInternalServerError)
 		return
 	}
 
-	// Convert to response format
-	summaryData := make([]SummaryData, 0, len(summaries))
-	for _, summary := range summaries {
-		upToMsgID := ""
-		if summary.SummarizedUpToMessageID != nil {
-			upToMsgID = *summary.SummarizedUpToMessageID
-		}
-		summaryData = append(summaryData, SummaryData{
-			ID:                      summary.ID,
-			SummaryContent:          summary.SummaryContent,
-			SummarizedUpToMessageID: upToMsgID,
-			UsageCount:              summary.UsageCount,
-			CreatedAt:               summary.CreatedAt.String(),
-		})
-	}
-
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RestoreMessagesResponse{RestoredMessages: restored})
+}
+
+// PurgeConversationMessagesHandler permanently deletes the cleared messages of a conversation
+func (ch *ChatHandlers) PurgeConversationMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Purge messages request from user: %s for conversation: %s", username, convID)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversationIncludingArchived(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	purged, storageKeys, err := db.PurgeConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error purging messages: %v", err)
+		http.Error(w, "Error purging messages", http.StatusInternalServerError)
+		return
+	}
+	removeAttachmentFiles(reqLog, storageKeys)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PurgeMessagesResponse{PurgedMessages: purged})
+}
+
+// GetModelsHandler returns the list of available models, optionally filtered by the capability
+// and min_context_window query parameters
+func (ch *ChatHandlers) GetModelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	minTokens := 0
+	if value := query.Get("min_context_window"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "'min_context_window' must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		minTokens = parsed
+	}
+
+	capability := query.Get("capability")
+	if capability != "" && !config.IsKnownCapability(capability) {
+		http.Error(w, fmt.Sprintf("Unknown capability %q", capability), http.StatusBadRequest)
+		return
+	}
+
+	models := config.GetModelsByMinContextWindow(minTokens)
+	if capability != "" {
+		models = slices.DeleteFunc(models, func(model config.Model) bool {
+			return !model.HasCapability(capability)
+		})
+	}
+
+	if models == nil {
+		models = []config.Model{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelsResponse{
+		Models: models,
+	})
+}
+
+// SummarizeConversationHandler creates a summary of the conversation
+func (ch *ChatHandlers) SummarizeConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Summarize conversation request from user: %s for conversation: %s", username, convID)
+
+	var req SummarizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Empty body is acceptable, use defaults
+		req.Model = ""
+		req.Temperature = nil
+	}
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	input, err := prepareSummarization(reqLog, convID)
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	if input.current != nil {
+		// Summary exists but hasn't been used enough yet - don't create new summary
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SummarizeResponse{
+			Summary:             input.current.SummaryContent,
+			SummarizedUpToMsgID: *input.current.SummarizedUpToMessageID,
+			ConversationID:      convID,
+		})
+		return
+	}
+
+	// Validate model if provided
+	if req.Model != "" && !config.IsValidModel(req.Model) {
+		http.Error(w, "Invalid model specified", http.StatusBadRequest)
+		return
+	}
+	model := selectSummarizationModel(reqLog, req.Model)
+
+	// Get LLM provider for summarization
+	provider := ch.getSummarizer(req.Provider)
+	reqLog.Printf("[SUMMARIZE] Using provider for summarization: %T", provider)
+
+	summarizationPrompt := getSummarizationPrompt()
+
+	// Call LLM to generate summary (using ChatForSummarization to avoid default system prompt)
+	reqLog.Printf("[SUMMARIZE] Calling LLM to generate summary with %d messages", len(input.messages))
+	summaryContent, err := provider.ChatForSummarization(r.Context(), input.messages, summarizationPrompt, model, req.Temperature)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error from LLM: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SummarizeResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	summaryContent = enforceSummaryLength(r.Context(), reqLog, provider, input.messages, summarizationPrompt, model, req.Temperature, summaryContent)
+
+	reqLog.Printf("[SUMMARIZE] Generated summary: %s", summaryContent)
+
+	if _, err := saveSummary(provider, convID, summaryContent, input.lastMessageID); err != nil {
+		reqLog.Printf("[SUMMARIZE] Error saving summary: %v", err)
+		http.Error(w, "Error saving summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SummarizeResponse{
+		Summary:             summaryContent,
+		SummarizedUpToMsgID: *input.lastMessageID,
+		ConversationID:      convID,
+	})
+}
+
+// summarizationInput holds what a new conversation summary is generated from
+type summarizationInput struct {
+	messages      []llm.Message
+	lastMessageID *string
+	current       *db.ConversationSummary // active summary that is not yet due for renewal, nil if a new one is needed
+}
+
+// prepareSummarization collects the messages to summarize. Without an active summary the whole conversation
+// is summarized; an active summary used at least SUMMARY_USAGE_THRESHOLD times is renewed from itself plus the newer messages.
+// A less used active summary is kept and returned in current.
+func prepareSummarization(reqLog *log.Logger, convID string) (*summarizationInput, error) {
+	activeSummary, err := db.GetActiveSummary(convID)
+	input := &summarizationInput{}
+
+	if err != nil || activeSummary == nil {
+		// No active summary exists - summarize all messages
+		reqLog.Printf("[SUMMARIZE] No active summary found, summarizing all messages")
+		input.messages, err = db.GetConversationMessages(convID)
+		if err != nil {
+			reqLog.Printf("[SUMMARIZE] Error getting conversation messages: %v", err)
+			return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error retrieving messages"}
+		}
+	} else if activeSummary.UsageCount >= config.GetSummaryUsageThreshold() {
+		// Summary has been used often enough - create new summary from old summary + new messages
+		reqLog.Printf("[SUMMARIZE] Active summary used %d times, creating new summary", activeSummary.UsageCount)
+
+		// Start with the old summary as a "system" message
+		input.messages = []llm.Message{
+			{Role: "assistant", Content: fmt.Sprintf("Previous summary:\n%s", activeSummary.SummaryContent)},
+		}
+
+		// Get messages after the last summarized message
+		if activeSummary.SummarizedUpToMessageID != nil {
+			newMessages, err := db.GetMessagesAfterMessage(convID, *activeSummary.SummarizedUpToMessageID)
+			if err != nil {
+				reqLog.Printf("[SUMMARIZE] Error getting messages after last summarized: %v", err)
+				return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error retrieving new messages"}
+			}
+			input.messages = append(input.messages, newMessages...)
+		}
+	} else {
+		reqLog.Printf("[SUMMARIZE] Active summary exists with usage count %d, not creating new summary", activeSummary.UsageCount)
+		input.current = activeSummary
+		return input, nil
+	}
+
+	// Get the last message ID
+	input.lastMessageID, err = db.GetLastMessageID(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error getting last message ID: %v", err)
+		return nil, &chatError{Status: http.StatusInternalServerError, Message: "Error retrieving last message"}
+	}
+
+	return input, nil
+}
+
+// getSummarizationPrompt returns the system prompt used to summarize conversations (OPENROUTER_SUMMARIZATION_PROMPT)
+func getSummarizationPrompt() string {
+	if prompt := os.Getenv("OPENROUTER_SUMMARIZATION_PROMPT"); prompt != "" {
+		return prompt
+	}
+
+	// Note: the original custom system prompt is not stored, so text conversations
+	// are summarized with the summarization prompt only
+	return `You are a conversation summarizer. Your task is to create a concise, comprehensive summary of the conversation that captures:
+1. The main topics discussed
+2. Key questions asked and answers provided
+3. Important decisions or conclusions reached
+4. Any action items or next steps mentioned
+
+Format the summary in a clear, structured way that can be used as context for continuing the conversation. Keep the summary focused and avoid unnecessary details while preserving essential information.`
+}
+
+// saveSummary stores a generated summary as the conversation's active summary and refreshes the title if configured
+func saveSummary(provider llm.Summarizer, convID, summaryContent string, lastMessageID *string) (*db.ConversationSummary, error) {
+	// Save the new summary and make it the conversation's active summary atomically
+	summary, err := db.TransactionalSummarize(convID, summaryContent, lastMessageID)
+	if err != nil {
+		return nil, err
+	}
+	invalidateActiveSummaryCache(convID)
+
+	// Refresh the title from the new summary in the background
+	if config.GetUpdateTitleOnSummarize() {
+		go generateTitleFromSummary(provider, convID, summaryContent)
+	}
+	return summary, nil
+}
+
+// GetConversationSummariesHandler retrieves all summaries for a conversation
+func (ch *ChatHandlers) GetConversationSummariesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get summaries request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Get all summaries for conversation
+	summaries, err := db.GetAllSummaries(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting summaries: %v", err)
+		http.Error(w, "Error retrieving summaries", http.StatusInternalServerError)
+		return
+	}
+
+	// Convert to response format
+	summaryData := make([]SummaryData, 0, len(summaries))
+	for i := range summaries {
+		summaryData = append(summaryData, newSummaryData(&summaries[i]))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(SummariesResponse{
 		Summaries: summaryData,
 	})
 }
+
+// GetPartialMessagesHandler lists assistant responses whose streaming never completed
+func (ch *ChatHandlers) GetPartialMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get partial messages request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	messages, err := db.GetPartialMessages(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting partial messages: %v", err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessagesResponse{
+		Messages: newMessageDataList(messages),
+	})
+}
+
+// StarConversationHandler stars (bookmarks) or unstars a conversation
+func (ch *ChatHandlers) StarConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Star conversation request from user: %s for conversation: %s", username, convID)
+
+	// Empty body stars the conversation
+	var req StarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	starred := req.Starred == nil || *req.Starred
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := db.SetConversationStarred(convID, user.ID, starred); err != nil {
+		reqLog.Printf("[CHAT] Error starring conversation: %v", err)
+		http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StarResponse{
+		Starred: starred,
+	})
+}
+
+// resolveResponseSchema validates a format change and returns the schema to store with it.
+// Text conversations have no schema; structured ones require a valid one.
+func resolveResponseSchema(format, schema string) (string, error) {
+	if err := validation.ValidateResponseFormat(format); err != nil {
+		return "", err
+	}
+
+	if format == "text" {
+		return "", nil
+	}
+	if strings.TrimSpace(schema) == "" {
+		return "", fmt.Errorf("response_schema is required for json and xml formats")
+	}
+
+	if err := validation.ValidateResponseSchema(format, schema); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// UpdateResponseFormatHandler changes the response format of an existing conversation.
+// Any active summary is discarded since it may reflect the previous format.
+func (ch *ChatHandlers) UpdateResponseFormatHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Update response format request from user: %s for conversation: %s", username, convID)
+
+	var req UpdateFormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	schema, err := resolveResponseSchema(req.ResponseFormat, req.ResponseSchema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.ResponseSchema = schema
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Resubmitting the current format keeps the active summary
+	if req.ResponseFormat != conversation.ResponseFormat || req.ResponseSchema != conversation.ResponseSchema {
+		if err := db.UpdateConversationFormat(convID, req.ResponseFormat, req.ResponseSchema); err != nil {
+			reqLog.Printf("[CHAT] Error updating conversation format: %v", err)
+			http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+			return
+		}
+		invalidateActiveSummaryCache(convID)
+
+		conversation.ResponseFormat = req.ResponseFormat
+		conversation.ResponseSchema = req.ResponseSchema
+		conversation.ActiveSummaryID = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newConversationInfo(conversation, nil))
+}
+
+// UpdateConversationHandler applies a partial update to a conversation's title, response format and UI settings.
+// Changing the response format or schema discards any active summary, as UpdateResponseFormatHandler does.
+func (ch *ChatHandlers) UpdateConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Update conversation request from user: %s for conversation: %s", username, convID)
+
+	var req UpdateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if err := validation.ValidateTitle(title); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Title = &title
+	}
+
+	if req.Color != nil && *req.Color != "" {
+		if err := validation.ValidateColor(*req.Color); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	updates := db.ConversationUpdate{Title: req.Title, Color: req.Color}
+
+	// A format or schema given alone is validated against the conversation's current counterpart
+	if req.ResponseFormat != nil || req.ResponseSchema != nil {
+		format := conversation.ResponseFormat
+		if req.ResponseFormat != nil {
+			format = *req.ResponseFormat
+		}
+		schema := conversation.ResponseSchema
+		if req.ResponseSchema != nil {
+			schema = *req.ResponseSchema
+		}
+
+		schema, err := resolveResponseSchema(format, schema)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Resubmitting the current settings keeps the active summary
+		if format != conversation.ResponseFormat || schema != conversation.ResponseSchema {
+			updates.ResponseFormat = &format
+			updates.ResponseSchema = &schema
+			updates.DiscardActiveSummary = conversation.ActiveSummaryID != nil
+		}
+	}
+
+	if err := db.UpdateConversation(convID, updates); err != nil {
+		reqLog.Printf("[CHAT] Error updating conversation: %v", err)
+		http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+		return
+	}
+
+	if updates.DiscardActiveSummary {
+		invalidateActiveSummaryCache(convID)
+	}
+
+	conversation, err = db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error reloading conversation: %v", err)
+		http.Error(w, "Error updating conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newConversationInfo(conversation, nil))
+}
+
+// GetMessageCountByRoleHandler returns how many messages each party has sent in a conversation
+func (ch *ChatHandlers) GetMessageCountByRoleHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get message count by role request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	counts, err := db.GetMessageCountByRole(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error counting messages: %v", err)
+		http.Error(w, "Error retrieving message counts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
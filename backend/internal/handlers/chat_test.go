@@ -0,0 +1,931 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"chat-app/internal/moderation"
+	"chat-app/internal/rag"
+	"chat-app/internal/testutil"
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// stubVectorStore returns the same passages, or error, for every query
+type stubVectorStore struct {
+	passages []rag.Passage
+	err      error
+	queries  []string
+	k        int
+}
+
+func (s *stubVectorStore) Query(text string, k int) ([]rag.Passage, error) {
+	s.queries = append(s.queries, text)
+	s.k = k
+	return s.passages, s.err
+}
+
+func TestChatHandlerStatelessHistory(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	moderator, err := moderation.NewModerator(true, []string{`(?i)forbidden`})
+	if err != nil {
+		t.Fatalf("error creating moderator: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		lookupUser bool
+		wantStatus int
+		wantCode   string
+		wantCalls  int
+	}{
+		{
+			name:       "invalid history",
+			body:       `{"messages":[{"role":"assistant","content":"hi"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "blocked latest message",
+			body:       `{"messages":[{"role":"user","content":"forbidden"}]}`,
+			lookupUser: true,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "CONTENT_MODERATED",
+		},
+		{
+			name: "blocked earlier user message",
+			body: `{"messages":[{"role":"user","content":"Forbidden plan"},{"role":"assistant","content":"ok"},
+				{"role":"user","content":"continue"}]}`,
+			lookupUser: true,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "CONTENT_MODERATED",
+		},
+		{
+			name: "blocked assistant turn",
+			body: `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"forbidden"},
+				{"role":"user","content":"continue"}]}`,
+			lookupUser: true,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "CONTENT_MODERATED",
+		},
+		{
+			name: "answered without storing",
+			body: `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},
+				{"role":"user","content":"how are you?"}]}`,
+			lookupUser: true,
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.lookupUser {
+				testutil.ExpectUser(mock, userID, "alice")
+			}
+
+			provider := &stubProvider{response: "fine"}
+			store := &stubVectorStore{passages: []rag.Passage{{Text: "Retrieved fact", Score: 0.9}}}
+			ch := &ChatHandlers{moderator: moderator, vectorStore: store, fallbackProvider: provider}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(tt.body), "alice", nil)
+			ch.ChatHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("error code = %q (decode error %v), want %q", resp.Code, err, tt.wantCode)
+				}
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ChatResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Response != "fine" || resp.ConversationID != "" {
+				t.Errorf("response = %+v, want the provider's answer and no conversation", resp)
+			}
+			if len(provider.messages) != 3 {
+				t.Errorf("provider got %d messages, want the 3 supplied", len(provider.messages))
+			}
+			if len(store.queries) != 1 || store.queries[0] != "how are you?" {
+				t.Errorf("vector store queries = %q, want the latest user message", store.queries)
+			}
+			if !strings.Contains(provider.systemPrompt, "Retrieved fact") {
+				t.Errorf("system prompt = %q, want the retrieved context", provider.systemPrompt)
+			}
+		})
+	}
+}
+
+// expectStreamStart expects what ChatStreamHandler reads and writes before it opens the LLM stream
+// for a message in conv: the user and conversation lookups, the user message insert, the active
+// summary lookup and the stored history. The duplicate message check is disabled.
+func expectStreamStart(t *testing.T, mock sqlmock.Sqlmock, conv testutil.Conversation, history ...string) {
+	t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "0")
+	testutil.ExpectUser(mock, conv.UserID, "alice")
+	testutil.ExpectConversation(mock, conv)
+	testutil.ExpectAddMessage(mock, conv.ID)
+	testutil.ExpectNoActiveSummary(mock, conv.ID)
+	testutil.ExpectHistory(mock, conv.ID, history...)
+}
+
+// sseFrame is one event of an SSE response
+type sseFrame struct {
+	event string
+	data  string
+}
+
+// parseSSE splits an SSE response body into its events
+func parseSSE(body string) []sseFrame {
+	var frames []sseFrame
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var frame sseFrame
+		for _, line := range strings.Split(block, "\n") {
+			if event, ok := strings.CutPrefix(line, "event: "); ok {
+				frame.event = event
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				frame.data = data
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestChatStreamHandlerErrorFrame(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+
+	provider := &stubProvider{err: errors.New("upstream said \"no\"\n\tat \\path")}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+	w := httptest.NewRecorder()
+	r := newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	ch.ChatStreamHandler(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want it left to the CORS middleware", got)
+	}
+
+	frames := parseSSE(w.Body.String())
+	if len(frames) != 1 || frames[0].event != sseEventError {
+		t.Fatalf("frames = %+v, want a single error frame", frames)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(frames[0].data), &payload); err != nil {
+		t.Fatalf("error frame %q is not valid JSON: %v", frames[0].data, err)
+	}
+	if payload["error"] != provider.err.Error() {
+		t.Errorf("error = %q, want %q", payload["error"], provider.err.Error())
+	}
+}
+
+// expectMessageStart expects what sendMessage reads and writes before it calls the LLM for a message
+// in conv: the user and conversation lookups and the user message insert. The duplicate message
+// check is disabled.
+func expectMessageStart(t *testing.T, mock sqlmock.Sqlmock, conv testutil.Conversation) {
+	t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "0")
+	testutil.ExpectUser(mock, conv.UserID, "alice")
+	testutil.ExpectConversation(mock, conv)
+	testutil.ExpectAddMessage(mock, conv.ID)
+}
+
+// expectReplyStored expects sendMessage to store the assistant reply and the hash of its system
+// prompt. Auto-summarization is disabled.
+func expectReplyStored(t *testing.T, mock sqlmock.Sqlmock, convID string) {
+	t.Setenv("AUTO_SUMMARIZE_THRESHOLD", "0")
+	testutil.ExpectAddMessage(mock, convID)
+	mock.ExpectExec(`UPDATE messages SET system_prompt_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestChatStreamHandlerModeration(t *testing.T) {
+	moderator, err := moderation.NewModerator(true, []string{`(?i)forbidden`})
+	if err != nil {
+		t.Fatalf("error creating moderator: %v", err)
+	}
+	// Blocked messages are rejected before the database or the LLM is reached
+	testutil.NewMockDB(t)
+	provider := &stubProvider{response: "reply"}
+	ch := &ChatHandlers{moderator: moderator, inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	w := httptest.NewRecorder()
+	r := newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(`{"message":"a Forbidden plan"}`), "alice", nil)
+	ch.ChatStreamHandler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "forbidden") {
+		t.Errorf("response %q reveals the triggering pattern", w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != "CONTENT_MODERATED" {
+		t.Errorf("response = %+v (%v), want code CONTENT_MODERATED", resp, err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times, want 0", provider.calls)
+	}
+}
+
+func TestChatStreamHandlerCheckpointsPartialResponse(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+
+	tests := []struct {
+		name     string
+		interval string
+		setup    func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:     "checkpointed and finalized",
+			interval: "2",
+			setup: func(mock sqlmock.Sqlmock) {
+				msgID := &testutil.SameArg{}
+				mock.ExpectExec(`INSERT INTO messages \(id, conversation_id, role, content, partial\)\s+VALUES \(\$1, \$2, \$3, \$4, TRUE\)\s+ON CONFLICT \(id\) DO UPDATE SET content = EXCLUDED.content`).
+					WithArgs(msgID, conv.ID, "assistant", "Hello, ").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE messages\s+SET content = \$2, .* partial = FALSE\s+WHERE id = \$1\s+RETURNING conversation_id`).
+					WillReturnRows(sqlmock.NewRows([]string{"conversation_id"}).AddRow(conv.ID))
+				mock.ExpectExec(`UPDATE conversations SET updated_at`).WithArgs(conv.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE messages SET system_prompt_hash = \$1 WHERE id = \$2`).
+					WithArgs(sqlmock.AnyArg(), msgID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE messages SET content_hash = \$1 WHERE id = \$2`).
+					WithArgs(sqlmock.AnyArg(), msgID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "checkpoints disabled",
+			interval: "0",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectAddMessage(mock, conv.ID)
+				mock.ExpectExec(`UPDATE messages SET system_prompt_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CHECKPOINT_CHUNK_INTERVAL", tt.interval)
+			t.Setenv("AUTO_SUMMARIZE_THRESHOLD", "0")
+			mock := testutil.NewMockDB(t)
+			expectStreamStart(t, mock, conv, "hi")
+			tt.setup(mock)
+
+			provider := &stubProvider{chunks: []string{"Hello", ", ", "world"}}
+			ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+			body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+			w := httptest.NewRecorder()
+			ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+			frames := parseSSE(w.Body.String())
+			if last := frames[len(frames)-1]; last.event != sseEventDone {
+				t.Errorf("last frame = %+v, want the done frame", last)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestChatStreamHandlerChecksum(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	mock := testutil.NewMockDB(t)
+	t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+	expectStreamStart(t, mock, conv, "hi")
+	expectReplyStored(t, mock, conv.ID)
+	// SHA-256 of the assembled response "Hello, world"
+	const checksum = "4ae7c3b6ac0beff671efa8cf57386151c06e58ca53a78d83f36107316cec125f"
+	mock.ExpectExec(`UPDATE messages SET content_hash = \$1 WHERE id = \$2`).
+		WithArgs(checksum, "00000000-0000-0000-0000-00000000aaaa").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	provider := &stubProvider{chunks: []string{"Hello", ", ", "world"}}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+	w := httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	frames := parseSSE(w.Body.String())
+	if len(frames) < 2 {
+		t.Fatalf("frames = %+v, want the checksum and done frames at the end", frames)
+	}
+	if got := frames[len(frames)-2]; got.event != sseEventChecksum || got.data != checksum {
+		t.Errorf("second-to-last frame = %+v, want checksum %s", got, checksum)
+	}
+	if got := frames[len(frames)-1]; got.event != sseEventDone {
+		t.Errorf("last frame = %+v, want the done frame", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestChatStreamHandlerProtocol(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	// SHA-256 of the assembled response "Hi\nthere"
+	const checksum = "79febc795d5d63e17233dd4b6025c2c440fd1930aaf3bd8a65fb3bc4c836368a"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantFrames []sseFrame
+		wantSunset bool
+	}{
+		{
+			name: "named events",
+			wantFrames: []sseFrame{
+				{event: sseEventConvID, data: conv.ID},
+				{event: sseEventModel, data: "stub/model"},
+				{event: sseEventTemperature, data: "0.50"},
+				{event: sseEventContent, data: `Hi\n`},
+				{event: sseEventContent, data: "there"},
+				{event: sseEventChecksum, data: checksum},
+				{event: sseEventDone, data: "[DONE]"},
+			},
+		},
+		{
+			name:  "legacy protocol",
+			query: "?legacy=true",
+			wantFrames: []sseFrame{
+				{data: "CONV_ID:" + conv.ID},
+				{data: "MODEL:stub/model"},
+				{data: "TEMPERATURE:0.50"},
+				{data: `Hi\n`},
+				{data: "there"},
+				{data: "CHECKSUM:" + checksum},
+				{data: "[DONE]"},
+			},
+			wantSunset: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+			expectStreamStart(t, mock, conv, "hi")
+			expectReplyStored(t, mock, conv.ID)
+			mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			provider := &stubProvider{chunks: []string{"Hi\n", "there"}}
+			ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+			body := `{"message":"hi","conversation_id":"` + conv.ID + `","temperature":0.5}`
+			w := httptest.NewRecorder()
+			ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream"+tt.query, strings.NewReader(body), "alice", nil))
+
+			if got := parseSSE(w.Body.String()); !slices.Equal(got, tt.wantFrames) {
+				t.Errorf("frames = %+v, want %+v", got, tt.wantFrames)
+			}
+			if sunset := w.Header().Get("Sunset") != "" && w.Header().Get("Deprecation") == "true"; sunset != tt.wantSunset {
+				t.Errorf("Sunset = %q, Deprecation = %q, want them set only for the legacy protocol", w.Header().Get("Sunset"), w.Header().Get("Deprecation"))
+			}
+		})
+	}
+}
+
+func TestChatStreamHandlerFlushMode(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	chunks := []string{"Hel", "lo. Wor", "ld!\n", "\nNew para", "graph"}
+
+	// Frames escape newlines, so the expected segments contain a literal \n
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{mode: "", want: []string{"Hel", "lo. Wor", `ld!\n`, `\nNew para`, "graph"}},
+		{mode: "token", want: []string{"Hel", "lo. Wor", `ld!\n`, `\nNew para`, "graph"}},
+		{mode: "sentence", want: []string{"Hello.", " World!", `\n\n`, "New paragraph"}},
+		{mode: "paragraph", want: []string{`Hello. World!\n\n`, "New paragraph"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(cmp.Or(tt.mode, "default"), func(t *testing.T) {
+			t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+			mock := testutil.NewMockDB(t)
+			expectStreamStart(t, mock, conv, "hi")
+			expectReplyStored(t, mock, conv.ID)
+			mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			provider := &stubProvider{chunks: chunks}
+			ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+			body := `{"message":"hi","conversation_id":"` + conv.ID + `","flush_mode":"` + tt.mode + `"}`
+			w := httptest.NewRecorder()
+			ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+			var content []string
+			for _, frame := range parseSSE(w.Body.String()) {
+				if frame.event == sseEventContent {
+					content = append(content, frame.data)
+				}
+			}
+			if !slices.Equal(content, tt.want) {
+				t.Errorf("content frames = %q, want %q", content, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		testutil.NewMockDB(t)
+		provider := &stubProvider{chunks: chunks}
+		ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+		w := httptest.NewRecorder()
+		ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(`{"message":"hi","flush_mode":"word"}`), "alice", nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+		}
+		if provider.calls != 0 {
+			t.Errorf("provider called %d times, want 0", provider.calls)
+		}
+	})
+}
+
+func TestChatHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "too many stop sequences", body: `{"message":"hi","stop_sequences":["a","b","c","d","e"]}`},
+		{name: "empty stop sequence", body: `{"message":"hi","stop_sequences":[""]}`},
+		{name: "malformed JSON schema", body: `{"message":"hi","response_format":"json","response_schema":"{\"type\":"}`},
+		{name: "JSON schema without type", body: `{"message":"hi","response_format":"json","response_schema":"{\"properties\":{}}"}`},
+		{name: "malformed XML schema", body: `{"message":"hi","response_format":"xml","response_schema":"<a><b></a>"}`},
+		{name: "negative seed", body: `{"message":"hi","seed":-1}`},
+		{name: "presence penalty too high", body: `{"message":"hi","presence_penalty":2.5}`},
+		{name: "frequency penalty too low", body: `{"message":"hi","frequency_penalty":-3}`},
+		{name: "invalid color", body: `{"message":"hi","color":"red"}`},
+		{name: "provider config not an object", body: `{"message":"hi","provider_specific_config":["reasoning"]}`},
+		{name: "provider config replacing messages", body: `{"message":"hi","provider_specific_config":{"messages":[]}}`},
+		{name: "provider config replacing stream", body: `{"message":"hi","provider_specific_config":{"stream":true}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Invalid requests are rejected before the database or the LLM is reached
+			testutil.NewMockDB(t)
+			provider := &stubProvider{response: "reply"}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(tt.body), "alice", nil)
+			(&ChatHandlers{fallbackProvider: provider}).ChatHandler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if provider.calls != 0 {
+				t.Errorf("provider called %d times, want 0", provider.calls)
+			}
+		})
+	}
+}
+
+func TestChatHandlersPassPenalties(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: userID}
+	penalty := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name          string
+		penalties     string
+		wantPresence  *float64
+		wantFrequency *float64
+	}{
+		{name: "without penalties"},
+		{name: "with penalties", penalties: `,"presence_penalty":0.5,"frequency_penalty":-1.5`, wantPresence: penalty(0.5), wantFrequency: penalty(-1.5)},
+	}
+
+	samePenalty := func(got, want *float64) bool {
+		return (got == nil) == (want == nil) && (got == nil || *got == *want)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("stateless", func(t *testing.T) {
+				mock := testutil.NewMockDB(t)
+				testutil.ExpectUser(mock, userID, "alice")
+
+				provider := &stubProvider{response: "fine"}
+				body := `{"messages":[{"role":"user","content":"hi"}]` + tt.penalties + `}`
+				w := httptest.NewRecorder()
+				(&ChatHandlers{fallbackProvider: provider}).ChatHandler(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+				}
+				if !samePenalty(provider.opts.PresencePenalty, tt.wantPresence) || !samePenalty(provider.opts.FrequencyPenalty, tt.wantFrequency) {
+					t.Errorf("options = %+v, want presence %v and frequency %v", provider.opts, tt.wantPresence, tt.wantFrequency)
+				}
+			})
+
+			t.Run("stream", func(t *testing.T) {
+				t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+				mock := testutil.NewMockDB(t)
+				expectStreamStart(t, mock, conv, "hi")
+				expectReplyStored(t, mock, conv.ID)
+				mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				provider := &stubProvider{response: "fine"}
+				ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+				body := `{"message":"hi","conversation_id":"` + conv.ID + `"` + tt.penalties + `}`
+				w := httptest.NewRecorder()
+				ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+				if provider.calls != 1 {
+					t.Fatalf("provider called %d times, want 1 (body %q)", provider.calls, w.Body.String())
+				}
+				if !samePenalty(provider.opts.PresencePenalty, tt.wantPresence) || !samePenalty(provider.opts.FrequencyPenalty, tt.wantFrequency) {
+					t.Errorf("options = %+v, want presence %v and frequency %v", provider.opts, tt.wantPresence, tt.wantFrequency)
+				}
+			})
+		})
+	}
+}
+
+func TestChatHandlerLogsRequestFields(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	testutil.ExpectNoConversation(mock, convID)
+
+	r := newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(`{"message":"hi","conversation_id":"`+convID+`"}`), "alice", nil)
+	r.Header.Set(logger.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	logger.RequestLogger(http.HandlerFunc((&ChatHandlers{fallbackProvider: &stubProvider{}}).ChatHandler)).ServeHTTP(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusNotFound, w.Body.String())
+	}
+	if logged := buf.String(); !strings.Contains(logged, "correlation_id=req-42 user_id="+userID+" [CHAT] Error getting conversation") {
+		t.Errorf("log = %q, want the error logged with the correlation and user IDs", logged)
+	}
+}
+
+// disconnectingProvider streams two chunks and then holds the stream open until the request context
+// is cancelled, closing stopped once its stream goroutine exits
+type disconnectingProvider struct {
+	stubProvider
+	sent    chan struct{}
+	stopped chan struct{}
+}
+
+func (p *disconnectingProvider) ChatWithHistoryStream(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (<-chan llm.StreamChunk, error) {
+	chunks := make(chan llm.StreamChunk)
+	go func() {
+		defer close(p.stopped)
+		defer close(chunks)
+		chunks <- llm.StreamChunk{Content: "Hello"}
+		chunks <- llm.StreamChunk{Content: ", "}
+		close(p.sent)
+		<-ctx.Done()
+	}()
+	return chunks, nil
+}
+
+func TestChatStreamHandlerClientDisconnect(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+	// Only the partial response is stored: it is never finalized
+	mock.ExpectExec(`INSERT INTO messages \(id, conversation_id, role, content, partial\)\s+VALUES \(\$1, \$2, \$3, \$4, TRUE\)`).
+		WithArgs(sqlmock.AnyArg(), conv.ID, "assistant", "Hello, ").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	provider := &disconnectingProvider{sent: make(chan struct{}), stopped: make(chan struct{})}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+	r := newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch.ChatStreamHandler(httptest.NewRecorder(), r)
+	}()
+
+	<-provider.sent
+	cancel()
+
+	for name, stopped := range map[string]chan struct{}{"handler": done, "stream goroutine": provider.stopped} {
+		select {
+		case <-stopped:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s still running after the client disconnected", name)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// slowProvider answers like stubProvider after a fixed delay
+type slowProvider struct {
+	stubProvider
+	delay time.Duration
+}
+
+func (p *slowProvider) ChatWithHistory(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (string, error) {
+	time.Sleep(p.delay)
+	return p.stubProvider.ChatWithHistory(ctx, messages, customSystemPrompt, format, modelOverride, temperature, opts)
+}
+
+func (p *slowProvider) ChatWithHistoryStream(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (<-chan llm.StreamChunk, error) {
+	time.Sleep(p.delay)
+	return p.stubProvider.ChatWithHistoryStream(ctx, messages, customSystemPrompt, format, modelOverride, temperature, opts)
+}
+
+// responseTimeArg matches any response_time_ms argument and records it
+type responseTimeArg struct {
+	ms  int64
+	set bool
+}
+
+func (a *responseTimeArg) Match(v driver.Value) bool {
+	a.ms, a.set = v.(int64)
+	return a.set
+}
+
+// expectAssistantMessage expects the assistant reply to be inserted into a conversation with its
+// response time captured by responseTime
+func expectAssistantMessage(mock sqlmock.Sqlmock, convID string, responseTime *responseTimeArg) {
+	args := make([]driver.Value, 19)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[1], args[2], args[17] = convID, "assistant", responseTime
+	mock.ExpectQuery(`INSERT INTO messages \(.*, response_time_ms, parent_message_id\)`).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("00000000-0000-0000-0000-00000000bbbb", time.Now()))
+	mock.ExpectExec(`UPDATE conversations SET updated_at`).
+		WithArgs(convID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestChatHandlersRecordResponseTime(t *testing.T) {
+	const (
+		delay     = 100 * time.Millisecond
+		tolerance = 50 * time.Millisecond
+	)
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, mock sqlmock.Sqlmock, responseTime *responseTimeArg)
+		call  func(ch *ChatHandlers, w http.ResponseWriter)
+	}{
+		{
+			name: "chat",
+			setup: func(t *testing.T, mock sqlmock.Sqlmock, responseTime *responseTimeArg) {
+				expectMessageStart(t, mock, conv)
+				testutil.ExpectHistory(mock, conv.ID, "hi")
+				expectAssistantMessage(mock, conv.ID, responseTime)
+				mock.ExpectExec(`UPDATE messages SET system_prompt_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(ch *ChatHandlers, w http.ResponseWriter) {
+				ch.ChatHandler(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+			},
+		},
+		{
+			name: "stream",
+			setup: func(t *testing.T, mock sqlmock.Sqlmock, responseTime *responseTimeArg) {
+				t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+				expectStreamStart(t, mock, conv, "hi")
+				expectAssistantMessage(mock, conv.ID, responseTime)
+				mock.ExpectExec(`UPDATE messages SET system_prompt_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call: func(ch *ChatHandlers, w http.ResponseWriter) {
+				ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTO_SUMMARIZE_THRESHOLD", "0")
+			mock := testutil.NewMockDB(t)
+			responseTime := &responseTimeArg{}
+			tt.setup(t, mock, responseTime)
+
+			provider := &slowProvider{stubProvider: stubProvider{response: "hello"}, delay: delay}
+			w := httptest.NewRecorder()
+			tt.call(&ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}, w)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			got := time.Duration(responseTime.ms) * time.Millisecond
+			if !responseTime.set || got < delay || got > delay+tolerance {
+				t.Errorf("response_time_ms = %v, want %v within %v", got, delay, tolerance)
+			}
+		})
+	}
+}
+
+func TestChatHandlerParentMessage(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "55555555-5555-5555-5555-555555555555"
+		parentID    = "44444444-4444-4444-4444-444444444444"
+	)
+	body := `{"message":"hi","conversation_id":"` + convID + `","parent_message_id":"` + parentID + `"}`
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			name: "parent in another conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectMessage(mock, parentID, otherConvID, "assistant", "elsewhere")
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "missing parent",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+					WithArgs(parentID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns))
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "parent in the conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectMessage(mock, parentID, convID, "assistant", "earlier answer")
+				args := make([]driver.Value, 19)
+				for i := range args {
+					args[i] = sqlmock.AnyArg()
+				}
+				args[1], args[2], args[18] = convID, "user", parentID
+				mock.ExpectQuery(`INSERT INTO messages \(.*, parent_message_id\)\s+VALUES \(.*, NULLIF\(\$19, ''\)::uuid\)`).
+					WithArgs(args...).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("00000000-0000-0000-0000-00000000aaaa", time.Now()))
+				mock.ExpectExec(`UPDATE conversations SET updated_at`).WithArgs(convID).WillReturnResult(sqlmock.NewResult(0, 1))
+				testutil.ExpectHistory(mock, convID, "hi")
+				expectReplyStored(t, mock, convID)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "0")
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			tt.setup(mock)
+
+			provider := &stubProvider{response: "reply"}
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: provider}).ChatHandler(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", provider.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIsDuplicateMessage(t *testing.T) {
+	const convID = "33333333-3333-3333-3333-333333333333"
+	lastQuery := `FROM messages\s+WHERE conversation_id = \$1 AND role = \$2 AND deleted_at IS NULL\s+ORDER BY created_at DESC\s+LIMIT 1`
+
+	// lastMessage returns the rows of a last user message sent age ago
+	lastMessage := func(content string, age time.Duration) *sqlmock.Rows {
+		row := testutil.MessageRow("m1", convID, "user", content)
+		row[len(row)-1] = time.Now().Add(-age)
+		return sqlmock.NewRows(testutil.MessageColumns).AddRow(row...)
+	}
+
+	tests := []struct {
+		name    string
+		window  string
+		rows    *sqlmock.Rows // nil when the last message is not looked up
+		content string
+		want    bool
+	}{
+		{name: "exact match within the window", rows: lastMessage("hi", time.Second), content: "hi", want: true},
+		{name: "match outside the window", rows: lastMessage("hi", 6*time.Second), content: "hi"},
+		{name: "different content", rows: lastMessage("hi", time.Second), content: "hello"},
+		{name: "first message", rows: sqlmock.NewRows(testutil.MessageColumns), content: "hi"},
+		{name: "configured window", window: "10000", rows: lastMessage("hi", 6*time.Second), content: "hi", want: true},
+		{name: "disabled", window: "0", content: "hi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", tt.window)
+			mock := testutil.NewMockDB(t)
+			if tt.rows != nil {
+				mock.ExpectQuery(lastQuery).WithArgs(convID, "user").WillReturnRows(tt.rows)
+			}
+
+			got, err := isDuplicateMessage(convID, tt.content)
+			if err != nil {
+				t.Fatalf("isDuplicateMessage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isDuplicateMessage(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestChatHandlerRejectsDuplicateMessage(t *testing.T) {
+	conv := testutil.Conversation{ID: "33333333-3333-3333-3333-333333333333", UserID: "11111111-1111-1111-1111-111111111111"}
+	t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "5000")
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, conv.UserID, "alice")
+	testutil.ExpectConversation(mock, conv)
+	mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND role = \$2`).
+		WithArgs(conv.ID, "user").
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow("m1", conv.ID, "user", "hi")...))
+
+	provider := &stubProvider{response: "reply"}
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+	w := httptest.NewRecorder()
+	(&ChatHandlers{fallbackProvider: provider}).ChatHandler(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusConflict, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != "DUPLICATE_MESSAGE" {
+		t.Errorf("response = %+v (%v), want code DUPLICATE_MESSAGE", resp, err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times, want 0", provider.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/logger"
+	stdcontext "context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsRequestTimeout is how long a client has to send its chat request after the handshake
+	wsRequestTimeout = 30 * time.Second
+
+	// wsMaxRequestBytes caps the size of the chat request message
+	wsMaxRequestBytes = 1 << 20
+
+	// wsWriteTimeout bounds the delivery of a single frame to the client
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsUpgrader accepts browser connections from the origins in the CORS allow-list of the REST endpoints
+// and selects the token subprotocol; requests are authenticated by WebSocketAuthMiddleware before the upgrade
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || config.IsOriginAllowed(origin)
+	},
+	Subprotocols: []string{auth.WebSocketProtocol},
+}
+
+// WSFrame is a chat stream frame sent over the WebSocket. Its type is one of the SSE event types.
+type WSFrame struct {
+	Type      string          `json:"type"`
+	Content   string          `json:"content,omitempty"`    // Text payload: content, conversation ID, model, checksum, ...
+	Data      json.RawMessage `json:"data,omitempty"`       // JSON payload of usage and error frames
+	Status    int             `json:"status,omitempty"`     // HTTP status of errors raised before streaming started
+	RequestID string          `json:"request_id,omitempty"` // Correlation ID of error frames, for clients to quote when reporting the error
+}
+
+// wsStreamWriter lets ChatStreamHandler stream over a WebSocket. Frames become JSON messages and
+// an HTTP error written before streaming started is sent as an error frame. Its headers start with
+// the correlation ID of the handshake so errors can report it.
+type wsStreamWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	status int
+	log    *log.Logger
+}
+
+func newWSStreamWriter(reqLog *log.Logger, conn *websocket.Conn, requestID string) *wsStreamWriter {
+	header := make(http.Header)
+	header.Set(logger.RequestIDHeader, requestID)
+	return &wsStreamWriter{conn: conn, header: header, status: http.StatusOK, log: reqLog}
+}
+
+func (ws *wsStreamWriter) Header() http.Header {
+	return ws.header
+}
+
+func (ws *wsStreamWriter) WriteHeader(status int) {
+	ws.status = status
+}
+
+// Write sends a plain HTTP response body, which ChatStreamHandler only writes for errors, as an error frame
+func (ws *wsStreamWriter) Write(body []byte) (int, error) {
+	frame := WSFrame{Type: sseEventError, Status: ws.status}
+	if strings.HasPrefix(ws.header.Get("Content-Type"), "application/json") {
+		frame.Data = json.RawMessage(bytes.TrimSpace(body))
+	} else {
+		frame.Data = json.RawMessage(errorFrameData(strings.TrimSpace(string(body))))
+	}
+	if err := ws.writeFrame(frame); err != nil {
+		return 0, err
+	}
+	return len(body), nil
+}
+
+// Flush is a no-op: every frame is sent as soon as it is written
+func (ws *wsStreamWriter) Flush() {}
+
+// send writes a chat stream frame; JSON object payloads are embedded as data, anything else as content
+func (ws *wsStreamWriter) send(event, data string) {
+	frame := WSFrame{Type: event}
+	if strings.HasPrefix(data, "{") && json.Valid([]byte(data)) {
+		frame.Data = json.RawMessage(data)
+	} else {
+		frame.Content = data
+	}
+	if err := ws.writeFrame(frame); err != nil {
+		ws.log.Printf("[CHAT] Warning: failed to send WebSocket frame: %v", err)
+	}
+}
+
+func (ws *wsStreamWriter) writeFrame(frame WSFrame) error {
+	if frame.Type == sseEventError {
+		frame.RequestID = ws.header.Get(logger.RequestIDHeader)
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return ws.conn.WriteJSON(frame)
+}
+
+// ChatWSHandler streams a chat response over a WebSocket as an alternative to the SSE endpoint.
+// After the handshake the client sends a ChatRequest as its first message; the response is then
+// streamed as WSFrame messages and the server closes the connection after the done or error frame.
+// Closing the socket early cancels the stream like a dropped SSE connection.
+// Browsers, which cannot set an Authorization header, offer the "bearer" subprotocol followed by their token.
+func (ch *ChatHandlers) ChatWSHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+
+	// The handshake response is written by the upgrader, so the correlation ID is passed on explicitly
+	requestID := w.Header().Get(logger.RequestIDHeader)
+	conn, err := wsUpgrader.Upgrade(w, r, http.Header{logger.RequestIDHeader: {requestID}})
+	if err != nil {
+		// The upgrader has already written an error response
+		reqLog.Printf("[CHAT] WebSocket upgrade failed for user %s: %v", username, err)
+		return
+	}
+	defer conn.Close()
+	reqLog.Printf("WebSocket chat connection from user: %s", username)
+
+	conn.SetReadLimit(wsMaxRequestBytes)
+	conn.SetReadDeadline(time.Now().Add(wsRequestTimeout))
+	_, payload, err := conn.ReadMessage()
+	if err != nil {
+		reqLog.Printf("[CHAT] Error reading WebSocket chat request: %v", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// Keep reading so close frames are handled; the stream is cancelled once the client goes away
+	ctx, cancel := stdcontext.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	streamReq := r.Clone(ctx)
+	streamReq.Method = http.MethodPost
+	streamReq.Body = io.NopCloser(bytes.NewReader(payload))
+	ch.ChatStreamHandler(newWSStreamWriter(reqLog, conn, requestID), streamReq)
+
+	if ctx.Err() == nil {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(wsWriteTimeout)); err != nil {
+			reqLog.Printf("[CHAT] Warning: failed to close WebSocket: %v", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/logger"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWSTestServer serves ChatWSHandler as the given user behind the request logger
+func newWSTestServer(t *testing.T, username string) string {
+	t.Helper()
+	handler := logger.RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), auth.UserContextKey, username)
+		(&ChatHandlers{}).ChatWSHandler(w, r.WithContext(ctx))
+	}))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestChatWSHandlerErrorFrameHasRequestID(t *testing.T) {
+	url := newWSTestServer(t, "alice")
+
+	dialer := websocket.Dialer{Subprotocols: []string{auth.WebSocketProtocol, "token"}}
+	conn, resp, err := dialer.Dial(url, http.Header{logger.RequestIDHeader: {"ws-test-1"}})
+	if err != nil {
+		t.Fatalf("error dialing: %v", err)
+	}
+	defer conn.Close()
+	if got := resp.Header.Get(logger.RequestIDHeader); got != "ws-test-1" {
+		t.Errorf("handshake %s = %q, want %q", logger.RequestIDHeader, got, "ws-test-1")
+	}
+	if conn.Subprotocol() != auth.WebSocketProtocol {
+		t.Errorf("subprotocol = %q, want %q", conn.Subprotocol(), auth.WebSocketProtocol)
+	}
+
+	if err := conn.WriteJSON(ChatRequest{}); err != nil {
+		t.Fatalf("error sending chat request: %v", err)
+	}
+	var frame WSFrame
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("error reading frame: %v", err)
+	}
+	if frame.Type != sseEventError || frame.Status != http.StatusBadRequest || frame.RequestID != "ws-test-1" {
+		t.Errorf("got frame %+v, want a 400 error frame with request ID ws-test-1", frame)
+	}
+}
+
+func TestChatWSHandlerCheckOrigin(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	url := newWSTestServer(t, "alice")
+
+	tests := []struct {
+		name    string
+		origin  string
+		wantErr bool
+	}{
+		{name: "allowed origin", origin: "https://app.example.com"},
+		{name: "other origin", origin: "https://evil.example.com", wantErr: true},
+		{name: "no origin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, _, err := websocket.DefaultDialer.Dial(url, header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dial error = %v, want error %v", err, tt.wantErr)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
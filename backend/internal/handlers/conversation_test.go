@@ -0,0 +1,958 @@
+package handlers
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"cmp"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var conversationListColumns = []string{"id", "user_id", "title", "response_format", "response_schema", "starred_at", "color", "created_at", "updated_at"}
+
+func TestConversationCursorRoundTrip(t *testing.T) {
+	conv := db.Conversation{
+		ID:        "55555555-5555-5555-5555-555555555555",
+		UpdatedAt: time.Date(2026, 3, 4, 5, 6, 7, 890123000, time.UTC),
+	}
+
+	cursor, err := parseConversationCursor(formatConversationCursor(conv))
+	if err != nil {
+		t.Fatalf("error parsing cursor: %v", err)
+	}
+	if cursor.ID != conv.ID || !cursor.UpdatedAt.Equal(conv.UpdatedAt) {
+		t.Errorf("got cursor %+v, want %s at %s", cursor, conv.ID, conv.UpdatedAt)
+	}
+}
+
+func TestParseConversationCursorInvalid(t *testing.T) {
+	for _, value := range []string{
+		"2026-03-04T05:06:07Z",
+		"yesterday_55555555-5555-5555-5555-555555555555",
+		"2026-03-04T05:06:07Z_not-a-uuid",
+	} {
+		if _, err := parseConversationCursor(value); err == nil {
+			t.Errorf("parseConversationCursor(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestGetConversationsHandler(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	newer := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	older := newer.Add(-time.Hour)
+	cursorID := "66666666-6666-6666-6666-666666666666"
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(mock sqlmock.Sqlmock)
+		wantStatus     int
+		wantCount      int
+		wantNextCursor string
+	}{
+		{name: "zero limit", query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "limit above the maximum", query: "?limit=101", wantStatus: http.StatusBadRequest},
+		{name: "non-numeric limit", query: "?limit=ten", wantStatus: http.StatusBadRequest},
+		{name: "malformed cursor", query: "?before=2026-03-04T12:00:00Z", wantStatus: http.StatusBadRequest},
+		{
+			name:  "full first page has a next cursor",
+			query: "?limit=2",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1`).
+					WithArgs(userID, false, nil, nil, 2).
+					WillReturnRows(sqlmock.NewRows(conversationListColumns).
+						AddRow("77777777-7777-7777-7777-777777777777", userID, "Newer", "text", "", nil, "", newer, newer).
+						AddRow(cursorID, userID, "Older", "text", "", nil, "", older, older))
+				mock.ExpectQuery(`JOIN conversation_summaries`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantStatus:     http.StatusOK,
+			wantCount:      2,
+			wantNextCursor: older.Format(time.RFC3339Nano) + "_" + cursorID,
+		},
+		{
+			name:  "partial page after a cursor is the last page",
+			query: "?limit=2&before=" + older.Format(time.RFC3339Nano) + "_" + cursorID,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1`).
+					WithArgs(userID, false, older, cursorID, 2).
+					WillReturnRows(sqlmock.NewRows(conversationListColumns).
+						AddRow("88888888-8888-8888-8888-888888888888", userID, "Oldest", "text", "", nil, "", older, older))
+				mock.ExpectQuery(`JOIN conversation_summaries`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantStatus: http.StatusOK,
+			wantCount:  1,
+		},
+		{
+			name:  "starred filter",
+			query: "?starred=true",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1`).
+					WithArgs(userID, true, nil, nil, defaultConversationsPageSize).
+					WillReturnRows(sqlmock.NewRows(conversationListColumns).
+						AddRow(cursorID, userID, "Bookmarked", "text", "", older, "", older, newer))
+				mock.ExpectQuery(`JOIN conversation_summaries`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+			wantStatus: http.StatusOK,
+			wantCount:  1,
+		},
+		{
+			name: "default page size",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1`).
+					WithArgs(userID, false, nil, nil, defaultConversationsPageSize).
+					WillReturnRows(sqlmock.NewRows(conversationListColumns))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/conversations"+tt.query, nil, "alice", nil)
+			(&ChatHandlers{}).GetConversationsHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ConversationsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if len(resp.Conversations) != tt.wantCount {
+				t.Errorf("got %d conversations, want %d", len(resp.Conversations), tt.wantCount)
+			}
+			if resp.NextCursor != tt.wantNextCursor {
+				t.Errorf("next_cursor = %q, want %q", resp.NextCursor, tt.wantNextCursor)
+			}
+		})
+	}
+}
+
+func TestGetConversationsHandlerBatchesSummaries(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	now := time.Now()
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	var ids []string
+	conversations := sqlmock.NewRows(conversationListColumns)
+	summaries := sqlmock.NewRows(activeSummaryColumns)
+	for i := range 10 {
+		id := fmt.Sprintf("conv-%d", i)
+		ids = append(ids, id)
+		conversations.AddRow(id, userID, "Chat", "text", "", nil, "", now, now)
+		if i%2 == 0 {
+			summaries.AddRow("summary-"+id, id, "Summary.", "msg-"+id, 0, now)
+		}
+	}
+	mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1`).WillReturnRows(conversations)
+	mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id\s+WHERE c.id = ANY\(\$1\)`).
+		WithArgs(pq.Array(ids)).
+		WillReturnRows(summaries)
+
+	w := httptest.NewRecorder()
+	(&ChatHandlers{}).GetConversationsHandler(w, newAuthedRequest(http.MethodGet, "/api/conversations", nil, "alice", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// Any per-conversation summary query would fail against the mock and leave the summary unset
+	var resp ConversationsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(resp.Conversations) != 10 {
+		t.Fatalf("got %d conversations, want 10", len(resp.Conversations))
+	}
+	for i, conv := range resp.Conversations {
+		got := conv.SummarizedUpToMessageID
+		if i%2 == 0 && (got == nil || *got != "msg-"+conv.ID) {
+			t.Errorf("%s summarized up to %v, want msg-%s", conv.ID, got, conv.ID)
+		}
+		if i%2 == 1 && got != nil {
+			t.Errorf("%s summarized up to %s, want no summary", conv.ID, *got)
+		}
+	}
+}
+
+func TestRestoreConversationHandler(t *testing.T) {
+	const (
+		userID  = "11111111-1111-1111-1111-111111111111"
+		otherID = "22222222-2222-2222-2222-222222222222"
+		convID  = "33333333-3333-3333-3333-333333333333"
+	)
+	archivedAt := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "conversation not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "another user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID, ArchivedAt: &archivedAt})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "conversation not archived",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "archived conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, ArchivedAt: &archivedAt})
+				mock.ExpectExec(`UPDATE conversations SET archived_at = NULL`).
+					WithArgs(convID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/restore", nil, "alice", map[string]string{"id": convID})
+			(&ChatHandlers{}).RestoreConversationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetRecentConversationsHandler(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantIDs    []string
+	}{
+		{
+			name:       "user not found",
+			setup:      func(mock sqlmock.Sqlmock) { testutil.ExpectNoUser(mock, "alice") },
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "query error",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations`).WillReturnError(errors.New("connection reset"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "recent conversations of the last week",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				now := time.Now()
+				mock.ExpectQuery(`FROM conversations\s+WHERE user_id = \$1 AND archived_at IS NULL AND updated_at > \$2`).
+					WithArgs(userID, weekAgo{}, 10).
+					WillReturnRows(sqlmock.NewRows(conversationListColumns).
+						AddRow("c2", userID, "Second", "text", "", nil, "", now, now).
+						AddRow("c1", userID, "First", "text", "", nil, "", now, now))
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"c2", "c1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/conversations/recent", nil, "alice", nil)
+			(&ChatHandlers{}).GetRecentConversationsHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ConversationsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			var ids []string
+			for _, conv := range resp.Conversations {
+				ids = append(ids, conv.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("conversation IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+// weekAgo matches a time about recentConversationsWindow before now
+type weekAgo struct{}
+
+func (weekAgo) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && time.Since(t.Add(recentConversationsWindow)).Abs() < time.Minute
+}
+
+func TestGetConversationHandler(t *testing.T) {
+	const (
+		userID  = "11111111-1111-1111-1111-111111111111"
+		otherID = "22222222-2222-2222-2222-222222222222"
+		convID  = "33333333-3333-3333-3333-333333333333"
+	)
+	expectStats := func(mock sqlmock.Sqlmock, ownerID string) {
+		now := time.Now()
+		mock.ExpectQuery(`FROM conversations c\s+LEFT JOIN`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(conversationStatsColumns).
+				AddRow(convID, ownerID, "Trip", "text", "", nil, nil, "", now, now, 3, 2, 1, 10, 20, 30, 0.002, 1, nil, []byte(`{"user":2,"assistant":1}`)))
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "own conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				expectStats(mock, userID)
+				testutil.ExpectNoActiveSummary(mock, convID)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "another user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				expectStats(mock, otherID)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "missing conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM conversations c\s+LEFT JOIN`).WithArgs(convID).WillReturnRows(sqlmock.NewRows(conversationStatsColumns))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "unknown user",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectNoUser(mock, "alice")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/conversations/"+convID, nil, "alice", map[string]string{"id": convID})
+			(&ChatHandlers{}).GetConversationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			// A conversation without a color reports an empty string, not null
+			if !strings.Contains(w.Body.String(), `"color":""`) {
+				t.Errorf("body = %s, want an empty color", w.Body.String())
+			}
+
+			var resp ConversationWithStatsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.ID != convID || resp.Stats.MessageCount != 3 || resp.Stats.TotalTokens != 30 || resp.Stats.TotalCost != 0.002 {
+				t.Errorf("response = %+v", resp)
+			}
+			if resp.Stats.MessageCountByRole["user"] != 2 || resp.Stats.MessageCountByRole["assistant"] != 1 {
+				t.Errorf("counts by role = %v", resp.Stats.MessageCountByRole)
+			}
+		})
+	}
+}
+
+func TestStarConversationHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	star := func(w http.ResponseWriter, r *http.Request) { (&ChatHandlers{}).StarConversationHandler(w, r) }
+	testConversationOwnership(t, star, http.MethodPost, "/api/conversations/"+convID+"/star", "", map[string]string{"id": convID})
+	starred, unstarred := true, false
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantStarred *bool // starred state written, nil when nothing is written
+	}{
+		{name: "empty body stars", wantStatus: http.StatusOK, wantStarred: &starred},
+		{name: "star", body: `{"starred":true}`, wantStatus: http.StatusOK, wantStarred: &starred},
+		{name: "unstar", body: `{"starred":false}`, wantStatus: http.StatusOK, wantStarred: &unstarred},
+		{name: "invalid body", body: `{"starred":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.wantStarred != nil {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				mock.ExpectExec(`UPDATE conversations\s+SET starred_at`).
+					WithArgs(convID, userID, *tt.wantStarred).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			w := httptest.NewRecorder()
+			star(w, newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/star", strings.NewReader(tt.body), "alice",
+				map[string]string{"id": convID}))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStarred == nil {
+				return
+			}
+			var resp StarResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Starred != *tt.wantStarred {
+				t.Errorf("starred = %t, want %t", resp.Starred, *tt.wantStarred)
+			}
+		})
+	}
+}
+
+func TestGetMessageCountByRoleHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	countByRole := func(w http.ResponseWriter, r *http.Request) { (&ChatHandlers{}).GetMessageCountByRoleHandler(w, r) }
+	target := "/api/conversations/" + convID + "/messages/count-by-role"
+	testConversationOwnership(t, countByRole, http.MethodGet, target, "", map[string]string{"id": convID})
+
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows
+		wantBody string
+	}{
+		{name: "both roles", rows: sqlmock.NewRows([]string{"role", "count"}).AddRow("user", 10).AddRow("assistant", 10), wantBody: `{"assistant":10,"user":10}`},
+		{name: "no messages", rows: sqlmock.NewRows([]string{"role", "count"}), wantBody: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			mock.ExpectQuery(`SELECT role, COUNT\(\*\) FROM messages`).WithArgs(convID).WillReturnRows(tt.rows)
+
+			w := httptest.NewRecorder()
+			countByRole(w, newAuthedRequest(http.MethodGet, target, nil, "alice", map[string]string{"id": convID}))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUpdateResponseFormatHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+		schema = `{"type":"object","properties":{"answer":{"type":"string"}}}`
+	)
+	handler := (&ChatHandlers{}).UpdateResponseFormatHandler
+	pathValues := map[string]string{"id": convID}
+	target := "/api/conversations/" + convID + "/response-format"
+	jsonBody := `{"response_format":"json","response_schema":` + strconv.Quote(schema) + `}`
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodPatch, target, jsonBody, pathValues)
+	})
+
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{name: "invalid body", body: `{"response_format":`},
+		{name: "unknown format", body: `{"response_format":"yaml"}`},
+		{name: "json without schema", body: `{"response_format":"json"}`},
+		{name: "xml with blank schema", body: `{"response_format":"xml","response_schema":"  "}`},
+		{name: "malformed json schema", body: `{"response_format":"json","response_schema":"{\"type\":"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Invalid requests are rejected before the database is reached
+			testutil.NewMockDB(t)
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodPatch, target, strings.NewReader(tt.body), "alice", pathValues))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+
+	summaryID := "99999999-9999-9999-9999-999999999999"
+	tests := []struct {
+		name       string
+		current    testutil.Conversation
+		body       string
+		wantFormat string
+		wantSchema string
+		wantUpdate bool
+	}{
+		{
+			name:       "text to json",
+			current:    testutil.Conversation{ResponseFormat: "text", ActiveSummaryID: &summaryID},
+			body:       jsonBody,
+			wantFormat: "json",
+			wantSchema: schema,
+			wantUpdate: true,
+		},
+		{
+			name:       "json to text clears the schema",
+			current:    testutil.Conversation{ResponseFormat: "json", ResponseSchema: schema, ActiveSummaryID: &summaryID},
+			body:       `{"response_format":"text","response_schema":"ignored"}`,
+			wantFormat: "text",
+			wantUpdate: true,
+		},
+		{
+			name:       "json to xml",
+			current:    testutil.Conversation{ResponseFormat: "json", ResponseSchema: schema},
+			body:       `{"response_format":"xml","response_schema":"<answer><text/></answer>"}`,
+			wantFormat: "xml",
+			wantSchema: "<answer><text/></answer>",
+			wantUpdate: true,
+		},
+		{
+			name:       "new schema for the same format",
+			current:    testutil.Conversation{ResponseFormat: "json", ResponseSchema: `{"type":"array"}`, ActiveSummaryID: &summaryID},
+			body:       jsonBody,
+			wantFormat: "json",
+			wantSchema: schema,
+			wantUpdate: true,
+		},
+		{
+			name:       "unchanged format keeps the summary",
+			current:    testutil.Conversation{ResponseFormat: "json", ResponseSchema: schema, ActiveSummaryID: &summaryID},
+			body:       jsonBody,
+			wantFormat: "json",
+			wantSchema: schema,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			current := tt.current
+			current.ID, current.UserID = convID, userID
+			testutil.ExpectConversation(mock, current)
+			if tt.wantUpdate {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE conversations SET response_format = \$1, response_schema = \$2 WHERE id = \$3`).
+					WithArgs(tt.wantFormat, tt.wantSchema, convID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM conversation_summaries WHERE id = \(SELECT active_summary_id FROM conversations WHERE id = \$1\)`).
+					WithArgs(convID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+			activeSummaryCache.Store(convID, cachedSummary{expiresAt: time.Now().Add(time.Minute)})
+			t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodPatch, target, strings.NewReader(tt.body), "alice", pathValues))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			var resp ConversationInfo
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.ResponseFormat != tt.wantFormat || resp.ResponseSchema != tt.wantSchema {
+				t.Errorf("response format = %q with schema %q, want %q with %q", resp.ResponseFormat, resp.ResponseSchema, tt.wantFormat, tt.wantSchema)
+			}
+			// A discarded summary must not be served from the cache
+			if _, cached := activeSummaryCache.Load(convID); cached == tt.wantUpdate {
+				t.Errorf("active summary cached = %v after the request", cached)
+			}
+		})
+	}
+}
+
+func TestClearConversationMessagesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages"
+
+	t.Run("ownership", func(t *testing.T) {
+		handler := (&ChatHandlers{inFlight: NewInFlightTracker(time.Minute)}).ClearConversationMessagesHandler
+		testConversationOwnership(t, handler, http.MethodDelete, path, "", pathValues)
+	})
+
+	t.Run("stream in progress", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		tracker := NewInFlightTracker(time.Minute)
+		defer tracker.BeginConversation(convID)()
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{inFlight: tracker}).ClearConversationMessagesHandler(w, newAuthedRequest(http.MethodDelete, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusConflict, w.Body.String())
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != "STREAM_IN_PROGRESS" {
+			t.Errorf("error code = %q (decode error %v), want STREAM_IN_PROGRESS", resp.Code, err)
+		}
+		// Nothing is cleared: no statement beyond the lookups was expected
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("cleared", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id = NULL`).WithArgs(convID).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM conversation_summaries`).WithArgs(convID).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE messages SET deleted_at`).WithArgs(convID).WillReturnResult(sqlmock.NewResult(0, 42))
+		mock.ExpectCommit()
+		activeSummaryCache.Store(convID, cachedSummary{expiresAt: time.Now().Add(time.Minute)})
+		t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+		// A stream in another conversation does not block clearing this one
+		tracker := NewInFlightTracker(time.Minute)
+		defer tracker.BeginConversation("44444444-4444-4444-4444-444444444444")()
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{inFlight: tracker}).ClearConversationMessagesHandler(w, newAuthedRequest(http.MethodDelete, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != `{"cleared_messages":42,"cleared_summaries":3}` {
+			t.Errorf("body = %s, want the cleared row counts", got)
+		}
+		if _, cached := activeSummaryCache.Load(convID); cached {
+			t.Error("active summary still cached after clearing")
+		}
+	})
+}
+
+func TestRestoreConversationMessagesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages/restore"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).RestoreConversationMessagesHandler, http.MethodPost, path, "", pathValues)
+	})
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "restored", wantStatus: http.StatusOK, wantBody: `{"restored_messages":42}`},
+		{name: "database error", err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError, wantBody: "Error restoring messages"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			restore := mock.ExpectExec(`UPDATE messages SET deleted_at = NULL WHERE conversation_id = \$1 AND deleted_at IS NOT NULL`).WithArgs(convID)
+			if tt.err != nil {
+				restore.WillReturnError(tt.err)
+			} else {
+				restore.WillReturnResult(sqlmock.NewResult(0, 42))
+			}
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).RestoreConversationMessagesHandler(w, newAuthedRequest(http.MethodPost, path, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPurgeConversationMessagesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages/purge"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).PurgeConversationMessagesHandler, http.MethodPost, path, "", pathValues)
+	})
+
+	t.Run("purged with attachment files", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("ATTACHMENTS_DIR", dir)
+		purgedFile := filepath.Join(convID, "a.txt")
+		keptFile := filepath.Join(convID, "b.txt")
+		if err := os.MkdirAll(filepath.Join(dir, convID), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{purgedFile, keptFile} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		// Archived conversations can be purged too
+		archivedAt := time.Now()
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, ArchivedAt: &archivedAt})
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT a.storage_key`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow(purgedFile))
+		mock.ExpectExec(`DELETE FROM messages WHERE conversation_id = \$1 AND deleted_at IS NOT NULL`).
+			WithArgs(convID).
+			WillReturnResult(sqlmock.NewResult(0, 7))
+		mock.ExpectCommit()
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).PurgeConversationMessagesHandler(w, newAuthedRequest(http.MethodPost, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != `{"purged_messages":7}` {
+			t.Errorf("body = %s, want the purged message count", body)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, purgedFile)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("purged attachment file still present (stat error %v)", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, keptFile)); err != nil {
+			t.Errorf("attachment of a visible message removed: %v", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT a.storage_key`).WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).PurgeConversationMessagesHandler(w, newAuthedRequest(http.MethodPost, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusInternalServerError, w.Body.String())
+		}
+	})
+}
+
+func TestUpdateConversationHandlerColor(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).UpdateConversationHandler, http.MethodPatch, path, `{"color":"#ff5733"}`, pathValues)
+	})
+
+	for name, body := range map[string]string{
+		"invalid body":  `{"color":`,
+		"invalid color": `{"color":"#ff573"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).UpdateConversationHandler(w, newAuthedRequest(http.MethodPatch, path, strings.NewReader(body), "alice", pathValues))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	tests := []struct {
+		name     string
+		previous string
+		color    string
+	}{
+		{name: "set", color: "#ff5733"},
+		{name: "changed", previous: "#000000", color: "#FF5733"},
+		{name: "cleared", previous: "#ff5733", color: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, Color: tt.previous})
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE conversations SET updated_at = CURRENT_TIMESTAMP, color = NULLIF\(\$1, ''\) WHERE id = \$2`).
+				WithArgs(tt.color, convID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, Color: tt.color})
+
+			body := `{"color":"` + tt.color + `"}`
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).UpdateConversationHandler(w, newAuthedRequest(http.MethodPatch, path, strings.NewReader(body), "alice", pathValues))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if want := `"color":"` + tt.color + `"`; !strings.Contains(w.Body.String(), want) {
+				t.Errorf("body = %s, want %s", w.Body.String(), want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestChatHandlerCreatesConversationWithColor(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+
+	for _, color := range []string{"#ff5733", ""} {
+		t.Run(cmp.Or(color, "no color"), func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "0")
+			testutil.ExpectUser(mock, userID, "alice")
+			now := time.Now()
+			mock.ExpectQuery(`INSERT INTO conversations`).
+				WithArgs(sqlmock.AnyArg(), userID, "hi", "text", "", color).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("c1", now, now))
+			testutil.ExpectAddMessage(mock, "c1")
+			testutil.ExpectHistory(mock, "c1", "hi")
+			expectReplyStored(t, mock, "c1")
+
+			body := `{"message":"hi","color":"` + color + `"}`
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: &stubProvider{response: "hello"}}).ChatHandler(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
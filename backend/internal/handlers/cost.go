@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+const (
+	// costSampleSize is how many recent assistant messages the percentile cost is computed from
+	costSampleSize = 100
+
+	// maxProjectedMessages bounds the additional_messages parameter
+	maxProjectedMessages = 10000
+)
+
+// CostProjection estimates the cost of continuing a conversation
+type CostProjection struct {
+	AvgCostPerMessage  float64  `json:"avg_cost_per_message"`
+	P95CostPerMessage  float64  `json:"p95_cost_per_message"`
+	ProjectedTotalCost float64  `json:"projected_total_cost"`
+	CurrentTotalCost   float64  `json:"current_total_cost"`
+	BudgetRemaining    *float64 `json:"budget_remaining,omitempty"` // Budget left after the projected messages, nil without a budget
+}
+
+// ProjectConversationCost projects the cost of additionalMessages more assistant replies from the
+// conversation's average cost per reply. The conversation must be owned by the given user.
+func ProjectConversationCost(convID, userID string, additionalMessages int, budget *float64) (*CostProjection, error) {
+	conversation, err := db.GetConversationWithStats(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, fmt.Errorf("conversation does not belong to user")
+	}
+
+	costs, err := db.GetRecentMessageCosts(convID, costSampleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	projection := &CostProjection{
+		CurrentTotalCost:  conversation.TotalCost,
+		P95CostPerMessage: percentile(costs, 0.95),
+	}
+	// Average over the messages with a known cost so unpriced replies don't dilute it
+	if conversation.CostedMessageCount > 0 {
+		projection.AvgCostPerMessage = conversation.TotalCost / float64(conversation.CostedMessageCount)
+	}
+	projection.ProjectedTotalCost = projection.AvgCostPerMessage * float64(additionalMessages)
+
+	if budget != nil {
+		remaining := *budget - projection.CurrentTotalCost - projection.ProjectedTotalCost
+		projection.BudgetRemaining = &remaining
+	}
+
+	return projection, nil
+}
+
+// percentile returns the nearest-rank p-th percentile of values, or 0 if there are none.
+// With fewer than 1/(1-p) samples this is the maximum, a conservative estimate for small conversations.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// GetCostProjectionHandler forecasts the cost of sending more messages in a conversation
+func (ch *ChatHandlers) GetCostProjectionHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	query := r.URL.Query()
+
+	additionalMessages, err := strconv.Atoi(query.Get("additional_messages"))
+	if err != nil || additionalMessages < 0 || additionalMessages > maxProjectedMessages {
+		http.Error(w, fmt.Sprintf("'additional_messages' must be between 0 and %d", maxProjectedMessages), http.StatusBadRequest)
+		return
+	}
+
+	var budget *float64
+	if value := query.Get("budget"); value != "" {
+		b, err := strconv.ParseFloat(value, 64)
+		if err != nil || b < 0 {
+			http.Error(w, "'budget' must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		budget = &b
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	projection, err := ProjectConversationCost(convID, user.ID, additionalMessages, budget)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error projecting conversation cost: %v", err)
+		http.Error(w, "Error projecting cost", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projection)
+}
+
+// costSplitTolerance is how far input plus output cost may drift from the total before a warning is logged
+const costSplitTolerance = 1e-6
+
+// ConversationCostResponse is the cost of a conversation split into prompt and completion costs
+type ConversationCostResponse struct {
+	TotalCost     float64 `json:"total_cost"`
+	InputCostUSD  float64 `json:"input_cost_usd"`
+	OutputCostUSD float64 `json:"output_cost_usd"`
+}
+
+// GetConversationCostHandler returns the total, input and output cost of a conversation
+func (ch *ChatHandlers) GetConversationCostHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	breakdown, err := db.GetConversationCostBreakdown(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation cost: %v", err)
+		http.Error(w, "Error retrieving cost", http.StatusInternalServerError)
+		return
+	}
+
+	// The split is computed from configured prices, the total is reported by the provider
+	if diff := breakdown.InputCostUSD + breakdown.OutputCostUSD - breakdown.SplitTotalCost; math.Abs(diff) > costSplitTolerance {
+		reqLog.Printf("[CHAT] Warning: input cost $%.8f + output cost $%.8f differs from total $%.8f for conversation %s",
+			breakdown.InputCostUSD, breakdown.OutputCostUSD, breakdown.SplitTotalCost, convID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConversationCostResponse{
+		TotalCost:     breakdown.TotalCost,
+		InputCostUSD:  breakdown.InputCostUSD,
+		OutputCostUSD: breakdown.OutputCostUSD,
+	})
+}
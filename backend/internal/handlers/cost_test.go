@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// conversationStatsColumns are the columns of the conversation-with-stats query
+var conversationStatsColumns = []string{"id", "user_id", "title", "response_format", "response_schema", "active_summary_id", "starred_at", "color", "created_at", "updated_at",
+	"message_count", "user_message_count", "assistant_message_count", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost",
+	"costed_message_count", "avg_response_time_ms", "count_by_role"}
+
+func TestPercentile(t *testing.T) {
+	series := func(n int) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(n - i) // descending, so sorting matters
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "no values", values: nil, want: 0},
+		{name: "single value", values: []float64{0.004}, want: 0.004},
+		{name: "fewer than 20 values", values: []float64{0.001, 0.009, 0.002, 0.003, 0.002}, want: 0.009},
+		{name: "19 values", values: series(19), want: 19},
+		{name: "20 values", values: series(20), want: 19},
+		{name: "100 values", values: series(100), want: 95},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := slices.Clone(tt.values)
+			if got := percentile(tt.values, 0.95); got != tt.want {
+				t.Errorf("percentile(%v, 0.95) = %v, want %v", tt.values, got, tt.want)
+			}
+			if !slices.Equal(tt.values, original) {
+				t.Errorf("percentile reordered its input to %v", tt.values)
+			}
+		})
+	}
+}
+
+func TestGetCostProjectionHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/cost-projection"
+	handler := (&ChatHandlers{}).GetCostProjectionHandler
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodGet, path+"?additional_messages=10", "", pathValues)
+	})
+
+	for _, query := range []string{"", "?additional_messages=ten", "?additional_messages=-1", "?additional_messages=10001", "?additional_messages=10&budget=-1", "?additional_messages=10&budget=lots"} {
+		t.Run("invalid query "+query, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodGet, path+query, nil, "alice", pathValues))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	// Three of four assistant replies have a known cost, totalling $0.006
+	expectCosts := func(mock sqlmock.Sqlmock) {
+		now := time.Now()
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		mock.ExpectQuery(`FROM conversations c\s+LEFT JOIN`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(conversationStatsColumns).
+				AddRow(convID, userID, "Trip", "text", "", nil, nil, "", now, now, 8, 4, 4, 100, 200, 300, 0.006, 3, nil, []byte(`{"user":4,"assistant":4}`)))
+		mock.ExpectQuery(`SELECT total_cost\s+FROM messages\s+WHERE conversation_id = \$1 AND role = 'assistant' AND total_cost IS NOT NULL AND deleted_at IS NULL\s+ORDER BY created_at DESC\s+LIMIT \$2`).
+			WithArgs(convID, costSampleSize).
+			WillReturnRows(sqlmock.NewRows([]string{"total_cost"}).AddRow(0.001).AddRow(0.003).AddRow(0.002))
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		wantProjected float64
+		hasBudget     bool
+		wantRemaining float64
+	}{
+		{name: "without budget", query: "?additional_messages=10", wantProjected: 0.02},
+		{name: "with budget", query: "?additional_messages=10&budget=0.05", wantProjected: 0.02, hasBudget: true, wantRemaining: 0.024},
+		{name: "over budget", query: "?additional_messages=100&budget=0.1", wantProjected: 0.2, hasBudget: true, wantRemaining: -0.106},
+		{name: "no additional messages", query: "?additional_messages=0", wantProjected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			expectCosts(mock)
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodGet, path+tt.query, nil, "alice", pathValues))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp CostProjection
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+
+			near := func(got, want float64) bool { return math.Abs(got-want) < 1e-12 }
+			if !near(resp.AvgCostPerMessage, 0.002) || !near(resp.P95CostPerMessage, 0.003) || !near(resp.CurrentTotalCost, 0.006) {
+				t.Errorf("projection = %+v, want average 0.002, p95 0.003 and current total 0.006", resp)
+			}
+			if !near(resp.ProjectedTotalCost, tt.wantProjected) {
+				t.Errorf("projected total = %v, want %v", resp.ProjectedTotalCost, tt.wantProjected)
+			}
+			switch {
+			case !tt.hasBudget && resp.BudgetRemaining != nil:
+				t.Errorf("budget remaining = %v, want it omitted without a budget", *resp.BudgetRemaining)
+			case tt.hasBudget && (resp.BudgetRemaining == nil || !near(*resp.BudgetRemaining, tt.wantRemaining)):
+				t.Errorf("budget remaining = %v, want %v", resp.BudgetRemaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestGetConversationCostHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/cost"
+	handler := (&ChatHandlers{}).GetConversationCostHandler
+	breakdownColumns := []string{"total", "input", "output", "split_total"}
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodGet, path, "", pathValues)
+	})
+
+	tests := []struct {
+		name                 string
+		total, input, output float64
+		splitTotal           float64
+		wantWarning          bool
+	}{
+		{name: "split adds up", total: 0.02, input: 0.003, output: 0.0075, splitTotal: 0.0105},
+		{name: "no split costs", total: 0.02},
+		{name: "split differs from the total", total: 0.02, input: 0.003, output: 0.0075, splitTotal: 0.012, wantWarning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			out := log.Writer()
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(out) })
+
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			mock.ExpectQuery(`FILTER \(WHERE split\)`).
+				WithArgs(convID).
+				WillReturnRows(sqlmock.NewRows(breakdownColumns).AddRow(tt.total, tt.input, tt.output, tt.splitTotal))
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp ConversationCostResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if want := (ConversationCostResponse{TotalCost: tt.total, InputCostUSD: tt.input, OutputCostUSD: tt.output}); resp != want {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+			if warned := strings.Contains(logs.String(), "differs from total"); warned != tt.wantWarning {
+				t.Errorf("mismatch warning logged = %v, want %v", warned, tt.wantWarning)
+			}
+		})
+	}
+
+	t.Run("database error", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		mock.ExpectQuery(`FILTER \(WHERE split\)`).WillReturnError(errors.New("connection reset"))
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// exportQueueSize is how many export jobs may wait for the worker before new ones are rejected
+	exportQueueSize = 10
+
+	// exportWebhookTimeout bounds the delivery of a job notification to the user's webhook
+	exportWebhookTimeout = 10 * time.Second
+)
+
+// ConversationExport is the document written by an export job
+type ConversationExport struct {
+	Conversation ConversationInfo `json:"conversation"`
+	Messages     []MessageData    `json:"messages"`
+	ExportedAt   time.Time        `json:"exported_at"`
+}
+
+// ExportJobResponse describes the state of an export job
+type ExportJobResponse struct {
+	JobID       string  `json:"job_id"`
+	Status      string  `json:"status"`
+	DownloadURL string  `json:"download_url,omitempty"` // Set once the export is complete
+	Error       string  `json:"error,omitempty"`
+	CreatedAt   string  `json:"created_at,omitempty"`
+	CompletedAt *string `json:"completed_at,omitempty"`
+}
+
+// ExportWebhookPayload is POSTed to the user's webhook when an export job finishes
+type ExportWebhookPayload struct {
+	JobID       string `json:"job_id"`
+	Status      string `json:"status"`
+	DownloadURL string `json:"download_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func newExportJobResponse(job *db.ExportJob) ExportJobResponse {
+	resp := ExportJobResponse{
+		JobID:     job.ID,
+		Status:    job.Status,
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+	}
+	if job.Status == db.ExportJobComplete {
+		resp.DownloadURL = exportDownloadURL(job.ID)
+	}
+	if job.CompletedAt != nil {
+		completedAt := job.CompletedAt.Format(time.RFC3339)
+		resp.CompletedAt = &completedAt
+	}
+	return resp
+}
+
+// exportDownloadURL returns the link under which a completed export can be downloaded
+func exportDownloadURL(jobID string) string {
+	return config.GetPublicBaseURL() + "/api/jobs/" + jobID + "/download"
+}
+
+// JobRunner runs conversation exports in the background, one at a time, and notifies
+// the owner's webhook when each job finishes
+type JobRunner struct {
+	queue  chan db.ExportJob
+	dir    string
+	client *http.Client
+}
+
+// NewJobRunner creates a runner writing exports to dir and starts its worker
+func NewJobRunner(dir string) *JobRunner {
+	jr := &JobRunner{
+		queue:  make(chan db.ExportJob, exportQueueSize),
+		dir:    dir,
+		client: newWebhookClient(),
+	}
+	go jr.run()
+	return jr
+}
+
+// newWebhookClient returns the client used to call user webhooks. Redirects are not followed, and unless
+// private webhooks are allowed the webhook host must resolve to public addresses only, so a webhook
+// cannot be used to reach internal services.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: exportWebhookTimeout}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: exportWebhookTimeout,
+	}
+	if !config.AllowPrivateWebhooks() {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range addrs {
+				if !validation.IsPublicIP(ip.IP) {
+					return nil, fmt.Errorf("webhook host %s resolves to non-public address %s", host, ip.IP)
+				}
+			}
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("webhook host %s has no addresses", host)
+			}
+			// Dial the checked address rather than resolving the host again
+			return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+		}
+	}
+
+	return &http.Client{
+		Timeout:   exportWebhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Resume re-enqueues the export jobs a previous server process left pending or running. Jobs that
+// don't fit in the queue are marked as failed.
+func (jr *JobRunner) Resume() {
+	jobs, err := db.GetUnfinishedExportJobs()
+	if err != nil {
+		log.Printf("[EXPORT] Warning: failed to load unfinished export jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if jr.Enqueue(job) {
+			log.Printf("[EXPORT] Re-enqueued unfinished job %s", job.ID)
+			continue
+		}
+		log.Printf("[EXPORT] Queue full, failing unfinished job %s", job.ID)
+		if err := db.UpdateExportJobStatus(job.ID, db.ExportJobFailed, "", "export queue is full"); err != nil {
+			log.Printf("[EXPORT] Warning: failed to mark job %s as failed: %v", job.ID, err)
+		}
+	}
+}
+
+// PurgeExpiredExports deletes export jobs that finished more than olderThan ago together with their files
+func PurgeExpiredExports(olderThan time.Duration) error {
+	filePaths, err := db.DeleteExpiredExportJobs(olderThan)
+
+	// Files of jobs deleted before an error are removed all the same
+	removeExportFiles(filePaths)
+	return err
+}
+
+// removeExportFiles deletes export files, ignoring files that are already gone
+func removeExportFiles(filePaths []string) {
+	for _, filePath := range filePaths {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[EXPORT] Warning: failed to remove export file %s: %v", filePath, err)
+		}
+	}
+}
+
+// Enqueue hands a job to the worker. It returns false if the queue is full.
+func (jr *JobRunner) Enqueue(job db.ExportJob) bool {
+	select {
+	case jr.queue <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (jr *JobRunner) run() {
+	for job := range jr.queue {
+		jr.process(job)
+	}
+}
+
+// process runs a single export job, records its outcome and notifies the user
+func (jr *JobRunner) process(job db.ExportJob) {
+	log.Printf("[EXPORT] Starting job %s for conversation %s", job.ID, job.ConversationID)
+	if err := db.UpdateExportJobStatus(job.ID, db.ExportJobRunning, "", ""); err != nil {
+		log.Printf("[EXPORT] Warning: failed to mark job %s as running: %v", job.ID, err)
+	}
+
+	payload := ExportWebhookPayload{JobID: job.ID}
+	filePath, err := jr.writeExport(job)
+	if err != nil {
+		log.Printf("[EXPORT] Job %s failed: %v", job.ID, err)
+		payload.Status = db.ExportJobFailed
+		payload.Error = "export failed"
+		if err := db.UpdateExportJobStatus(job.ID, db.ExportJobFailed, "", payload.Error); err != nil {
+			log.Printf("[EXPORT] Warning: failed to mark job %s as failed: %v", job.ID, err)
+		}
+	} else {
+		log.Printf("[EXPORT] Job %s complete: %s", job.ID, filePath)
+		payload.Status = db.ExportJobComplete
+		payload.DownloadURL = exportDownloadURL(job.ID)
+		if err := db.UpdateExportJobStatus(job.ID, db.ExportJobComplete, filePath, ""); err != nil {
+			log.Printf("[EXPORT] Warning: failed to mark job %s as complete: %v", job.ID, err)
+		}
+	}
+
+	jr.notify(job.UserID, payload)
+}
+
+// newConversationExport loads a conversation and its messages for export
+func newConversationExport(conversation *db.Conversation) (*ConversationExport, error) {
+	messages, err := db.GetConversationMessagesWithDetails(conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses still being streamed are not part of the conversation yet
+	complete := make([]db.Message, 0, len(messages))
+	for _, msg := range messages {
+		if !msg.Partial {
+			complete = append(complete, msg)
+		}
+	}
+
+	return &ConversationExport{
+		Conversation: newConversationInfo(conversation, nil),
+		Messages:     newMessageDataList(complete),
+		ExportedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// writeExport writes the conversation and its messages as JSON and returns the file path
+func (jr *JobRunner) writeExport(job db.ExportJob) (string, error) {
+	conversation, err := db.GetConversation(job.ConversationID)
+	if err != nil {
+		return "", err
+	}
+
+	export, err := newConversationExport(conversation)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding export: %w", err)
+	}
+
+	if err := os.MkdirAll(jr.dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating export directory: %w", err)
+	}
+	filePath := filepath.Join(jr.dir, job.ID+".json")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		removeExportFiles([]string{filePath})
+		return "", fmt.Errorf("error writing export: %w", err)
+	}
+	return filePath, nil
+}
+
+// notify POSTs the job outcome to the user's webhook, if one is registered
+func (jr *JobRunner) notify(userID string, payload ExportWebhookPayload) {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("[EXPORT] Warning: failed to load user for job %s: %v", payload.JobID, err)
+		return
+	}
+	if user.WebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[EXPORT] Warning: failed to encode webhook payload for job %s: %v", payload.JobID, err)
+		return
+	}
+
+	resp, err := jr.client.Post(user.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[EXPORT] Warning: webhook delivery for job %s failed: %v", payload.JobID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("[EXPORT] Warning: webhook for job %s returned status %d", payload.JobID, resp.StatusCode)
+	}
+}
+
+// ResumeExportJobs hands the export jobs left unfinished by a previous server process back to the runner
+func (ch *ChatHandlers) ResumeExportJobs() {
+	ch.exports.Resume()
+}
+
+// ExportConversationAsyncHandler queues a background export of a conversation and returns the job immediately
+func (ch *ChatHandlers) ExportConversationAsyncHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Async export request from user: %s for conversation: %s", username, convID)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	job, err := db.CreateExportJob(user.ID, convID)
+	if err != nil {
+		reqLog.Printf("[EXPORT] Error creating export job: %v", err)
+		http.Error(w, "Error creating export job", http.StatusInternalServerError)
+		return
+	}
+
+	if !ch.exports.Enqueue(*job) {
+		reqLog.Printf("[EXPORT] Queue full, rejecting job %s", job.ID)
+		if err := db.UpdateExportJobStatus(job.ID, db.ExportJobFailed, "", "export queue is full"); err != nil {
+			reqLog.Printf("[EXPORT] Warning: failed to mark job %s as failed: %v", job.ID, err)
+		}
+		writeErrorCode(w, http.StatusServiceUnavailable, "EXPORT_QUEUE_FULL")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ExportJobResponse{JobID: job.ID, Status: job.Status})
+}
+
+// getOwnedExportJob loads an export job and writes an error response unless it belongs to the authenticated user
+func getOwnedExportJob(w http.ResponseWriter, r *http.Request) (*db.ExportJob, bool) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	job, err := db.GetExportJob(r.PathValue("id"))
+	if err != nil {
+		reqLog.Printf("[EXPORT] Error getting export job: %v", err)
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if job.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+	return job, true
+}
+
+// GetJobHandler returns the status of an export job
+func (ch *ChatHandlers) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := getOwnedExportJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newExportJobResponse(job))
+}
+
+// DownloadExportHandler serves the file produced by a completed export job
+func (ch *ChatHandlers) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := getOwnedExportJob(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status != db.ExportJobComplete {
+		http.Error(w, "Export is not complete", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%s.json"`, job.ConversationID))
+	http.ServeFile(w, r, job.FilePath)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFormat describes how a conversation export is encoded and served
+type exportFormat struct {
+	extension   string
+	contentType string
+	write       func(w io.Writer, export *ConversationExport) error
+}
+
+// exportFormats are the formats accepted by the export endpoint's format parameter
+var exportFormats = map[string]exportFormat{
+	"json":     {"json", "application/json", writeExportJSON},
+	"markdown": {"md", "text/markdown; charset=utf-8", writeExportMarkdown},
+	"csv":      {"csv", "text/csv; charset=utf-8", writeExportCSV},
+}
+
+// ExportConversationHandler downloads a conversation with its messages as JSON, Markdown or CSV
+// (?format=json|markdown|csv, default json)
+func (ch *ChatHandlers) ExportConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Export request from user: %s for conversation: %s", username, convID)
+
+	formatName := r.URL.Query().Get("format")
+	if formatName == "" {
+		formatName = "json"
+	}
+	format, ok := exportFormats[formatName]
+	if !ok {
+		http.Error(w, "Invalid format: must be json, markdown or csv", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	export, err := newConversationExport(conversation)
+	if err != nil {
+		reqLog.Printf("[EXPORT] Error loading conversation for export: %v", err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conv-%s.%s"`, convID, format.extension))
+	if err := format.write(w, export); err != nil {
+		// Headers are already sent, so the client only sees a truncated file
+		reqLog.Printf("[EXPORT] Error writing %s export of conversation %s: %v", formatName, convID, err)
+	}
+}
+
+func writeExportJSON(w io.Writer, export *ConversationExport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// writeExportMarkdown renders the conversation as a transcript with its metadata as YAML front matter
+func writeExportMarkdown(w io.Writer, export *ConversationExport) error {
+	conv := export.Conversation
+	var b strings.Builder
+
+	// JSON strings are valid double-quoted YAML scalars, which keeps titles with quotes or colons intact
+	title, _ := json.Marshal(conv.Title)
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", conv.ID)
+	fmt.Fprintf(&b, "title: %s\n", title)
+	fmt.Fprintf(&b, "response_format: %s\n", conv.ResponseFormat)
+	fmt.Fprintf(&b, "starred: %t\n", conv.Starred)
+	fmt.Fprintf(&b, "created_at: %s\n", conv.CreatedAt)
+	fmt.Fprintf(&b, "updated_at: %s\n", conv.UpdatedAt)
+	fmt.Fprintf(&b, "exported_at: %s\n", export.ExportedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "message_count: %d\n", len(export.Messages))
+	b.WriteString("---\n\n")
+
+	for _, msg := range export.Messages {
+		fmt.Fprintf(&b, "**%s:** %s\n\n", roleLabel(msg.Role), msg.Content)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// roleLabel capitalizes a message role for display, e.g. "assistant" -> "Assistant"
+func roleLabel(role string) string {
+	if role == "" {
+		return role
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+// writeExportCSV writes one row per message. Free-text cells are escaped with csvCell.
+func writeExportCSV(w io.Writer, export *ConversationExport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "role", "content", "model", "created_at", "edited_at", "parent_message_id",
+		"prompt_tokens", "completion_tokens", "total_tokens", "total_cost", "response_time_ms"})
+
+	for _, msg := range export.Messages {
+		cw.Write([]string{
+			msg.ID,
+			msg.Role,
+			csvCell(msg.Content),
+			csvCell(msg.Model),
+			msg.CreatedAt,
+			optionalString(msg.EditedAt),
+			optionalString(msg.ParentMessageID),
+			optionalInt(msg.PromptTokens),
+			optionalInt(msg.CompletionTokens),
+			optionalInt(msg.TotalTokens),
+			optionalFloat(msg.TotalCost),
+			optionalInt(msg.ResponseTimeMs),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell prefixes text that a spreadsheet would evaluate as a formula with a quote, so opening
+// an export cannot run formulas injected into messages
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func optionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
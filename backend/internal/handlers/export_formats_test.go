@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestWriteExportCSVEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{content: "=HYPERLINK(\"http://example.com\")", want: "'=HYPERLINK(\"http://example.com\")"},
+		{content: "+1+2", want: "'+1+2"},
+		{content: "-2+3", want: "'-2+3"},
+		{content: "@SUM(A1)", want: "'@SUM(A1)"},
+		{content: "plain text = fine", want: "plain text = fine"},
+		{content: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			var buf bytes.Buffer
+			export := &ConversationExport{Messages: []MessageData{{ID: "m1", Role: "user", Content: tt.content}}}
+			if err := writeExportCSV(&buf, export); err != nil {
+				t.Fatalf("writeExportCSV: %v", err)
+			}
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("error reading CSV: %v", err)
+			}
+			if got := records[1][2]; got != tt.want {
+				t.Errorf("content cell = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
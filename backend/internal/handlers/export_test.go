@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var exportJobColumns = []string{"id", "user_id", "conversation_id", "status", "file_path", "error", "created_at", "completed_at"}
+
+func TestExportConversationAsyncHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "22222222-2222-2222-2222-222222222222"
+	)
+
+	tests := []struct {
+		name       string
+		queueSize  int
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantQueued int
+	}{
+		{
+			name: "conversation not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "other user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "someone-else"})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:      "queue full",
+			queueSize: 0,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				mock.ExpectQuery(`INSERT INTO export_jobs`).
+					WithArgs(sqlmock.AnyArg(), userID, convID, db.ExportJobPending).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+				mock.ExpectExec(`UPDATE export_jobs`).
+					WithArgs(db.ExportJobFailed, "", "export queue is full", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:      "queued",
+			queueSize: 1,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				mock.ExpectQuery(`INSERT INTO export_jobs`).
+					WithArgs(sqlmock.AnyArg(), userID, convID, db.ExportJobPending).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+			},
+			wantStatus: http.StatusAccepted,
+			wantQueued: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			// No worker runs, so queued jobs stay in the queue
+			runner := &JobRunner{queue: make(chan db.ExportJob, tt.queueSize)}
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/export/async", nil, "alice", map[string]string{"id": convID})
+			(&ChatHandlers{exports: runner}).ExportConversationAsyncHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if len(runner.queue) != tt.wantQueued {
+				t.Errorf("queued jobs = %d, want %d", len(runner.queue), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestGetJobHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		jobID  = "33333333-3333-3333-3333-333333333333"
+	)
+	createdAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	completedAt := createdAt.Add(time.Minute)
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "job not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM export_jobs`).WithArgs(jobID).WillReturnRows(sqlmock.NewRows(exportJobColumns))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "other user's job",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM export_jobs`).WithArgs(jobID).WillReturnRows(sqlmock.NewRows(exportJobColumns).
+					AddRow(jobID, "someone-else", "conv", db.ExportJobPending, "", "", createdAt, nil))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "complete job",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM export_jobs`).WithArgs(jobID).WillReturnRows(sqlmock.NewRows(exportJobColumns).
+					AddRow(jobID, userID, "conv", db.ExportJobComplete, "/tmp/export.json", "", createdAt, completedAt))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/jobs/"+jobID, nil, "alice", map[string]string{"id": jobID})
+			(&ChatHandlers{}).GetJobHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ExportJobResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.CreatedAt != "2026-03-01T10:00:00Z" || resp.CompletedAt == nil || *resp.CompletedAt != "2026-03-01T10:01:00Z" {
+				t.Errorf("timestamps = %q, %v, want RFC 3339", resp.CreatedAt, resp.CompletedAt)
+			}
+			if resp.DownloadURL != "/api/jobs/"+jobID+"/download" {
+				t.Errorf("download_url = %q", resp.DownloadURL)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	t.Run("blocked by default", func(t *testing.T) {
+		resp, err := newWebhookClient().Post(server.URL, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatal("webhook to a loopback address succeeded, want it rejected")
+		}
+	})
+
+	t.Run("allowed when opted in", func(t *testing.T) {
+		t.Setenv("ALLOW_PRIVATE_WEBHOOKS", "true")
+		resp, err := newWebhookClient().Post(server.URL, "application/json", nil)
+		if err != nil {
+			t.Fatalf("webhook with private webhooks allowed failed: %v", err)
+		}
+		resp.Body.Close()
+	})
+}
+
+func TestJobRunnerProcessWritesExportAndNotifies(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "22222222-2222-2222-2222-222222222222"
+		jobID  = "33333333-3333-3333-3333-333333333333"
+	)
+	t.Setenv("ALLOW_PRIVATE_WEBHOOKS", "true")
+
+	payloads := make(chan ExportWebhookPayload, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload ExportWebhookPayload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		payloads <- payload
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, jobID+".json")
+	mock := testutil.NewMockDB(t)
+	mock.ExpectExec(`UPDATE export_jobs`).
+		WithArgs(db.ExportJobRunning, "", "", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, Title: "Notes"})
+	mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow("m1", convID, "user", "hi")...))
+	mock.ExpectExec(`UPDATE export_jobs`).
+		WithArgs(db.ExportJobComplete, filePath, "", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM users WHERE id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "is_admin", "webhook_url", "created_at"}).
+			AddRow(userID, "alice", "alice@example.com", "hash", false, webhook.URL, time.Now()))
+
+	runner := &JobRunner{dir: dir, client: newWebhookClient()}
+	runner.process(db.ExportJob{ID: jobID, UserID: userID, ConversationID: convID})
+
+	var export ConversationExport
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("error reading export: %v", err)
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatalf("error decoding export: %v", err)
+	}
+	if export.Conversation.Title != "Notes" || len(export.Messages) != 1 {
+		t.Errorf("export = %+v, want the conversation and its message", export)
+	}
+
+	select {
+	case payload := <-payloads:
+		if payload.JobID != jobID || payload.Status != db.ExportJobComplete || payload.DownloadURL == "" {
+			t.Errorf("webhook payload = %+v, want the completed job", payload)
+		}
+	default:
+		t.Error("webhook was not called")
+	}
+}
+
+func TestJobRunnerProcessFailure(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "22222222-2222-2222-2222-222222222222"
+		jobID  = "33333333-3333-3333-3333-333333333333"
+	)
+
+	mock := testutil.NewMockDB(t)
+	mock.ExpectExec(`UPDATE export_jobs`).
+		WithArgs(db.ExportJobRunning, "", "", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	testutil.ExpectNoConversation(mock, convID)
+	mock.ExpectExec(`UPDATE export_jobs`).
+		WithArgs(db.ExportJobFailed, "", "export failed", jobID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The user has no webhook, so no notification is sent
+	mock.ExpectQuery(`FROM users WHERE id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "is_admin", "webhook_url", "created_at"}).
+			AddRow(userID, "alice", "alice@example.com", "hash", false, "", time.Now()))
+
+	runner := &JobRunner{dir: t.TempDir(), client: newWebhookClient()}
+	runner.process(db.ExportJob{ID: jobID, UserID: userID, ConversationID: convID})
+
+	if entries, _ := os.ReadDir(runner.dir); len(entries) != 0 {
+		t.Errorf("export directory has %d files, want none", len(entries))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestJobRunnerResume(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock := testutil.NewMockDB(t)
+	mock.ExpectQuery(`FROM export_jobs\s+WHERE status IN \('pending', 'running'\)`).
+		WillReturnRows(sqlmock.NewRows(exportJobColumns).
+			AddRow("j1", "u1", "c1", db.ExportJobRunning, "", "", createdAt, nil).
+			AddRow("j2", "u1", "c2", db.ExportJobPending, "", "", createdAt, nil))
+	// Only one job fits in the queue, the other one is failed
+	mock.ExpectExec(`UPDATE export_jobs`).
+		WithArgs(db.ExportJobFailed, "", "export queue is full", "j2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	runner := &JobRunner{queue: make(chan db.ExportJob, 1)}
+	runner.Resume()
+
+	if len(runner.queue) != 1 {
+		t.Fatalf("queued jobs = %d, want 1", len(runner.queue))
+	}
+	if job := <-runner.queue; job.ID != "j1" {
+		t.Errorf("queued job = %s, want j1", job.ID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPurgeExpiredExports(t *testing.T) {
+	dir := t.TempDir()
+	expired := filepath.Join(dir, "j1.json")
+	if err := os.WriteFile(expired, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := testutil.NewMockDB(t)
+	// A file that is already gone is not an error
+	mock.ExpectQuery(`DELETE FROM export_jobs`).
+		WithArgs(float64(3600)).
+		WillReturnRows(sqlmock.NewRows([]string{"file_path"}).AddRow(expired).AddRow(filepath.Join(dir, "gone.json")))
+
+	if err := PurgeExpiredExports(time.Hour); err != nil {
+		t.Fatalf("PurgeExpiredExports() error = %v", err)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("expired export still exists: %v", err)
+	}
+}
+
+func TestDownloadExportHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		jobID  = "33333333-3333-3333-3333-333333333333"
+	)
+	createdAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	filePath := filepath.Join(t.TempDir(), jobID+".json")
+	if err := os.WriteFile(filePath, []byte(`{"messages":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		owner      string
+		status     string
+		found      bool
+		wantStatus int
+	}{
+		{name: "job not found", wantStatus: http.StatusNotFound},
+		{name: "other user's job", found: true, owner: "someone-else", status: db.ExportJobComplete, wantStatus: http.StatusForbidden},
+		{name: "pending job", found: true, owner: userID, status: db.ExportJobPending, wantStatus: http.StatusConflict},
+		{name: "failed job", found: true, owner: userID, status: db.ExportJobFailed, wantStatus: http.StatusConflict},
+		{name: "complete job", found: true, owner: userID, status: db.ExportJobComplete, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			rows := sqlmock.NewRows(exportJobColumns)
+			if tt.found {
+				rows.AddRow(jobID, tt.owner, "conv", tt.status, filePath, "", createdAt, nil)
+			}
+			mock.ExpectQuery(`FROM export_jobs`).WithArgs(jobID).WillReturnRows(rows)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/jobs/"+jobID+"/download", nil, "alice", map[string]string{"id": jobID})
+			(&ChatHandlers{}).DownloadExportHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if w.Body.String() != `{"messages":[]}` {
+				t.Errorf("body = %q, want the export file", w.Body.String())
+			}
+			if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="conversation-conv.json"` {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+		})
+	}
+}
+
+func TestUpdateWebhookHandler(t *testing.T) {
+	for name, body := range map[string]string{
+		"invalid body":       `{`,
+		"unsupported scheme": `{"webhook_url":"ftp://hooks.example.com"}`,
+		"private address":    `{"webhook_url":"http://10.0.0.5/hook"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).UpdateWebhookHandler(w, newAuthedRequest(http.MethodPut, "/api/users/me/webhook", strings.NewReader(body), "alice", nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ name, body, want string }{
+		{name: "set", body: `{"webhook_url":" https://hooks.example.com/export "}`, want: "https://hooks.example.com/export"},
+		{name: "removed", body: `{"webhook_url":""}`, want: ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			mock.ExpectExec(`UPDATE users SET webhook_url = NULLIF\(\$1, ''\) WHERE username = \$2`).
+				WithArgs(tt.want, "alice").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).UpdateWebhookHandler(w, newAuthedRequest(http.MethodPut, "/api/users/me/webhook", strings.NewReader(tt.body), "alice", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp WebhookSettings
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.WebhookURL != tt.want {
+				t.Errorf("webhook_url = %q, want %q", resp.WebhookURL, tt.want)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
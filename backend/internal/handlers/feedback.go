@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type FeedbackRequest struct {
+	Rating       int    `json:"rating"`
+	Comment      string `json:"comment"`
+	FeedbackType string `json:"feedback_type"`
+}
+
+type FeedbackData struct {
+	ID           string `json:"id"`
+	MessageID    string `json:"message_id"`
+	UserID       string `json:"user_id,omitempty"`
+	Rating       int    `json:"rating"`
+	Comment      string `json:"comment,omitempty"`
+	FeedbackType string `json:"feedback_type"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// newFeedbackData converts a db.MessageFeedback to FeedbackData
+func newFeedbackData(f *db.MessageFeedback) *FeedbackData {
+	return &FeedbackData{
+		ID:           f.ID,
+		MessageID:    f.MessageID,
+		UserID:       f.UserID,
+		Rating:       f.Rating,
+		Comment:      f.Comment,
+		FeedbackType: f.FeedbackType,
+		CreatedAt:    f.CreatedAt.String(),
+	}
+}
+
+// SubmitFeedbackHandler records a user's rating and comment on a message in their conversation
+func (ch *ChatHandlers) SubmitFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	msgID := r.PathValue("msgId")
+	reqLog.Printf("Submit feedback request from user: %s for message: %s", username, msgID)
+
+	var req FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.ValidateFeedback(req.Rating, req.Comment, req.FeedbackType); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[FEEDBACK] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[FEEDBACK] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Verify the message belongs to this conversation
+	message, err := db.GetMessage(msgID)
+	if err != nil || message.ConversationID != convID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	feedback, err := db.UpsertMessageFeedback(msgID, user.ID, req.Rating, req.Comment, req.FeedbackType)
+	if err != nil {
+		reqLog.Printf("[FEEDBACK] Error saving feedback: %v", err)
+		http.Error(w, "Error saving feedback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFeedbackData(feedback))
+}
+
+// GetFeedbackHandler lists feedback across all users, optionally filtered by type and RFC3339 date range
+func (ch *ChatHandlers) GetFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Admin feedback request from user: %s", username)
+
+	query := r.URL.Query()
+	filter := db.FeedbackFilter{FeedbackType: query.Get("type")}
+
+	if from := query.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.From = &t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		filter.To = &t
+	}
+
+	feedback, err := db.GetFeedback(filter)
+	if err != nil {
+		reqLog.Printf("[FEEDBACK] Error getting feedback: %v", err)
+		http.Error(w, "Error retrieving feedback", http.StatusInternalServerError)
+		return
+	}
+
+	feedbackData := make([]FeedbackData, 0, len(feedback))
+	for i := range feedback {
+		feedbackData = append(feedbackData, *newFeedbackData(&feedback[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedbackData)
+}
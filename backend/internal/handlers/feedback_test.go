@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSubmitFeedbackHandler(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "55555555-5555-5555-5555-555555555555"
+		msgID       = "44444444-4444-4444-4444-444444444444"
+		validBody   = `{"rating":4,"comment":"Mostly right","feedback_type":"helpful"}`
+	)
+	target := "/api/conversations/" + convID + "/messages/" + msgID + "/feedback"
+	pathValues := map[string]string{"id": convID, "msgId": msgID}
+	submit := func(w http.ResponseWriter, r *http.Request) { (&ChatHandlers{}).SubmitFeedbackHandler(w, r) }
+	testConversationOwnership(t, submit, http.MethodPost, target, validBody, pathValues)
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{name: "invalid body", body: `{"rating":`, wantStatus: http.StatusBadRequest},
+		{name: "rating out of range", body: `{"rating":9,"feedback_type":"helpful"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown feedback type", body: `{"rating":3,"feedback_type":"funny"}`, wantStatus: http.StatusBadRequest},
+		{
+			name: "message of another conversation",
+			body: validBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, otherConvID, "assistant", "Paris")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "feedback stored",
+			body: validBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "Paris")
+				mock.ExpectQuery(`INSERT INTO message_feedback`).
+					WithArgs(sqlmock.AnyArg(), msgID, userID, 4, "Mostly right", "helpful").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("f1", time.Now()))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			submit(w, newAuthedRequest(http.MethodPost, target, strings.NewReader(tt.body), "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp FeedbackData
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.ID != "f1" || resp.MessageID != msgID || resp.Rating != 4 || resp.FeedbackType != "helpful" {
+				t.Errorf("feedback = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestGetFeedbackHandler(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		query      string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "invalid from", query: "?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid to", query: "?to=2026-02-01", wantStatus: http.StatusBadRequest},
+		{
+			name: "no filter",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM message_feedback`).
+					WithArgs("", nil, nil).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "user_id", "rating", "comment", "feedback_type", "created_at"}))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:  "type and date range",
+			query: "?type=harmful&from=2026-01-01T00:00:00Z&to=2026-02-01T00:00:00Z",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`FROM message_feedback`).
+					WithArgs("harmful", from, to).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "user_id", "rating", "comment", "feedback_type", "created_at"}).
+						AddRow("f1", "m1", "u1", 1, "Unsafe advice", "harmful", from.Add(time.Hour)))
+			},
+			wantStatus: http.StatusOK,
+			wantCount:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetFeedbackHandler(w, newAuthedRequest(http.MethodGet, "/api/admin/feedback"+tt.query, nil, "admin", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp []FeedbackData
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp == nil || len(resp) != tt.wantCount {
+				t.Errorf("got %d feedback records (%v), want %d", len(resp), resp, tt.wantCount)
+			}
+		})
+	}
+}
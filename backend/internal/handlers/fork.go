@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type ForkRequest struct {
+	FromMessageID string `json:"from_message_id"` // Last message copied into the fork
+}
+
+// ForkConversationHandler creates a new conversation from the messages of an existing one up to and
+// including a given message, so an alternative reply can be explored without losing the original
+func (ch *ChatHandlers) ForkConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Fork request from user: %s for conversation: %s", username, convID)
+
+	var req ForkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := uuid.Parse(req.FromMessageID); err != nil {
+		http.Error(w, "Invalid from_message_id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	fork, err := db.ForkConversation(convID, req.FromMessageID, user.ID)
+	if errors.Is(err, db.ErrForkMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[CHAT] Error forking conversation %s: %v", convID, err)
+		http.Error(w, "Error forking conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newConversationInfo(fork, nil))
+}
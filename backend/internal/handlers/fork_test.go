@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// capturedArg is a sqlmock argument matcher that accepts any value and remembers it
+type capturedArg struct {
+	value driver.Value
+}
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+func TestForkConversationHandler(t *testing.T) {
+	const (
+		userID   = "11111111-1111-1111-1111-111111111111"
+		otherID  = "22222222-2222-2222-2222-222222222222"
+		convID   = "33333333-3333-3333-3333-333333333333"
+		firstID  = "44444444-4444-4444-4444-444444444444"
+		secondID = "55555555-5555-5555-5555-555555555555"
+	)
+	source := testutil.Conversation{ID: convID, UserID: userID, Title: "Trip plans", ResponseFormat: "json", ResponseSchema: `{"type":"object"}`}
+	forkBody := `{"from_message_id":"` + secondID + `"}`
+
+	// Parent links of the copied messages, checked by the successful fork
+	firstNewID, secondNewID, secondParent := &capturedArg{}, &capturedArg{}, &capturedArg{}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{name: "invalid body", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "invalid message ID", body: `{"from_message_id":"latest"}`, wantStatus: http.StatusBadRequest},
+		{
+			name: "conversation not found",
+			body: forkBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "another user's conversation",
+			body: forkBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "message not in the conversation",
+			body: forkBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, source)
+				testutil.ExpectConversation(mock, source)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT id, parent_message_id\s+FROM messages`).
+					WithArgs(convID, secondID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "parent_message_id"}))
+				mock.ExpectRollback()
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "fork",
+			body: forkBody,
+			setup: func(mock sqlmock.Sqlmock) {
+				now := time.Now()
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, source)
+				testutil.ExpectConversation(mock, source)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT id, parent_message_id\s+FROM messages`).
+					WithArgs(convID, secondID).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "parent_message_id"}).AddRow(firstID, nil).AddRow(secondID, firstID))
+				mock.ExpectQuery(`INSERT INTO conversations`).
+					WithArgs(sqlmock.AnyArg(), userID, "Fork of: Trip plans", "json", `{"type":"object"}`, "").
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+				mock.ExpectExec(`INSERT INTO messages`).
+					WithArgs(firstNewID, sqlmock.AnyArg(), nil, firstID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO messages`).
+					WithArgs(secondNewID, sqlmock.AnyArg(), secondParent, secondID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/fork", strings.NewReader(tt.body), "alice",
+				map[string]string{"id": convID})
+			(&ChatHandlers{}).ForkConversationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var info ConversationInfo
+			if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if info.ID == convID || info.Title != "Fork of: Trip plans" || info.ResponseFormat != "json" || info.ResponseSchema != source.ResponseSchema {
+				t.Errorf("got fork %+v, want a new conversation inheriting the source's format", info)
+			}
+			if secondParent.value != firstNewID.value {
+				t.Errorf("second message parent = %v, want the copy of the first message %v", secondParent.value, firstNewID.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newAuthedRequest builds a request as AuthMiddleware leaves it for the given user, with path
+// values set as the router would
+func newAuthedRequest(method, target string, body io.Reader, username string, pathValues map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	for name, value := range pathValues {
+		r.SetPathValue(name, value)
+	}
+	return r.WithContext(context.WithValue(r.Context(), auth.UserContextKey, username))
+}
+
+// setTestModels replaces the available models for the duration of a test
+func setTestModels(t *testing.T, models []config.Model) {
+	t.Helper()
+	previous := config.GetAvailableModels()
+	t.Cleanup(func() { config.SetModels(previous) })
+	config.SetModels(models)
+}
+
+// stubProvider is an LLM provider that answers every request with a fixed response (streamed as
+// one chunk per element of chunks, or as a single chunk) and records what it was sent
+type stubProvider struct {
+	response string
+	chunks   []string
+	err      error
+
+	calls        int
+	messages     []llm.Message
+	systemPrompt string
+	model        string
+	opts         *llm.ChatOptions
+}
+
+func (p *stubProvider) record(messages []llm.Message, systemPrompt, model string) {
+	p.calls++
+	p.messages = messages
+	p.systemPrompt = systemPrompt
+	p.model = model
+}
+
+func (p *stubProvider) stream() <-chan llm.StreamChunk {
+	chunks := p.chunks
+	if len(chunks) == 0 {
+		chunks = []string{p.response}
+	}
+	out := make(chan llm.StreamChunk, len(chunks)+1)
+	for _, content := range chunks {
+		out <- llm.StreamChunk{Content: content}
+	}
+	out <- llm.StreamChunk{IsDone: true}
+	close(out)
+	return out
+}
+
+func (p *stubProvider) ChatWithHistory(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (string, error) {
+	p.record(messages, customSystemPrompt, modelOverride)
+	p.opts = opts
+	return p.response, p.err
+}
+
+func (p *stubProvider) ChatWithHistoryStream(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (<-chan llm.StreamChunk, error) {
+	p.record(messages, customSystemPrompt, modelOverride)
+	p.opts = opts
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.stream(), nil
+}
+
+func (p *stubProvider) ChatForSummarization(ctx context.Context, messages []llm.Message, summarizationPrompt, modelOverride string, temperature *float64) (string, error) {
+	p.record(messages, summarizationPrompt, modelOverride)
+	return p.response, p.err
+}
+
+func (p *stubProvider) ChatForSummarizationStream(ctx context.Context, messages []llm.Message, summarizationPrompt, modelOverride string, temperature *float64) (<-chan llm.StreamChunk, error) {
+	p.record(messages, summarizationPrompt, modelOverride)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.stream(), nil
+}
+
+func (p *stubProvider) FetchGenerationCost(generationID string) (*llm.GenerationData, error) {
+	return nil, nil
+}
+
+func (p *stubProvider) GetDefaultModel() string {
+	return "stub/model"
+}
+
+// testConversationOwnership checks that a handler scoped to the conversation in the "id" path value
+// answers 404 for a missing conversation and 403 for another user's conversation
+func testConversationOwnership(t *testing.T, handler http.HandlerFunc, method, target, body string, pathValues map[string]string) {
+	t.Helper()
+	const (
+		userID  = "11111111-1111-1111-1111-111111111111"
+		otherID = "22222222-2222-2222-2222-222222222222"
+	)
+	convID := pathValues["id"]
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "missing conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "another user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(method, target, strings.NewReader(body), "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// importedTitle is used when an imported conversation has no title
+const importedTitle = "Imported conversation"
+
+// importTimeLayouts are the accepted message timestamps: the export format and RFC 3339
+var importTimeLayouts = []string{"2006-01-02 15:04:05.999999999 -0700 MST", time.RFC3339Nano}
+
+// ImportConversationHandler creates a new conversation from a JSON export (see ConversationExport).
+// All entities get new IDs and token usage and cost data is dropped since it belongs to the
+// exporting account. Messages are validated and moderated like chat messages.
+func (ch *ChatHandlers) ImportConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Import request from user: %s", username)
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.GetMaxImportSize())
+	var export ConversationExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Import exceeds the maximum size of %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conv := export.Conversation
+	title := strings.TrimSpace(conv.Title)
+	if title == "" {
+		title = importedTitle
+	} else if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+
+	format := conv.ResponseFormat
+	if format == "" {
+		format = "text"
+	}
+	schema, err := resolveResponseSchema(format, conv.ResponseSchema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if conv.Color != "" {
+		if err := validation.ValidateColor(conv.Color); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages, err := newImportedMessages(export.Messages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, msg := range messages {
+		if !ch.checkModeration(reqLog, w, username, msg.Content) {
+			return
+		}
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	imported, err := db.ImportConversation(user.ID, title, format, schema, conv.Color, messages)
+	if err != nil {
+		reqLog.Printf("[IMPORT] Error importing conversation for user %s: %v", username, err)
+		http.Error(w, "Error importing conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newConversationInfo(imported, nil))
+}
+
+// newImportedMessages validates exported messages and converts them for db.ImportConversation
+func newImportedMessages(messages []MessageData) ([]db.ImportedMessage, error) {
+	if maxMessages := config.GetMaxImportMessages(); len(messages) > maxMessages {
+		return nil, fmt.Errorf("imports may contain at most %d messages", maxMessages)
+	}
+
+	imported := make([]db.ImportedMessage, 0, len(messages))
+	for i, msg := range messages {
+		switch msg.Role {
+		case "user", "assistant", "system":
+		default:
+			return nil, fmt.Errorf("message %d: invalid role %q", i+1, msg.Role)
+		}
+		if err := validation.ValidateMessage(msg.Content); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+
+		im := db.ImportedMessage{
+			SourceID:  msg.ID,
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Model:     msg.Model,
+			CreatedAt: parseImportTime(msg.CreatedAt),
+		}
+		if msg.ParentMessageID != nil {
+			im.ParentSourceID = *msg.ParentMessageID
+		}
+		imported = append(imported, im)
+	}
+	return imported, nil
+}
+
+// parseImportTime parses an exported timestamp, returning the zero time when it is missing or malformed
+func parseImportTime(value string) time.Time {
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
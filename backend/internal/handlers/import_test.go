@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"chat-app/internal/moderation"
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestImportConversationHandler(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	t.Setenv("MAX_IMPORT_MESSAGES", "3")
+
+	moderator, err := moderation.NewModerator(true, []string{`(?i)forbidden`})
+	if err != nil {
+		t.Fatalf("error creating moderator: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "invalid body", body: `{"messages":`, wantStatus: http.StatusBadRequest},
+		{
+			name:       "invalid role",
+			body:       `{"messages":[{"role":"tool","content":"hi"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty message",
+			body:       `{"messages":[{"role":"user","content":""}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "oversized message",
+			body:       `{"messages":[{"role":"user","content":"` + strings.Repeat("a", 32*1024+1) + `"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "too many messages",
+			body: `{"messages":[{"role":"user","content":"1"},{"role":"assistant","content":"2"},
+				{"role":"user","content":"3"},{"role":"assistant","content":"4"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "moderated message",
+			body:       `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"Forbidden words"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "CONTENT_MODERATED",
+		},
+		{
+			name: "valid import",
+			body: `{"conversation":{"title":"Notes"},"messages":[{"id":"a","role":"user","content":"hi"},{"id":"b","role":"assistant","content":"hello","parent_message_id":"a"}]}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				now := time.Now()
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO conversations`).
+					WithArgs(sqlmock.AnyArg(), userID, "Notes", "text", "", "").
+					WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(now, now))
+				mock.ExpectExec(`INSERT INTO messages`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO messages`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/import", strings.NewReader(tt.body), "alice", nil)
+			(&ChatHandlers{moderator: moderator}).ImportConversationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("error code = %q (decode error %v), want %q", resp.Code, err, tt.wantCode)
+				}
+			}
+		})
+	}
+}
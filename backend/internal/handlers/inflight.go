@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// InFlightTracker tracks stream requests that are currently being processed so that
+// identical requests fired in quick succession (e.g. a double-clicked send button) are rejected
+type InFlightTracker struct {
+	requests sync.Map // request key -> start time
+	window   time.Duration
+
+	mu            sync.Mutex
+	conversations map[string]int // conversation ID -> number of streams in progress
+}
+
+// NewInFlightTracker creates a tracker that rejects duplicates started within the given window
+func NewInFlightTracker(window time.Duration) *InFlightTracker {
+	return &InFlightTracker{window: window, conversations: make(map[string]int)}
+}
+
+// inFlightKey builds the tracker key for a user's message
+func inFlightKey(userID, message string) string {
+	hash := sha256.Sum256([]byte(userID + message))
+	return hex.EncodeToString(hash[:])
+}
+
+// Begin marks a request as in flight. It returns false if an identical request started
+// within the window is still being processed; otherwise it returns a release function
+// that must be called once the request completes.
+func (t *InFlightTracker) Begin(key string) (func(), bool) {
+	if t.window <= 0 {
+		return func() {}, true
+	}
+
+	now := time.Now()
+	existing, loaded := t.requests.LoadOrStore(key, now)
+	if loaded {
+		// An older request with the same key is still running - only reject within the window
+		if now.Sub(existing.(time.Time)) < t.window {
+			return nil, false
+		}
+		if !t.requests.CompareAndSwap(key, existing, now) {
+			return nil, false
+		}
+	}
+
+	return func() {
+		t.requests.CompareAndDelete(key, now)
+	}, true
+}
+
+// BeginConversation marks a stream as in progress for a conversation. The returned
+// release function must be called once the stream completes.
+func (t *InFlightTracker) BeginConversation(convID string) func() {
+	t.mu.Lock()
+	t.conversations[convID]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.conversations[convID] <= 1 {
+				delete(t.conversations, convID)
+			} else {
+				t.conversations[convID]--
+			}
+		})
+	}
+}
+
+// IsConversationActive reports whether a stream is in progress for the conversation
+func (t *InFlightTracker) IsConversationActive(convID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conversations[convID] > 0
+}
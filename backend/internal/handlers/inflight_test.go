@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInFlightTrackerBegin(t *testing.T) {
+	tracker := NewInFlightTracker(time.Minute)
+	key := inFlightKey("user-1", "hello")
+
+	release, ok := tracker.Begin(key)
+	if !ok {
+		t.Fatal("first request rejected")
+	}
+	if _, ok := tracker.Begin(key); ok {
+		t.Error("identical request accepted while the first is in flight")
+	}
+	if _, ok := tracker.Begin(inFlightKey("user-2", "hello")); !ok {
+		t.Error("another user's identical message rejected")
+	}
+
+	release()
+	if _, ok := tracker.Begin(key); !ok {
+		t.Error("identical request rejected after the first completed")
+	}
+}
+
+func TestInFlightTrackerWindow(t *testing.T) {
+	key := inFlightKey("user-1", "hello")
+
+	tracker := NewInFlightTracker(10 * time.Millisecond)
+	if _, ok := tracker.Begin(key); !ok {
+		t.Fatal("first request rejected")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := tracker.Begin(key); !ok {
+		t.Error("identical request rejected after the window elapsed")
+	}
+
+	disabled := NewInFlightTracker(0)
+	disabled.Begin(key)
+	if _, ok := disabled.Begin(key); !ok {
+		t.Error("identical request rejected with the tracker disabled")
+	}
+}
+
+func TestInFlightTrackerConversation(t *testing.T) {
+	tracker := NewInFlightTracker(time.Minute)
+	if tracker.IsConversationActive("c1") {
+		t.Fatal("conversation active before any stream")
+	}
+
+	first := tracker.BeginConversation("c1")
+	second := tracker.BeginConversation("c1")
+	if !tracker.IsConversationActive("c1") || tracker.IsConversationActive("c2") {
+		t.Fatal("only c1 should be active")
+	}
+
+	// Releasing one stream twice must not end the other
+	first()
+	first()
+	if !tracker.IsConversationActive("c1") {
+		t.Error("conversation inactive while a second stream is in progress")
+	}
+	second()
+	if tracker.IsConversationActive("c1") {
+		t.Error("conversation active after all streams completed")
+	}
+}
+
+// blockingProvider holds every stream request until unblock is closed and then fails it
+type blockingProvider struct {
+	stubProvider
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *blockingProvider) ChatWithHistoryStream(ctx context.Context, messages []llm.Message, customSystemPrompt, format, modelOverride string, temperature *float64, opts *llm.ChatOptions) (<-chan llm.StreamChunk, error) {
+	close(p.started)
+	<-p.unblock
+	return nil, errors.New("upstream unavailable")
+}
+
+func TestChatStreamHandlerRejectsDuplicateInFlight(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+	// The duplicate is rejected right after its user lookup
+	testutil.ExpectUser(mock, conv.UserID, "alice")
+
+	provider := &blockingProvider{started: make(chan struct{}), unblock: make(chan struct{})}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch.ChatStreamHandler(first, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+	}()
+	<-provider.started
+
+	second := httptest.NewRecorder()
+	ch.ChatStreamHandler(second, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	close(provider.unblock)
+	<-done
+
+	if second.Code != http.StatusConflict {
+		t.Fatalf("duplicate status = %d, want %d (body %q)", second.Code, http.StatusConflict, second.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(second.Body).Decode(&resp); err != nil || resp.Code != "REQUEST_IN_FLIGHT" {
+		t.Errorf("duplicate response = %+v (%v), want code REQUEST_IN_FLIGHT", resp, err)
+	}
+	if frames := parseSSE(first.Body.String()); len(frames) != 1 || frames[0].event != sseEventError {
+		t.Errorf("first request frames = %+v, want it to reach the provider", frames)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	if _, ok := ch.inFlight.Begin(inFlightKey(conv.UserID, "hi")); !ok {
+		t.Error("message still marked in flight after the first request completed")
+	}
+}
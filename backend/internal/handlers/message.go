@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"net/http"
+)
+
+// getOwnedMessage loads a message and writes an error response unless its conversation
+// belongs to the authenticated user
+func getOwnedMessage(w http.ResponseWriter, r *http.Request) (*db.Message, bool) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	message, err := db.GetMessage(r.PathValue("id"))
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting message: %v", err)
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	conversation, err := db.GetConversation(message.ConversationID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+	return message, true
+}
+
+// GetMessageHandler returns a single message with its full metadata
+func (ch *ChatHandlers) GetMessageHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Get message request from user: %s for message: %s", username, r.PathValue("id"))
+
+	message, ok := getOwnedMessage(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newMessageData(message))
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type EditMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type MessageEditData struct {
+	ID              string `json:"id"`
+	PreviousContent string `json:"previous_content"`
+	EditedAt        string `json:"edited_at"`
+}
+
+type MessageEditsResponse struct {
+	Edits []MessageEditData `json:"edits"`
+}
+
+// EditMessageHandler replaces the content of one of the user's own messages. Assistant replies
+// cannot be edited. The previous content is kept and listed by GetMessageEditsHandler.
+func (ch *ChatHandlers) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Edit message request from user: %s for message: %s", username, r.PathValue("id"))
+
+	var req EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "content must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Content) > validation.MaxMessageLengthBytes {
+		http.Error(w, fmt.Sprintf("content must be at most %d bytes", validation.MaxMessageLengthBytes), http.StatusBadRequest)
+		return
+	}
+
+	message, ok := getOwnedMessage(w, r)
+	if !ok {
+		return
+	}
+
+	if message.Role != "user" {
+		http.Error(w, "Only user messages can be edited", http.StatusForbidden)
+		return
+	}
+
+	if !ch.checkModeration(reqLog, w, username, req.Content) {
+		return
+	}
+
+	edited, err := db.EditMessage(message.ID, req.Content)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error editing message: %v", err)
+		http.Error(w, "Error editing message", http.StatusInternalServerError)
+		return
+	}
+	// The edit may have discarded the active summary
+	invalidateActiveSummaryCache(message.ConversationID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newMessageData(edited))
+}
+
+// GetMessageEditsHandler returns the previous contents of one of the user's messages, oldest first
+func (ch *ChatHandlers) GetMessageEditsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Get message edits request from user: %s for message: %s", username, r.PathValue("id"))
+
+	message, ok := getOwnedMessage(w, r)
+	if !ok {
+		return
+	}
+
+	edits, err := db.GetMessageEdits(message.ID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting message edits: %v", err)
+		http.Error(w, "Error retrieving message edits", http.StatusInternalServerError)
+		return
+	}
+
+	editData := make([]MessageEditData, 0, len(edits))
+	for _, edit := range edits {
+		editData = append(editData, MessageEditData{
+			ID:              edit.ID,
+			PreviousContent: edit.PreviousContent,
+			EditedAt:        edit.EditedAt.String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessageEditsResponse{Edits: editData})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// MessageStat holds the token usage, cost and latency of a single assistant message
+type MessageStat struct {
+	ID               string   `json:"id"`
+	Model            string   `json:"model,omitempty"`
+	PromptTokens     *int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens *int     `json:"completion_tokens,omitempty"`
+	TotalTokens      *int     `json:"total_tokens,omitempty"`
+	Cost             *float64 `json:"cost,omitempty"`
+	LatencyMs        *int     `json:"latency_ms,omitempty"`
+	CreatedAt        string   `json:"created_at"`
+
+	createdAt int64 // creation time in nanoseconds, used for the default ordering
+}
+
+type MessageStatsResponse struct {
+	Messages []MessageStat `json:"messages"`
+}
+
+// messageStatSortKeys maps the sort query parameter to the value compared; nil values sort last
+var messageStatSortKeys = map[string]func(s *MessageStat) *float64{
+	"created_at":        func(s *MessageStat) *float64 { v := float64(s.createdAt); return &v },
+	"cost":              func(s *MessageStat) *float64 { return s.Cost },
+	"prompt_tokens":     func(s *MessageStat) *float64 { return intToFloat(s.PromptTokens) },
+	"completion_tokens": func(s *MessageStat) *float64 { return intToFloat(s.CompletionTokens) },
+	"total_tokens":      func(s *MessageStat) *float64 { return intToFloat(s.TotalTokens) },
+	"latency":           func(s *MessageStat) *float64 { return intToFloat(s.LatencyMs) },
+}
+
+func intToFloat(v *int) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+// GetMessageStats lists the usage of a conversation's assistant messages, optionally restricted to one
+// model and sorted by sortBy ("created_at" by default) in the given order ("asc" by default).
+// The conversation must be owned by the given user.
+func GetMessageStats(convID, userID, sortBy, order, model string) ([]MessageStat, error) {
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	sortKey, ok := messageStatSortKeys[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", sortBy)
+	}
+	if order == "" {
+		order = "asc"
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("unknown sort order %q", order)
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, fmt.Errorf("conversation does not belong to user")
+	}
+
+	messages, err := db.GetConversationMessagesWithDetails(convID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []MessageStat{}
+	for _, msg := range messages {
+		if msg.Role != "assistant" || (model != "" && msg.Model != model) {
+			continue
+		}
+		stats = append(stats, MessageStat{
+			ID:               msg.ID,
+			Model:            msg.Model,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: msg.CompletionTokens,
+			TotalTokens:      msg.TotalTokens,
+			Cost:             msg.TotalCost,
+			LatencyMs:        msg.Latency,
+			CreatedAt:        msg.CreatedAt.String(),
+			createdAt:        msg.CreatedAt.UnixNano(),
+		})
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := sortKey(&stats[i]), sortKey(&stats[j])
+		if a == nil || b == nil {
+			return a != nil
+		}
+		if order == "desc" {
+			return *a > *b
+		}
+		return *a < *b
+	})
+
+	return stats, nil
+}
+
+// GetMessageStatsHandler returns per-message token usage, cost and latency for a conversation
+func (ch *ChatHandlers) GetMessageStatsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	query := r.URL.Query()
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if _, ok := messageStatSortKeys[sortBy]; !ok {
+			http.Error(w, "Invalid 'sort' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if order := query.Get("order"); order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "Invalid 'order' parameter, expected asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	stats, err := GetMessageStats(convID, user.ID, query.Get("sort"), query.Get("order"), query.Get("model"))
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting message stats: %v", err)
+		http.Error(w, "Error retrieving message stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessageStatsResponse{Messages: stats})
+}
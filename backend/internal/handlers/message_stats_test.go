@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"cmp"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectMessageStatsRows expects a conversation's messages to be read: a user message followed by
+// three assistant replies, the last of which has no known cost
+func expectMessageStatsRows(mock sqlmock.Sqlmock, convID string) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	reply := func(id, model string, prompt, completion int, cost any, latency int, minute int) []driver.Value {
+		row := testutil.MessageRow(id, convID, "assistant", "reply")
+		row[4] = model
+		row[9], row[10], row[11] = prompt, completion, prompt+completion
+		row[12] = cost
+		row[15] = latency
+		row[22] = start.Add(time.Duration(minute) * time.Minute)
+		return row
+	}
+	question := testutil.MessageRow("u1", convID, "user", "question")
+	question[22] = start
+
+	mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).
+			AddRow(question...).
+			AddRow(reply("a1", "vendor/a", 100, 50, 0.003, 300, 1)...).
+			AddRow(reply("a2", "vendor/b", 300, 20, 0.001, 100, 2)...).
+			AddRow(reply("a3", "vendor/a", 200, 80, nil, 500, 3)...))
+}
+
+func TestGetMessageStats(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+
+	tests := []struct {
+		sort, order, model string
+		want               []string
+	}{
+		{want: []string{"a1", "a2", "a3"}},
+		{order: "desc", want: []string{"a3", "a2", "a1"}},
+		{sort: "created_at", order: "asc", want: []string{"a1", "a2", "a3"}},
+		// Messages without a value come last in either order
+		{sort: "cost", want: []string{"a2", "a1", "a3"}},
+		{sort: "cost", order: "desc", want: []string{"a1", "a2", "a3"}},
+		{sort: "prompt_tokens", want: []string{"a1", "a3", "a2"}},
+		{sort: "prompt_tokens", order: "desc", want: []string{"a2", "a3", "a1"}},
+		{sort: "completion_tokens", want: []string{"a2", "a1", "a3"}},
+		{sort: "completion_tokens", order: "desc", want: []string{"a3", "a1", "a2"}},
+		{sort: "total_tokens", want: []string{"a1", "a3", "a2"}},
+		{sort: "total_tokens", order: "desc", want: []string{"a2", "a3", "a1"}},
+		{sort: "latency", want: []string{"a2", "a1", "a3"}},
+		{sort: "latency", order: "desc", want: []string{"a3", "a1", "a2"}},
+		{model: "vendor/a", want: []string{"a1", "a3"}},
+		{sort: "latency", order: "desc", model: "vendor/a", want: []string{"a3", "a1"}},
+		{model: "vendor/unknown", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		name := cmp.Or(strings.TrimSpace(strings.Join([]string{tt.sort, tt.order, tt.model}, " ")), "default")
+		t.Run(name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			expectMessageStatsRows(mock, convID)
+
+			stats, err := GetMessageStats(convID, userID, tt.sort, tt.order, tt.model)
+			if err != nil {
+				t.Fatalf("GetMessageStats() error = %v", err)
+			}
+			ids := []string{}
+			for _, stat := range stats {
+				ids = append(ids, stat.ID)
+			}
+			if stats == nil || !slices.Equal(ids, tt.want) {
+				t.Errorf("GetMessageStats() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		if _, err := GetMessageStats(convID, userID, "content", "", ""); err == nil {
+			t.Error("GetMessageStats() accepted an unknown sort field")
+		}
+		if _, err := GetMessageStats(convID, userID, "cost", "up", ""); err == nil {
+			t.Error("GetMessageStats() accepted an unknown order")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("another user's conversation", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: "22222222-2222-2222-2222-222222222222"})
+
+		if _, err := GetMessageStats(convID, userID, "", "", ""); err == nil {
+			t.Error("GetMessageStats() returned another user's messages")
+		}
+	})
+}
+
+func TestGetMessageStatsHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages/stats"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).GetMessageStatsHandler, http.MethodGet, path, "", pathValues)
+	})
+
+	for name, query := range map[string]string{
+		"unknown sort field": "?sort=content",
+		"unknown order":      "?sort=cost&order=up",
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetMessageStatsHandler(w, newAuthedRequest(http.MethodGet, path+query, nil, "alice", pathValues))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("sorted and filtered", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		expectMessageStatsRows(mock, convID)
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetMessageStatsHandler(w, newAuthedRequest(http.MethodGet, path+"?sort=cost&order=desc&model=vendor/a", nil, "alice", pathValues))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if len(resp.Messages) != 2 {
+			t.Fatalf("messages = %v, want the two vendor/a replies", resp.Messages)
+		}
+		first := resp.Messages[0]
+		if first["id"] != "a1" || first["prompt_tokens"] != 100.0 || first["completion_tokens"] != 50.0 || first["cost"] != 0.003 || first["latency_ms"] != 300.0 {
+			t.Errorf("first message = %v, want a1 with its usage", first)
+		}
+		if _, ok := resp.Messages[1]["cost"]; ok || resp.Messages[1]["id"] != "a3" {
+			t.Errorf("second message = %v, want a3 without a cost", resp.Messages[1])
+		}
+	})
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetMessageHandler(t *testing.T) {
+	const (
+		userID  = "11111111-1111-1111-1111-111111111111"
+		otherID = "22222222-2222-2222-2222-222222222222"
+		convID  = "33333333-3333-3333-3333-333333333333"
+		msgID   = "44444444-4444-4444-4444-444444444444"
+	)
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{
+			name: "message not found",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+					WithArgs(msgID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "message in another user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+					WithArgs(msgID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow(msgID, convID, "user", "hello")...))
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "message in an archived conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				archivedAt := time.Now().Add(-time.Hour)
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+					WithArgs(msgID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow(msgID, convID, "user", "hello")...))
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, ArchivedAt: &archivedAt})
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "own message",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+					WithArgs(msgID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow(msgID, convID, "user", "hello")...))
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/messages/"+msgID, nil, "alice", map[string]string{"id": msgID})
+			(&ChatHandlers{}).GetMessageHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var msg MessageData
+			if err := json.NewDecoder(w.Body).Decode(&msg); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if msg.ID != msgID || msg.Content != "hello" {
+				t.Errorf("got message %+v, want %s with content %q", msg, msgID, "hello")
+			}
+		})
+	}
+}
+
+func TestGetMessageHandlerCostSplit(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+		msgID  = "44444444-4444-4444-4444-444444444444"
+	)
+	row := testutil.MessageRow(msgID, convID, "assistant", "hello")
+	row[12], row[13], row[14] = 0.0105, 0.003, 0.0075
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+		WithArgs(msgID).
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(row...))
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+
+	w := httptest.NewRecorder()
+	(&ChatHandlers{}).GetMessageHandler(w, newAuthedRequest(http.MethodGet, "/api/messages/"+msgID, nil, "alice", map[string]string{"id": msgID}))
+
+	var msg map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&msg); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if msg["total_cost"] != 0.0105 || msg["input_cost_usd"] != 0.003 || msg["output_cost_usd"] != 0.0075 {
+		t.Errorf("costs = %v, %v, %v, want 0.0105 split into 0.003 and 0.0075", msg["total_cost"], msg["input_cost_usd"], msg["output_cost_usd"])
+	}
+}
+
+func TestGetPartialMessagesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	path := "/api/conversations/" + convID + "/partial-messages"
+	pathValues := map[string]string{"id": convID}
+	testConversationOwnership(t, (&ChatHandlers{}).GetPartialMessagesHandler, http.MethodGet, path, "", pathValues)
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND partial = TRUE`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).AddRow(testutil.MessageRow("m1", convID, "assistant", "Half an ans")...))
+
+	w := httptest.NewRecorder()
+	(&ChatHandlers{}).GetPartialMessagesHandler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+	var resp MessagesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(resp.Messages) != 1 || resp.Messages[0].Content != "Half an ans" {
+		t.Errorf("messages = %+v, want the partial message", resp.Messages)
+	}
+}
+
+func TestGetConversationMessagesHandler(t *testing.T) {
+	const (
+		userID   = "11111111-1111-1111-1111-111111111111"
+		convID   = "33333333-3333-3333-3333-333333333333"
+		rootID   = "44444444-4444-4444-4444-444444444444"
+		replyID  = "55555555-5555-5555-5555-555555555555"
+		branchID = "66666666-6666-6666-6666-666666666666"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages"
+	handler := (&ChatHandlers{}).GetConversationMessagesHandler
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodGet, path, "", pathValues)
+	})
+
+	// childRow returns the row of a message replying to parentID
+	childRow := func(id, parentID, content string) []driver.Value {
+		row := testutil.MessageRow(id, convID, "user", content)
+		row[slices.Index(testutil.MessageColumns, "parent_message_id")] = parentID
+		return row
+	}
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectExtras := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM message_feedback f`).
+			WithArgs(convID, userID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(`FROM message_attachments a`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantIDs    []string
+		wantParent map[string]string // parent_message_id by message ID, absent for main thread messages
+	}{
+		{
+			name:  "flat list with parent references",
+			query: "",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+					WithArgs(convID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).
+						AddRow(testutil.MessageRow(rootID, convID, "user", "root")...).
+						AddRow(childRow(replyID, rootID, "reply")...).
+						AddRow(childRow(branchID, rootID, "branch")...))
+				expectExtras(mock)
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{rootID, replyID, branchID},
+			wantParent: map[string]string{replyID: rootID, branchID: rootID},
+		},
+		{
+			name:  "direct children",
+			query: "?parent_id=" + rootID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND parent_message_id = \$2 AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+					WithArgs(convID, rootID).
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).
+						AddRow(childRow(replyID, rootID, "reply")...).
+						AddRow(childRow(branchID, rootID, "branch")...))
+				expectExtras(mock)
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{replyID, branchID},
+			wantParent: map[string]string{replyID: rootID, branchID: rootID},
+		},
+		{
+			name:       "invalid parent_id",
+			query:      "?parent_id=not-a-uuid",
+			setup:      expectOwned,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			handler(w, newAuthedRequest(http.MethodGet, path+tt.query, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp MessagesResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			var ids []string
+			for _, msg := range resp.Messages {
+				ids = append(ids, msg.ID)
+				want, hasParent := tt.wantParent[msg.ID]
+				if (msg.ParentMessageID != nil) != hasParent || (hasParent && *msg.ParentMessageID != want) {
+					t.Errorf("message %s parent = %v, want %q", msg.ID, msg.ParentMessageID, want)
+				}
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("messages = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"chat-app/internal/metrics"
+	stdcontext "context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// modelChain returns the models to try for a request: the requested model (or the provider's
+// default) followed by its configured fallbacks
+func modelChain(provider llm.LLMProvider, model string) []string {
+	if model == "" {
+		model = provider.GetDefaultModel()
+	}
+	return config.GetModelChain(model)
+}
+
+// modelChainError reports that every model in the chain failed, wrapping the last error
+func modelChainError(tried []string, lastErr error) error {
+	return fmt.Errorf("all models failed (tried %s): %w", strings.Join(tried, ", "), lastErr)
+}
+
+// chatWithFallback gets a response from the requested model, trying its fallbacks in order
+// if it fails. It returns the response and the model that produced it.
+func chatWithFallback(ctx stdcontext.Context, reqLog *log.Logger, provider llm.LLMProvider, history []llm.Message, systemPrompt, format, model string, temperature *float64, opts *llm.ChatOptions) (string, string, error) {
+	chain := modelChain(provider, model)
+	var lastErr error
+	for i, candidate := range chain {
+		reqLog.Printf("[CHAT] Requesting response from model %s (attempt %d/%d)", candidate, i+1, len(chain))
+		response, err := provider.ChatWithHistory(ctx, history, systemPrompt, format, candidate, temperature, opts)
+		if err == nil {
+			metrics.RecordChatRequest(candidate, format)
+			return response, candidate, nil
+		}
+		lastErr = err
+		reqLog.Printf("[CHAT] Warning: model %s failed: %v", candidate, err)
+	}
+	if len(chain) == 1 {
+		return "", "", lastErr
+	}
+	return "", "", modelChainError(chain, lastErr)
+}
+
+// streamWithFallback starts a response stream from the requested model, trying its fallbacks in
+// order if the stream cannot be opened. It returns the stream and the model serving it.
+// Errors after the stream has started are not retried on other models.
+func streamWithFallback(ctx stdcontext.Context, reqLog *log.Logger, provider llm.LLMProvider, history []llm.Message, systemPrompt, format, model string, temperature *float64, opts *llm.ChatOptions) (<-chan llm.StreamChunk, string, error) {
+	chain := modelChain(provider, model)
+	var lastErr error
+	for i, candidate := range chain {
+		reqLog.Printf("[CHAT] Opening stream with model %s (attempt %d/%d)", candidate, i+1, len(chain))
+		chunks, err := provider.ChatWithHistoryStream(ctx, history, systemPrompt, format, candidate, temperature, opts)
+		if err == nil {
+			metrics.RecordChatRequest(candidate, format)
+			return chunks, candidate, nil
+		}
+		lastErr = err
+		reqLog.Printf("[CHAT] Warning: model %s stream failed: %v", candidate, err)
+	}
+	if len(chain) == 1 {
+		return nil, "", lastErr
+	}
+	return nil, "", modelChainError(chain, lastErr)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// pricingExamplePromptTokens and pricingExampleCompletionTokens size the sample request used for cost estimates
+	pricingExamplePromptTokens     = 1000
+	pricingExampleCompletionTokens = 500
+)
+
+type ModelPricingResponse struct {
+	ModelID              string           `json:"model_id"`
+	InputPricePerMToken  float64          `json:"input_price_per_m_token"`
+	OutputPricePerMToken float64          `json:"output_price_per_m_token"`
+	EstimatedCost        CostEstimateData `json:"estimated_cost"`
+}
+
+type CostEstimateData struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalCost        float64 `json:"total_cost"`
+}
+
+// estimateCost returns the USD cost of a request with the given token counts
+func estimateCost(model config.Model, promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*model.InputPricePerMToken + float64(completionTokens)*model.OutputPricePerMToken) / 1_000_000
+}
+
+// GetModelHandler returns the full metadata of a single model, or its pricing for .../pricing.
+// Model IDs contain slashes (e.g. "openai/gpt-oss-120b"), so the route captures the rest of the path.
+func (ch *ChatHandlers) GetModelHandler(w http.ResponseWriter, r *http.Request) {
+	modelID := r.PathValue("id")
+	if pricingModelID, ok := strings.CutSuffix(modelID, "/pricing"); ok {
+		ch.writeModelPricing(w, pricingModelID)
+		return
+	}
+
+	model, ok := config.GetModelByID(modelID)
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model)
+}
+
+// writeModelPricing writes a model's token pricing with a cost estimate for a typical request
+func (ch *ChatHandlers) writeModelPricing(w http.ResponseWriter, modelID string) {
+	model, ok := config.GetModelByID(modelID)
+	if !ok {
+		http.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+
+	if !model.HasKnownPricing() {
+		http.Error(w, "Pricing not available for this model", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ModelPricingResponse{
+		ModelID:              model.ID,
+		InputPricePerMToken:  model.InputPricePerMToken,
+		OutputPricePerMToken: model.OutputPricePerMToken,
+		EstimatedCost: CostEstimateData{
+			PromptTokens:     pricingExamplePromptTokens,
+			CompletionTokens: pricingExampleCompletionTokens,
+			TotalCost:        estimateCost(model, pricingExamplePromptTokens, pricingExampleCompletionTokens),
+		},
+	})
+}
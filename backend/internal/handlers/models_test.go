@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestGetModelHandler(t *testing.T) {
+	setTestModels(t, []config.Model{
+		{
+			ID: "vendor/large", Name: "Large", Provider: "vendor", Tier: "paid",
+			InputPricePerMToken: 3, OutputPricePerMToken: 15, ContextWindow: 200000,
+			Capabilities: []string{"json_mode", "vision"}, Fallbacks: []string{"vendor/small"},
+		},
+		{ID: "vendor/small:free", Name: "Small", Provider: "vendor", Tier: "free"},
+		{ID: "vendor/unpriced", Name: "Unpriced", Provider: "vendor", Tier: "paid"},
+	})
+
+	serve := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/models/"+id, nil)
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetModelHandler(w, r)
+		return w
+	}
+
+	t.Run("found", func(t *testing.T) {
+		w := serve("vendor/large")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var model config.Model
+		if err := json.NewDecoder(w.Body).Decode(&model); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if model.ID != "vendor/large" || model.ContextWindow != 200000 || model.InputPricePerMToken != 3 || model.OutputPricePerMToken != 15 ||
+			!slices.Equal(model.Capabilities, []string{"json_mode", "vision"}) || !slices.Equal(model.Fallbacks, []string{"vendor/small"}) {
+			t.Errorf("model = %+v, want the full metadata of vendor/large", model)
+		}
+	})
+
+	for _, id := range []string{"vendor/missing", "vendor/missing/pricing", "vendor/unpriced/pricing"} {
+		t.Run("not found "+id, func(t *testing.T) {
+			if w := serve(id); w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusNotFound, w.Body.String())
+			}
+		})
+	}
+
+	pricingTests := []struct {
+		id       string
+		wantCost float64
+	}{
+		// 1000 prompt tokens at $3/M plus 500 completion tokens at $15/M
+		{id: "vendor/large", wantCost: 0.0105},
+		{id: "vendor/small:free", wantCost: 0},
+	}
+	for _, tt := range pricingTests {
+		t.Run("pricing "+tt.id, func(t *testing.T) {
+			w := serve(tt.id + "/pricing")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp ModelPricingResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.ModelID != tt.id || resp.EstimatedCost.PromptTokens != 1000 || resp.EstimatedCost.CompletionTokens != 500 {
+				t.Errorf("response = %+v, want a 1000 + 500 token estimate for %s", resp, tt.id)
+			}
+			if math.Abs(resp.EstimatedCost.TotalCost-tt.wantCost) > 1e-12 {
+				t.Errorf("estimated cost = %v, want %v", resp.EstimatedCost.TotalCost, tt.wantCost)
+			}
+		})
+	}
+}
+
+func TestGetModelsHandlerFilters(t *testing.T) {
+	setTestModels(t, []config.Model{
+		{ID: "vendor/vision", ContextWindow: 128000, Capabilities: []string{"vision"}},
+		{ID: "vendor/json", ContextWindow: 32000, Capabilities: []string{"json_mode"}},
+		{ID: "vendor/large", ContextWindow: 200000, Capabilities: []string{"json_schema", "vision"}},
+		{ID: "vendor/plain", ContextWindow: 8000},
+	})
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetModelsHandler(w, httptest.NewRequest(http.MethodGet, "/api/models"+query, nil))
+		return w
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"vendor/vision", "vendor/json", "vendor/large", "vendor/plain"}},
+		{query: "?capability=vision", want: []string{"vendor/vision", "vendor/large"}},
+		{query: "?capability=structured_output", want: []string{"vendor/json", "vendor/large"}},
+		{query: "?capability=streaming", want: []string{"vendor/vision", "vendor/json", "vendor/large", "vendor/plain"}},
+		{query: "?capability=json_schema", want: []string{"vendor/large"}},
+		{query: "?min_context_window=100000", want: []string{"vendor/vision", "vendor/large"}},
+		{query: "?capability=vision&min_context_window=150000", want: []string{"vendor/large"}},
+		{query: "?capability=json_mode&min_context_window=150000", want: []string{}},
+		{query: "?capability=tools", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run("query "+tt.query, func(t *testing.T) {
+			w := serve(tt.query)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			// An empty result is an empty list, not null
+			var resp struct {
+				Models []config.Model `json:"models"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Models == nil {
+				t.Fatal("models = null, want a list")
+			}
+			ids := []string{}
+			for _, model := range resp.Models {
+				ids = append(ids, model.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("models = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?capability=telepathy", "?capability=VISION", "?min_context_window=-1", "?min_context_window=lots"} {
+		t.Run("invalid query "+query, func(t *testing.T) {
+			if w := serve(query); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
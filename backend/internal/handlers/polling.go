@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// GetMessageResourceHandler routes GET /api/conversations/{id}/messages/{msgId}/{resource}.
+// The since/{timestamp} path overlaps the per-message paths, so net/http cannot register
+// them as separate patterns and they are dispatched here instead.
+func (ch *ChatHandlers) GetMessageResourceHandler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.PathValue("msgId") == "since":
+		r.SetPathValue("timestamp", r.PathValue("resource"))
+		ch.GetMessagesSinceHandler(w, r)
+	case r.PathValue("resource") == "raw-prompt":
+		auth.AdminMiddleware(ch.GetRawPromptHandler)(w, r)
+	case r.PathValue("resource") == "verify":
+		ch.VerifyMessageHandler(w, r)
+	case r.PathValue("resource") == "siblings":
+		ch.GetMessageSiblingsHandler(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GetMessagesSinceHandler returns the messages created after an RFC3339 timestamp, for clients
+// that poll instead of streaming. Last-Modified carries the newest returned message's time.
+func (ch *ChatHandlers) GetMessagesSinceHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+
+	since, err := time.Parse(time.RFC3339, r.PathValue("timestamp"))
+	if err != nil {
+		http.Error(w, "Invalid timestamp, expected RFC3339", http.StatusBadRequest)
+		return
+	}
+	if since.After(time.Now()) {
+		http.Error(w, "Timestamp is in the future", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	messages, err := db.GetMessagesAfterTimestamp(convID, since)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting messages since %s: %v", since.Format(time.RFC3339), err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	if len(messages) > 0 {
+		w.Header().Set("Last-Modified", messages[len(messages)-1].CreatedAt.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessagesResponse{
+		Messages: newMessageDataList(messages),
+	})
+}
+
+type VerifyMessageResponse struct {
+	MessageID string `json:"message_id"`
+	Valid     bool   `json:"valid"`
+}
+
+// VerifyMessageHandler checks that a stored message still matches the checksum sent when it was streamed
+func (ch *ChatHandlers) VerifyMessageHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	msgID := r.PathValue("msgId")
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	message, err := db.GetMessage(msgID)
+	if err != nil || message.ConversationID != convID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	valid, err := db.VerifyMessageIntegrity(msgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No checksum stored for this message", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[CHAT] Error verifying message integrity: %v", err)
+		http.Error(w, "Error verifying message", http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		reqLog.Printf("[CHAT] Warning: message %s content does not match its stored checksum", msgID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VerifyMessageResponse{MessageID: msgID, Valid: valid})
+}
+
+// GetMessageSiblingsHandler returns the alternative assistant responses to the same user turn as a message
+func (ch *ChatHandlers) GetMessageSiblingsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	msgID := r.PathValue("msgId")
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	message, err := db.GetMessage(msgID)
+	if err != nil || message.ConversationID != convID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	siblings, err := db.GetMessageSiblings(msgID)
+	if errors.Is(err, db.ErrNotAssistantMessage) {
+		http.Error(w, "Siblings are only available for assistant messages", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting message siblings: %v", err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessagesResponse{
+		Messages: newMessageDataList(siblings),
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// instantArg is an argument matcher for a time.Time denoting the same instant, in any time zone
+type instantArg time.Time
+
+func (a instantArg) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	return ok && got.Equal(time.Time(a))
+}
+
+func TestGetMessagesSinceHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	since := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	latest := since.Add(90 * time.Second)
+
+	// serve requests the since path through the router-facing handler, as the mux dispatches it
+	serve := func(timestamp string) *httptest.ResponseRecorder {
+		pathValues := map[string]string{"id": convID, "msgId": "since", "resource": timestamp}
+		w := httptest.NewRecorder()
+		r := newAuthedRequest(http.MethodGet, "/api/conversations/"+convID+"/messages/since/"+timestamp, nil, "alice", pathValues)
+		(&ChatHandlers{}).GetMessageResourceHandler(w, r)
+		return w
+	}
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectMessagesSince := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND created_at > \$2 AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+			WithArgs(convID, instantArg(since)).
+			WillReturnRows(rows)
+	}
+
+	t.Run("ownership", func(t *testing.T) {
+		pathValues := map[string]string{"id": convID, "timestamp": since.Format(time.RFC3339)}
+		testConversationOwnership(t, (&ChatHandlers{}).GetMessagesSinceHandler, http.MethodGet,
+			"/api/conversations/"+convID+"/messages/since/"+since.Format(time.RFC3339), "", pathValues)
+	})
+
+	for _, timestamp := range []string{"yesterday", "2026-03-01", "2026-03-01T12:00:00", "1740830400"} {
+		t.Run("invalid timestamp "+timestamp, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if w := serve(timestamp); w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("future timestamp", func(t *testing.T) {
+		testutil.NewMockDB(t)
+		w := serve(time.Now().Add(time.Hour).Format(time.RFC3339))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "future") {
+			t.Fatalf("status = %d with body %q, want %d for a future timestamp", w.Code, w.Body.String(), http.StatusBadRequest)
+		}
+	})
+
+	t.Run("timestamp with offset", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		expectOwned(mock)
+		expectMessagesSince(mock, sqlmock.NewRows(testutil.MessageColumns))
+
+		// The same instant as since, written in UTC+03:00
+		if w := serve("2026-03-01T15:00:00+03:00"); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("no new messages", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		expectOwned(mock)
+		expectMessagesSince(mock, sqlmock.NewRows(testutil.MessageColumns))
+
+		w := serve(since.Format(time.RFC3339))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != `{"messages":[]}` {
+			t.Errorf("body = %s, want an empty messages array", got)
+		}
+		if got := w.Header().Get("Last-Modified"); got != "" {
+			t.Errorf("Last-Modified = %q, want it unset without messages", got)
+		}
+	})
+
+	t.Run("new messages", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		expectOwned(mock)
+		first := testutil.MessageRow("m1", convID, "user", "q1")
+		first[len(first)-1] = since.Add(time.Second)
+		last := testutil.MessageRow("m2", convID, "assistant", "a1")
+		last[len(last)-1] = latest.In(time.FixedZone("UTC+3", 3*60*60))
+		expectMessagesSince(mock, sqlmock.NewRows(testutil.MessageColumns).AddRow(first...).AddRow(last...))
+
+		w := serve(since.Format(time.RFC3339))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		if got, want := w.Header().Get("Last-Modified"), "Sun, 01 Mar 2026 12:01:30 GMT"; got != want {
+			t.Errorf("Last-Modified = %q, want %q", got, want)
+		}
+		var resp MessagesResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if len(resp.Messages) != 2 || resp.Messages[0].ID != "m1" || resp.Messages[1].ID != "m2" {
+			t.Errorf("messages = %+v, want m1 and m2", resp.Messages)
+		}
+	})
+}
+
+func TestVerifyMessageHandler(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "22222222-2222-2222-2222-222222222222"
+		msgID       = "44444444-4444-4444-4444-444444444444"
+	)
+	pathValues := map[string]string{"id": convID, "msgId": msgID, "resource": "verify"}
+	path := "/api/conversations/" + convID + "/messages/" + msgID + "/verify"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).GetMessageResourceHandler, http.MethodGet, path, "", pathValues)
+	})
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectStored := func(mock sqlmock.Sqlmock, content string, hash any) {
+		testutil.ExpectMessage(mock, msgID, convID, "assistant", content)
+		mock.ExpectQuery(`SELECT content, content_hash FROM messages WHERE id = \$1`).
+			WithArgs(msgID).
+			WillReturnRows(sqlmock.NewRows([]string{"content", "content_hash"}).AddRow(content, hash))
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantValid  bool
+	}{
+		{
+			name: "message in another conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, otherConvID, "assistant", "Hello")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "no stored checksum",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectStored(mock, "Hello", nil)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "matching checksum",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectStored(mock, "Hello", db.ContentHash("Hello"))
+			},
+			wantStatus: http.StatusOK,
+			wantValid:  true,
+		},
+		{
+			name: "modified content",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectStored(mock, "Hello!", db.ContentHash("Hello"))
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetMessageResourceHandler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp VerifyMessageResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.MessageID != msgID || resp.Valid != tt.wantValid {
+				t.Errorf("response = %+v, want valid = %v for %s", resp, tt.wantValid, msgID)
+			}
+		})
+	}
+}
+
+func TestGetMessageSiblingsHandler(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "22222222-2222-2222-2222-222222222222"
+		msgID       = "44444444-4444-4444-4444-444444444444"
+	)
+	pathValues := map[string]string{"id": convID, "msgId": msgID, "resource": "siblings"}
+	path := "/api/conversations/" + convID + "/messages/" + msgID + "/siblings"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).GetMessageResourceHandler, http.MethodGet, path, "", pathValues)
+	})
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectSiblings := func(mock sqlmock.Sqlmock, ids ...string) {
+		rows := sqlmock.NewRows(testutil.MessageColumns)
+		for _, id := range ids {
+			rows.AddRow(testutil.MessageRow(id, convID, "assistant", "answer")...)
+		}
+		mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND role = 'assistant'`).
+			WithArgs(convID, sqlmock.AnyArg()).
+			WillReturnRows(rows)
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantIDs    []string
+	}{
+		{
+			name: "message in another conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, otherConvID, "assistant", "answer")
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "user message",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, convID, "user", "question")
+				testutil.ExpectMessage(mock, msgID, convID, "user", "question")
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "no regeneration",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "answer")
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "answer")
+				expectSiblings(mock, msgID)
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{msgID},
+		},
+		{
+			name: "one regeneration",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "answer")
+				testutil.ExpectMessage(mock, msgID, convID, "assistant", "answer")
+				expectSiblings(mock, msgID, "m2")
+			},
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{msgID, "m2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetMessageResourceHandler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp MessagesResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			var ids []string
+			for _, msg := range resp.Messages {
+				ids = append(ids, msg.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("siblings = %q, want %q", ids, tt.wantIDs)
+			}
+		})
+	}
+}
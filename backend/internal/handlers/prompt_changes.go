@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+type PromptChangesResponse struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+// storeSystemPromptHash records which system prompt an assistant message was generated with,
+// so that prompt changes within a conversation can be detected
+func storeSystemPromptHash(reqLog *log.Logger, msgID, systemPrompt string) {
+	if err := db.SetMessageSystemPromptHash(msgID, db.ContentHash(systemPrompt)); err != nil {
+		reqLog.Printf("[CHAT] Warning: failed to store system prompt hash: %v", err)
+	}
+}
+
+// GetPromptChangesHandler returns the messages at which the conversation's system prompt changed
+func (ch *ChatHandlers) GetPromptChangesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	msgIDs, err := db.GetSystemPromptChangePoints(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting system prompt changes: %v", err)
+		http.Error(w, "Error retrieving system prompt changes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PromptChangesResponse{MessageIDs: msgIDs})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"chat-app/internal/db"
+	"chat-app/internal/rag"
+	"chat-app/internal/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetPromptChangesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/prompt-changes"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).GetPromptChangesHandler, http.MethodGet, path, "", pathValues)
+	})
+
+	tests := []struct {
+		name     string
+		ids      []string
+		wantBody string
+	}{
+		{name: "no changes", wantBody: `{"message_ids":[]}`},
+		{name: "changes", ids: []string{"m3", "m7"}, wantBody: `{"message_ids":["m3","m7"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			rows := sqlmock.NewRows([]string{"id"})
+			for _, id := range tt.ids {
+				rows.AddRow(id)
+			}
+			mock.ExpectQuery(`LAG\(system_prompt_hash\)`).WithArgs(convID).WillReturnRows(rows)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues)
+			(&ChatHandlers{}).GetPromptChangesHandler(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewMessageDataListSystemPromptChanged(t *testing.T) {
+	// Messages without a hash (user messages, older replies) neither count as a change nor reset
+	// the previous hash
+	hashes := []string{"", "a", "", "a", "b", "b", "a"}
+	want := []bool{false, false, false, false, true, false, true}
+
+	messages := make([]db.Message, len(hashes))
+	for i, hash := range hashes {
+		messages[i].SystemPromptHash = hash
+	}
+
+	for i, data := range newMessageDataList(messages) {
+		if data.SystemPromptChanged != want[i] {
+			t.Errorf("message %d (hash %q) SystemPromptChanged = %t, want %t", i, hashes[i], data.SystemPromptChanged, want[i])
+		}
+	}
+}
+
+func TestChatStreamHandlerStoresSystemPromptHash(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+	t.Setenv("AUTO_SUMMARIZE_THRESHOLD", "0")
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+	testutil.ExpectAddMessage(mock, conv.ID)
+	// The hash covers the prompt the user set, not the retrieved context appended to it
+	mock.ExpectExec(`UPDATE messages SET system_prompt_hash = \$1 WHERE id = \$2`).
+		WithArgs(db.ContentHash("Be brief."), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	provider := &stubProvider{response: "fine"}
+	store := &stubVectorStore{passages: []rag.Passage{{Text: "Retrieved fact", Score: 0.9}}}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), vectorStore: store, fallbackProvider: provider}
+
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `","system_prompt":"Be brief."}`
+	w := httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	if !strings.Contains(provider.systemPrompt, "Retrieved fact") {
+		t.Errorf("system prompt = %q, want the retrieved context", provider.systemPrompt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
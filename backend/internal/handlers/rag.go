@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"log"
+	"strings"
+)
+
+// withRetrievedContext prepends the vector store passages most similar to the user's message
+// to the system prompt. Retrieval failures are logged and the prompt is returned unchanged.
+func (ch *ChatHandlers) withRetrievedContext(reqLog *log.Logger, systemPrompt, userMessage string) string {
+	if ch.vectorStore == nil || strings.TrimSpace(userMessage) == "" {
+		return systemPrompt
+	}
+
+	ragConfig := config.GetRAGConfig()
+	passages, err := ch.vectorStore.Query(userMessage, ragConfig.TopK)
+	if err != nil {
+		reqLog.Printf("[RAG] Warning: failed to query vector store: %v", err)
+		return systemPrompt
+	}
+
+	var texts []string
+	for _, passage := range passages {
+		if passage.Score < ragConfig.MinSimilarity || strings.TrimSpace(passage.Text) == "" {
+			continue
+		}
+		texts = append(texts, strings.TrimSpace(passage.Text))
+	}
+
+	reqLog.Printf("[RAG] Retrieved %d passages, %d above similarity %.2f", len(passages), len(texts), ragConfig.MinSimilarity)
+	if len(texts) == 0 {
+		return systemPrompt
+	}
+
+	retrieved := "Relevant context:\n" + strings.Join(texts, "\n\n")
+	if systemPrompt == "" {
+		return retrieved
+	}
+	return retrieved + "\n\n" + systemPrompt
+}
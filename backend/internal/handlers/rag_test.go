@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"chat-app/internal/rag"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestWithRetrievedContext(t *testing.T) {
+	passages := []rag.Passage{
+		{Text: "  Paris is the capital of France.\n", Score: 0.9},
+		{Text: "The Seine flows through Paris.", Score: 0.6},
+		{Text: "Bananas are yellow.", Score: 0.2},
+		{Text: "   ", Score: 0.95},
+	}
+
+	tests := []struct {
+		name          string
+		store         *stubVectorStore // nil for no vector store
+		minSimilarity string
+		systemPrompt  string
+		message       string
+		want          string
+		wantQueried   bool
+	}{
+		{
+			name:         "no vector store",
+			systemPrompt: "Be brief.",
+			message:      "Where is Paris?",
+			want:         "Be brief.",
+		},
+		{
+			name:         "blank message",
+			store:        &stubVectorStore{passages: passages},
+			systemPrompt: "Be brief.",
+			message:      "  ",
+			want:         "Be brief.",
+		},
+		{
+			name:         "passages prepended",
+			store:        &stubVectorStore{passages: passages},
+			systemPrompt: "Be brief.",
+			message:      "Where is Paris?",
+			want: "Relevant context:\nParis is the capital of France.\n\nThe Seine flows through Paris.\n\nBananas are yellow.\n\n" +
+				"Be brief.",
+			wantQueried: true,
+		},
+		{
+			name:          "passages below the minimum similarity dropped",
+			store:         &stubVectorStore{passages: passages},
+			minSimilarity: "0.5",
+			message:       "Where is Paris?",
+			want:          "Relevant context:\nParis is the capital of France.\n\nThe Seine flows through Paris.",
+			wantQueried:   true,
+		},
+		{
+			name:          "no passage similar enough",
+			store:         &stubVectorStore{passages: passages},
+			minSimilarity: "0.99",
+			systemPrompt:  "Be brief.",
+			message:       "Where is Paris?",
+			want:          "Be brief.",
+			wantQueried:   true,
+		},
+		{
+			name:         "vector store error",
+			store:        &stubVectorStore{err: errors.New("connection refused")},
+			systemPrompt: "Be brief.",
+			message:      "Where is Paris?",
+			want:         "Be brief.",
+			wantQueried:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RAG_TOP_K", "4")
+			t.Setenv("RAG_MIN_SIMILARITY", tt.minSimilarity)
+			ch := &ChatHandlers{}
+			if tt.store != nil {
+				ch.vectorStore = tt.store
+			}
+
+			if got := ch.withRetrievedContext(log.Default(), tt.systemPrompt, tt.message); got != tt.want {
+				t.Errorf("withRetrievedContext() = %q, want %q", got, tt.want)
+			}
+			if tt.store == nil {
+				return
+			}
+			if queried := len(tt.store.queries) > 0; queried != tt.wantQueried {
+				t.Fatalf("vector store queried = %v, want %v", queried, tt.wantQueried)
+			}
+			if tt.wantQueried && (tt.store.queries[0] != tt.message || tt.store.k != 4) {
+				t.Errorf("query = %q with k = %d, want the user message with RAG_TOP_K", tt.store.queries[0], tt.store.k)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const resumePrompt = "Briefly remind the user what we were discussing and invite them to continue."
+
+// shouldResume reports whether a conversation has been idle long enough to warrant a context refresher
+func shouldResume(lastMessageAt, now time.Time, resumeAfter time.Duration) bool {
+	return now.Sub(lastMessageAt) >= resumeAfter
+}
+
+// resumeHistory returns the context for a resume message: the active summary followed by
+// the messages after it if one exists, otherwise the full conversation history
+func resumeHistory(convID string) ([]llm.Message, error) {
+	activeSummary, err := db.GetActiveSummary(convID)
+	if err != nil || activeSummary == nil || activeSummary.SummarizedUpToMessageID == nil {
+		return db.GetConversationMessages(convID)
+	}
+
+	history := []llm.Message{
+		{Role: "assistant", Content: fmt.Sprintf("Previous conversation summary:\n%s", activeSummary.SummaryContent)},
+	}
+	newMessages, err := db.GetMessagesAfterMessage(convID, *activeSummary.SummarizedUpToMessageID)
+	if err != nil {
+		return nil, err
+	}
+	return append(history, newMessages...), nil
+}
+
+// ResumeConversationHandler adds a context-refresher assistant message to a conversation that
+// has been idle for a while. It returns 204 No Content if the conversation is still fresh.
+func (ch *ChatHandlers) ResumeConversationHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Resume conversation request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[RESUME] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[RESUME] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	lastMessageAt, err := db.GetLastMessageTime(convID)
+	if err != nil {
+		reqLog.Printf("[RESUME] Error getting last message time: %v", err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	resumeAfter := time.Duration(config.GetResumeAfterHours()) * time.Hour
+	if lastMessageAt == nil || !shouldResume(*lastMessageAt, time.Now(), resumeAfter) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	history, err := resumeHistory(convID)
+	if err != nil {
+		reqLog.Printf("[RESUME] Error getting conversation history: %v", err)
+		http.Error(w, "Error retrieving conversation history", http.StatusInternalServerError)
+		return
+	}
+
+	startedAt := time.Now()
+	provider := ch.getProvider("")
+	response, err := provider.ChatWithHistory(r.Context(), history, resumePrompt, "text", "", nil, nil)
+	if err != nil {
+		reqLog.Printf("[RESUME] Error from LLM: %v", err)
+		writeChatError(w, &chatError{Status: http.StatusInternalServerError, LLMErr: err})
+		return
+	}
+
+	usedModel := provider.GetDefaultModel()
+	responseTimeMs := int(time.Since(startedAt).Milliseconds())
+	if _, err := db.AddMessage(convID, "assistant", response, usedModel, nil, nil, "", "", nil, nil, nil, nil, nil, nil, nil, nil, &responseTimeMs, ""); err != nil {
+		reqLog.Printf("[RESUME] Error adding assistant message: %v", err)
+		http.Error(w, "Error saving response", http.StatusInternalServerError)
+		return
+	}
+
+	reqLog.Printf("[RESUME] Added resume message to conversation %s after %s idle", convID, time.Since(*lastMessageAt).Round(time.Minute))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChatResponse{
+		Response:       response,
+		ConversationID: convID,
+		Model:          usedModel,
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestShouldResume(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		lastMessageAt time.Time
+		want          bool
+	}{
+		{name: "just now", lastMessageAt: now},
+		{name: "just under the gap", lastMessageAt: now.Add(-24*time.Hour + time.Second)},
+		{name: "exactly the gap", lastMessageAt: now.Add(-24 * time.Hour), want: true},
+		{name: "days ago", lastMessageAt: now.Add(-72 * time.Hour), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldResume(tt.lastMessageAt, now, 24*time.Hour); got != tt.want {
+				t.Errorf("shouldResume(%s before now) = %v, want %v", now.Sub(tt.lastMessageAt), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeConversationHandler(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		prevMsgID = "55555555-5555-5555-5555-555555555555"
+		summaryID = "99999999-9999-9999-9999-999999999999"
+	)
+	pathValues := map[string]string{"id": convID}
+	target := "/api/conversations/" + convID + "/resume"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{fallbackProvider: &stubProvider{}}).ResumeConversationHandler, http.MethodPost, target, "", pathValues)
+	})
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectLastMessageAt := func(mock sqlmock.Sqlmock, at any) {
+		mock.ExpectQuery(`SELECT MAX\(created_at\) FROM messages WHERE conversation_id = \$1 AND deleted_at IS NULL`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(at))
+	}
+
+	tests := []struct {
+		name         string
+		resumeAfter  string
+		provider     *stubProvider
+		setup        func(mock sqlmock.Sqlmock)
+		wantStatus   int
+		wantMessages []string // contents sent to the LLM, nil when it is not called
+	}{
+		{
+			name:     "recent conversation",
+			provider: &stubProvider{response: "Welcome back!"},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectLastMessageAt(mock, time.Now().Add(-23*time.Hour))
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:     "no messages",
+			provider: &stubProvider{response: "Welcome back!"},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectLastMessageAt(mock, nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:        "configured gap",
+			resumeAfter: "2",
+			provider:    &stubProvider{response: "Welcome back!"},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectLastMessageAt(mock, time.Now().Add(-3*time.Hour))
+				testutil.ExpectNoActiveSummary(mock, convID)
+				testutil.ExpectHistory(mock, convID, "q1", "a1")
+				testutil.ExpectAddMessage(mock, convID)
+			},
+			wantStatus:   http.StatusOK,
+			wantMessages: []string{"q1", "a1"},
+		},
+		{
+			name:     "resumed from the active summary",
+			provider: &stubProvider{response: "Welcome back!"},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectLastMessageAt(mock, time.Now().Add(-48*time.Hour))
+				mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id`).
+					WithArgs(convID).
+					WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, convID, "Trip planning.", prevMsgID, 0, time.Now()))
+				mock.ExpectQuery(`SELECT role, content\s+FROM messages\s+WHERE conversation_id = \$1 .* created_at > \(`).
+					WithArgs(convID, prevMsgID).
+					WillReturnRows(sqlmock.NewRows([]string{"role", "content"}).AddRow("user", "q6"))
+				testutil.ExpectAddMessage(mock, convID)
+			},
+			wantStatus:   http.StatusOK,
+			wantMessages: []string{"Previous conversation summary:\nTrip planning.", "q6"},
+		},
+		{
+			name:     "provider error",
+			provider: &stubProvider{err: errors.New("upstream unavailable")},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectLastMessageAt(mock, time.Now().Add(-48*time.Hour))
+				testutil.ExpectNoActiveSummary(mock, convID)
+				testutil.ExpectHistory(mock, convID, "q1", "a1")
+			},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessages: []string{"q1", "a1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RESUME_AFTER_HOURS", tt.resumeAfter)
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: tt.provider}).ResumeConversationHandler(w, newAuthedRequest(http.MethodPost, target, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantMessages == nil {
+				if tt.provider.calls != 0 {
+					t.Errorf("provider called %d times, want 0", tt.provider.calls)
+				}
+				return
+			}
+
+			if tt.provider.systemPrompt != resumePrompt {
+				t.Errorf("system prompt = %q, want %q", tt.provider.systemPrompt, resumePrompt)
+			}
+			var sent []string
+			for _, msg := range tt.provider.messages {
+				sent = append(sent, msg.Content)
+			}
+			if len(sent) != len(tt.wantMessages) {
+				t.Fatalf("messages sent to the LLM = %q, want %q", sent, tt.wantMessages)
+			}
+			for i := range sent {
+				if sent[i] != tt.wantMessages[i] {
+					t.Errorf("message %d = %q, want %q", i, sent[i], tt.wantMessages[i])
+				}
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ChatResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Response != "Welcome back!" || resp.ConversationID != convID {
+				t.Errorf("response = %+v, want the resume message for %s", resp, convID)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// searchContextChars is how many characters of context are shown on each side of a match
+	searchContextChars = 50
+
+	maxSearchResults     = 50
+	maxSearchQueryLength = 200
+
+	// defaultSearchPageSize and maxSearchPageSize bound a page of conversation or message search results
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+type SearchResult struct {
+	MessageData
+	MatchContext string `json:"match_context"` // HTML-escaped snippet with matches wrapped in <mark> tags
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+}
+
+// ConversationSearchResponse is a page of conversation search results
+type ConversationSearchResponse struct {
+	ConversationsResponse
+	Total int `json:"total"` // Matching conversations across all pages
+}
+
+// MessageSearchResult is a message matching a search across conversations, with the conversation it belongs to
+type MessageSearchResult struct {
+	SearchResult
+	Conversation ConversationInfo `json:"conversation"`
+}
+
+// MessageSearchResponse is a page of message search results
+type MessageSearchResponse struct {
+	Results []MessageSearchResult `json:"results"`
+}
+
+// parseSearchPage reads the limit and offset parameters of a paginated search
+func parseSearchPage(params url.Values) (limit, offset int, err error) {
+	limit = defaultSearchPageSize
+	if value := params.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchPageSize {
+			return 0, 0, fmt.Errorf("'limit' must be between 1 and %d", maxSearchPageSize)
+		}
+	}
+
+	if value := params.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("'offset' must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// buildMatchContext returns the text around the first case-insensitive occurrence of query in content,
+// with every occurrence inside that window wrapped in <mark> tags. The remaining text is HTML-escaped.
+func buildMatchContext(content, query string, charsBefore, charsAfter int) string {
+	text := []rune(content)
+	needle := lowerRunes([]rune(query))
+	lowered := lowerRunes(text)
+
+	var matches []int
+	for i := 0; len(needle) > 0 && i+len(needle) <= len(lowered); i++ {
+		if runesEqual(lowered[i:i+len(needle)], needle) {
+			matches = append(matches, i)
+			i += len(needle) - 1
+		}
+	}
+
+	if len(matches) == 0 {
+		end := min(len(text), charsBefore+charsAfter)
+		return html.EscapeString(string(text[:end]))
+	}
+
+	start := max(0, matches[0]-charsBefore)
+	end := min(len(text), matches[0]+len(needle)+charsAfter)
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		if m+len(needle) > end {
+			break
+		}
+		snippet.WriteString(html.EscapeString(string(text[pos:m])))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(string(text[m : m+len(needle)])))
+		snippet.WriteString("</mark>")
+		pos = m + len(needle)
+	}
+	snippet.WriteString(html.EscapeString(string(text[pos:end])))
+	if end < len(text) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+// highlightHeadline HTML-escapes a search headline and wraps its matched words in <mark> tags
+func highlightHeadline(headline string) string {
+	return strings.NewReplacer(db.HeadlineStartSel, "<mark>", db.HeadlineStopSel, "</mark>").
+		Replace(html.EscapeString(headline))
+}
+
+// lowerRunes lowercases rune by rune so indexes line up with the original text
+func lowerRunes(runes []rune) []rune {
+	lowered := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+	}
+	return lowered
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchConversationMessagesHandler searches the messages of one conversation for the q parameter
+func (ch *ChatHandlers) SearchConversationMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "q parameter is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		http.Error(w, "q parameter is too long", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	messages, err := db.SearchMessages(convID, query, maxSearchResults)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error searching messages: %v", err)
+		http.Error(w, "Error searching messages", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]SearchResult, 0, len(messages))
+	for i := range messages {
+		results = append(results, SearchResult{
+			MessageData:  newMessageData(&messages[i]),
+			MatchContext: buildMatchContext(messages[i].Content, query, searchContextChars, searchContextChars),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{Results: results})
+}
+
+// SearchConversationsHandler finds the user's conversations whose title or messages match the q parameter,
+// most relevant first. Without q it lists all conversations. Results are paginated with limit and offset.
+func (ch *ChatHandlers) SearchConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Search conversations request from user: %s", username)
+
+	params := r.URL.Query()
+	query := strings.TrimSpace(params.Get("q"))
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		http.Error(w, "q parameter is too long", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := parseSearchPage(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversations, total, err := db.SearchConversationsByUser(user.ID, query, limit, offset)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error searching conversations: %v", err)
+		http.Error(w, "Error searching conversations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConversationSearchResponse{
+		ConversationsResponse: ConversationsResponse{Conversations: newConversationInfoList(reqLog, conversations)},
+		Total:                 total,
+	})
+}
+
+// SearchMessagesHandler runs a full-text search for the q parameter over the messages of all the user's
+// conversations, or of the one given by conversation_id, most relevant first. Results are paginated
+// with limit and offset.
+func (ch *ChatHandlers) SearchMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Search messages request from user: %s", username)
+
+	params := r.URL.Query()
+	query := strings.TrimSpace(params.Get("q"))
+	if query == "" {
+		http.Error(w, "q parameter is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		http.Error(w, "q parameter is too long", http.StatusBadRequest)
+		return
+	}
+
+	var conversationID *string
+	if value := params.Get("conversation_id"); value != "" {
+		if _, err := uuid.Parse(value); err != nil {
+			http.Error(w, "Invalid conversation_id", http.StatusBadRequest)
+			return
+		}
+		conversationID = &value
+	}
+
+	limit, offset, err := parseSearchPage(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	matches, err := db.SearchUserMessages(user.ID, query, conversationID, limit, offset)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error searching messages: %v", err)
+		http.Error(w, "Error searching messages", http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]MessageSearchResult, 0, len(matches))
+	for i := range matches {
+		results = append(results, MessageSearchResult{
+			SearchResult: SearchResult{
+				MessageData:  newMessageData(&matches[i].Message),
+				MatchContext: highlightHeadline(matches[i].Headline),
+			},
+			Conversation: newConversationInfo(&matches[i].Conversation, nil),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MessageSearchResponse{Results: results})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestBuildMatchContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		query         string
+		before, after int
+		want          string
+	}{
+		{
+			name:    "single match",
+			content: "The quick brown fox",
+			query:   "brown",
+			before:  50,
+			after:   50,
+			want:    "The quick <mark>brown</mark> fox",
+		},
+		{
+			name:    "case-insensitive match keeps the original case",
+			content: "The quick Brown fox",
+			query:   "BROWN",
+			before:  50,
+			after:   50,
+			want:    "The quick <mark>Brown</mark> fox",
+		},
+		{
+			name:    "no match",
+			content: strings.Repeat("a", 120),
+			query:   "b",
+			before:  50,
+			after:   50,
+			want:    strings.Repeat("a", 100),
+		},
+		{
+			name:    "query twice in the message",
+			content: "go left, then go right",
+			query:   "go",
+			before:  50,
+			after:   50,
+			want:    "<mark>go</mark> left, then <mark>go</mark> right",
+		},
+		{
+			name:    "overlapping occurrences",
+			content: "aaa",
+			query:   "aa",
+			before:  50,
+			after:   50,
+			want:    "<mark>aa</mark>a",
+		},
+		{
+			name:    "window cut on both sides",
+			content: strings.Repeat("x", 60) + "needle" + strings.Repeat("y", 60),
+			query:   "needle",
+			before:  5,
+			after:   5,
+			want:    "…xxxxx<mark>needle</mark>yyyyy…",
+		},
+		{
+			name:    "later match outside the window",
+			content: "needle" + strings.Repeat("x", 10) + "needle",
+			query:   "needle",
+			before:  0,
+			after:   5,
+			want:    "<mark>needle</mark>xxxxx…",
+		},
+		{
+			name:    "HTML escaped",
+			content: "<b>a & b</b>",
+			query:   "a & b",
+			before:  50,
+			after:   50,
+			want:    "&lt;b&gt;<mark>a &amp; b</mark>&lt;/b&gt;",
+		},
+		{
+			name:    "multibyte text",
+			content: "Schöne Grüße aus Übersee",
+			query:   "über",
+			before:  4,
+			after:   2,
+			want:    "…aus <mark>Über</mark>se…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildMatchContext(tt.content, tt.query, tt.before, tt.after); got != tt.want {
+				t.Errorf("buildMatchContext(%q, %q) = %q, want %q", tt.content, tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchConversationMessagesHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/messages/search"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, (&ChatHandlers{}).SearchConversationMessagesHandler, http.MethodGet, path+"?q=fox", "", pathValues)
+	})
+
+	for name, query := range map[string]string{
+		"missing query":  "",
+		"blank query":    "   ",
+		"query too long": strings.Repeat("a", maxSearchQueryLength+1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, path+"?q="+url.QueryEscape(query), nil, "alice", pathValues)
+			(&ChatHandlers{}).SearchConversationMessagesHandler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		pattern     string
+		rows        [][]string // id and content of the matching messages
+		wantContext []string
+	}{
+		{name: "no match", query: "fox", pattern: "%fox%"},
+		{
+			name:        "single match",
+			query:       "fox",
+			pattern:     "%fox%",
+			rows:        [][]string{{"m1", "The quick brown fox"}},
+			wantContext: []string{"The quick brown <mark>fox</mark>"},
+		},
+		{
+			name:        "several matches",
+			query:       "fox",
+			pattern:     "%fox%",
+			rows:        [][]string{{"m1", "A fox"}, {"m2", "Fox and fox"}},
+			wantContext: []string{"A <mark>fox</mark>", "<mark>Fox</mark> and <mark>fox</mark>"},
+		},
+		{
+			name:        "wildcards matched literally",
+			query:       "100%_done",
+			pattern:     `%100\%\_done%`,
+			rows:        [][]string{{"m1", "Now 100%_done"}},
+			wantContext: []string{"Now <mark>100%_done</mark>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			rows := sqlmock.NewRows(testutil.MessageColumns)
+			for _, row := range tt.rows {
+				rows.AddRow(testutil.MessageRow(row[0], convID, "user", row[1])...)
+			}
+			mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND content ILIKE \$2 AND deleted_at IS NULL\s+ORDER BY created_at ASC\s+LIMIT \$3`).
+				WithArgs(convID, tt.pattern, maxSearchResults).
+				WillReturnRows(rows)
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, path+"?q="+url.QueryEscape(tt.query), nil, "alice", pathValues)
+			(&ChatHandlers{}).SearchConversationMessagesHandler(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+
+			var resp SearchResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Results == nil || len(resp.Results) != len(tt.wantContext) {
+				t.Fatalf("results = %+v, want %d", resp.Results, len(tt.wantContext))
+			}
+			for i, result := range resp.Results {
+				if result.ID != tt.rows[i][0] || result.Content != tt.rows[i][1] || result.MatchContext != tt.wantContext[i] {
+					t.Errorf("result %d = %s %q with context %q, want %s with context %q",
+						i, result.ID, result.Content, result.MatchContext, tt.rows[i][0], tt.wantContext[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SSE event types of the chat stream
+const (
+	sseEventConvID      = "conv_id"
+	sseEventModel       = "model"
+	sseEventTemperature = "temperature"
+	sseEventContent     = "content"
+	sseEventUsage       = "usage"
+	sseEventChecksum    = "checksum"
+	sseEventError       = "error"
+	sseEventDone        = "done"
+)
+
+// legacySSEPrefixes are the data prefixes that identified each frame before named events were introduced
+var legacySSEPrefixes = map[string]string{
+	sseEventConvID:      "CONV_ID:",
+	sseEventModel:       "MODEL:",
+	sseEventTemperature: "TEMPERATURE:",
+	sseEventUsage:       "USAGE:",
+	sseEventChecksum:    "CHECKSUM:",
+}
+
+// legacySSESunset is when the ?legacy=true stream protocol is due to be removed
+const legacySSESunset = "Fri, 16 Apr 2027 00:00:00 GMT"
+
+// chatStreamWriter sends the typed frames of a chat stream to the client
+type chatStreamWriter interface {
+	send(event, data string)
+}
+
+// sseWriter writes chat stream frames as named SSE events ("event: <type>") or, for clients that
+// requested ?legacy=true, as unnamed "data:" frames whose type is encoded in a data prefix
+type sseWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	legacy  bool
+}
+
+// newChatStreamWriter returns w itself when the transport frames the stream on its own (WebSocket),
+// otherwise an SSE writer whose protocol is selected by the request's legacy query parameter
+func newChatStreamWriter(w http.ResponseWriter, r *http.Request, flusher http.Flusher) chatStreamWriter {
+	if stream, ok := w.(chatStreamWriter); ok {
+		return stream
+	}
+
+	legacy := r.URL.Query().Get("legacy") == "true"
+	if legacy {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Sunset", legacySSESunset)
+	}
+	return &sseWriter{w: w, flusher: flusher, legacy: legacy}
+}
+
+// errorFrameData returns the JSON payload of an error frame, {"error": message}
+func errorFrameData(message string) string {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	return string(data)
+}
+
+// send writes a single frame and flushes it to the client. Newlines are escaped since they would end the frame.
+func (s *sseWriter) send(event, data string) {
+	data = strings.ReplaceAll(data, "\n", "\\n")
+	if s.legacy {
+		fmt.Fprintf(s.w, "data: %s%s\n\n", legacySSEPrefixes[event], data)
+	} else {
+		fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	}
+	s.flusher.Flush()
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type StreamConnectionsResponse struct {
+	Active int `json:"active"`
+	Max    int `json:"max"` // 0 when unlimited
+}
+
+// acquireStreamSlot reserves one of the concurrent stream slots without blocking. It returns
+// false if all slots are taken; otherwise the returned function frees the slot.
+func (ch *ChatHandlers) acquireStreamSlot() (func(), bool) {
+	if ch.streamSlots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case ch.streamSlots <- struct{}{}:
+		return func() { <-ch.streamSlots }, true
+	default:
+		return nil, false
+	}
+}
+
+// ActiveStreams returns the number of chat streams currently holding a slot
+func (ch *ChatHandlers) ActiveStreams() int {
+	return len(ch.streamSlots)
+}
+
+// GetStreamConnectionsHandler returns the number of active streams and the configured limit
+func (ch *ChatHandlers) GetStreamConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StreamConnectionsResponse{
+		Active: ch.ActiveStreams(),
+		Max:    cap(ch.streamSlots),
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAcquireStreamSlot(t *testing.T) {
+	t.Run("unlimited", func(t *testing.T) {
+		ch := &ChatHandlers{}
+		for range 3 {
+			if _, ok := ch.acquireStreamSlot(); !ok {
+				t.Fatal("acquireStreamSlot() refused a slot without a limit")
+			}
+		}
+		if active := ch.ActiveStreams(); active != 0 {
+			t.Errorf("ActiveStreams() = %d, want 0 without a limit", active)
+		}
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		ch := &ChatHandlers{streamSlots: make(chan struct{}, 2)}
+		release, ok := ch.acquireStreamSlot()
+		if !ok {
+			t.Fatal("acquireStreamSlot() refused the first slot")
+		}
+		if _, ok := ch.acquireStreamSlot(); !ok {
+			t.Fatal("acquireStreamSlot() refused the second slot")
+		}
+		if _, ok := ch.acquireStreamSlot(); ok {
+			t.Fatal("acquireStreamSlot() granted a slot beyond the limit")
+		}
+		if active := ch.ActiveStreams(); active != 2 {
+			t.Errorf("ActiveStreams() = %d, want 2", active)
+		}
+
+		release()
+		if active := ch.ActiveStreams(); active != 1 {
+			t.Errorf("ActiveStreams() after release = %d, want 1", active)
+		}
+		if _, ok := ch.acquireStreamSlot(); !ok {
+			t.Error("acquireStreamSlot() refused a released slot")
+		}
+	})
+}
+
+func TestNewChatHandlersStreamLimit(t *testing.T) {
+	for value, want := range map[string]int{"": 100, "20": 20, "0": 0} {
+		t.Setenv("MAX_CONCURRENT_STREAMS", value)
+		if got := cap(NewChatHandlers(nil, nil).streamSlots); got != want {
+			t.Errorf("MAX_CONCURRENT_STREAMS=%q: stream slots = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestChatStreamHandlerStreamLimit(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `"}`
+
+	provider := &stubProvider{response: "hello"}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), streamSlots: make(chan struct{}, 1), fallbackProvider: provider}
+
+	// Saturated: rejected before the database or the LLM is reached
+	release, _ := ch.acquireStreamSlot()
+	mock := testutil.NewMockDB(t)
+	w := httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusServiceUnavailable, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != "TOO_MANY_STREAMS" {
+		t.Errorf("error code = %q (decode error %v), want TOO_MANY_STREAMS", resp.Code, err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times, want the stream rejected", provider.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// Once a slot is free the stream runs and gives the slot back when it completes
+	release()
+	t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+	mock = testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+	expectReplyStored(t, mock, conv.ID)
+	mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w = httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	if w.Code != http.StatusOK || provider.calls != 1 {
+		t.Fatalf("status = %d with %d provider calls, want %d and 1 (body %q)", w.Code, provider.calls, http.StatusOK, w.Body.String())
+	}
+	if active := ch.ActiveStreams(); active != 0 {
+		t.Errorf("ActiveStreams() after the stream = %d, want the slot released", active)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGetStreamConnectionsHandler(t *testing.T) {
+	limited := &ChatHandlers{streamSlots: make(chan struct{}, 20)}
+	for range 5 {
+		limited.acquireStreamSlot()
+	}
+
+	tests := []struct {
+		name     string
+		ch       *ChatHandlers
+		wantBody string
+	}{
+		{name: "limited", ch: limited, wantBody: `{"active":5,"max":20}`},
+		{name: "unlimited", ch: &ChatHandlers{}, wantBody: `{"active":0,"max":0}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.ch.GetStreamConnectionsHandler(w, newAuthedRequest(http.MethodGet, "/api/admin/stream-connections", nil, "admin", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,553 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedSummary struct {
+	summary   *db.ConversationSummary // nil when the conversation has no active summary
+	expiresAt time.Time
+}
+
+var activeSummaryCache sync.Map // conversation ID -> cachedSummary
+
+// getActiveSummaryCached returns the conversation's active summary, served from cache when fresh
+func getActiveSummaryCached(convID string) (*db.ConversationSummary, error) {
+	cacheConfig := config.GetCacheConfig()
+	if !cacheConfig.Enabled {
+		summary, err := db.GetActiveSummary(convID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return summary, err
+	}
+
+	if v, ok := activeSummaryCache.Load(convID); ok {
+		if entry := v.(cachedSummary); time.Now().Before(entry.expiresAt) {
+			return entry.summary, nil
+		}
+	}
+
+	summary, err := db.GetActiveSummary(convID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			summary = nil
+		} else {
+			return nil, err
+		}
+	}
+
+	activeSummaryCache.Store(convID, cachedSummary{summary: summary, expiresAt: time.Now().Add(cacheConfig.ActiveSummaryTTL)})
+	return summary, nil
+}
+
+// invalidateActiveSummaryCache drops the cached active summary after it has been replaced or deleted
+func invalidateActiveSummaryCache(convID string) {
+	activeSummaryCache.Delete(convID)
+}
+
+func newSummaryData(summary *db.ConversationSummary) SummaryData {
+	upToMsgID := ""
+	if summary.SummarizedUpToMessageID != nil {
+		upToMsgID = *summary.SummarizedUpToMessageID
+	}
+	return SummaryData{
+		ID:                      summary.ID,
+		SummaryContent:          summary.SummaryContent,
+		SummarizedUpToMessageID: upToMsgID,
+		UsageCount:              summary.UsageCount,
+		CreatedAt:               summary.CreatedAt.String(),
+	}
+}
+
+// SummaryDiff describes what a newer summary incorporated compared to an older one
+type SummaryDiff struct {
+	NewMessages   []db.Message
+	OldSummary    string
+	NewSummary    string
+	MessagesDelta int
+}
+
+type SummaryDiffResponse struct {
+	NewMessages   []MessageData `json:"new_messages"`
+	OldSummary    string        `json:"old_summary"`
+	NewSummary    string        `json:"new_summary"`
+	MessagesDelta int           `json:"messages_delta"`
+}
+
+// GetSummaryDiff computes the messages a new summary covers that an older summary did not.
+// Both summaries must belong to the same conversation, owned by the given user.
+func GetSummaryDiff(oldSummaryID, newSummaryID, userID string) (*SummaryDiff, error) {
+	newSummary, err := db.GetSummary(newSummaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldSummary, err := db.GetSummary(oldSummaryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldSummary.ConversationID != newSummary.ConversationID {
+		return nil, fmt.Errorf("summaries belong to different conversations")
+	}
+
+	conversation, err := db.GetConversation(newSummary.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, fmt.Errorf("conversation does not belong to user")
+	}
+
+	diff := &SummaryDiff{
+		NewMessages: []db.Message{},
+		OldSummary:  oldSummary.SummaryContent,
+		NewSummary:  newSummary.SummaryContent,
+	}
+
+	// Comparing a summary with itself yields no new messages
+	if oldSummary.ID == newSummary.ID {
+		return diff, nil
+	}
+
+	if oldSummary.CreatedAt.After(newSummary.CreatedAt) {
+		return nil, fmt.Errorf("compared summary is newer than the summary being diffed")
+	}
+
+	messages, err := db.GetMessagesBetween(newSummary.ConversationID, oldSummary.SummarizedUpToMessageID, newSummary.SummarizedUpToMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if messages != nil {
+		diff.NewMessages = messages
+	}
+	diff.MessagesDelta = len(diff.NewMessages)
+
+	return diff, nil
+}
+
+// GetSummaryDiffHandler shows which messages a summary added context for compared to an older summary
+func (ch *ChatHandlers) GetSummaryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	summaryID := r.PathValue("summaryId")
+	compareTo := r.URL.Query().Get("compare_to")
+	reqLog.Printf("Get summary diff request from user: %s for conversation: %s (summary %s vs %s)", username, convID, summaryID, compareTo)
+
+	if compareTo == "" {
+		http.Error(w, "compare_to parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Verify the diffed summary belongs to the conversation in the URL
+	summary, err := db.GetSummary(summaryID)
+	if err != nil || summary.ConversationID != convID {
+		http.Error(w, "Summary not found", http.StatusNotFound)
+		return
+	}
+
+	diff, err := GetSummaryDiff(compareTo, summaryID, user.ID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error computing summary diff: %v", err)
+		http.Error(w, "Invalid summary comparison", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SummaryDiffResponse{
+		NewMessages:   newMessageDataList(diff.NewMessages),
+		OldSummary:    diff.OldSummary,
+		NewSummary:    diff.NewSummary,
+		MessagesDelta: diff.MessagesDelta,
+	})
+}
+
+// SummaryHistoryMessage is a message newly covered by a summary in the summary history
+type SummaryHistoryMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// SummaryHistoryEntry is a summary with the messages between the previous summary's cut-off and its own
+type SummaryHistoryEntry struct {
+	Summary  SummaryData             `json:"summary"`
+	Messages []SummaryHistoryMessage `json:"messages"`
+}
+
+type SummaryHistoryResponse struct {
+	History []SummaryHistoryEntry `json:"history"`
+}
+
+// GetSummaryHistoryHandler returns every summary of a conversation, oldest first, with the messages each one
+// newly covered, so the conversation can be reconstructed from its summaries
+func (ch *ChatHandlers) GetSummaryHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get summary history request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	history, err := db.GetConversationSummaryHistory(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting summary history: %v", err)
+		http.Error(w, "Error retrieving summary history", http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]SummaryHistoryEntry, 0, len(history))
+	for i := range history {
+		messages := make([]SummaryHistoryMessage, 0, len(history[i].Messages))
+		for _, msg := range history[i].Messages {
+			messages = append(messages, SummaryHistoryMessage{Role: msg.Role, Content: msg.Content})
+		}
+		entries = append(entries, SummaryHistoryEntry{
+			Summary:  newSummaryData(&history[i].Summary),
+			Messages: messages,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SummaryHistoryResponse{History: entries})
+}
+
+// selectSummarizationModel picks the model for a summarization request: the requested model if any,
+// otherwise the configured summarization model, resolving "auto" to the cheapest available model.
+// An empty result means the provider default is used.
+func selectSummarizationModel(reqLog *log.Logger, requested string) string {
+	if requested != "" {
+		return requested
+	}
+
+	model := config.GetSummarizationModel()
+	if model != "auto" {
+		return model
+	}
+
+	cheapest, err := config.GetCheapestModel()
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Warning: could not auto-select summarization model: %v", err)
+		return ""
+	}
+	reqLog.Printf("[SUMMARIZE] Auto-selected summarization model: %s", cheapest.ID)
+	return cheapest.ID
+}
+
+const mergeSummariesPrompt = "Merge these summaries into one coherent narrative: "
+
+// errInvalidSummarySelection marks merge requests naming too few or unknown summaries
+var errInvalidSummarySelection = errors.New("invalid summary selection")
+
+type MergeSummariesRequest struct {
+	SummaryIDs    []string `json:"summary_ids"`
+	DeleteSources bool     `json:"delete_sources,omitempty"` // Delete the merged summaries afterwards
+	Model         string   `json:"model,omitempty"`
+	Provider      string   `json:"provider,omitempty"`
+}
+
+// MergeSummaries combines several summaries of a conversation into one new summary covering the messages
+// up to the latest of them. The conversation must be owned by the given user. The merged summary becomes
+// active only if the active summary was merged; if deleteSources is set, the input summaries are deleted
+// in the same transaction that stores it.
+func MergeSummaries(ctx context.Context, reqLog *log.Logger, provider llm.Summarizer, model, convID, userID string, summaryIDs []string, deleteSources bool) (*db.ConversationSummary, error) {
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, fmt.Errorf("conversation does not belong to user")
+	}
+
+	seen := make(map[string]bool)
+	var sources []db.ConversationSummary
+	for _, id := range summaryIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		summary, err := db.GetSummary(id)
+		if err != nil || summary.ConversationID != convID {
+			return nil, fmt.Errorf("%w: summary %s not found in conversation", errInvalidSummarySelection, id)
+		}
+		sources = append(sources, *summary)
+	}
+	if len(sources) < 2 {
+		return nil, fmt.Errorf("%w: at least two distinct summaries are required", errInvalidSummarySelection)
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].CreatedAt.Before(sources[j].CreatedAt)
+	})
+
+	var combined strings.Builder
+	for i, summary := range sources {
+		fmt.Fprintf(&combined, "Summary %d of %d (created %s):\n%s\n\n", i+1, len(sources), summary.CreatedAt.Format(time.RFC3339), summary.SummaryContent)
+	}
+
+	reqLog.Printf("[SUMMARIZE] Merging %d summaries for conversation %s", len(sources), convID)
+	messages := []llm.Message{{Role: "user", Content: combined.String()}}
+	merged, err := provider.ChatForSummarization(ctx, messages, mergeSummariesPrompt, model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error merging summaries: %w", err)
+	}
+	merged = enforceSummaryLength(ctx, reqLog, provider, messages, mergeSummariesPrompt, model, nil, merged)
+
+	ids := make([]string, 0, len(sources))
+	for _, source := range sources {
+		ids = append(ids, source.ID)
+	}
+
+	latest := sources[len(sources)-1]
+	summary, err := db.MergeSummaries(convID, merged, latest.SummarizedUpToMessageID, ids, deleteSources)
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateActiveSummaryCache(convID)
+	return summary, nil
+}
+
+// MergeSummariesHandler merges selected summaries of a conversation into a single new summary
+func (ch *ChatHandlers) MergeSummariesHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Merge summaries request from user: %s for conversation: %s", username, convID)
+
+	var req MergeSummariesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Model != "" && !config.IsValidModel(req.Model) {
+		http.Error(w, "Invalid model specified", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	provider := ch.getSummarizer(req.Provider)
+	summary, err := MergeSummaries(r.Context(), reqLog, provider, selectSummarizationModel(reqLog, req.Model), convID, user.ID, req.SummaryIDs, req.DeleteSources)
+	if errors.Is(err, errInvalidSummarySelection) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error merging summaries: %v", err)
+		http.Error(w, "Error merging summaries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newSummaryData(summary))
+}
+
+// enforceSummaryLength keeps a generated summary within the configured maximum length. An overlong
+// summary is regenerated once with the limit stated in the prompt; if that still doesn't fit, it is
+// truncated at the last sentence boundary.
+func enforceSummaryLength(ctx context.Context, reqLog *log.Logger, provider llm.Summarizer, messages []llm.Message, prompt, model string, temperature *float64, summary string) string {
+	maxLen := config.GetMaxSummaryLength()
+	if maxLen <= 0 || len([]rune(summary)) <= maxLen {
+		return summary
+	}
+
+	reqLog.Printf("[SUMMARIZE] Summary length %d exceeds limit %d, retrying with length constraint", len([]rune(summary)), maxLen)
+	constrainedPrompt := fmt.Sprintf("%s\n\nKeep your summary under %d characters.", prompt, maxLen)
+	if retried, err := provider.ChatForSummarization(ctx, messages, constrainedPrompt, model, temperature); err != nil {
+		reqLog.Printf("[SUMMARIZE] Warning: length-constrained retry failed: %v", err)
+	} else if len([]rune(retried)) <= maxLen {
+		return retried
+	} else {
+		summary = retried
+	}
+
+	reqLog.Printf("[SUMMARIZE] Summary still exceeds limit %d, truncating at sentence boundary", maxLen)
+	return truncateAtSentence(summary, maxLen)
+}
+
+// truncateAtSentence shortens text to at most maxLen characters, cutting after the last '.', '!'
+// or '?' within the limit, or at the limit itself if there is no sentence end
+func truncateAtSentence(text string, maxLen int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLen {
+		return text
+	}
+
+	head := string(runes[:maxLen])
+	if end := strings.LastIndexAny(head, ".!?"); end >= 0 {
+		return head[:end+1]
+	}
+	return head
+}
+
+// GetActiveSummaryHandler returns the conversation's current active summary, or 204 if there is none
+func (ch *ChatHandlers) GetActiveSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	summary, err := getActiveSummaryCached(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting active summary: %v", err)
+		http.Error(w, "Error retrieving summary", http.StatusInternalServerError)
+		return
+	}
+	if summary == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSummaryData(summary))
+}
+
+// DeleteSummaryHandler deletes one summary of a conversation. Deleting the active summary clears the
+// conversation's reference to it, so the next chat request uses the full history again.
+func (ch *ChatHandlers) DeleteSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	summaryID := r.PathValue("summaryId")
+	reqLog.Printf("Delete summary request from user: %s for conversation: %s (summary %s)", username, convID, summaryID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIES] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	// Verify user owns this conversation
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Verify the summary belongs to the conversation in the URL
+	summary, err := db.GetSummary(summaryID)
+	if err != nil || summary.ConversationID != convID {
+		http.Error(w, "Summary not found", http.StatusNotFound)
+		return
+	}
+
+	// The foreign key clears active_summary_id when the active summary is deleted
+	if err := db.DeleteSummaries(convID, []string{summaryID}); err != nil {
+		reqLog.Printf("[SUMMARIES] Error deleting summary: %v", err)
+		http.Error(w, "Error deleting summary", http.StatusInternalServerError)
+		return
+	}
+	invalidateActiveSummaryCache(convID)
+
+	if conversation.ActiveSummaryID != nil && *conversation.ActiveSummaryID == summaryID {
+		reqLog.Printf("[SUMMARIES] Deleted active summary %s, conversation %s falls back to full history", summaryID, convID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Data prefixes of the summarization stream frames
+const (
+	summaryProgressPrefix = "PROGRESS:"
+	summaryChunkPrefix    = "SUMMARY_CHUNK:"
+	summaryCompletePrefix = "SUMMARY_COMPLETE:"
+	summaryPrefix         = "SUMMARY:"
+	summaryErrorPrefix    = "SUMMARY_ERROR:"
+
+	// summaryDoneFrame is the data of the frame that ends a successful summarization stream
+	summaryDoneFrame = "[DONE]"
+)
+
+// SummaryStreamEvent is an update sent by SummarizeConversationStream. Exactly one field is set.
+type SummaryStreamEvent struct {
+	Progress string                  // What the summarization is doing, e.g. "Summarizing 12 messages"
+	Chunk    string                  // Next piece of the summary text as it is generated
+	Summary  *db.ConversationSummary // The stored active summary, sent last on success
+	Err      error                   // What ended the summarization, sent last on failure
+}
+
+// SummarizeConversationStream summarizes a conversation like SummarizeConversationHandler but streams
+// progress and the summary text as it is generated by ChatForSummarizationStream. The summary is only
+// stored once the stream has completed and is then sent as the last event. An active summary that is
+// not due for renewal is sent as is. Errors collecting the messages are returned; later errors are
+// sent as the last event. Cancelling ctx ends the stream without storing the summary.
+func SummarizeConversationStream(ctx context.Context, reqLog *log.Logger, provider llm.Summarizer, convID, model string, temperature *float64) (<-chan SummaryStreamEvent, error) {
+	input, err := prepareSummarization(reqLog, convID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan SummaryStreamEvent)
+	go func() {
+		defer close(events)
+
+		if input.current != nil {
+			events <- SummaryStreamEvent{Progress: "Active summary is up to date"}
+			events <- SummaryStreamEvent{Summary: input.current}
+			return
+		}
+
+		events <- SummaryStreamEvent{Progress: fmt.Sprintf("Summarizing %d messages", len(input.messages))}
+		reqLog.Printf("[SUMMARIZE] Streaming summary of %d messages with provider %T", len(input.messages), provider)
+
+		chunks, err := provider.ChatForSummarizationStream(ctx, input.messages, getSummarizationPrompt(), model, temperature)
+		if err != nil {
+			events <- SummaryStreamEvent{Err: err}
+			return
+		}
+
+		var summary strings.Builder
+		for chunk := range chunks {
+			if chunk.Content == "" {
+				continue
+			}
+			summary.WriteString(chunk.Content)
+			events <- SummaryStreamEvent{Chunk: chunk.Content}
+		}
+
+		// The client went away: discard the incomplete summary
+		if err := ctx.Err(); err != nil {
+			reqLog.Printf("[SUMMARIZE] Warning: client disconnected mid-stream, summary not saved: %v", err)
+			return
+		}
+
+		if summary.Len() == 0 {
+			events <- SummaryStreamEvent{Err: errors.New("stream ended without summary content")}
+			return
+		}
+
+		// Streamed text cannot be regenerated, so an overlong summary is only truncated
+		summaryContent := summary.String()
+		if maxLen := config.GetMaxSummaryLength(); maxLen > 0 {
+			summaryContent = truncateAtSentence(summaryContent, maxLen)
+		}
+
+		events <- SummaryStreamEvent{Progress: "Saving summary"}
+		saved, err := saveSummary(provider, convID, summaryContent, input.lastMessageID)
+		if err != nil {
+			events <- SummaryStreamEvent{Err: fmt.Errorf("error saving summary: %w", err)}
+			return
+		}
+		events <- SummaryStreamEvent{Summary: saved}
+	}()
+
+	return events, nil
+}
+
+// sendSummaryFrame writes a "data: <prefix><text>" frame with newlines escaped and flushes it
+func sendSummaryFrame(w http.ResponseWriter, flusher http.Flusher, prefix, text string) {
+	fmt.Fprintf(w, "data: %s%s\n\n", prefix, strings.ReplaceAll(text, "\n", "\\n"))
+	flusher.Flush()
+}
+
+// SummarizeConversationStreamHandler streams a conversation summary as SSE frames: PROGRESS:<text> while
+// it is prepared and saved, SUMMARY_CHUNK:<text> as it is generated, then SUMMARY_COMPLETE:<full text>
+// and SUMMARY:<summary JSON> once it is stored, followed by [DONE]. Failures end the stream with
+// SUMMARY_ERROR:<message> instead.
+func (ch *ChatHandlers) SummarizeConversationStreamHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Streaming summarize request from user: %s for conversation: %s", username, convID)
+
+	var req SummarizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Empty body is acceptable, use defaults
+		req = SummarizeRequest{}
+	}
+
+	if req.Model != "" && !config.IsValidModel(req.Model) {
+		http.Error(w, "Invalid model specified", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[SUMMARIZE] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	model := selectSummarizationModel(reqLog, req.Model)
+	events, err := SummarizeConversationStream(r.Context(), reqLog, ch.getSummarizer(req.Provider), convID, model, req.Temperature)
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for event := range events {
+		switch {
+		case event.Err != nil:
+			reqLog.Printf("[SUMMARIZE] Error streaming summary: %v", event.Err)
+			sendSummaryFrame(w, flusher, summaryErrorPrefix, "summarization failed")
+		case event.Summary != nil:
+			data, err := json.Marshal(newSummaryData(event.Summary))
+			if err != nil {
+				reqLog.Printf("[SUMMARIZE] Error encoding summary: %v", err)
+				sendSummaryFrame(w, flusher, summaryErrorPrefix, "summarization failed")
+				continue
+			}
+			sendSummaryFrame(w, flusher, summaryCompletePrefix, event.Summary.SummaryContent)
+			sendSummaryFrame(w, flusher, summaryPrefix, string(data))
+			sendSummaryFrame(w, flusher, "", summaryDoneFrame)
+		case event.Chunk != "":
+			sendSummaryFrame(w, flusher, summaryChunkPrefix, event.Chunk)
+		default:
+			sendSummaryFrame(w, flusher, summaryProgressPrefix, event.Progress)
+		}
+	}
+}
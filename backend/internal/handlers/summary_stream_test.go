@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/testutil"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSummarizeConversationStreamHandler(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		otherID   = "22222222-2222-2222-2222-222222222222"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+		summaryID = "99999999-9999-9999-9999-999999999999"
+	)
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectMessages := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectNoActiveSummary(mock, convID)
+		testutil.ExpectHistory(mock, convID, "hi", "hello")
+		mock.ExpectQuery(`SELECT id\s+FROM messages`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+	}
+
+	tests := []struct {
+		name       string
+		provider   *stubProvider
+		maxLength  string // MAX_SUMMARY_LENGTH, the default when empty
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantFrames []string
+		wantStored string // content of the SUMMARY frame, empty when none is sent
+	}{
+		{
+			name:     "streamed and stored",
+			provider: &stubProvider{chunks: []string{"Part one. ", "Part two."}},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+				testutil.ExpectSummarySaved(mock, convID, "Part one. Part two.", lastMsgID)
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				"SUMMARY_CHUNK:Part one. ",
+				"SUMMARY_CHUNK:Part two.",
+				"PROGRESS:Saving summary",
+				"SUMMARY_COMPLETE:Part one. Part two.",
+				"SUMMARY:",
+				"[DONE]",
+			},
+			wantStored: "Part one. Part two.",
+		},
+		{
+			name:     "newlines escaped",
+			provider: &stubProvider{chunks: []string{"Line one.\n", "Line two."}},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+				testutil.ExpectSummarySaved(mock, convID, "Line one.\nLine two.", lastMsgID)
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				`SUMMARY_CHUNK:Line one.\n`,
+				"SUMMARY_CHUNK:Line two.",
+				"PROGRESS:Saving summary",
+				`SUMMARY_COMPLETE:Line one.\nLine two.`,
+				"SUMMARY:",
+				"[DONE]",
+			},
+			wantStored: "Line one.\nLine two.",
+		},
+		{
+			name:      "overlong summary truncated at a sentence",
+			provider:  &stubProvider{chunks: []string{"First sentence. ", "Second sentence that is too long."}},
+			maxLength: "20",
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+				testutil.ExpectSummarySaved(mock, convID, "First sentence.", lastMsgID)
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				"SUMMARY_CHUNK:First sentence. ",
+				"SUMMARY_CHUNK:Second sentence that is too long.",
+				"PROGRESS:Saving summary",
+				"SUMMARY_COMPLETE:First sentence.",
+				"SUMMARY:",
+				"[DONE]",
+			},
+			wantStored: "First sentence.",
+		},
+		{
+			name:     "empty stream",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				"SUMMARY_ERROR:summarization failed",
+			},
+		},
+		{
+			name:     "summary not saved",
+			provider: &stubProvider{chunks: []string{"Summary."}},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO conversation_summaries`).WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				"SUMMARY_CHUNK:Summary.",
+				"PROGRESS:Saving summary",
+				"SUMMARY_ERROR:summarization failed",
+			},
+		},
+		{
+			name:     "active summary up to date",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id`).
+					WithArgs(convID).
+					WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, convID, "Current.", lastMsgID, 0, time.Now()))
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Active summary is up to date",
+				"SUMMARY_COMPLETE:Current.",
+				"SUMMARY:",
+				"[DONE]",
+			},
+			wantStored: "Current.",
+		},
+		{
+			name:     "provider error",
+			provider: &stubProvider{err: errors.New("upstream unavailable")},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectMessages(mock)
+			},
+			wantStatus: http.StatusOK,
+			wantFrames: []string{
+				"PROGRESS:Summarizing 2 messages",
+				"SUMMARY_ERROR:summarization failed",
+			},
+		},
+		{
+			name:     "another user's conversation",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "missing conversation",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_SUMMARY_LENGTH", cmp.Or(tt.maxLength, "2000"))
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+			t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize/stream", nil, "alice",
+				map[string]string{"id": convID})
+			(&ChatHandlers{fallbackProvider: tt.provider}).SummarizeConversationStreamHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantFrames == nil {
+				return
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want it left to the CORS middleware", got)
+			}
+
+			var data []string
+			var stored SummaryData
+			for _, frame := range parseSSE(w.Body.String()) {
+				if summary, ok := strings.CutPrefix(frame.data, summaryPrefix); ok {
+					if err := json.Unmarshal([]byte(summary), &stored); err != nil {
+						t.Fatalf("SUMMARY frame is not valid JSON: %v (%q)", err, summary)
+					}
+					data = append(data, summaryPrefix)
+					continue
+				}
+				data = append(data, frame.data)
+			}
+			if !slices.Equal(data, tt.wantFrames) {
+				t.Fatalf("frames = %q, want %q", data, tt.wantFrames)
+			}
+			if stored.SummaryContent != tt.wantStored {
+				t.Errorf("stored summary = %q, want %q", stored.SummaryContent, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestSummarizeConversationStreamHandlerInvalidModel(t *testing.T) {
+	const convID = "33333333-3333-3333-3333-333333333333"
+	setTestModels(t, []config.Model{{ID: "vendor/a"}})
+	mock := testutil.NewMockDB(t)
+
+	provider := &stubProvider{}
+	w := httptest.NewRecorder()
+	r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize/stream", strings.NewReader(`{"model":"vendor/unknown"}`),
+		"alice", map[string]string{"id": convID})
+	(&ChatHandlers{fallbackProvider: provider}).SummarizeConversationStreamHandler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("provider called %d times, want 0", provider.calls)
+	}
+}
+
+func TestSummarizeConversationStreamHandlerClientGone(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+	)
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	testutil.ExpectNoActiveSummary(mock, convID)
+	testutil.ExpectHistory(mock, convID, "hi", "hello")
+	mock.ExpectQuery(`SELECT id\s+FROM messages`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+
+	// The client disconnects while the summary is streamed, so it is not stored
+	provider := &stubProvider{chunks: []string{"Partial."}}
+	r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize/stream", nil, "alice",
+		map[string]string{"id": convID})
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	w := httptest.NewRecorder()
+	(&ChatHandlers{fallbackProvider: provider}).SummarizeConversationStreamHandler(w, r.WithContext(ctx))
+
+	var data []string
+	for _, frame := range parseSSE(w.Body.String()) {
+		data = append(data, frame.data)
+	}
+	if want := []string{"PROGRESS:Summarizing 2 messages", "SUMMARY_CHUNK:Partial."}; !slices.Equal(data, want) {
+		t.Errorf("frames = %q, want %q", data, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
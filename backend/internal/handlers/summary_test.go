@@ -0,0 +1,930 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+var activeSummaryColumns = []string{"id", "conversation_id", "summary_content", "summarized_up_to_message_id", "usage_count", "created_at"}
+
+func TestPrepareSummarizationUsageThreshold(t *testing.T) {
+	const (
+		convID    = "33333333-3333-3333-3333-333333333333"
+		summaryID = "99999999-9999-9999-9999-999999999999"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+	)
+
+	tests := []struct {
+		threshold  string
+		usageCount int
+		wantRenew  bool
+	}{
+		{threshold: "2", usageCount: 1, wantRenew: false},
+		{threshold: "2", usageCount: 2, wantRenew: true},
+		{threshold: "2", usageCount: 3, wantRenew: true},
+		{threshold: "5", usageCount: 4, wantRenew: false},
+		{threshold: "5", usageCount: 5, wantRenew: true},
+		{threshold: "1", usageCount: 0, wantRenew: false},
+		{threshold: "1", usageCount: 1, wantRenew: true},
+		// Thresholds below 1 are raised to 1
+		{threshold: "0", usageCount: 0, wantRenew: false},
+		{threshold: "0", usageCount: 1, wantRenew: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("threshold "+tt.threshold+" used "+strconv.Itoa(tt.usageCount), func(t *testing.T) {
+			t.Setenv("SUMMARY_USAGE_THRESHOLD", tt.threshold)
+			mock := testutil.NewMockDB(t)
+			mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id\s+WHERE c.id = \$1`).
+				WithArgs(convID).
+				WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, convID, "summary", nil, tt.usageCount, time.Now()))
+			if tt.wantRenew {
+				mock.ExpectQuery(`SELECT id\s+FROM messages`).
+					WithArgs(convID).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+			}
+
+			input, err := prepareSummarization(log.Default(), convID)
+			if err != nil {
+				t.Fatalf("prepareSummarization: %v", err)
+			}
+			if renewed := input.current == nil; renewed != tt.wantRenew {
+				t.Fatalf("renewed = %v, want %v", renewed, tt.wantRenew)
+			}
+			if tt.wantRenew && (input.lastMessageID == nil || *input.lastMessageID != lastMsgID) {
+				t.Errorf("lastMessageID = %v, want %s", input.lastMessageID, lastMsgID)
+			}
+		})
+	}
+}
+
+func TestDeleteSummaryHandler(t *testing.T) {
+	const (
+		userID          = "11111111-1111-1111-1111-111111111111"
+		otherID         = "22222222-2222-2222-2222-222222222222"
+		convID          = "33333333-3333-3333-3333-333333333333"
+		otherConvID     = "55555555-5555-5555-5555-555555555555"
+		summaryID       = "99999999-9999-9999-9999-999999999999"
+		activeSummaryID = "88888888-8888-8888-8888-888888888888"
+	)
+
+	expectSummary := func(mock sqlmock.Sqlmock, summaryConvID string) {
+		mock.ExpectQuery(`FROM conversation_summaries\s+WHERE id = \$1`).
+			WithArgs(summaryID).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, summaryConvID, "summary", nil, 0, time.Now()))
+	}
+	expectDelete := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(`DELETE FROM conversation_summaries WHERE conversation_id = \$1 AND id = ANY\(\$2\)`).
+			WithArgs(convID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	tests := []struct {
+		name           string
+		setup          func(mock sqlmock.Sqlmock)
+		wantStatus     int
+		wantInvalidate bool
+	}{
+		{
+			name: "active summary",
+			setup: func(mock sqlmock.Sqlmock) {
+				active := summaryID
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, ActiveSummaryID: &active})
+				expectSummary(mock, convID)
+				expectDelete(mock)
+			},
+			wantStatus:     http.StatusNoContent,
+			wantInvalidate: true,
+		},
+		{
+			name: "non-active summary",
+			setup: func(mock sqlmock.Sqlmock) {
+				active := activeSummaryID
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, ActiveSummaryID: &active})
+				expectSummary(mock, convID)
+				expectDelete(mock)
+			},
+			wantStatus:     http.StatusNoContent,
+			wantInvalidate: true,
+		},
+		{
+			name: "another user's conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "summary of another conversation",
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				expectSummary(mock, otherConvID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+			activeSummaryCache.Store(convID, cachedSummary{expiresAt: time.Now().Add(time.Minute)})
+			t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodDelete, "/api/conversations/"+convID+"/summaries/"+summaryID, nil, "alice",
+				map[string]string{"id": convID, "summaryId": summaryID})
+			(&ChatHandlers{}).DeleteSummaryHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if _, cached := activeSummaryCache.Load(convID); cached == tt.wantInvalidate {
+				t.Errorf("active summary cached = %v after the request, want %v", cached, !tt.wantInvalidate)
+			}
+		})
+	}
+}
+
+func TestSummarizeConversationHandler(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		otherID   = "22222222-2222-2222-2222-222222222222"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+		prevMsgID = "55555555-5555-5555-5555-555555555555"
+		summaryID = "99999999-9999-9999-9999-999999999999"
+	)
+	history := []string{"q1", "a1", "q2", "a2", "q3", "a3", "q4", "a4", "q5", "a5"}
+
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectActiveSummary := func(mock sqlmock.Sqlmock, usageCount int) {
+		mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id\s+WHERE c.id = \$1`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, convID, "Old summary.", prevMsgID, usageCount, time.Now()))
+	}
+	expectLastMessage := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`SELECT id\s+FROM messages\s+WHERE conversation_id = \$1`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+	}
+
+	tests := []struct {
+		name         string
+		provider     *stubProvider
+		setup        func(mock sqlmock.Sqlmock)
+		wantStatus   int
+		wantSummary  string
+		wantUpTo     string
+		wantMessages int // messages sent to the LLM, 0 when it is not called
+	}{
+		{
+			name:     "first summary",
+			provider: &stubProvider{response: "New summary."},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectNoActiveSummary(mock, convID)
+				testutil.ExpectHistory(mock, convID, history...)
+				expectLastMessage(mock)
+				testutil.ExpectSummarySaved(mock, convID, "New summary.", lastMsgID)
+			},
+			wantStatus:   http.StatusOK,
+			wantSummary:  "New summary.",
+			wantUpTo:     lastMsgID,
+			wantMessages: len(history),
+		},
+		{
+			name:     "active summary not yet due",
+			provider: &stubProvider{response: "New summary."},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectActiveSummary(mock, 0)
+			},
+			wantStatus:  http.StatusOK,
+			wantSummary: "Old summary.",
+			wantUpTo:    prevMsgID,
+		},
+		{
+			name:     "active summary renewed",
+			provider: &stubProvider{response: "Renewed summary."},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectActiveSummary(mock, 2)
+				mock.ExpectQuery(`SELECT role, content\s+FROM messages\s+WHERE conversation_id = \$1 .* created_at > \(`).
+					WithArgs(convID, prevMsgID).
+					WillReturnRows(sqlmock.NewRows([]string{"role", "content"}).AddRow("user", "q6").AddRow("assistant", "a6"))
+				expectLastMessage(mock)
+				testutil.ExpectSummarySaved(mock, convID, "Renewed summary.", lastMsgID)
+			},
+			wantStatus:   http.StatusOK,
+			wantSummary:  "Renewed summary.",
+			wantUpTo:     lastMsgID,
+			wantMessages: 3,
+		},
+		{
+			name:     "provider error",
+			provider: &stubProvider{err: errors.New("upstream unavailable")},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectNoActiveSummary(mock, convID)
+				testutil.ExpectHistory(mock, convID, history...)
+				expectLastMessage(mock)
+			},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessages: len(history),
+		},
+		{
+			name:     "summary not saved",
+			provider: &stubProvider{response: "New summary."},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				testutil.ExpectNoActiveSummary(mock, convID)
+				testutil.ExpectHistory(mock, convID, history...)
+				expectLastMessage(mock)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO conversation_summaries`).WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+				mock.ExpectExec(`UPDATE conversations SET active_summary_id`).WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+			},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessages: len(history),
+		},
+		{
+			name:     "another user's conversation",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:     "missing conversation",
+			provider: &stubProvider{},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SUMMARY_USAGE_THRESHOLD", "2")
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+			activeSummaryCache.Store(convID, cachedSummary{expiresAt: time.Now().Add(time.Minute)})
+			t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize", nil, "alice",
+				map[string]string{"id": convID})
+			(&ChatHandlers{fallbackProvider: tt.provider}).SummarizeConversationHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if len(tt.provider.messages) != tt.wantMessages {
+				t.Errorf("messages sent to the LLM = %d, want %d", len(tt.provider.messages), tt.wantMessages)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp SummarizeResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.Summary != tt.wantSummary || resp.SummarizedUpToMsgID != tt.wantUpTo || resp.ConversationID != convID {
+				t.Errorf("response = %+v, want summary %q up to %s", resp, tt.wantSummary, tt.wantUpTo)
+			}
+			// A stored summary replaces the cached active summary
+			if _, cached := activeSummaryCache.Load(convID); cached != (tt.wantUpTo == prevMsgID) {
+				t.Errorf("active summary cached = %v after the request", cached)
+			}
+		})
+	}
+}
+
+func TestGetSummaryDiff(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		otherID     = "22222222-2222-2222-2222-222222222222"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "55555555-5555-5555-5555-555555555555"
+		oldID       = "88888888-8888-8888-8888-888888888888"
+		newID       = "99999999-9999-9999-9999-999999999999"
+	)
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now()
+
+	expectSummary := func(mock sqlmock.Sqlmock, id, summaryConvID, content, upTo string, createdAt time.Time) {
+		mock.ExpectQuery(`FROM conversation_summaries\s+WHERE id = \$1`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(id, summaryConvID, content, upTo, 0, createdAt))
+	}
+
+	tests := []struct {
+		name        string
+		oldID       string
+		setup       func(mock sqlmock.Sqlmock)
+		wantErr     bool
+		wantDelta   int
+		wantOldText string
+	}{
+		{
+			name:  "messages between the cut-offs",
+			oldID: oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectSummary(mock, newID, convID, "New.", "m4", newer)
+				expectSummary(mock, oldID, convID, "Old.", "m2", older)
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL AND partial IS NOT TRUE`).
+					WithArgs(convID, "m2", "m4").
+					WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).
+						AddRow(testutil.MessageRow("m3", convID, "user", "q")...).
+						AddRow(testutil.MessageRow("m4", convID, "assistant", "a")...))
+			},
+			wantDelta:   2,
+			wantOldText: "Old.",
+		},
+		{
+			name:  "same summary",
+			oldID: newID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectSummary(mock, newID, convID, "New.", "m4", newer)
+				expectSummary(mock, newID, convID, "New.", "m4", newer)
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			},
+			wantOldText: "New.",
+		},
+		{
+			name:  "summaries of different conversations",
+			oldID: oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectSummary(mock, newID, convID, "New.", "m4", newer)
+				expectSummary(mock, oldID, otherConvID, "Old.", "m2", older)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "another user's conversation",
+			oldID: oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectSummary(mock, newID, convID, "New.", "m4", newer)
+				expectSummary(mock, oldID, convID, "Old.", "m2", older)
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantErr: true,
+		},
+		{
+			name:  "compared summary is newer",
+			oldID: oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectSummary(mock, newID, convID, "New.", "m4", older)
+				expectSummary(mock, oldID, convID, "Old.", "m2", newer)
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			tt.setup(mock)
+
+			diff, err := GetSummaryDiff(tt.oldID, newID, userID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("GetSummaryDiff() = %+v, want an error", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetSummaryDiff() error = %v", err)
+			}
+			if diff.MessagesDelta != tt.wantDelta || len(diff.NewMessages) != tt.wantDelta {
+				t.Errorf("delta = %d with %d messages, want %d", diff.MessagesDelta, len(diff.NewMessages), tt.wantDelta)
+			}
+			if diff.OldSummary != tt.wantOldText || diff.NewSummary != "New." {
+				t.Errorf("summaries = %q -> %q, want %q -> %q", diff.OldSummary, diff.NewSummary, tt.wantOldText, "New.")
+			}
+		})
+	}
+}
+
+func TestGetSummaryDiffHandler(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		otherID     = "22222222-2222-2222-2222-222222222222"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "55555555-5555-5555-5555-555555555555"
+		oldID       = "88888888-8888-8888-8888-888888888888"
+		newID       = "99999999-9999-9999-9999-999999999999"
+	)
+
+	tests := []struct {
+		name       string
+		query      string
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+	}{
+		{name: "missing compare_to", wantStatus: http.StatusBadRequest},
+		{
+			name:  "another user's conversation",
+			query: "?compare_to=" + oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:  "summary of another conversation",
+			query: "?compare_to=" + oldID,
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectUser(mock, userID, "alice")
+				testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+				mock.ExpectQuery(`FROM conversation_summaries\s+WHERE id = \$1`).
+					WithArgs(newID).
+					WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(newID, otherConvID, "New.", nil, 0, time.Now()))
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodGet, "/api/conversations/"+convID+"/summaries/"+newID+"/diff"+tt.query, nil, "alice",
+				map[string]string{"id": convID, "summaryId": newID})
+			(&ChatHandlers{}).GetSummaryDiffHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSelectSummarizationModel(t *testing.T) {
+	setTestModels(t, []config.Model{
+		{ID: "vendor/large", InputPricePerMToken: 3},
+		{ID: "vendor/small", InputPricePerMToken: 0.1},
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		requested  string
+		want       string
+	}{
+		{name: "requested model wins", configured: "auto", requested: "vendor/large", want: "vendor/large"},
+		{name: "configured model", configured: "vendor/large", want: "vendor/large"},
+		{name: "auto picks the cheapest model", configured: "auto", want: "vendor/small"},
+		{name: "unset uses the provider default", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SUMMARIZATION_MODEL", tt.configured)
+			if got := selectSummarizationModel(log.Default(), tt.requested); got != tt.want {
+				t.Errorf("selectSummarizationModel(%q) = %q, want %q", tt.requested, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("auto without priced models", func(t *testing.T) {
+		t.Setenv("SUMMARIZATION_MODEL", "auto")
+		config.SetModels([]config.Model{{ID: "vendor/unpriced", Tier: "paid"}})
+		if got := selectSummarizationModel(log.Default(), ""); got != "" {
+			t.Errorf("selectSummarizationModel() = %q, want the provider default", got)
+		}
+	})
+}
+
+func TestSummarizeConversationHandlerUsesSummarizationModel(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+	)
+	setTestModels(t, []config.Model{
+		{ID: "vendor/large", InputPricePerMToken: 3},
+		{ID: "vendor/small", InputPricePerMToken: 0.1},
+	})
+	t.Setenv("SUMMARIZATION_MODEL", "auto")
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	testutil.ExpectNoActiveSummary(mock, convID)
+	testutil.ExpectHistory(mock, convID, "q1", "a1")
+	mock.ExpectQuery(`SELECT id\s+FROM messages\s+WHERE conversation_id = \$1`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+	testutil.ExpectSummarySaved(mock, convID, "Summary.", lastMsgID)
+	t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+	provider := &stubProvider{response: "Summary."}
+	w := httptest.NewRecorder()
+	r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize", nil, "alice", map[string]string{"id": convID})
+	(&ChatHandlers{fallbackProvider: provider}).SummarizeConversationHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if provider.model != "vendor/small" {
+		t.Errorf("summarization model = %q, want the cheapest model vendor/small", provider.model)
+	}
+}
+
+func TestGetActiveSummaryCached(t *testing.T) {
+	const (
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+	)
+	expectActive := func(mock sqlmock.Sqlmock, id, content string) {
+		mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id\s+WHERE c.id = \$1`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(id, convID, content, lastMsgID, 0, time.Now()))
+	}
+	setup := func(t *testing.T) sqlmock.Sqlmock {
+		mock := testutil.NewMockDB(t)
+		t.Setenv("QUERY_CACHE_ENABLED", "true")
+		t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+		return mock
+	}
+
+	t.Run("cache hit", func(t *testing.T) {
+		mock := setup(t)
+		expectActive(mock, "s1", "First.")
+
+		for range 2 {
+			summary, err := getActiveSummaryCached(convID)
+			if err != nil || summary == nil || summary.ID != "s1" {
+				t.Fatalf("getActiveSummaryCached() = %+v, %v, want s1", summary, err)
+			}
+		}
+		// The second lookup is served from the cache: only one query was expected
+	})
+
+	t.Run("missing summary cached", func(t *testing.T) {
+		mock := setup(t)
+		testutil.ExpectNoActiveSummary(mock, convID)
+
+		for range 2 {
+			if summary, err := getActiveSummaryCached(convID); err != nil || summary != nil {
+				t.Fatalf("getActiveSummaryCached() = %+v, %v, want no summary", summary, err)
+			}
+		}
+	})
+
+	t.Run("invalidated by a new summary", func(t *testing.T) {
+		mock := setup(t)
+		expectActive(mock, "s1", "First.")
+		expectActive(mock, "s2", "Second.")
+
+		if summary, _ := getActiveSummaryCached(convID); summary == nil || summary.ID != "s1" {
+			t.Fatalf("first lookup = %+v, want s1", summary)
+		}
+		invalidateActiveSummaryCache(convID)
+		if summary, _ := getActiveSummaryCached(convID); summary == nil || summary.ID != "s2" {
+			t.Fatalf("lookup after invalidation = %+v, want s2", summary)
+		}
+	})
+
+	t.Run("expired entry", func(t *testing.T) {
+		mock := setup(t)
+		activeSummaryCache.Store(convID, cachedSummary{expiresAt: time.Now().Add(-time.Second)})
+		expectActive(mock, "s2", "Second.")
+
+		if summary, _ := getActiveSummaryCached(convID); summary == nil || summary.ID != "s2" {
+			t.Fatalf("getActiveSummaryCached() = %+v, want s2 from the database", summary)
+		}
+	})
+}
+
+func TestGetActiveSummaryHandler(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+		summaryID = "99999999-9999-9999-9999-999999999999"
+	)
+	handler := (&ChatHandlers{}).GetActiveSummaryHandler
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/summaries/active"
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodGet, path, "", pathValues)
+	})
+
+	t.Run("no active summary", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		testutil.ExpectNoActiveSummary(mock, convID)
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+			t.Fatalf("status = %d with body %q, want %d and no body", w.Code, w.Body.String(), http.StatusNoContent)
+		}
+	})
+
+	t.Run("active summary", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(summaryID, convID, "Trip planning.", lastMsgID, 3, time.Now()))
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp SummaryData
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if resp.ID != summaryID || resp.SummaryContent != "Trip planning." || resp.SummarizedUpToMessageID != lastMsgID || resp.UsageCount != 3 {
+			t.Errorf("summary = %+v, want the active summary", resp)
+		}
+	})
+}
+
+func TestTruncateAtSentence(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+		want   string
+	}{
+		{name: "empty", text: "", maxLen: 10, want: ""},
+		{name: "within limit", text: "Short. Text", maxLen: 20, want: "Short. Text"},
+		{name: "exactly the limit", text: "Ten chars.", maxLen: 10, want: "Ten chars."},
+		{name: "last period before the limit", text: "One. Two. Three four five.", maxLen: 12, want: "One. Two."},
+		{name: "exclamation mark", text: "Wow! Then more text here.", maxLen: 10, want: "Wow!"},
+		{name: "question mark", text: "Why? Because. And then", maxLen: 18, want: "Why? Because."},
+		{name: "sentence end at the limit", text: "First. Second", maxLen: 6, want: "First."},
+		{name: "no sentence end", text: "no punctuation at all", maxLen: 8, want: "no punct"},
+		{name: "multibyte characters", text: "Привет. Как дела?", maxLen: 10, want: "Привет."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateAtSentence(tt.text, tt.maxLen); got != tt.want {
+				t.Errorf("truncateAtSentence(%q, %d) = %q, want %q", tt.text, tt.maxLen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceSummaryLength(t *testing.T) {
+	const prompt = "Summarize the conversation."
+	long := "A first sentence. A second sentence that runs past the limit."
+
+	tests := []struct {
+		name      string
+		maxLen    string
+		summary   string
+		provider  *stubProvider
+		want      string
+		wantRetry bool
+	}{
+		{name: "within limit", maxLen: "100", summary: long, provider: &stubProvider{}, want: long},
+		{name: "limit disabled", maxLen: "0", summary: long, provider: &stubProvider{}, want: long},
+		{name: "retry fits", maxLen: "20", summary: long, provider: &stubProvider{response: "Short summary."}, want: "Short summary.", wantRetry: true},
+		{
+			name: "retry still too long", maxLen: "20", summary: long,
+			provider: &stubProvider{response: "Still long. Far too long for the limit."}, want: "Still long.", wantRetry: true,
+		},
+		{name: "retry fails", maxLen: "20", summary: long, provider: &stubProvider{err: errors.New("upstream unavailable")}, want: "A first sentence.", wantRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_SUMMARY_LENGTH", tt.maxLen)
+			messages := []llm.Message{{Role: "user", Content: "hi"}}
+
+			got := enforceSummaryLength(context.Background(), log.Default(), tt.provider, messages, prompt, "stub/model", nil, tt.summary)
+
+			if got != tt.want {
+				t.Errorf("enforceSummaryLength() = %q, want %q", got, tt.want)
+			}
+			if retried := tt.provider.calls == 1; retried != tt.wantRetry {
+				t.Fatalf("provider called %d times, want retry = %v", tt.provider.calls, tt.wantRetry)
+			}
+			if tt.wantRetry {
+				if want := prompt + "\n\nKeep your summary under " + tt.maxLen + " characters."; tt.provider.systemPrompt != want {
+					t.Errorf("retry prompt = %q, want %q", tt.provider.systemPrompt, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeSummariesHandler(t *testing.T) {
+	const (
+		userID      = "11111111-1111-1111-1111-111111111111"
+		convID      = "33333333-3333-3333-3333-333333333333"
+		otherConvID = "22222222-2222-2222-2222-222222222222"
+		firstUpTo   = "44444444-4444-4444-4444-444444444444"
+		secondUpTo  = "55555555-5555-5555-5555-555555555555"
+	)
+	handler := (&ChatHandlers{}).MergeSummariesHandler
+	pathValues := map[string]string{"id": convID}
+	path := "/api/conversations/" + convID + "/summaries/merge"
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("ownership", func(t *testing.T) {
+		testConversationOwnership(t, handler, http.MethodPost, path, `{"summary_ids":["s1","s2"]}`, pathValues)
+	})
+
+	// The handler and MergeSummaries both check the conversation
+	expectOwned := func(mock sqlmock.Sqlmock) {
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	}
+	expectSummary := func(mock sqlmock.Sqlmock, id, conversationID, content, upTo string, createdAt time.Time) {
+		mock.ExpectQuery(`FROM conversation_summaries\s+WHERE id = \$1`).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).AddRow(id, conversationID, content, upTo, 0, createdAt))
+	}
+	// expectSources expects s2 then s1 to be looked up, in the request's order, s1 being the older
+	expectSources := func(mock sqlmock.Sqlmock) {
+		expectSummary(mock, "s2", convID, "Second part.", secondUpTo, first.Add(time.Hour))
+		expectSummary(mock, "s1", convID, "First part.", firstUpTo, first)
+	}
+	expectMerged := func(mock sqlmock.Sqlmock, deleteSources bool) {
+		summaryID := &testutil.SameArg{}
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO conversation_summaries`).
+			WithArgs(summaryID, convID, "Merged.", secondUpTo).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+		mock.ExpectExec(`UPDATE conversations SET active_summary_id = \$1 WHERE id = \$2 AND active_summary_id = ANY\(\$3\)`).
+			WithArgs(summaryID, convID, pq.Array([]string{"s1", "s2"})).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		if deleteSources {
+			mock.ExpectExec(`DELETE FROM conversation_summaries WHERE conversation_id = \$1 AND id = ANY\(\$2\)`).
+				WithArgs(convID, pq.Array([]string{"s1", "s2"})).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+		}
+		mock.ExpectCommit()
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		provider   *stubProvider
+		setup      func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "invalid body", body: `{"summary_ids":`, wantStatus: http.StatusBadRequest},
+		{name: "unknown model", body: `{"summary_ids":["s1","s2"],"model":"vendor/unknown"}`, wantStatus: http.StatusBadRequest},
+		{
+			name: "single summary",
+			body: `{"summary_ids":["s1","s1"]}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectSummary(mock, "s1", convID, "First part.", firstUpTo, first)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "summary of another conversation",
+			body: `{"summary_ids":["s1","s2"]}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectSummary(mock, "s1", convID, "First part.", firstUpTo, first)
+				expectSummary(mock, "s2", otherConvID, "Elsewhere.", secondUpTo, first)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "provider error",
+			body:     `{"summary_ids":["s2","s1"]}`,
+			provider: &stubProvider{err: errors.New("upstream unavailable")},
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectSources(mock)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name: "merged",
+			body: `{"summary_ids":["s2","s1","s2"]}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectSources(mock)
+				expectMerged(mock, false)
+			},
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+		},
+		{
+			name: "merged and sources deleted",
+			body: `{"summary_ids":["s2","s1"],"delete_sources":true}`,
+			setup: func(mock sqlmock.Sqlmock) {
+				expectOwned(mock)
+				expectSources(mock)
+				expectMerged(mock, true)
+			},
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestModels(t, []config.Model{{ID: "vendor/large"}})
+			t.Setenv("SUMMARIZATION_MODEL", "")
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+			provider := tt.provider
+			if provider == nil {
+				provider = &stubProvider{response: "Merged."}
+			}
+			t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, path, strings.NewReader(tt.body), "alice", pathValues)
+			(&ChatHandlers{fallbackProvider: provider}).MergeSummariesHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if provider.calls != tt.wantCalls {
+				t.Fatalf("LLM calls = %d, want %d", provider.calls, tt.wantCalls)
+			}
+			if tt.wantCalls == 0 {
+				return
+			}
+
+			// The sources are sent oldest first, whatever order the request named them in
+			want := "Summary 1 of 2 (created 2026-03-01T10:00:00Z):\nFirst part.\n\n" +
+				"Summary 2 of 2 (created 2026-03-01T11:00:00Z):\nSecond part.\n\n"
+			if len(provider.messages) != 1 || provider.messages[0].Content != want {
+				t.Errorf("messages sent to the LLM = %+v, want %q", provider.messages, want)
+			}
+			if provider.systemPrompt != mergeSummariesPrompt {
+				t.Errorf("prompt = %q, want %q", provider.systemPrompt, mergeSummariesPrompt)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp SummaryData
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.SummaryContent != "Merged." || resp.SummarizedUpToMessageID != secondUpTo {
+				t.Errorf("response = %+v, want the merged summary up to %s", resp, secondUpTo)
+			}
+		})
+	}
+}
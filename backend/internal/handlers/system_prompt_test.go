@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"chat-app/internal/context"
+	"chat-app/internal/testutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestChatHandlersSystemPromptLength(t *testing.T) {
+	const convID = "22222222-2222-2222-2222-222222222222"
+	handlers := map[string]func(ch *ChatHandlers) http.HandlerFunc{
+		"ChatHandler":       func(ch *ChatHandlers) http.HandlerFunc { return ch.ChatHandler },
+		"ChatStreamHandler": func(ch *ChatHandlers) http.HandlerFunc { return ch.ChatStreamHandler },
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("MAX_SYSTEM_PROMPT_LENGTH_BYTES", "10")
+			// Rejected before the database or the LLM is reached
+			testutil.NewMockDB(t)
+			provider := &stubProvider{response: "reply"}
+			ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+			// 6 characters but 12 bytes
+			body := `{"message":"hi","conversation_id":"` + convID + `","system_prompt":"éééééé"}`
+			w := httptest.NewRecorder()
+			handler(ch)(w, newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(body), "alice", nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != "system_prompt exceeds maximum length of 10 bytes" {
+				t.Errorf("body = %q, want the limit error", got)
+			}
+			if provider.calls != 0 {
+				t.Errorf("provider called %d times, want 0", provider.calls)
+			}
+		})
+	}
+}
+
+func TestChatStreamHandlerSystemPromptLimitExcludesWarAndPeace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "war_and_peace.txt")
+	if err := os.WriteFile(path, []byte(strings.Repeat("Well, Prince, so Genoa and Lucca are now just family estates. ", 10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.LoadWarAndPeace(path); err != nil {
+		t.Fatal(err)
+	}
+
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	t.Setenv("MAX_SYSTEM_PROMPT_LENGTH_BYTES", "10")
+	t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+	t.Setenv("AUTO_SUMMARIZE_THRESHOLD", "0")
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "hi")
+	testutil.ExpectAddMessage(mock, conv.ID)
+	mock.ExpectExec(`UPDATE messages SET system_prompt_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	provider := &stubProvider{response: "fine"}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	// The user's prompt is at the limit; the appended book is far over it
+	body := `{"message":"hi","conversation_id":"` + conv.ID + `","system_prompt":"Be brief.!","use_war_and_peace":true}`
+	w := httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.HasPrefix(provider.systemPrompt, "Be brief.!") || !strings.Contains(provider.systemPrompt, "Genoa and Lucca") {
+		t.Errorf("system prompt = %q, want the user's prompt followed by War and Peace", provider.systemPrompt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
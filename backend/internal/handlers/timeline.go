@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// TimelineEvent is a single message or summary in a conversation's timeline
+type TimelineEvent struct {
+	Type      string          `json:"type"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type TimelineResponse struct {
+	Events []TimelineEvent `json:"events"`
+}
+
+// GetConversationTimeline merges a conversation's messages and summaries into one list ordered by
+// creation time, showing where each summary was produced relative to the messages around it.
+// The conversation must be owned by the given user.
+func GetConversationTimeline(convID, userID string) ([]TimelineEvent, error) {
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.UserID != userID {
+		return nil, fmt.Errorf("conversation does not belong to user")
+	}
+
+	messages, err := db.GetConversationMessagesWithDetails(convID)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := db.GetAllSummaries(convID)
+	if err != nil {
+		return nil, err
+	}
+
+	type timedEvent struct {
+		at    time.Time
+		event TimelineEvent
+	}
+	timed := make([]timedEvent, 0, len(messages)+len(summaries))
+
+	for i := range messages {
+		data, err := json.Marshal(newMessageData(&messages[i]))
+		if err != nil {
+			return nil, err
+		}
+		timed = append(timed, timedEvent{
+			at:    messages[i].CreatedAt,
+			event: TimelineEvent{Type: "message", CreatedAt: messages[i].CreatedAt.String(), Data: data},
+		})
+	}
+
+	for i := range summaries {
+		data, err := json.Marshal(newSummaryData(&summaries[i]))
+		if err != nil {
+			return nil, err
+		}
+		timed = append(timed, timedEvent{
+			at:    summaries[i].CreatedAt,
+			event: TimelineEvent{Type: "summary", CreatedAt: summaries[i].CreatedAt.String(), Data: data},
+		})
+	}
+
+	// Stable sort keeps messages ahead of a summary created in the same instant
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].at.Before(timed[j].at)
+	})
+
+	events := make([]TimelineEvent, 0, len(timed))
+	for _, t := range timed {
+		events = append(events, t.event)
+	}
+	return events, nil
+}
+
+// GetConversationTimelineHandler returns a conversation's messages and summaries in chronological order
+func (ch *ChatHandlers) GetConversationTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Get timeline request from user: %s for conversation: %s", username, convID)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[TIMELINE] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[TIMELINE] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	events, err := GetConversationTimeline(convID, user.ID)
+	if err != nil {
+		reqLog.Printf("[TIMELINE] Error building timeline: %v", err)
+		http.Error(w, "Error retrieving timeline", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TimelineResponse{Events: events})
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGetConversationTimeline(t *testing.T) {
+	const (
+		userID  = "11111111-1111-1111-1111-111111111111"
+		otherID = "22222222-2222-2222-2222-222222222222"
+		convID  = "33333333-3333-3333-3333-333333333333"
+	)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// messageAt returns the row of a message created at the given offset from start
+	messageAt := func(id, content string, offset time.Duration) []driver.Value {
+		row := testutil.MessageRow(id, convID, "user", content)
+		row[len(row)-1] = start.Add(offset)
+		return row
+	}
+	expectEvents := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM messages\s+WHERE conversation_id = \$1 AND deleted_at IS NULL\s+ORDER BY created_at ASC`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(testutil.MessageColumns).
+				AddRow(messageAt("m1", "q1", 0)...).
+				AddRow(messageAt("m2", "a1", time.Minute)...).
+				AddRow(messageAt("m3", "q2", 3*time.Minute)...).
+				AddRow(messageAt("m4", "a2", 5*time.Minute)...))
+		mock.ExpectQuery(`FROM conversation_summaries\s+WHERE conversation_id = \$1\s+ORDER BY created_at ASC`).
+			WithArgs(convID).
+			WillReturnRows(sqlmock.NewRows(activeSummaryColumns).
+				AddRow("s1", convID, "First exchange.", "m2", 1, start.Add(2*time.Minute)).
+				// Created in the same instant as m4, so it follows the message
+				AddRow("s2", convID, "Both exchanges.", "m4", 0, start.Add(5*time.Minute)))
+	}
+
+	t.Run("summaries between messages", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		expectEvents(mock)
+
+		events, err := GetConversationTimeline(convID, userID)
+		if err != nil {
+			t.Fatalf("GetConversationTimeline() error = %v", err)
+		}
+
+		want := []struct{ typ, id string }{
+			{"message", "m1"}, {"message", "m2"}, {"summary", "s1"}, {"message", "m3"}, {"message", "m4"}, {"summary", "s2"},
+		}
+		if len(events) != len(want) {
+			t.Fatalf("got %d events, want %d", len(events), len(want))
+		}
+		for i, event := range events {
+			var data struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(event.Data, &data); err != nil {
+				t.Fatalf("event %d data %s: %v", i, event.Data, err)
+			}
+			if event.Type != want[i].typ || data.ID != want[i].id {
+				t.Errorf("event %d = %s %s, want %s %s", i, event.Type, data.ID, want[i].typ, want[i].id)
+			}
+			if event.CreatedAt == "" {
+				t.Errorf("event %d has no created_at", i)
+			}
+		}
+
+		var summary SummaryData
+		if err := json.Unmarshal(events[2].Data, &summary); err != nil {
+			t.Fatal(err)
+		}
+		if summary.SummaryContent != "First exchange." || summary.SummarizedUpToMessageID != "m2" {
+			t.Errorf("summary event data = %+v, want s1 up to m2", summary)
+		}
+	})
+
+	t.Run("another user's conversation", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: otherID})
+
+		if events, err := GetConversationTimeline(convID, userID); err == nil {
+			t.Fatalf("GetConversationTimeline() = %d events, want an error", len(events))
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		pathValues := map[string]string{"id": convID}
+		path := "/api/conversations/" + convID + "/timeline"
+		handler := (&ChatHandlers{}).GetConversationTimelineHandler
+
+		testConversationOwnership(t, handler, http.MethodGet, path, "", pathValues)
+
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+		expectEvents(mock)
+
+		w := httptest.NewRecorder()
+		handler(w, newAuthedRequest(http.MethodGet, path, nil, "alice", pathValues))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp TimelineResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		var types []string
+		for _, event := range resp.Events {
+			types = append(types, event.Type)
+		}
+		if want := []string{"message", "message", "summary", "message", "message", "summary"}; !slices.Equal(types, want) {
+			t.Errorf("event types = %q, want %q", types, want)
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/llm"
+	"chat-app/internal/logger"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// titleContextMessages is how many of the latest messages are used to generate a title
+	titleContextMessages = 10
+	// titleRegenerateCooldown is the minimum time between title regenerations for a conversation
+	titleRegenerateCooldown = 60 * time.Second
+	// maxTitleLength matches the truncation applied to titles taken from the first message
+	maxTitleLength = 100
+	// titleTranslationTTL is how long a translated title is reused for the same title and language
+	titleTranslationTTL = time.Hour
+	// maxCachedTitleTranslations bounds the number of translated titles kept in memory
+	maxCachedTitleTranslations = 1000
+)
+
+const titleGenerationPrompt = `You generate short titles for conversations. Read the conversation and reply with a concise title of at most 8 words that describes its main topic. Reply with the title only: no quotes, no trailing punctuation, no explanation.`
+
+const titleFromSummaryPrompt = `Generate a 5-10 word title from this summary. Reply with the title only: no quotes, no trailing punctuation, no explanation.`
+
+const titleTranslationPrompt = `You translate conversation titles. Reply with the translated title only: no quotes, no trailing punctuation, no explanation.`
+
+// languageNames maps ISO 639-1 codes to the language names used in translation prompts
+var languageNames = map[string]string{
+	"ar": "Arabic", "cs": "Czech", "da": "Danish", "de": "German", "el": "Greek", "es": "Spanish",
+	"fi": "Finnish", "fr": "French", "he": "Hebrew", "hi": "Hindi", "hu": "Hungarian", "id": "Indonesian",
+	"it": "Italian", "ja": "Japanese", "ko": "Korean", "nl": "Dutch", "no": "Norwegian", "pl": "Polish",
+	"pt": "Portuguese", "ro": "Romanian", "ru": "Russian", "sv": "Swedish", "th": "Thai", "tr": "Turkish",
+	"uk": "Ukrainian", "vi": "Vietnamese", "zh": "Chinese",
+}
+
+type cachedTranslation struct {
+	title     string
+	expiresAt time.Time
+}
+
+var (
+	titleTranslationCache   = make(map[string]cachedTranslation) // sha256(title + language) -> translation
+	titleTranslationCacheMu sync.Mutex
+)
+
+// cachedTitleTranslation returns an unexpired cached translation
+func cachedTitleTranslation(key string) (string, bool) {
+	titleTranslationCacheMu.Lock()
+	defer titleTranslationCacheMu.Unlock()
+
+	entry, ok := titleTranslationCache[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(titleTranslationCache, key)
+		return "", false
+	}
+	return entry.title, true
+}
+
+// cacheTitleTranslation stores a translation. When the cache is full, expired entries are dropped
+// first; if it is still full, the translation is not cached.
+func cacheTitleTranslation(key, title string) {
+	titleTranslationCacheMu.Lock()
+	defer titleTranslationCacheMu.Unlock()
+
+	now := time.Now()
+	if len(titleTranslationCache) >= maxCachedTitleTranslations {
+		for k, entry := range titleTranslationCache {
+			if now.After(entry.expiresAt) {
+				delete(titleTranslationCache, k)
+			}
+		}
+		if len(titleTranslationCache) >= maxCachedTitleTranslations {
+			return
+		}
+	}
+	titleTranslationCache[key] = cachedTranslation{title: title, expiresAt: now.Add(titleTranslationTTL)}
+}
+
+type TitleResponse struct {
+	Title string `json:"title"`
+}
+
+// generateTitle asks the LLM for a title describing the given messages. When title translation is
+// enabled and lang is a non-English language code, the title is translated to that language.
+func (ch *ChatHandlers) generateTitle(ctx context.Context, reqLog *log.Logger, messages []llm.Message, lang string) (string, error) {
+	if len(messages) > titleContextMessages {
+		messages = messages[len(messages)-titleContextMessages:]
+	}
+
+	// Titles are generated without the chat system prompt, like summaries
+	provider := ch.getSummarizer("")
+	raw, err := provider.ChatForSummarization(ctx, messages, titleGenerationPrompt, "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanTitle(raw)
+	if title == "" {
+		return "", fmt.Errorf("LLM returned an empty title")
+	}
+
+	if config.GetAutoTranslateTitles() && lang != "" && lang != "en" {
+		translated, err := translateTitle(ctx, provider, title, lang)
+		if err != nil {
+			// Keep the untranslated title rather than failing the request
+			reqLog.Printf("[TITLE] Warning: failed to translate title to %s: %v", lang, err)
+			return title, nil
+		}
+		title = translated
+	}
+	return title, nil
+}
+
+// translateTitle translates a title to the language with the given code, reusing recent translations
+func translateTitle(ctx context.Context, summarizer llm.Summarizer, title, lang string) (string, error) {
+	hash := sha256.Sum256([]byte(title + lang))
+	key := hex.EncodeToString(hash[:])
+
+	if cached, ok := cachedTitleTranslation(key); ok {
+		return cached, nil
+	}
+
+	language, ok := languageNames[lang]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q", lang)
+	}
+
+	prompt := fmt.Sprintf("Translate the following conversation title to %s: %s", language, title)
+	raw, err := summarizer.ChatForSummarization(ctx, []llm.Message{{Role: "user", Content: prompt}}, titleTranslationPrompt, "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	translated := cleanTitle(raw)
+	if translated == "" {
+		return "", fmt.Errorf("LLM returned an empty translation")
+	}
+
+	cacheTitleTranslation(key, translated)
+	return translated, nil
+}
+
+// preferredLanguage returns the primary language code (e.g. "fr" for "fr-FR") with the highest
+// quality value in an Accept-Language header among English and the languages in languageNames,
+// or "" if the header names none of them
+func preferredLanguage(acceptLanguage string) string {
+	type weightedLanguage struct {
+		code    string
+		quality float64
+	}
+
+	var languages []weightedLanguage
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		code, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		code = strings.ToLower(code)
+		if _, ok := languageNames[code]; !ok && code != "en" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality > 0 {
+			languages = append(languages, weightedLanguage{code: code, quality: quality})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+	// Stable sort keeps the header order among languages of equal quality
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].quality > languages[j].quality })
+	return languages[0].code
+}
+
+// generateTitleFromSummary replaces a conversation's title with one generated from its summary.
+// Failures are only logged: the title update never fails the summarization.
+func generateTitleFromSummary(summarizer llm.Summarizer, convID, summary string) {
+	messages := []llm.Message{{Role: "user", Content: summary}}
+	raw, err := summarizer.ChatForSummarization(context.Background(), messages, titleFromSummaryPrompt, selectSummarizationModel(log.Default(), ""), nil)
+	if err != nil {
+		log.Printf("[TITLE] Warning: failed to generate title from summary for conversation %s: %v", convID, err)
+		return
+	}
+
+	title := cleanTitle(raw)
+	if title == "" {
+		log.Printf("[TITLE] Warning: empty title generated from summary for conversation %s", convID)
+		return
+	}
+
+	if err := db.UpdateConversationTitle(convID, title); err != nil {
+		log.Printf("[TITLE] Warning: failed to update title for conversation %s: %v", convID, err)
+	}
+}
+
+// cleanTitle strips surrounding quotes, whitespace and extra lines from an LLM-generated title
+func cleanTitle(raw string) string {
+	title := strings.TrimSpace(raw)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = strings.TrimSpace(title[:i])
+	}
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(title, " \t\"'`*")
+	title = strings.TrimRight(title, ".")
+
+	runes := []rune(title)
+	if len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+	return title
+}
+
+// RegenerateTitleHandler regenerates a conversation's title from its latest messages
+func (ch *ChatHandlers) RegenerateTitleHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	convID := r.PathValue("id")
+	reqLog.Printf("Regenerate title request from user: %s for conversation: %s", username, convID)
+
+	// Get user from database
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[TITLE] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// Get conversation and verify ownership
+	conversation, err := db.GetConversation(convID)
+	if err != nil {
+		reqLog.Printf("[TITLE] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	if conversation.UserID != user.ID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Enforce the regeneration cooldown
+	if conversation.TitleGeneratedAt != nil {
+		if remaining := titleRegenerateCooldown - time.Since(*conversation.TitleGeneratedAt); remaining > 0 {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(remaining.Seconds()))))
+			http.Error(w, "Title was regenerated recently, try again later", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	messages, err := db.GetConversationMessages(convID)
+	if err != nil {
+		reqLog.Printf("[TITLE] Error getting messages: %v", err)
+		http.Error(w, "Error retrieving messages", http.StatusInternalServerError)
+		return
+	}
+
+	if len(messages) == 0 {
+		http.Error(w, "Conversation has no messages", http.StatusBadRequest)
+		return
+	}
+
+	title, err := ch.generateTitle(r.Context(), reqLog, messages, preferredLanguage(r.Header.Get("Accept-Language")))
+	if err != nil {
+		reqLog.Printf("[TITLE] Error generating title: %v", err)
+		http.Error(w, "Error generating title", http.StatusBadGateway)
+		return
+	}
+
+	if err := db.UpdateConversationTitle(convID, title); err != nil {
+		reqLog.Printf("[TITLE] Error updating title: %v", err)
+		http.Error(w, "Error updating title", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TitleResponse{Title: title})
+}
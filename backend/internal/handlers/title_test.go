@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "Trip to Paris", want: "Trip to Paris"},
+		{raw: "  \"Trip to Paris.\"  ", want: "Trip to Paris"},
+		{raw: "Title: **Trip to Paris**", want: "Trip to Paris"},
+		{raw: "Trip to Paris\nThis title describes the conversation", want: "Trip to Paris"},
+		{raw: strings.Repeat("a", maxTitleLength+20), want: strings.Repeat("a", maxTitleLength)},
+	}
+
+	for _, tt := range tests {
+		if got := cleanTitle(tt.raw); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestRegenerateTitleHandler(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	target := "/api/conversations/" + convID + "/title/generate"
+	pathValues := map[string]string{"id": convID}
+	testConversationOwnership(t, (&ChatHandlers{}).RegenerateTitleHandler, http.MethodPost, target, "", pathValues)
+
+	recently := time.Now().Add(-20 * time.Second)
+	longAgo := time.Now().Add(-2 * titleRegenerateCooldown)
+
+	tests := []struct {
+		name           string
+		generatedAt    *time.Time
+		provider       *stubProvider
+		setup          func(mock sqlmock.Sqlmock)
+		wantStatus     int
+		wantTitle      string
+		wantRetryAfter bool
+	}{
+		{
+			name:           "regenerated within the cooldown",
+			generatedAt:    &recently,
+			provider:       &stubProvider{response: "Never asked"},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: true,
+		},
+		{
+			name:     "first regeneration",
+			provider: &stubProvider{response: "\"Trip to Paris.\"\nThe conversation plans a trip"},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectHistory(mock, convID, "Plan a trip to Paris", "Sure, when?")
+				mock.ExpectExec(`UPDATE conversations SET title = \$1, title_generated_at = CURRENT_TIMESTAMP WHERE id = \$2`).
+					WithArgs("Trip to Paris", convID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusOK,
+			wantTitle:  "Trip to Paris",
+		},
+		{
+			name:        "cooldown elapsed",
+			generatedAt: &longAgo,
+			provider:    &stubProvider{response: "Paris itinerary"},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectHistory(mock, convID, "Plan a trip to Paris", "Sure, when?")
+				mock.ExpectExec(`UPDATE conversations SET title`).
+					WithArgs("Paris itinerary", convID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantStatus: http.StatusOK,
+			wantTitle:  "Paris itinerary",
+		},
+		{
+			name:     "no messages",
+			provider: &stubProvider{response: "Never asked"},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectHistory(mock, convID)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "provider error",
+			provider: &stubProvider{err: errors.New("upstream unavailable")},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectHistory(mock, convID, "Plan a trip to Paris")
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:     "empty title",
+			provider: &stubProvider{response: "\"\""},
+			setup: func(mock sqlmock.Sqlmock) {
+				testutil.ExpectHistory(mock, convID, "Plan a trip to Paris")
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID, TitleGeneratedAt: tt.generatedAt})
+			if tt.setup != nil {
+				tt.setup(mock)
+			}
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: tt.provider}).RegenerateTitleHandler(w, newAuthedRequest(http.MethodPost, target, nil, "alice", pathValues))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			if tt.wantRetryAfter {
+				seconds, err := strconv.Atoi(w.Header().Get("Retry-After"))
+				if err != nil || seconds < 1 || seconds > int(titleRegenerateCooldown.Seconds()) {
+					t.Errorf("Retry-After = %q, want the remaining cooldown in seconds", w.Header().Get("Retry-After"))
+				}
+				if tt.provider.calls != 0 {
+					t.Errorf("provider called %d times during the cooldown, want 0", tt.provider.calls)
+				}
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp TitleResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", resp.Title, tt.wantTitle)
+			}
+			if tt.provider.systemPrompt != titleGenerationPrompt {
+				t.Errorf("system prompt = %q, want the title generation prompt", tt.provider.systemPrompt)
+			}
+		})
+	}
+}
+
+// summaryTitleProvider answers summarization requests with a summary and title requests with a
+// title, passing the messages of each title request on to titleRequests
+type summaryTitleProvider struct {
+	stubProvider
+	summary       string
+	title         string
+	titleRequests chan []llm.Message
+}
+
+func (p *summaryTitleProvider) ChatForSummarization(ctx context.Context, messages []llm.Message, summarizationPrompt, modelOverride string, temperature *float64) (string, error) {
+	if summarizationPrompt == titleFromSummaryPrompt {
+		p.titleRequests <- messages
+		return p.title, nil
+	}
+	return p.summary, nil
+}
+
+func TestSummarizeConversationHandlerUpdatesTitle(t *testing.T) {
+	const (
+		userID    = "11111111-1111-1111-1111-111111111111"
+		convID    = "33333333-3333-3333-3333-333333333333"
+		lastMsgID = "44444444-4444-4444-4444-444444444444"
+	)
+	t.Setenv("UPDATE_TITLE_ON_SUMMARIZE", "true")
+
+	mock := testutil.NewMockDB(t)
+	testutil.ExpectUser(mock, userID, "alice")
+	testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+	testutil.ExpectNoActiveSummary(mock, convID)
+	testutil.ExpectHistory(mock, convID, "q1", "a1")
+	mock.ExpectQuery(`SELECT id\s+FROM messages\s+WHERE conversation_id = \$1`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(lastMsgID))
+	testutil.ExpectSummarySaved(mock, convID, "The user is planning a trip to Lisbon.", lastMsgID)
+	mock.ExpectExec(`UPDATE conversations SET title = \$1, title_generated_at = CURRENT_TIMESTAMP WHERE id = \$2`).
+		WithArgs("Planning a Trip to Lisbon", convID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	t.Cleanup(func() { invalidateActiveSummaryCache(convID) })
+
+	provider := &summaryTitleProvider{
+		summary:       "The user is planning a trip to Lisbon.",
+		title:         `"Planning a Trip to Lisbon"`,
+		titleRequests: make(chan []llm.Message, 1),
+	}
+	w := httptest.NewRecorder()
+	r := newAuthedRequest(http.MethodPost, "/api/conversations/"+convID+"/summarize", nil, "alice", map[string]string{"id": convID})
+	(&ChatHandlers{fallbackProvider: provider}).SummarizeConversationHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp SummarizeResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Summary != provider.summary {
+		t.Errorf("summary = %q, want %q", resp.Summary, provider.summary)
+	}
+
+	select {
+	case messages := <-provider.titleRequests:
+		if len(messages) != 1 || messages[0].Content != provider.summary {
+			t.Errorf("title request messages = %+v, want the new summary", messages)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("title was not generated from the summary")
+	}
+
+	// The title is stored in the background after the response is sent
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestGenerateTitleFromSummaryFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider *stubProvider
+		wantLog  string
+	}{
+		{name: "provider error", provider: &stubProvider{err: errors.New("upstream unavailable")}, wantLog: "failed to generate title from summary"},
+		{name: "empty title", provider: &stubProvider{response: "  \"\"  "}, wantLog: "empty title generated from summary"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			out := log.Writer()
+			log.SetOutput(&buf)
+			t.Cleanup(func() { log.SetOutput(out) })
+			// The title is left untouched: the mock expects no update
+			mock := testutil.NewMockDB(t)
+
+			generateTitleFromSummary(tt.provider, "c1", "The user is planning a trip to Lisbon.")
+
+			if logs := buf.String(); !strings.Contains(logs, tt.wantLog) || strings.Contains(logs, "failed to update title") {
+				t.Errorf("log = %q, want only %q", logs, tt.wantLog)
+			}
+
+			if tt.provider.calls != 1 || tt.provider.systemPrompt != titleFromSummaryPrompt {
+				t.Errorf("provider calls = %d with prompt %q, want one title request", tt.provider.calls, tt.provider.systemPrompt)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+// translatingProvider answers title translation requests with translation and any other request
+// like stubProvider, recording the prompt of each translation request
+type translatingProvider struct {
+	stubProvider
+	translation    string
+	translationErr error
+	translations   []string
+}
+
+func (p *translatingProvider) ChatForSummarization(ctx context.Context, messages []llm.Message, summarizationPrompt, modelOverride string, temperature *float64) (string, error) {
+	if summarizationPrompt == titleTranslationPrompt {
+		p.translations = append(p.translations, messages[0].Content)
+		return p.translation, p.translationErr
+	}
+	return p.stubProvider.ChatForSummarization(ctx, messages, summarizationPrompt, modelOverride, temperature)
+}
+
+// resetTitleTranslationCache empties the title translation cache now and after the test
+func resetTitleTranslationCache(t *testing.T) {
+	reset := func() {
+		titleTranslationCacheMu.Lock()
+		clear(titleTranslationCache)
+		titleTranslationCacheMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "fr-FR", want: "fr"},
+		{header: "FR", want: "fr"},
+		{header: "en-US,en;q=0.9", want: "en"},
+		{header: "fr-FR,fr;q=0.9,en-US;q=0.8,en;q=0.7", want: "fr"},
+		{header: "en;q=0.5, de;q=0.8", want: "de"},
+		{header: "de, fr", want: "de"},              // equal quality keeps the header order
+		{header: "xx-YY, ja;q=0.3", want: "ja"},     // unsupported languages are skipped
+		{header: "*", want: ""},                     // wildcard names no language
+		{header: "es;q=0, it;q=0.1", want: "it"},    // q=0 means not acceptable
+		{header: "pt;q=high, ru;q=0.2", want: "ru"}, // malformed quality values are skipped
+		{header: " zh-Hant-TW ;q=0.9 ", want: "zh"}, // whitespace and subtags
+		{header: "klingon", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := preferredLanguage(tt.header); got != tt.want {
+			t.Errorf("preferredLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateTitle(t *testing.T) {
+	t.Run("cache miss then hit", func(t *testing.T) {
+		resetTitleTranslationCache(t)
+		provider := &translatingProvider{translation: "\"Voyage à Paris.\""}
+
+		for range 2 {
+			got, err := translateTitle(context.Background(), provider, "Trip to Paris", "fr")
+			if err != nil || got != "Voyage à Paris" {
+				t.Fatalf("translateTitle() = %q, %v, want Voyage à Paris", got, err)
+			}
+		}
+		want := []string{"Translate the following conversation title to French: Trip to Paris"}
+		if !slices.Equal(provider.translations, want) {
+			t.Errorf("translation prompts = %q, want %q", provider.translations, want)
+		}
+	})
+
+	t.Run("cached per language", func(t *testing.T) {
+		resetTitleTranslationCache(t)
+		provider := &translatingProvider{translation: "Übersetzt"}
+
+		translateTitle(context.Background(), provider, "Trip to Paris", "fr")
+		translateTitle(context.Background(), provider, "Trip to Paris", "de")
+		translateTitle(context.Background(), provider, "Trip to Rome", "fr")
+		if len(provider.translations) != 3 {
+			t.Errorf("translation requests = %d, want 3", len(provider.translations))
+		}
+	})
+
+	t.Run("expired translation", func(t *testing.T) {
+		resetTitleTranslationCache(t)
+		provider := &translatingProvider{translation: "Voyage à Paris"}
+		translateTitle(context.Background(), provider, "Trip to Paris", "fr")
+		titleTranslationCacheMu.Lock()
+		for key, entry := range titleTranslationCache {
+			entry.expiresAt = time.Now().Add(-time.Second)
+			titleTranslationCache[key] = entry
+		}
+		titleTranslationCacheMu.Unlock()
+
+		translateTitle(context.Background(), provider, "Trip to Paris", "fr")
+		if len(provider.translations) != 2 {
+			t.Errorf("translation requests = %d, want 2", len(provider.translations))
+		}
+	})
+
+	for _, tt := range []struct {
+		name     string
+		lang     string
+		provider *translatingProvider
+		wantCall bool
+	}{
+		{name: "unsupported language", lang: "xx", provider: &translatingProvider{translation: "Never asked"}},
+		{name: "provider error", lang: "fr", provider: &translatingProvider{translationErr: errors.New("upstream unavailable")}, wantCall: true},
+		{name: "empty translation", lang: "fr", provider: &translatingProvider{translation: "  "}, wantCall: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resetTitleTranslationCache(t)
+
+			if _, err := translateTitle(context.Background(), tt.provider, "Trip to Paris", tt.lang); err == nil {
+				t.Fatal("translateTitle() succeeded, want an error")
+			}
+			if called := len(tt.provider.translations) > 0; called != tt.wantCall {
+				t.Errorf("provider called = %v, want %v", called, tt.wantCall)
+			}
+			// Failures are not cached
+			if len(titleTranslationCache) != 0 {
+				t.Errorf("cached translations = %d, want 0", len(titleTranslationCache))
+			}
+		})
+	}
+}
+
+func TestCacheTitleTranslationBounded(t *testing.T) {
+	resetTitleTranslationCache(t)
+	for i := range maxCachedTitleTranslations {
+		cacheTitleTranslation(strconv.Itoa(i), "title")
+	}
+
+	cacheTitleTranslation("new", "title")
+	if _, ok := cachedTitleTranslation("new"); ok {
+		t.Error("translation cached in a full cache")
+	}
+
+	// Expired entries make room
+	titleTranslationCacheMu.Lock()
+	titleTranslationCache["0"] = cachedTranslation{title: "title", expiresAt: time.Now().Add(-time.Second)}
+	titleTranslationCacheMu.Unlock()
+	cacheTitleTranslation("new", "title")
+	if _, ok := cachedTitleTranslation("new"); !ok {
+		t.Error("translation not cached after expired entries were dropped")
+	}
+	if len(titleTranslationCache) != maxCachedTitleTranslations {
+		t.Errorf("cached translations = %d, want %d", len(titleTranslationCache), maxCachedTitleTranslations)
+	}
+}
+
+func TestRegenerateTitleHandlerTranslation(t *testing.T) {
+	const (
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	target := "/api/conversations/" + convID + "/title/generate"
+	pathValues := map[string]string{"id": convID}
+
+	tests := []struct {
+		name            string
+		enabled         bool
+		acceptLanguage  string
+		translationErr  error
+		wantTitle       string
+		wantTranslation bool
+	}{
+		{name: "disabled", acceptLanguage: "fr-FR", wantTitle: "Trip to Paris"},
+		{name: "French", enabled: true, acceptLanguage: "fr-FR,fr;q=0.9,en;q=0.8", wantTitle: "Voyage à Paris", wantTranslation: true},
+		{name: "English", enabled: true, acceptLanguage: "en-US,fr;q=0.5", wantTitle: "Trip to Paris"},
+		{name: "no header", enabled: true, wantTitle: "Trip to Paris"},
+		{name: "translation failure keeps the title", enabled: true, acceptLanguage: "fr", translationErr: errors.New("upstream unavailable"),
+			wantTitle: "Trip to Paris", wantTranslation: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetTitleTranslationCache(t)
+			t.Setenv("AUTO_TRANSLATE_TITLES", strconv.FormatBool(tt.enabled))
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			testutil.ExpectConversation(mock, testutil.Conversation{ID: convID, UserID: userID})
+			testutil.ExpectHistory(mock, convID, "Plan a trip to Paris", "Sure, when?")
+			mock.ExpectExec(`UPDATE conversations SET title = \$1, title_generated_at = CURRENT_TIMESTAMP WHERE id = \$2`).
+				WithArgs(tt.wantTitle, convID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			provider := &translatingProvider{stubProvider: stubProvider{response: "Trip to Paris"}, translation: "Voyage à Paris", translationErr: tt.translationErr}
+			r := newAuthedRequest(http.MethodPost, target, nil, "alice", pathValues)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: provider}).RegenerateTitleHandler(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			var resp TitleResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", resp.Title, tt.wantTitle)
+			}
+			if translated := len(provider.translations) > 0; translated != tt.wantTranslation {
+				t.Errorf("translation requested = %v, want %v", translated, tt.wantTranslation)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
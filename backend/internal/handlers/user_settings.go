@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"chat-app/internal/validation"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// WebhookSettings holds the URL notified when the user's background jobs finish
+type WebhookSettings struct {
+	WebhookURL string `json:"webhook_url"` // Empty string removes the webhook
+}
+
+// UpdateWebhookHandler registers or removes the authenticated user's webhook URL
+func (ch *ChatHandlers) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Update webhook request from user: %s", username)
+
+	var req WebhookSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+	if req.WebhookURL != "" {
+		if err := validation.ValidateWebhookURL(req.WebhookURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := db.UpdateUserWebhookURL(username, req.WebhookURL); err != nil {
+		reqLog.Printf("[CHAT] Error updating webhook URL: %v", err)
+		http.Error(w, "Error updating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// userStatsPeriods are the time windows accepted by the stats endpoint's period parameter;
+// zero means all time
+var userStatsPeriods = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"all": 0,
+}
+
+// UserStatsResponse is the usage dashboard of the current user
+type UserStatsResponse struct {
+	Period                string           `json:"period"`
+	TotalConversations    int              `json:"total_conversations"`
+	TotalMessages         int              `json:"total_messages"`
+	UserMessages          int              `json:"user_messages"`
+	AssistantMessages     int              `json:"assistant_messages"`
+	PromptTokens          int              `json:"prompt_tokens"`
+	CompletionTokens      int              `json:"completion_tokens"`
+	TotalTokensUsed       int              `json:"total_tokens_used"`
+	TotalCostUSD          float64          `json:"total_cost_usd"`
+	AvgConversationLength float64          `json:"avg_conversation_length"`
+	FavoriteModel         string           `json:"favorite_model"`
+	ByModel               []ModelUsageData `json:"by_model"` // Highest cost first
+	CreatedAt             time.Time        `json:"created_at"`
+}
+
+// ModelUsageData is the usage of one model within the requested period
+type ModelUsageData struct {
+	Model            string  `json:"model"`
+	Messages         int     `json:"messages"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// GetUserStatsHandler returns aggregate usage stats for the authenticated user over the last
+// 7 or 30 days or all time (?period=7d|30d|all, default all)
+func (ch *ChatHandlers) GetUserStatsHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	username := r.Context().Value(auth.UserContextKey).(string)
+	reqLog.Printf("Get user stats request from user: %s", username)
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "all"
+	}
+	window, ok := userStatsPeriods[period]
+	if !ok {
+		http.Error(w, "Invalid period: must be 7d, 30d or all", http.StatusBadRequest)
+		return
+	}
+	var since time.Time
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user: %v", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := db.GetUserStats(user.ID, since)
+	if err != nil {
+		reqLog.Printf("[CHAT] Error getting user stats: %v", err)
+		http.Error(w, "Error retrieving user stats", http.StatusInternalServerError)
+		return
+	}
+
+	byModel := make([]ModelUsageData, 0, len(stats.ByModel))
+	for _, usage := range stats.ByModel {
+		byModel = append(byModel, ModelUsageData{
+			Model:            usage.Model,
+			Messages:         usage.Messages,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+			CostUSD:          usage.CostUSD,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserStatsResponse{
+		Period:                period,
+		TotalConversations:    stats.TotalConversations,
+		TotalMessages:         stats.TotalMessages,
+		UserMessages:          stats.UserMessages,
+		AssistantMessages:     stats.AssistantMessages,
+		PromptTokens:          stats.PromptTokens,
+		CompletionTokens:      stats.CompletionTokens,
+		TotalTokensUsed:       stats.TotalTokensUsed,
+		TotalCostUSD:          stats.TotalCostUSD,
+		AvgConversationLength: stats.AvgConversationLength,
+		FavoriteModel:         stats.FavoriteModel,
+		ByModel:               byModel,
+		CreatedAt:             stats.CreatedAt,
+	})
+}
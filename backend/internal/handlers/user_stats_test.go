@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"chat-app/internal/testutil"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// agoArg is an argument matcher for a time.Time about the given duration before now
+type agoArg time.Duration
+
+func (a agoArg) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	return ok && (time.Since(got)-time.Duration(a)).Abs() < time.Minute
+}
+
+func TestGetUserStatsHandler(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	createdAt := time.Date(2025, 12, 1, 9, 0, 0, 0, time.UTC)
+
+	expectStats := func(mock sqlmock.Sqlmock, since driver.Value) {
+		mock.ExpectQuery(`WITH user_conversations AS`).
+			WithArgs(userID, since).
+			WillReturnRows(sqlmock.NewRows([]string{"conversations", "conversations_with_messages", "messages", "user_messages",
+				"assistant_messages", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost", "favorite_model", "created_at"}).
+				AddRow(3, 2, 10, 5, 5, 600, 400, 1000, 0.25, "vendor/a", createdAt))
+		mock.ExpectQuery(`GROUP BY m.model`).
+			WithArgs(userID, since).
+			WillReturnRows(sqlmock.NewRows([]string{"model", "count", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost"}).
+				AddRow("vendor/a", 5, 600, 400, 1000, 0.25))
+	}
+
+	t.Run("unknown user", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectNoUser(mock, "alice")
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetUserStatsHandler(w, newAuthedRequest(http.MethodGet, "/api/users/me/stats", nil, "alice", nil))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetUserStatsHandler(w, newAuthedRequest(http.MethodGet, "/api/users/me/stats?period=1y", nil, "alice", nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		query, wantPeriod string
+		since             driver.Value
+	}{
+		{query: "", wantPeriod: "all", since: nil},
+		{query: "?period=all", wantPeriod: "all", since: nil},
+		{query: "?period=7d", wantPeriod: "7d", since: agoArg(7 * 24 * time.Hour)},
+		{query: "?period=30d", wantPeriod: "30d", since: agoArg(30 * 24 * time.Hour)},
+	} {
+		t.Run("period "+tt.wantPeriod+tt.query, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			testutil.ExpectUser(mock, userID, "alice")
+			expectStats(mock, tt.since)
+
+			w := httptest.NewRecorder()
+			(&ChatHandlers{}).GetUserStatsHandler(w, newAuthedRequest(http.MethodGet, "/api/users/me/stats"+tt.query, nil, "alice", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+			var resp UserStatsResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			want := UserStatsResponse{
+				Period:                tt.wantPeriod,
+				TotalConversations:    3,
+				TotalMessages:         10,
+				UserMessages:          5,
+				AssistantMessages:     5,
+				PromptTokens:          600,
+				CompletionTokens:      400,
+				TotalTokensUsed:       1000,
+				TotalCostUSD:          0.25,
+				AvgConversationLength: 5,
+				FavoriteModel:         "vendor/a",
+				ByModel:               []ModelUsageData{{Model: "vendor/a", Messages: 5, PromptTokens: 600, CompletionTokens: 400, TotalTokens: 1000, CostUSD: 0.25}},
+				CreatedAt:             createdAt,
+			}
+			if !slices.Equal(resp.ByModel, want.ByModel) {
+				t.Errorf("by_model = %+v, want %+v", resp.ByModel, want.ByModel)
+			}
+			resp.ByModel, want.ByModel = nil, nil
+			if !reflect.DeepEqual(resp, want) {
+				t.Errorf("response = %+v, want %+v", resp, want)
+			}
+		})
+	}
+
+	t.Run("empty usage is an empty list", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		mock.ExpectQuery(`WITH user_conversations AS`).
+			WillReturnRows(sqlmock.NewRows([]string{"conversations", "conversations_with_messages", "messages", "user_messages",
+				"assistant_messages", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost", "favorite_model", "created_at"}).
+				AddRow(0, 0, 0, 0, 0, 0, 0, 0, 0, "", createdAt))
+		mock.ExpectQuery(`GROUP BY m.model`).
+			WillReturnRows(sqlmock.NewRows([]string{"model", "count", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost"}))
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetUserStatsHandler(w, newAuthedRequest(http.MethodGet, "/api/users/me/stats", nil, "alice", nil))
+
+		var resp map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if byModel, ok := resp["by_model"].([]any); !ok || len(byModel) != 0 {
+			t.Errorf("by_model = %v, want []", resp["by_model"])
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock := testutil.NewMockDB(t)
+		testutil.ExpectUser(mock, userID, "alice")
+		mock.ExpectQuery(`WITH user_conversations AS`).WillReturnError(errors.New("connection reset"))
+
+		w := httptest.NewRecorder()
+		(&ChatHandlers{}).GetUserStatsHandler(w, newAuthedRequest(http.MethodGet, "/api/users/me/stats", nil, "alice", nil))
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
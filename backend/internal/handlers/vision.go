@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"chat-app/internal/validation"
+	"log"
+	"net/http"
+)
+
+// checkImageSupport validates the images of a request, both those given in image_urls and those
+// embedded in a client-supplied history, and rejects them if the selected model has no vision
+// support. It returns false if a response was written.
+func (ch *ChatHandlers) checkImageSupport(reqLog *log.Logger, w http.ResponseWriter, req *ChatRequest) bool {
+	imageURLs := req.ImageURLs
+	for _, msg := range req.Messages {
+		imageURLs = append(imageURLs, msg.ImageURLs...)
+	}
+	if len(imageURLs) == 0 {
+		return true
+	}
+
+	if err := validation.ValidateImageURLs(imageURLs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	modelID := req.Model
+	if modelID == "" {
+		modelID = ch.getProvider(req.Provider).GetDefaultModel()
+	}
+	if model, ok := config.GetModelByID(modelID); !ok || !model.SupportsVision() {
+		reqLog.Printf("[CHAT] Rejected %d images for model without vision support: %s", len(imageURLs), modelID)
+		writeErrorCode(w, http.StatusBadRequest, "MODEL_DOES_NOT_SUPPORT_VISION")
+		return false
+	}
+	return true
+}
+
+// attachImages adds the request's images to the latest user message of the history sent to the LLM
+func attachImages(history []llm.Message, imageURLs []string) {
+	if len(imageURLs) == 0 {
+		return
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			history[i].ImageURLs = append(history[i].ImageURLs, imageURLs...)
+			return
+		}
+	}
+}
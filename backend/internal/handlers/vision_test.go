@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"chat-app/internal/testutil"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestChatHandlerImages(t *testing.T) {
+	const userID = "11111111-1111-1111-1111-111111111111"
+	setTestModels(t, []config.Model{
+		{ID: "vendor/vision", Capabilities: []string{"vision"}},
+		{ID: "vendor/text", Capabilities: []string{"json_mode"}},
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantImages []string // images of the latest message sent to the provider
+	}{
+		{
+			name:       "invalid image URL",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"model":"vendor/vision","image_urls":["ftp://example.com/a.png"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "model without vision",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"model":"vendor/text","image_urls":["https://example.com/a.png"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "MODEL_DOES_NOT_SUPPORT_VISION",
+		},
+		{
+			name:       "unknown model",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"model":"vendor/unknown","image_urls":["https://example.com/a.png"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "MODEL_DOES_NOT_SUPPORT_VISION",
+		},
+		{
+			name:       "provider default model without vision",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"image_urls":["https://example.com/a.png"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "MODEL_DOES_NOT_SUPPORT_VISION",
+		},
+		{
+			name: "images in the history for a model without vision",
+			body: `{"messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+				{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}],"model":"vendor/text"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "MODEL_DOES_NOT_SUPPORT_VISION",
+		},
+		{
+			name:       "vision model",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"model":"vendor/vision","image_urls":["https://example.com/a.png"]}`,
+			wantStatus: http.StatusOK,
+			wantImages: []string{"https://example.com/a.png"},
+		},
+		{
+			name: "images in the history for a vision model",
+			body: `{"messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+				{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}],"model":"vendor/vision"}`,
+			wantStatus: http.StatusOK,
+			wantImages: []string{"https://example.com/a.png"},
+		},
+		{
+			name:       "no images for a model without vision",
+			body:       `{"messages":[{"role":"user","content":"what is this?"}],"model":"vendor/text"}`,
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.NewMockDB(t)
+			if tt.wantStatus == http.StatusOK {
+				testutil.ExpectUser(mock, userID, "alice")
+			}
+
+			provider := &stubProvider{response: "a cat"}
+			ch := &ChatHandlers{fallbackProvider: provider}
+
+			w := httptest.NewRecorder()
+			r := newAuthedRequest(http.MethodPost, "/api/chat", strings.NewReader(tt.body), "alice", nil)
+			ch.ChatHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("error code = %q (decode error %v), want %q", resp.Code, err, tt.wantCode)
+				}
+			}
+			if tt.wantStatus != http.StatusOK {
+				if provider.calls != 0 {
+					t.Errorf("provider called %d times, want the request rejected first", provider.calls)
+				}
+				return
+			}
+
+			if len(provider.messages) != 1 {
+				t.Fatalf("provider got %d messages, want 1", len(provider.messages))
+			}
+			if msg := provider.messages[0]; msg.Content != "what is this?" || !slices.Equal(msg.ImageURLs, tt.wantImages) {
+				t.Errorf("provider message = %+v, want the text with images %q", msg, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestChatStreamHandlerImages(t *testing.T) {
+	conv := testutil.Conversation{ID: "22222222-2222-2222-2222-222222222222", UserID: "11111111-1111-1111-1111-111111111111"}
+	setTestModels(t, []config.Model{{ID: "vendor/vision", Capabilities: []string{"vision"}}})
+	t.Setenv("CHECKPOINT_CHUNK_INTERVAL", "0")
+
+	mock := testutil.NewMockDB(t)
+	expectStreamStart(t, mock, conv, "earlier question", "earlier answer", "what is this?")
+	expectReplyStored(t, mock, conv.ID)
+	mock.ExpectExec(`UPDATE messages SET content_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	provider := &stubProvider{response: "a cat"}
+	ch := &ChatHandlers{inFlight: NewInFlightTracker(time.Minute), fallbackProvider: provider}
+
+	body := `{"message":"what is this?","conversation_id":"` + conv.ID + `","model":"vendor/vision","image_urls":["https://example.com/a.png"]}`
+	w := httptest.NewRecorder()
+	ch.ChatStreamHandler(w, newAuthedRequest(http.MethodPost, "/api/chat/stream", strings.NewReader(body), "alice", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+	// Only the latest user message carries the images
+	want := [][]string{nil, nil, {"https://example.com/a.png"}}
+	if len(provider.messages) != len(want) {
+		t.Fatalf("provider got %d messages, want %d", len(provider.messages), len(want))
+	}
+	for i, msg := range provider.messages {
+		if !slices.Equal(msg.ImageURLs, want[i]) {
+			t.Errorf("message %d images = %q, want %q", i, msg.ImageURLs, want[i])
+		}
+	}
+}
+
+func TestAttachImages(t *testing.T) {
+	history := []llm.Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "reply"},
+		{Role: "user", Content: "second", ImageURLs: []string{"https://example.com/a.png"}},
+		{Role: "assistant", Content: "reply"},
+	}
+	attachImages(history, []string{"https://example.com/b.png"})
+
+	if history[0].ImageURLs != nil {
+		t.Errorf("first user message images = %q, want none", history[0].ImageURLs)
+	}
+	if want := []string{"https://example.com/a.png", "https://example.com/b.png"}; !slices.Equal(history[2].ImageURLs, want) {
+		t.Errorf("latest user message images = %q, want %q", history[2].ImageURLs, want)
+	}
+
+	// A history without a user message is left unchanged
+	assistantOnly := []llm.Message{{Role: "assistant", Content: "hi"}}
+	attachImages(assistantOnly, []string{"https://example.com/b.png"})
+	if assistantOnly[0].ImageURLs != nil {
+		t.Errorf("assistant message images = %q, want none", assistantOnly[0].ImageURLs)
+	}
+}
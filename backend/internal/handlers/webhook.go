@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/db"
+	"chat-app/internal/logger"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxWebhookBodyBytes limits the size of an incoming webhook payload
+const maxWebhookBodyBytes = 1 << 20
+
+// WebhookEvent is an event delivered by an external system
+type WebhookEvent struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewMessageEventPayload is the payload of a "new_message" webhook event
+type NewMessageEventPayload struct {
+	ConversationID string `json:"conversation_id"`
+	Message        string `json:"message"`
+}
+
+// ValidateWebhookSignature checks a hex-encoded HMAC-SHA256 signature (optionally prefixed with "sha256=") of the body
+func ValidateWebhookSignature(body []byte, signature, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// WebhookIngestHandler accepts signed events from external systems and routes them
+func (ch *ChatHandlers) WebhookIngestHandler(w http.ResponseWriter, r *http.Request) {
+	reqLog := logger.FromContext(r.Context())
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !ValidateWebhookSignature(body, r.Header.Get("X-Signature-SHA256"), config.GetWebhookSecret()) {
+		reqLog.Printf("[WEBHOOK] Rejected event with invalid signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	reqLog.Printf("[WEBHOOK] Received event of type: %s", event.Type)
+
+	switch event.Type {
+	case "new_message":
+		ch.handleNewMessageEvent(w, r, event.Payload)
+	default:
+		http.Error(w, "Unknown event type", http.StatusBadRequest)
+	}
+}
+
+// handleNewMessageEvent sends the message to the conversation on behalf of its owner
+func (ch *ChatHandlers) handleNewMessageEvent(w http.ResponseWriter, r *http.Request, payload json.RawMessage) {
+	reqLog := logger.FromContext(r.Context())
+	var event NewMessageEventPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		http.Error(w, "Invalid event payload", http.StatusBadRequest)
+		return
+	}
+
+	if event.ConversationID == "" || event.Message == "" {
+		http.Error(w, "conversation_id and message are required", http.StatusBadRequest)
+		return
+	}
+
+	conversation, err := db.GetConversation(event.ConversationID)
+	if err != nil {
+		reqLog.Printf("[WEBHOOK] Error getting conversation: %v", err)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	resp, err := ch.sendMessage(r.Context(), conversation.UserID, &ChatRequest{
+		Message:        event.Message,
+		ConversationID: conversation.ID,
+	})
+	if err != nil {
+		writeChatError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"chat-app/internal/testutil"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// signWebhook returns the hex HMAC-SHA256 signature of body with secret
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidateWebhookSignature(t *testing.T) {
+	const secret = "shared-secret"
+	body := []byte(`{"type":"new_message"}`)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		want      bool
+	}{
+		{name: "correct secret", body: body, signature: signWebhook(body, secret), secret: secret, want: true},
+		{name: "sha256 prefix", body: body, signature: "sha256=" + signWebhook(body, secret), secret: secret, want: true},
+		{name: "incorrect secret", body: body, signature: signWebhook(body, "other-secret"), secret: secret},
+		{name: "tampered body", body: []byte(`{"type":"other"}`), signature: signWebhook(body, secret), secret: secret},
+		{name: "not hex", body: body, signature: "not-a-signature", secret: secret},
+		{name: "missing signature", body: body, secret: secret},
+		{name: "no secret configured", body: body, signature: signWebhook(body, ""), secret: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateWebhookSignature(tt.body, tt.signature, tt.secret); got != tt.want {
+				t.Errorf("ValidateWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookIngestHandler(t *testing.T) {
+	const (
+		secret = "shared-secret"
+		userID = "11111111-1111-1111-1111-111111111111"
+		convID = "33333333-3333-3333-3333-333333333333"
+	)
+	newMessage := `{"type":"new_message","payload":{"conversation_id":"` + convID + `","message":"ping"}}`
+
+	tests := []struct {
+		name       string
+		body       string
+		signWith   string
+		setup      func(t *testing.T, mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "invalid signature", body: newMessage, signWith: "other-secret", wantStatus: http.StatusUnauthorized},
+		{name: "unknown event type", body: `{"type":"deleted_message","payload":{}}`, signWith: secret, wantStatus: http.StatusBadRequest},
+		{name: "missing message", body: `{"type":"new_message","payload":{"conversation_id":"` + convID + `"}}`, signWith: secret, wantStatus: http.StatusBadRequest},
+		{
+			name:     "unknown conversation",
+			body:     newMessage,
+			signWith: secret,
+			setup: func(t *testing.T, mock sqlmock.Sqlmock) {
+				testutil.ExpectNoConversation(mock, convID)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:     "new message routed to the conversation",
+			body:     newMessage,
+			signWith: secret,
+			setup: func(t *testing.T, mock sqlmock.Sqlmock) {
+				t.Setenv("DUPLICATE_MESSAGE_WINDOW_MS", "0")
+				conv := testutil.Conversation{ID: convID, UserID: userID}
+				testutil.ExpectConversation(mock, conv)
+				testutil.ExpectConversation(mock, conv)
+				testutil.ExpectAddMessage(mock, convID)
+				testutil.ExpectHistory(mock, convID, "ping")
+				expectReplyStored(t, mock, convID)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WEBHOOK_SECRET", secret)
+			mock := testutil.NewMockDB(t)
+			if tt.setup != nil {
+				tt.setup(t, mock)
+			}
+			provider := &stubProvider{response: "pong"}
+
+			body := []byte(tt.body)
+			r := httptest.NewRequest(http.MethodPost, "/api/webhook/ingest", bytes.NewReader(body))
+			r.Header.Set("X-Signature-SHA256", signWebhook(body, tt.signWith))
+			w := httptest.NewRecorder()
+			(&ChatHandlers{fallbackProvider: provider}).WebhookIngestHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider calls = %d, want %d", provider.calls, tt.wantCalls)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp ChatResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if resp.Response != "pong" || resp.ConversationID != convID {
+				t.Errorf("response = %+v, want pong in %s", resp, convID)
+			}
+			if last := provider.messages[len(provider.messages)-1]; last.Content != "ping" {
+				t.Errorf("last message sent to the LLM = %+v, want the event's message", last)
+			}
+		})
+	}
+}
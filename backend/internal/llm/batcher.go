@@ -0,0 +1,79 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Flush modes controlling how streamed chunks are grouped before being sent to the client
+const (
+	FlushToken     = "token"     // Send every chunk as it arrives
+	FlushSentence  = "sentence"  // Send complete sentences, ending at '.', '!', '?' or a blank line
+	FlushParagraph = "paragraph" // Send complete paragraphs, ending at a blank line
+)
+
+// ChunkBatcher buffers streamed chunks and releases them in segments according to its flush mode
+type ChunkBatcher struct {
+	Mode   string
+	Buffer strings.Builder
+}
+
+// NewChunkBatcher creates a batcher for the given flush mode; an empty mode means FlushToken
+func NewChunkBatcher(mode string) (*ChunkBatcher, error) {
+	if mode == "" {
+		mode = FlushToken
+	}
+	if mode != FlushToken && mode != FlushSentence && mode != FlushParagraph {
+		return nil, fmt.Errorf("invalid flush mode %q: must be token, sentence or paragraph", mode)
+	}
+	return &ChunkBatcher{Mode: mode}, nil
+}
+
+// Add buffers a chunk and returns the segments that are complete and ready to be sent
+func (b *ChunkBatcher) Add(chunk string) ([]string, error) {
+	switch b.Mode {
+	case FlushToken, "":
+		return []string{chunk}, nil
+	case FlushSentence, FlushParagraph:
+	default:
+		return nil, fmt.Errorf("invalid flush mode %q", b.Mode)
+	}
+
+	b.Buffer.WriteString(chunk)
+	pending := b.Buffer.String()
+
+	var segments []string
+	for {
+		end := b.segmentEnd(pending)
+		if end < 0 {
+			break
+		}
+		segments = append(segments, pending[:end])
+		pending = pending[end:]
+	}
+
+	b.Buffer.Reset()
+	b.Buffer.WriteString(pending)
+	return segments, nil
+}
+
+// Flush returns and clears whatever is still buffered, for sending once the stream ends
+func (b *ChunkBatcher) Flush() string {
+	rest := b.Buffer.String()
+	b.Buffer.Reset()
+	return rest
+}
+
+// segmentEnd returns the index just past the first segment boundary in s, or -1 if s holds no complete segment
+func (b *ChunkBatcher) segmentEnd(s string) int {
+	end := -1
+	if i := strings.Index(s, "\n\n"); i >= 0 {
+		end = i + 2
+	}
+	if b.Mode == FlushSentence {
+		if i := strings.IndexAny(s, ".!?"); i >= 0 && (end < 0 || i+1 < end) {
+			end = i + 1
+		}
+	}
+	return end
+}
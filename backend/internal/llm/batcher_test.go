@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+)
+
+func TestNewChunkBatcher(t *testing.T) {
+	for _, mode := range []string{"", FlushToken, FlushSentence, FlushParagraph} {
+		batcher, err := NewChunkBatcher(mode)
+		if err != nil {
+			t.Errorf("NewChunkBatcher(%q) error = %v", mode, err)
+			continue
+		}
+		if want := cmp.Or(mode, FlushToken); batcher.Mode != want {
+			t.Errorf("NewChunkBatcher(%q) mode = %q, want %q", mode, batcher.Mode, want)
+		}
+	}
+
+	for _, mode := range []string{"word", "Sentence", "paragraphs"} {
+		if _, err := NewChunkBatcher(mode); err == nil {
+			t.Errorf("NewChunkBatcher(%q) accepted an unknown mode", mode)
+		}
+	}
+}
+
+func TestChunkBatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		chunks   []string
+		want     [][]string // segments returned by each Add
+		wantRest string     // left for Flush at the end of the stream
+	}{
+		{
+			name:   "token mode sends every chunk",
+			mode:   FlushToken,
+			chunks: []string{"Hel", "lo. ", "World"},
+			want:   [][]string{{"Hel"}, {"lo. "}, {"World"}},
+		},
+		{
+			name:     "sentence split across chunks",
+			mode:     FlushSentence,
+			chunks:   []string{"Hel", "lo", ". Wor", "ld"},
+			want:     [][]string{nil, nil, {"Hello."}, nil},
+			wantRest: " World",
+		},
+		{
+			name:   "several sentences in one chunk",
+			mode:   FlushSentence,
+			chunks: []string{"One. Two! Three? Fo", "ur."},
+			want:   [][]string{{"One.", " Two!", " Three?"}, {" Four."}},
+		},
+		{
+			name:   "punctuation at the start of a chunk",
+			mode:   FlushSentence,
+			chunks: []string{"Yes", "! And", "?"},
+			want:   [][]string{nil, {"Yes!"}, {" And?"}},
+		},
+		{
+			name:     "blank line ends a sentence",
+			mode:     FlushSentence,
+			chunks:   []string{"A heading\n\nBody text"},
+			want:     [][]string{{"A heading\n\n"}},
+			wantRest: "Body text",
+		},
+		{
+			name:     "paragraph mode ignores sentence ends",
+			mode:     FlushParagraph,
+			chunks:   []string{"One. Two.", " Three.\n", "\nNext. "},
+			want:     [][]string{nil, nil, {"One. Two. Three.\n\n"}},
+			wantRest: "Next. ",
+		},
+		{
+			name:   "several paragraphs in one chunk",
+			mode:   FlushParagraph,
+			chunks: []string{"First.\n\nSecond!\n\n"},
+			want:   [][]string{{"First.\n\n", "Second!\n\n"}},
+		},
+		{
+			name:     "no boundary",
+			mode:     FlushParagraph,
+			chunks:   []string{"no ending", " at all"},
+			want:     [][]string{nil, nil},
+			wantRest: "no ending at all",
+		},
+		{
+			name:   "empty chunks",
+			mode:   FlushSentence,
+			chunks: []string{"", "Hi.", ""},
+			want:   [][]string{nil, {"Hi."}, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batcher, err := NewChunkBatcher(tt.mode)
+			if err != nil {
+				t.Fatalf("NewChunkBatcher(%q) error = %v", tt.mode, err)
+			}
+
+			for i, chunk := range tt.chunks {
+				segments, err := batcher.Add(chunk)
+				if err != nil {
+					t.Fatalf("Add(%q) error = %v", chunk, err)
+				}
+				if !slices.Equal(segments, tt.want[i]) {
+					t.Errorf("Add(%q) = %q, want %q", chunk, segments, tt.want[i])
+				}
+			}
+			if rest := batcher.Flush(); rest != tt.wantRest {
+				t.Errorf("Flush() = %q, want %q", rest, tt.wantRest)
+			}
+			if rest := batcher.Flush(); rest != "" {
+				t.Errorf("second Flush() = %q, want the buffer cleared", rest)
+			}
+		})
+	}
+
+	t.Run("invalid mode", func(t *testing.T) {
+		batcher := &ChunkBatcher{Mode: "word"}
+		if _, err := batcher.Add("Hi."); err == nil {
+			t.Error("Add() succeeded with an unknown mode")
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// FallbackLLMProvider delegates to a chain of providers in order, returning the first successful result
+type FallbackLLMProvider struct {
+	providers []LLMProvider
+}
+
+// NewFallbackLLMProvider creates a provider that tries each of the given providers in order
+func NewFallbackLLMProvider(providers ...LLMProvider) *FallbackLLMProvider {
+	return &FallbackLLMProvider{providers: providers}
+}
+
+// NewProviderChain builds a fallback provider from an ordered list of provider names
+func NewProviderChain(order []string) (*FallbackLLMProvider, error) {
+	var providers []LLMProvider
+	for _, name := range order {
+		providerType, err := ParseProviderType(name)
+		if err != nil {
+			return nil, err
+		}
+		provider, err := NewLLMProvider(providerType)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s provider: %w", providerType, err)
+		}
+		providers = append(providers, provider)
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("provider chain is empty")
+	}
+
+	log.Printf("[Fallback] Created provider chain: %v", order)
+	return NewFallbackLLMProvider(providers...), nil
+}
+
+// ChatWithHistory tries each provider in order until one returns a response
+func (p *FallbackLLMProvider) ChatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error) {
+	var lastErr error
+	for i, provider := range p.providers {
+		response, err := provider.ChatWithHistory(ctx, messages, customSystemPrompt, format, modelOverride, temperature, opts)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+		p.logFailure(i, provider, err)
+	}
+	return "", p.chainError(lastErr)
+}
+
+// ChatWithHistoryStream tries each provider in order until one starts a stream.
+// Once a stream has started, errors during streaming are not retried on other providers.
+func (p *FallbackLLMProvider) ChatWithHistoryStream(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (<-chan StreamChunk, error) {
+	var lastErr error
+	for i, provider := range p.providers {
+		chunks, err := provider.ChatWithHistoryStream(ctx, messages, customSystemPrompt, format, modelOverride, temperature, opts)
+		if err == nil {
+			return chunks, nil
+		}
+		lastErr = err
+		p.logFailure(i, provider, err)
+	}
+	return nil, p.chainError(lastErr)
+}
+
+// FetchGenerationCost tries each provider in order until one returns cost information
+func (p *FallbackLLMProvider) FetchGenerationCost(generationID string) (*GenerationData, error) {
+	var lastErr error
+	for i, provider := range p.providers {
+		data, err := provider.FetchGenerationCost(generationID)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		p.logFailure(i, provider, err)
+	}
+	return nil, p.chainError(lastErr)
+}
+
+// GetDefaultModel returns the default model of the primary provider
+func (p *FallbackLLMProvider) GetDefaultModel() string {
+	if len(p.providers) == 0 {
+		return GetModel()
+	}
+	return p.providers[0].GetDefaultModel()
+}
+
+// logFailure logs a provider error as a warning when another provider is left to try
+func (p *FallbackLLMProvider) logFailure(index int, provider LLMProvider, err error) {
+	if index < len(p.providers)-1 {
+		log.Printf("[Fallback] Warning: provider %T failed, trying next provider: %v", provider, err)
+	}
+}
+
+// chainError wraps the error of the last provider in the chain
+func (p *FallbackLLMProvider) chainError(lastErr error) error {
+	if lastErr == nil {
+		return fmt.Errorf("no providers configured")
+	}
+	return fmt.Errorf("all %d providers failed, last error: %w", len(p.providers), lastErr)
+}
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeProvider answers with a fixed response or error and counts its calls
+type fakeProvider struct {
+	response string
+	err      error
+	calls    int
+}
+
+func (p *fakeProvider) ChatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error) {
+	p.calls++
+	return p.response, p.err
+}
+
+func (p *fakeProvider) ChatWithHistoryStream(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (<-chan StreamChunk, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	chunks := make(chan StreamChunk, 1)
+	chunks <- StreamChunk{Content: p.response}
+	close(chunks)
+	return chunks, nil
+}
+
+func (p *fakeProvider) FetchGenerationCost(generationID string) (*GenerationData, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &GenerationData{ID: generationID}, nil
+}
+
+func (p *fakeProvider) GetDefaultModel() string {
+	return p.response + "/model"
+}
+
+func TestFallbackLLMProviderChatWithHistory(t *testing.T) {
+	primary := &fakeProvider{err: errors.New("primary down")}
+	secondary := &fakeProvider{response: "secondary"}
+	tertiary := &fakeProvider{response: "tertiary"}
+	chain := NewFallbackLLMProvider(primary, secondary, tertiary)
+
+	response, err := chain.ChatWithHistory(context.Background(), nil, "", "text", "", nil, nil)
+	if err != nil {
+		t.Fatalf("ChatWithHistory() error = %v", err)
+	}
+	if response != "secondary" {
+		t.Errorf("response = %q, want the secondary provider's", response)
+	}
+	if primary.calls != 1 || secondary.calls != 1 || tertiary.calls != 0 {
+		t.Errorf("calls = %d, %d, %d, want 1, 1, 0", primary.calls, secondary.calls, tertiary.calls)
+	}
+}
+
+func TestFallbackLLMProviderChatWithHistoryStream(t *testing.T) {
+	primary := &fakeProvider{err: errors.New("primary down")}
+	secondary := &fakeProvider{response: "secondary"}
+	chain := NewFallbackLLMProvider(primary, secondary)
+
+	chunks, err := chain.ChatWithHistoryStream(context.Background(), nil, "", "text", "", nil, nil)
+	if err != nil {
+		t.Fatalf("ChatWithHistoryStream() error = %v", err)
+	}
+	if chunk := <-chunks; chunk.Content != "secondary" {
+		t.Errorf("first chunk = %+v, want the secondary provider's stream", chunk)
+	}
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Errorf("calls = %d, %d, want 1, 1", primary.calls, secondary.calls)
+	}
+}
+
+func TestFallbackLLMProviderFetchGenerationCost(t *testing.T) {
+	chain := NewFallbackLLMProvider(&fakeProvider{err: errors.New("not found")}, &fakeProvider{})
+
+	data, err := chain.FetchGenerationCost("gen-1")
+	if err != nil || data.ID != "gen-1" {
+		t.Errorf("FetchGenerationCost() = %+v, %v, want the secondary provider's data", data, err)
+	}
+}
+
+func TestFallbackLLMProviderAllFail(t *testing.T) {
+	lastErr := errors.New("secondary down")
+	chain := NewFallbackLLMProvider(&fakeProvider{err: errors.New("primary down")}, &fakeProvider{err: lastErr})
+
+	if _, err := chain.ChatWithHistory(context.Background(), nil, "", "text", "", nil, nil); !errors.Is(err, lastErr) {
+		t.Errorf("ChatWithHistory() error = %v, want it to wrap the last provider's error", err)
+	}
+	if _, err := chain.ChatWithHistoryStream(context.Background(), nil, "", "text", "", nil, nil); !errors.Is(err, lastErr) {
+		t.Errorf("ChatWithHistoryStream() error = %v, want it to wrap the last provider's error", err)
+	}
+}
+
+func TestFallbackLLMProviderGetDefaultModel(t *testing.T) {
+	chain := NewFallbackLLMProvider(&fakeProvider{response: "primary"}, &fakeProvider{response: "secondary"})
+	if model := chain.GetDefaultModel(); model != "primary/model" {
+		t.Errorf("GetDefaultModel() = %q, want the primary provider's", model)
+	}
+}
+
+func TestNewProviderChainInvalid(t *testing.T) {
+	if _, err := NewProviderChain(nil); err == nil {
+		t.Error("NewProviderChain() accepted an empty order")
+	}
+	if _, err := NewProviderChain([]string{"unknown"}); err == nil {
+		t.Error("NewProviderChain() accepted an unknown provider")
+	}
+}
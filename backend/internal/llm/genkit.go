@@ -2,6 +2,7 @@ package llm
 
 import (
 	"bytes"
+	"chat-app/internal/tracing"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,17 +11,74 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/compat_oai"
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 )
 
+// generationIDHeaders are the OpenRouter response headers that may carry the generation ID
+var generationIDHeaders = []string{"openrouter-generation-id", "x-request-id"}
+
+type requestNonceKey struct{}
+
+// generationIDCapture is an http.RoundTripper that records the generation ID header of each
+// outbound request tagged with a nonce, since compat_oai does not expose response headers
+type generationIDCapture struct {
+	base   http.RoundTripper
+	ids    sync.Map // request nonce -> generation ID
+	nonces atomic.Uint64
+}
+
+// tag returns a context whose outbound requests have their generation ID recorded under nonce
+func (c *generationIDCapture) tag(ctx context.Context) (context.Context, uint64) {
+	nonce := c.nonces.Add(1)
+	return context.WithValue(ctx, requestNonceKey{}, nonce), nonce
+}
+
+// take returns and forgets the generation ID captured for nonce, or "" if none was seen
+func (c *generationIDCapture) take(nonce uint64) string {
+	if id, ok := c.ids.LoadAndDelete(nonce); ok {
+		return id.(string)
+	}
+	return ""
+}
+
+func (c *generationIDCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if nonce, ok := req.Context().Value(requestNonceKey{}).(uint64); ok {
+		for _, header := range generationIDHeaders {
+			if id := resp.Header.Get(header); id != "" {
+				c.ids.Store(nonce, id)
+				break
+			}
+		}
+	}
+
+	return resp, nil
+}
+
 // GenkitProvider implements LLMProvider using Firebase Genkit with OpenRouter via compat_oai
 type GenkitProvider struct {
-	genkit *genkit.Genkit
-	mu     sync.Mutex
+	genkit  *genkit.Genkit
+	mu      sync.Mutex
+	capture *generationIDCapture
+}
+
+// genkitRole maps a chat role to its Genkit equivalent. Genkit calls the assistant "model" and
+// drops messages with roles it doesn't know.
+func genkitRole(role string) ai.Role {
+	if role == "assistant" {
+		return ai.RoleModel
+	}
+	return ai.Role(role)
 }
 
 // NewGenkitProvider creates a new Genkit provider instance configured for OpenRouter
@@ -35,12 +93,16 @@ func NewGenkitProvider() (*GenkitProvider, error) {
 	// Get default model from config
 	defaultModel := GetModel()
 
+	// Route OpenRouter calls through the capture transport to read the generation ID header
+	capture := &generationIDCapture{base: tracing.Transport(http.DefaultTransport)}
+
 	// Initialize Genkit with OpenRouter plugin
 	g := genkit.Init(ctx,
 		genkit.WithPlugins(&compat_oai.OpenAICompatible{
 			Provider: "openrouter",
 			APIKey:   apiKey,
 			BaseURL:  "https://openrouter.ai/api/v1",
+			Opts:     []option.RequestOption{option.WithHTTPClient(&http.Client{Transport: capture})},
 		}),
 		genkit.WithDefaultModel("openrouter/"+defaultModel),
 	)
@@ -48,12 +110,13 @@ func NewGenkitProvider() (*GenkitProvider, error) {
 	log.Printf("[Genkit] Initialized with OpenRouter provider, default model: %s", defaultModel)
 
 	return &GenkitProvider{
-		genkit: g,
+		genkit:  g,
+		capture: capture,
 	}, nil
 }
 
 // ChatWithHistory sends a chat request with conversation history and returns the full response
-func (p *GenkitProvider) ChatWithHistory(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (string, error) {
+func (p *GenkitProvider) ChatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error) {
 	model := modelOverride
 	if model == "" {
 		model = GetModel()
@@ -75,10 +138,9 @@ func (p *GenkitProvider) ChatWithHistory(messages []Message, customSystemPrompt
 	// Convert messages to Genkit format
 	var genkitMessages []*ai.Message
 	for _, msg := range messagesWithHistory {
-		role := ai.Role(msg.Role)
 		genkitMessages = append(genkitMessages, &ai.Message{
-			Role:    role,
-			Content: []*ai.Part{ai.NewTextPart(msg.Content)},
+			Role:    genkitRole(msg.Role),
+			Content: genkitParts(msg),
 		})
 	}
 
@@ -98,8 +160,29 @@ func (p *GenkitProvider) ChatWithHistory(messages []Message, customSystemPrompt
 
 	// Note: OpenAI API doesn't support top_k, so we skip it for Genkit
 
+	// Set stop sequences
+	if stop := opts.stopSequences(); len(stop) > 0 {
+		config.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: stop}
+	}
+
+	// Set seed
+	if seed := opts.seed(); seed != nil {
+		config.Seed = openai.Int(int64(*seed))
+	}
+
+	// Set presence and frequency penalties
+	if penalty := opts.presencePenalty(); penalty != nil {
+		config.PresencePenalty = openai.Float(*penalty)
+	}
+	if penalty := opts.frequencyPenalty(); penalty != nil {
+		config.FrequencyPenalty = openai.Float(*penalty)
+	}
+
+	if len(opts.providerConfig()) > 0 {
+		log.Printf("[Genkit] Warning: provider-specific config is not supported by the Genkit provider and is ignored")
+	}
+
 	// Generate response
-	ctx := context.Background()
 	resp, err := genkit.Generate(ctx, p.genkit,
 		ai.WithMessages(genkitMessages...),
 		ai.WithModelName(model),
@@ -113,8 +196,60 @@ func (p *GenkitProvider) ChatWithHistory(messages []Message, customSystemPrompt
 	return resp.Text(), nil
 }
 
+// ChatForSummarization sends a chat request for summarization with ONLY the custom prompt (no default system prompt)
+func (p *GenkitProvider) ChatForSummarization(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (string, error) {
+	model := modelOverride
+	if model == "" {
+		model = GetModel()
+	}
+
+	// Ensure model has openrouter/ prefix
+	if !strings.HasPrefix(model, "openrouter/") {
+		model = "openrouter/" + model
+	}
+
+	tempStr := "nil"
+	if temperature != nil {
+		tempStr = fmt.Sprintf("%.2f", *temperature)
+	}
+	log.Printf("[Genkit] Calling for summarization with model: %s, temperature: %s, message history count: %d", model, tempStr, len(messages))
+
+	messagesWithHistory := buildMessagesWithCustomSystemPrompt(messages, summarizationPrompt)
+
+	// Convert messages to Genkit format
+	var genkitMessages []*ai.Message
+	for _, msg := range messagesWithHistory {
+		genkitMessages = append(genkitMessages, &ai.Message{
+			Role:    genkitRole(msg.Role),
+			Content: []*ai.Part{ai.NewTextPart(msg.Content)},
+		})
+	}
+
+	// Build config using OpenAI ChatCompletionNewParams
+	config := &openai.ChatCompletionNewParams{}
+	if temperature != nil {
+		config.Temperature = openai.Float(*temperature)
+	}
+	if topP := GetTopP("text"); topP != nil {
+		config.TopP = openai.Float(*topP)
+	}
+
+	resp, err := genkit.Generate(ctx, p.genkit,
+		ai.WithMessages(genkitMessages...),
+		ai.WithModelName(model),
+		ai.WithConfig(config),
+	)
+	if err != nil {
+		return "", fmt.Errorf("genkit summarization failed: %w", err)
+	}
+
+	content := resp.Text()
+	log.Printf("[Genkit] Extracted summarization content length: %d", len(content))
+	return content, nil
+}
+
 // ChatWithHistoryStream sends a chat request with conversation history and streams the response
-func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (<-chan StreamChunk, error) {
+func (p *GenkitProvider) ChatWithHistoryStream(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (<-chan StreamChunk, error) {
 	model := modelOverride
 	if model == "" {
 		model = GetModel()
@@ -136,10 +271,9 @@ func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemP
 	// Convert messages to Genkit format
 	var genkitMessages []*ai.Message
 	for _, msg := range messagesWithHistory {
-		role := ai.Role(msg.Role)
 		genkitMessages = append(genkitMessages, &ai.Message{
-			Role:    role,
-			Content: []*ai.Part{ai.NewTextPart(msg.Content)},
+			Role:    genkitRole(msg.Role),
+			Content: genkitParts(msg),
 		})
 	}
 
@@ -159,14 +293,86 @@ func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemP
 
 	// Note: OpenAI API doesn't support top_k, so we skip it for Genkit
 
+	// Set stop sequences
+	if stop := opts.stopSequences(); len(stop) > 0 {
+		config.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: stop}
+	}
+
+	// Set seed
+	if seed := opts.seed(); seed != nil {
+		config.Seed = openai.Int(int64(*seed))
+	}
+
+	// Set presence and frequency penalties
+	if penalty := opts.presencePenalty(); penalty != nil {
+		config.PresencePenalty = openai.Float(*penalty)
+	}
+	if penalty := opts.frequencyPenalty(); penalty != nil {
+		config.FrequencyPenalty = openai.Float(*penalty)
+	}
+
+	if len(opts.providerConfig()) > 0 {
+		log.Printf("[Genkit] Warning: provider-specific config is not supported by the Genkit provider and is ignored")
+	}
+
+	return p.generateStream(ctx, genkitMessages, model, config), nil
+}
+
+// ChatForSummarizationStream streams a summarization response, using ONLY the custom prompt (no default system prompt)
+func (p *GenkitProvider) ChatForSummarizationStream(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (<-chan StreamChunk, error) {
+	model := modelOverride
+	if model == "" {
+		model = GetModel()
+	}
+
+	// Ensure model has openrouter/ prefix
+	if !strings.HasPrefix(model, "openrouter/") {
+		model = "openrouter/" + model
+	}
+
+	tempStr := "nil"
+	if temperature != nil {
+		tempStr = fmt.Sprintf("%.2f", *temperature)
+	}
+	log.Printf("[Genkit] Calling (streaming) for summarization with model: %s, temperature: %s, message history count: %d", model, tempStr, len(messages))
+
+	messagesWithHistory := buildMessagesWithCustomSystemPrompt(messages, summarizationPrompt)
+
+	// Convert messages to Genkit format
+	var genkitMessages []*ai.Message
+	for _, msg := range messagesWithHistory {
+		genkitMessages = append(genkitMessages, &ai.Message{
+			Role:    genkitRole(msg.Role),
+			Content: []*ai.Part{ai.NewTextPart(msg.Content)},
+		})
+	}
+
+	// Build config using OpenAI ChatCompletionNewParams
+	config := &openai.ChatCompletionNewParams{}
+	if temperature != nil {
+		config.Temperature = openai.Float(*temperature)
+	}
+	if topP := GetTopP("text"); topP != nil {
+		config.TopP = openai.Float(*topP)
+	}
+
+	return p.generateStream(ctx, genkitMessages, model, config), nil
+}
+
+// generateStream runs a streaming Genkit generation and relays the response chunks.
+// Cancelling ctx aborts the generation and closes the returned channel.
+func (p *GenkitProvider) generateStream(ctx context.Context, genkitMessages []*ai.Message, model string, config *openai.ChatCompletionNewParams) <-chan StreamChunk {
 	// Create channel to stream chunks
 	chunks := make(chan StreamChunk)
 
+	// Tag the request so the generation ID header can be matched to this stream
+	ctx, nonce := p.capture.tag(ctx)
+
 	// Start streaming in a goroutine
 	go func() {
 		defer close(chunks)
+		defer p.capture.take(nonce)
 
-		ctx := context.Background()
 		var fullResponse strings.Builder
 
 		// Generate with streaming
@@ -180,7 +386,11 @@ func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemP
 					if part.IsText() {
 						text := part.Text
 						fullResponse.WriteString(text)
-						chunks <- StreamChunk{Content: text}
+						select {
+						case chunks <- StreamChunk{Content: text}:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
 						log.Printf("[Genkit] Stream chunk: %q", text)
 					}
 				}
@@ -189,6 +399,10 @@ func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemP
 		)
 
 		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("[Genkit] Warning: stream cancelled by caller: %v", ctx.Err())
+				return
+			}
 			log.Printf("[Genkit] Stream error: %v", err)
 			return
 		}
@@ -205,29 +419,36 @@ func (p *GenkitProvider) ChatWithHistoryStream(messages []Message, customSystemP
 				usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
 		}
 
-		// Send final metadata chunk with usage data
-		// Note: Genkit doesn't expose OpenRouter's generation ID for cost tracking
-		chunks <- StreamChunk{
+		generationID := p.capture.take(nonce)
+		if generationID == "" {
+			log.Printf("[Genkit] Warning: no generation ID header in OpenRouter response, cost tracking unavailable")
+		}
+
+		// Send final metadata chunk with usage data and the captured generation ID for cost lookup
+		select {
+		case chunks <- StreamChunk{
 			Metadata: &StreamMetadata{
-				GenerationID: "", // Not available from Genkit/compat_oai
+				GenerationID: generationID,
 				Usage:        usage,
 			},
 			IsDone: true,
+		}:
+		case <-ctx.Done():
+			log.Printf("[Genkit] Warning: stream cancelled before final metadata: %v", ctx.Err())
+			return
 		}
 
 		log.Printf("[Genkit] Stream completed, full response length: %d", len(fullResponse.String()))
 	}()
 
-	return chunks, nil
+	return chunks
 }
 
 // FetchGenerationCost fetches cost information for a generation
-// Note: Genkit doesn't provide generation cost tracking in the same way as OpenRouter
+// Genkit doesn't expose OpenRouter's generation endpoint, so this queries OpenRouter directly
+// using the generation ID captured from the streaming response headers
 func (p *GenkitProvider) FetchGenerationCost(generationID string) (*GenerationData, error) {
-	// Genkit via compat_oai doesn't expose OpenRouter's generation endpoint
-	// We could potentially track this via OpenTelemetry traces if needed
-	log.Printf("[Genkit] FetchGenerationCost not supported for Genkit provider")
-	return nil, fmt.Errorf("generation cost tracking not supported for Genkit provider")
+	return p.FetchGenerationCostViaOpenRouter(generationID)
 }
 
 // GetDefaultModel returns the default model for Genkit provider
@@ -275,6 +496,7 @@ func (p *GenkitProvider) FetchGenerationCostViaOpenRouter(generationID string) (
 		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
+	genResp.Data.splitCost()
 	return &genResp.Data, nil
 }
 
@@ -329,3 +551,12 @@ func UnmarshalResponseForID(data []byte) string {
 
 	return response.ID
 }
+
+// genkitParts converts a message's text and images into Genkit content parts
+func genkitParts(msg Message) []*ai.Part {
+	parts := []*ai.Part{ai.NewTextPart(msg.Content)}
+	for _, url := range msg.ImageURLs {
+		parts = append(parts, ai.NewMediaPart("", url))
+	}
+	return parts
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerationIDCapture(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		tagged  bool
+		wantID  string
+	}{
+		{name: "generation ID header", headers: map[string]string{"openrouter-generation-id": "gen-1"}, tagged: true, wantID: "gen-1"},
+		{name: "request ID fallback", headers: map[string]string{"x-request-id": "req-1"}, tagged: true, wantID: "req-1"},
+		{
+			name:    "generation ID preferred",
+			headers: map[string]string{"x-request-id": "req-1", "openrouter-generation-id": "gen-1"},
+			tagged:  true,
+			wantID:  "gen-1",
+		},
+		{name: "no header", tagged: true},
+		{name: "untagged request", headers: map[string]string{"openrouter-generation-id": "gen-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, value := range tt.headers {
+					w.Header().Set(name, value)
+				}
+			}))
+			defer server.Close()
+
+			capture := &generationIDCapture{base: http.DefaultTransport}
+			ctx, nonce := context.Background(), uint64(0)
+			if tt.tagged {
+				ctx, nonce = capture.tag(ctx)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := (&http.Client{Transport: capture}).Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := capture.take(nonce); got != tt.wantID {
+				t.Errorf("take() = %q, want %q", got, tt.wantID)
+			}
+			if got := capture.take(nonce); got != "" {
+				t.Errorf("second take() = %q, want the ID to be forgotten", got)
+			}
+		})
+	}
+
+	t.Run("distinct nonces", func(t *testing.T) {
+		capture := &generationIDCapture{}
+		_, first := capture.tag(context.Background())
+		_, second := capture.tag(context.Background())
+		if first == second {
+			t.Errorf("tag() returned nonce %d twice", first)
+		}
+	})
+}
+
+func TestGenkitParts(t *testing.T) {
+	parts := genkitParts(Message{Role: "user", Content: "What is this?", ImageURLs: []string{"https://example.com/a.png"}})
+	if len(parts) != 2 {
+		t.Fatalf("genkitParts() returned %d parts, want 2", len(parts))
+	}
+	if !parts[0].IsText() || parts[0].Text != "What is this?" {
+		t.Errorf("part 0 = %+v, want the text", parts[0])
+	}
+	if !parts[1].IsMedia() || parts[1].Text != "https://example.com/a.png" {
+		t.Errorf("part 1 = %+v, want the image URL as media", parts[1])
+	}
+
+	if parts := genkitParts(Message{Role: "assistant", Content: "Hi"}); len(parts) != 1 || parts[0].Text != "Hi" {
+		t.Errorf("genkitParts() without images = %+v, want a single text part", parts)
+	}
+}
@@ -1,12 +1,18 @@
 package llm
 
+import (
+	"context"
+	"encoding/json"
+)
+
 // LLMProvider defines the interface for LLM providers (OpenRouter direct API, Genkit, etc.)
 type LLMProvider interface {
 	// ChatWithHistory sends a chat request with conversation history and returns the full response
-	ChatWithHistory(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (string, error)
+	ChatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error)
 
-	// ChatWithHistoryStream sends a chat request with conversation history and streams the response
-	ChatWithHistoryStream(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (<-chan StreamChunk, error)
+	// ChatWithHistoryStream sends a chat request with conversation history and streams the response.
+	// Cancelling ctx aborts the upstream request and closes the returned channel.
+	ChatWithHistoryStream(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (<-chan StreamChunk, error)
 
 	// FetchGenerationCost fetches cost information for a generation (if supported)
 	FetchGenerationCost(generationID string) (*GenerationData, error)
@@ -14,3 +20,63 @@ type LLMProvider interface {
 	// GetDefaultModel returns the default model for this provider
 	GetDefaultModel() string
 }
+
+// Summarizer is implemented by providers that can run a chat request with only a custom
+// system prompt, without prepending the default system prompt
+type Summarizer interface {
+	// ChatForSummarization runs a non-streaming summarization request. Cancelling ctx aborts the upstream request.
+	ChatForSummarization(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (string, error)
+
+	// ChatForSummarizationStream is the streaming variant of ChatForSummarization.
+	// Cancelling ctx aborts the upstream request and closes the returned channel.
+	ChatForSummarizationStream(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (<-chan StreamChunk, error)
+}
+
+// ChatOptions holds optional generation parameters passed through to the provider
+type ChatOptions struct {
+	Stop             []string        // Sequences at which the model stops generating
+	Seed             *int            // Sampling seed for reproducible outputs, nil for none
+	PresencePenalty  *float64        // Penalty for tokens that already appeared (-2 to 2), nil for the model default
+	FrequencyPenalty *float64        // Penalty proportional to how often a token appeared (-2 to 2), nil for the model default
+	ProviderConfig   json.RawMessage // Extra provider-specific request fields (JSON object), merged into the request body
+}
+
+// stopSequences returns the configured stop sequences, tolerating nil options
+func (o *ChatOptions) stopSequences() []string {
+	if o == nil {
+		return nil
+	}
+	return o.Stop
+}
+
+// seed returns the configured sampling seed, tolerating nil options
+func (o *ChatOptions) seed() *int {
+	if o == nil {
+		return nil
+	}
+	return o.Seed
+}
+
+// presencePenalty returns the configured presence penalty, tolerating nil options
+func (o *ChatOptions) presencePenalty() *float64 {
+	if o == nil {
+		return nil
+	}
+	return o.PresencePenalty
+}
+
+// frequencyPenalty returns the configured frequency penalty, tolerating nil options
+func (o *ChatOptions) frequencyPenalty() *float64 {
+	if o == nil {
+		return nil
+	}
+	return o.FrequencyPenalty
+}
+
+// providerConfig returns the provider-specific request fields, tolerating nil options
+func (o *ChatOptions) providerConfig() json.RawMessage {
+	if o == nil {
+		return nil
+	}
+	return o.ProviderConfig
+}
@@ -0,0 +1,80 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ContentPart is one element of a multi-part message content as sent to OpenRouter
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// messageJSON is the wire form of a Message, whose content is either a string or a list of parts
+type messageJSON struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// MarshalJSON encodes the content as a plain string, or as text and image_url parts when the message has images
+func (m Message) MarshalJSON() ([]byte, error) {
+	if len(m.ImageURLs) == 0 {
+		content, err := json.Marshal(m.Content)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(messageJSON{Role: m.Role, Content: content})
+	}
+
+	parts := make([]ContentPart, 0, len(m.ImageURLs)+1)
+	if m.Content != "" {
+		parts = append(parts, ContentPart{Type: "text", Text: m.Content})
+	}
+	for _, url := range m.ImageURLs {
+		parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}})
+	}
+
+	content, err := json.Marshal(parts)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(messageJSON{Role: m.Role, Content: content})
+}
+
+// UnmarshalJSON accepts string content as well as multi-part content, joining the text parts
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw messageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = Message{Role: raw.Role}
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if raw.Content[0] == '"' {
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+
+	var parts []ContentPart
+	if err := json.Unmarshal(raw.Content, &parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			texts = append(texts, part.Text)
+		case part.Type == "image_url" && part.ImageURL != nil:
+			m.ImageURLs = append(m.ImageURLs, part.ImageURL.URL)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
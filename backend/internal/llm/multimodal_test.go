@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestMessageMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{
+			name: "text only",
+			msg:  Message{Role: "user", Content: "Hi"},
+			want: `{"role":"user","content":"Hi"}`,
+		},
+		{
+			name: "text and images",
+			msg:  Message{Role: "user", Content: "What is this?", ImageURLs: []string{"https://example.com/a.png", "https://example.com/b.png"}},
+			want: `{"role":"user","content":[{"type":"text","text":"What is this?"},` +
+				`{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},` +
+				`{"type":"image_url","image_url":{"url":"https://example.com/b.png"}}]}`,
+		},
+		{
+			name: "image without text",
+			msg:  Message{Role: "user", ImageURLs: []string{"https://example.com/a.png"}},
+			want: `{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "string content",
+			data: `{"role":"assistant","content":"Hello"}`,
+			want: Message{Role: "assistant", Content: "Hello"},
+		},
+		{
+			name: "multi-part content",
+			data: `{"role":"user","content":[{"type":"text","text":"First"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},{"type":"text","text":"Second"}]}`,
+			want: Message{Role: "user", Content: "First\nSecond", ImageURLs: []string{"https://example.com/a.png"}},
+		},
+		{
+			name: "unknown and incomplete parts ignored",
+			data: `{"role":"user","content":[{"type":"audio"},{"type":"image_url"},{"type":"text","text":"Hi"}]}`,
+			want: Message{Role: "user", Content: "Hi"},
+		},
+		{
+			name: "missing content",
+			data: `{"role":"user"}`,
+			want: Message{Role: "user"},
+		},
+		{
+			name: "null content",
+			data: `{"role":"user","content":null}`,
+			want: Message{Role: "user"},
+		},
+		{
+			name:    "invalid content",
+			data:    `{"role":"user","content":42}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tt.data), &msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if msg.Role != tt.want.Role || msg.Content != tt.want.Content || !slices.Equal(msg.ImageURLs, tt.want.ImageURLs) {
+				t.Errorf("Unmarshal() = %+v, want %+v", msg, tt.want)
+			}
+		})
+	}
+
+	// Images survive a round trip through the wire format
+	original := Message{Role: "user", Content: "Look", ImageURLs: []string{"https://example.com/a.png"}}
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Content != original.Content || !slices.Equal(decoded.ImageURLs, original.ImageURLs) {
+		t.Errorf("round trip = %+v, want %+v", decoded, original)
+	}
+}
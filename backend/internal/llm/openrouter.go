@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"chat-app/internal/config"
+	"chat-app/internal/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,22 +14,32 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const openRouterURL = "https://openrouter.ai/api/v1/chat/completions"
 const openRouterGenerationURL = "https://openrouter.ai/api/v1/generation"
 
 // OpenRouterProvider implements LLMProvider using direct OpenRouter API calls
-type OpenRouterProvider struct{}
+type OpenRouterProvider struct {
+	client       *http.Client // non-streaming requests
+	streamClient *http.Client // streaming requests, whose timeout also covers reading the stream
+}
 
 // NewOpenRouterProvider creates a new OpenRouter provider instance
 func NewOpenRouterProvider() *OpenRouterProvider {
-	return &OpenRouterProvider{}
+	return &OpenRouterProvider{
+		client:       &http.Client{Timeout: config.GetLLMRequestTimeout(), Transport: tracing.Transport(http.DefaultTransport)},
+		streamClient: &http.Client{Timeout: config.GetLLMStreamTimeout(), Transport: tracing.Transport(http.DefaultTransport)},
+	}
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string   `json:"role"`
+	Content   string   `json:"content"`
+	ImageURLs []string `json:"-"` // Images sent alongside the text to vision models (see MarshalJSON)
 }
 
 type Provider struct {
@@ -35,13 +47,17 @@ type Provider struct {
 }
 
 type ChatRequest struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	Stream      bool      `json:"stream"`
-	Temperature *float64  `json:"temperature,omitempty"`
-	TopP        *float64  `json:"top_p,omitempty"`
-	TopK        *int      `json:"top_k,omitempty"`
-	Provider    *Provider `json:"provider,omitempty"`
+	Model            string    `json:"model"`
+	Messages         []Message `json:"messages"`
+	Stream           bool      `json:"stream"`
+	Temperature      *float64  `json:"temperature,omitempty"`
+	TopP             *float64  `json:"top_p,omitempty"`
+	TopK             *int      `json:"top_k,omitempty"`
+	Stop             []string  `json:"stop,omitempty"`
+	Seed             *int      `json:"seed,omitempty"`
+	PresencePenalty  *float64  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64  `json:"frequency_penalty,omitempty"`
+	Provider         *Provider `json:"provider,omitempty"`
 }
 
 type ResponseUsage struct {
@@ -145,6 +161,18 @@ func GetTopK(format string) *int {
 }
 
 func buildMessagesWithHistory(messages []Message, customPrompt string) []Message {
+	promptMessages := BuildPromptMessages(messages, customPrompt)
+
+	// Log the final system prompt
+	systemPrompt := promptMessages[0].Content
+	log.Printf("[LLM] System prompt (length: %d): %s", len(systemPrompt), systemPrompt)
+
+	return promptMessages
+}
+
+// BuildPromptMessages returns the exact message list sent to the LLM for a chat request:
+// the default system prompt (with the custom prompt appended) followed by the conversation history
+func BuildPromptMessages(messages []Message, customPrompt string) []Message {
 	systemPrompt := GetSystemPrompt()
 
 	// If custom prompt is provided, append it to the default system prompt
@@ -152,9 +180,6 @@ func buildMessagesWithHistory(messages []Message, customPrompt string) []Message
 		systemPrompt = systemPrompt + "\n\n" + customPrompt
 	}
 
-	// Log the final system prompt
-	log.Printf("[LLM] System prompt (length: %d): %s", len(systemPrompt), systemPrompt)
-
 	// Prepend system message to the conversation history
 	return append([]Message{{Role: "system", Content: systemPrompt}}, messages...)
 }
@@ -170,7 +195,18 @@ func buildMessagesWithCustomSystemPrompt(messages []Message, customPrompt string
 }
 
 // ChatWithHistory sends a chat request with conversation history and returns the full response
-func (p *OpenRouterProvider) ChatWithHistory(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (string, error) {
+func (p *OpenRouterProvider) ChatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error) {
+	ctx, span := tracing.Start(ctx, "openrouter.chat_completion", trace.WithAttributes(
+		attribute.String("llm.model", modelOverride),
+		attribute.String("llm.format", format),
+		attribute.Int("llm.messages", len(messages)),
+	))
+	response, err := p.chatWithHistory(ctx, messages, customSystemPrompt, format, modelOverride, temperature, opts)
+	tracing.End(span, err)
+	return response, err
+}
+
+func (p *OpenRouterProvider) chatWithHistory(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (string, error) {
 	apiKey := GetAPIKey()
 	if apiKey == "" {
 		return "", fmt.Errorf("OPENROUTER_API_KEY not configured")
@@ -190,36 +226,29 @@ func (p *OpenRouterProvider) ChatWithHistory(messages []Message, customSystemPro
 	messagesWithHistory := buildMessagesWithHistory(messages, customSystemPrompt)
 
 	reqBody := ChatRequest{
-		Model:       model,
-		Messages:    messagesWithHistory,
-		Stream:      false,
-		Temperature: temperature,
-		TopP:        GetTopP(format),
-		TopK:        GetTopK(format),
+		Model:            model,
+		Messages:         messagesWithHistory,
+		Stream:           false,
+		Temperature:      temperature,
+		TopP:             GetTopP(format),
+		TopK:             GetTopK(format),
+		Stop:             opts.stopSequences(),
+		Seed:             opts.seed(),
+		PresencePenalty:  opts.presencePenalty(),
+		FrequencyPenalty: opts.frequencyPenalty(),
 		Provider: &Provider{
 			RequireParameters: false,
 		},
 	}
 
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := p.mergeProviderConfig(reqBody, opts.providerConfig())
 	if err != nil {
 		return "", fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", openRouterURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "http://localhost:3000")
-	req.Header.Set("X-Title", "Chat App")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.postChatCompletion(ctx, p.client, apiKey, jsonData)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -250,7 +279,7 @@ func (p *OpenRouterProvider) ChatWithHistory(messages []Message, customSystemPro
 }
 
 // ChatForSummarization sends a chat request for summarization with ONLY the custom prompt (no default system prompt)
-func (p *OpenRouterProvider) ChatForSummarization(messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (string, error) {
+func (p *OpenRouterProvider) ChatForSummarization(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (string, error) {
 	apiKey := GetAPIKey()
 	if apiKey == "" {
 		return "", fmt.Errorf("OPENROUTER_API_KEY not configured")
@@ -286,20 +315,9 @@ func (p *OpenRouterProvider) ChatForSummarization(messages []Message, summarizat
 		return "", fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", openRouterURL, bytes.NewBuffer(jsonData))
+	resp, err := p.postChatCompletion(ctx, p.client, apiKey, jsonData)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "http://localhost:3000")
-	req.Header.Set("X-Title", "Chat App")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error sending request: %w", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -330,7 +348,7 @@ func (p *OpenRouterProvider) ChatForSummarization(messages []Message, summarizat
 }
 
 // ChatWithHistoryStream sends a chat request with conversation history and streams the response
-func (p *OpenRouterProvider) ChatWithHistoryStream(messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64) (<-chan StreamChunk, error) {
+func (p *OpenRouterProvider) ChatWithHistoryStream(ctx context.Context, messages []Message, customSystemPrompt string, format string, modelOverride string, temperature *float64, opts *ChatOptions) (<-chan StreamChunk, error) {
 	apiKey := GetAPIKey()
 	if apiKey == "" {
 		return nil, fmt.Errorf("OPENROUTER_API_KEY not configured")
@@ -349,13 +367,54 @@ func (p *OpenRouterProvider) ChatWithHistoryStream(messages []Message, customSys
 
 	messagesWithHistory := buildMessagesWithHistory(messages, customSystemPrompt)
 
+	reqBody := ChatRequest{
+		Model:            model,
+		Messages:         messagesWithHistory,
+		Stream:           true,
+		Temperature:      temperature,
+		TopP:             GetTopP(format),
+		TopK:             GetTopK(format),
+		Stop:             opts.stopSequences(),
+		Seed:             opts.seed(),
+		PresencePenalty:  opts.presencePenalty(),
+		FrequencyPenalty: opts.frequencyPenalty(),
+		Provider: &Provider{
+			RequireParameters: false,
+		},
+	}
+
+	jsonData, err := p.mergeProviderConfig(reqBody, opts.providerConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	return p.streamRequest(ctx, jsonData)
+}
+
+// ChatForSummarizationStream streams a summarization response, using ONLY the custom prompt (no default system prompt)
+func (p *OpenRouterProvider) ChatForSummarizationStream(ctx context.Context, messages []Message, summarizationPrompt string, modelOverride string, temperature *float64) (<-chan StreamChunk, error) {
+	if GetAPIKey() == "" {
+		return nil, fmt.Errorf("OPENROUTER_API_KEY not configured")
+	}
+
+	model := modelOverride
+	if model == "" {
+		model = GetModel()
+	}
+
+	tempStr := "nil"
+	if temperature != nil {
+		tempStr = fmt.Sprintf("%.2f", *temperature)
+	}
+	log.Printf("[LLM] Calling OpenRouter API (streaming) for summarization with model: %s, temperature: %s, message history count: %d", model, tempStr, len(messages))
+
 	reqBody := ChatRequest{
 		Model:       model,
-		Messages:    messagesWithHistory,
+		Messages:    buildMessagesWithCustomSystemPrompt(messages, summarizationPrompt),
 		Stream:      true,
 		Temperature: temperature,
-		TopP:        GetTopP(format),
-		TopK:        GetTopK(format),
+		TopP:        GetTopP("text"),
+		TopK:        GetTopK("text"),
 		Provider: &Provider{
 			RequireParameters: false,
 		},
@@ -366,20 +425,17 @@ func (p *OpenRouterProvider) ChatWithHistoryStream(messages []Message, customSys
 		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", openRouterURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+	return p.streamRequest(ctx, jsonData)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("HTTP-Referer", "http://localhost:3000")
-	req.Header.Set("X-Title", "Chat App")
+// streamRequest sends a streaming chat completion request and relays the response chunks.
+// Cancelling ctx aborts the upstream request and closes the returned channel.
+func (p *OpenRouterProvider) streamRequest(ctx context.Context, jsonData []byte) (<-chan StreamChunk, error) {
+	apiKey := GetAPIKey()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.postChatCompletion(ctx, p.streamClient, apiKey, jsonData)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -434,26 +490,39 @@ func (p *OpenRouterProvider) ChatWithHistoryStream(messages []Message, customSys
 				// Extract content from delta field (streaming responses use delta)
 				if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
 					chunk := streamResp.Choices[0].Delta.Content
-					chunks <- StreamChunk{Content: chunk}
+					select {
+					case chunks <- StreamChunk{Content: chunk}:
+					case <-ctx.Done():
+						log.Printf("[LLM] Warning: stream cancelled by caller: %v", ctx.Err())
+						return
+					}
 					log.Printf("[LLM] Stream chunk: %q", chunk)
 				}
 			}
 		}
 
+		if err := scanner.Err(); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("[LLM] Warning: stream cancelled by caller: %v", ctx.Err())
+				return
+			}
+			log.Printf("[LLM] Scanner error: %v", err)
+		}
+
 		// Send final metadata chunk
 		if generationID != "" || usage != nil {
-			chunks <- StreamChunk{
+			select {
+			case chunks <- StreamChunk{
 				Metadata: &StreamMetadata{
 					GenerationID: generationID,
 					Usage:        usage,
 				},
 				IsDone: true,
+			}:
+				log.Printf("[LLM] Sent final metadata chunk")
+			case <-ctx.Done():
+				log.Printf("[LLM] Warning: stream cancelled before final metadata: %v", ctx.Err())
 			}
-			log.Printf("[LLM] Sent final metadata chunk")
-		}
-
-		if err := scanner.Err(); err != nil {
-			log.Printf("[LLM] Scanner error: %v", err)
 		}
 	}()
 
@@ -468,14 +537,84 @@ type GenerationData struct {
 	TokensCompletion       int     `json:"tokens_completion"`
 	NativeTokensPrompt     int     `json:"native_tokens_prompt"`
 	NativeTokensCompletion int     `json:"native_tokens_completion"`
-	Latency                int     `json:"latency"`        // Time to first token in milliseconds
+	Latency                int     `json:"latency"`         // Time to first token in milliseconds
 	GenerationTime         int     `json:"generation_time"` // Total generation time in milliseconds
+	Model                  string  `json:"model"`
+
+	// InputCostUSD and OutputCostUSD split TotalCost by token type using the model's configured
+	// pricing. They are nil when the model has no known pricing.
+	InputCostUSD  *float64 `json:"-"`
+	OutputCostUSD *float64 `json:"-"`
+}
+
+// splitCost computes the input and output cost of the generation from the native token counts
+// and the per-million-token prices in the models configuration
+func (g *GenerationData) splitCost() {
+	model, ok := config.GetModelByID(g.Model)
+	if !ok || !model.HasKnownPricing() {
+		return
+	}
+
+	inputCost := float64(g.NativeTokensPrompt) * model.InputPricePerMToken / 1_000_000
+	outputCost := float64(g.NativeTokensCompletion) * model.OutputPricePerMToken / 1_000_000
+	g.InputCostUSD = &inputCost
+	g.OutputCostUSD = &outputCost
 }
 
 type GenerationResponse struct {
 	Data GenerationData `json:"data"`
 }
 
+// mergeProviderConfig serializes the request body with provider-specific fields from extra deep-merged
+// into it. Nested objects are merged key by key; any other value in extra replaces the base value.
+func (p *OpenRouterProvider) mergeProviderConfig(base ChatRequest, extra json.RawMessage) (json.RawMessage, error) {
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(extra)) == 0 {
+		return baseJSON, nil
+	}
+
+	var extraFields map[string]interface{}
+	if err := json.Unmarshal(extra, &extraFields); err != nil {
+		return nil, fmt.Errorf("provider-specific config must be a JSON object: %w", err)
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &merged); err != nil {
+		return nil, err
+	}
+
+	for key, value := range extraFields {
+		baseValue, ok := merged[key]
+		if !ok {
+			continue
+		}
+		_, baseIsMap := baseValue.(map[string]interface{})
+		_, extraIsMap := value.(map[string]interface{})
+		if !baseIsMap || !extraIsMap {
+			log.Printf("[LLM] Warning: provider-specific config overrides request field %q", key)
+		}
+	}
+	deepMerge(merged, extraFields)
+
+	return json.Marshal(merged)
+}
+
+// deepMerge copies src into dst, merging nested objects recursively
+func deepMerge(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			deepMerge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = srcValue
+	}
+}
+
 // FetchGenerationCost fetches cost information for a generation from OpenRouter
 // with retry logic to handle timing delays in data availability
 func (p *OpenRouterProvider) FetchGenerationCost(generationID string) (*GenerationData, error) {
@@ -511,8 +650,7 @@ func (p *OpenRouterProvider) FetchGenerationCost(generationID string) (*Generati
 
 		req.Header.Set("Authorization", "Bearer "+apiKey)
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := p.client.Do(req)
 		if err != nil {
 			lastErr = fmt.Errorf("error sending request: %w", err)
 			continue
@@ -542,6 +680,7 @@ func (p *OpenRouterProvider) FetchGenerationCost(generationID string) (*Generati
 			genResp.Data.TotalCost, genResp.Data.NativeTokensPrompt, genResp.Data.NativeTokensCompletion,
 			genResp.Data.Latency, genResp.Data.GenerationTime)
 
+		genResp.Data.splitCost()
 		return &genResp.Data, nil
 	}
 
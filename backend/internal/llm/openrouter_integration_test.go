@@ -0,0 +1,410 @@
+//go:build integration_local
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/firebase/genkit/go/plugins/compat_oai"
+	"github.com/openai/openai-go/option"
+)
+
+const testAPIKey = "sk-or-test-key"
+
+// fakeOpenRouter simulates the OpenRouter chat completions and generation endpoints
+type fakeOpenRouter struct {
+	mu               sync.Mutex
+	completionStatus int    // status of /chat/completions, 200 when zero
+	completionBody   string // body of non-streaming and failed completions
+	streamBody       string // SSE body of streaming completions
+	holdStream       bool   // keep streaming completions open after streamBody until the client goes away
+	generationMisses int    // 404 responses to /generation before it answers
+	generationHeader string // openrouter-generation-id header of completions, omitted when empty
+	requests         []ChatRequest
+	authHeaders      []string
+	generationCalls  int
+}
+
+func (f *fakeOpenRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.authHeaders = append(f.authHeaders, r.Header.Get("Authorization"))
+
+	switch r.URL.Path {
+	case "/api/v1/chat/completions":
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, req)
+
+		if f.generationHeader != "" {
+			w.Header().Set("openrouter-generation-id", f.generationHeader)
+		}
+		if f.completionStatus != 0 && f.completionStatus != http.StatusOK {
+			http.Error(w, f.completionBody, f.completionStatus)
+			return
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, f.streamBody)
+			if f.holdStream {
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, f.completionBody)
+
+	case "/api/v1/generation":
+		f.generationCalls++
+		if f.generationCalls <= f.generationMisses {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":{"id":%q,"total_cost":0.0015,"native_tokens_prompt":12,"native_tokens_completion":34,"latency":120,"generation_time":900,"model":"test/model"}}`,
+			r.URL.Query().Get("id"))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// rewriteTransport sends every request to the test server instead of openrouter.ai
+type rewriteTransport struct {
+	target *url.URL
+	next   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	return t.next.RoundTrip(r)
+}
+
+// newTestOpenRouterProvider returns a provider talking to a TLS server simulating OpenRouter
+func newTestOpenRouterProvider(t *testing.T, fake *fakeOpenRouter) *OpenRouterProvider {
+	t.Helper()
+	t.Setenv("OPENROUTER_API_KEY", testAPIKey)
+	t.Setenv("LLM_RATE_LIMIT_RETRIES", "0")
+
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parsing server URL: %v", err)
+	}
+	client := server.Client()
+	client.Transport = &rewriteTransport{target: target, next: client.Transport}
+	return &OpenRouterProvider{client: client, streamClient: client}
+}
+
+func TestOpenRouterChatWithHistory(t *testing.T) {
+	fake := &fakeOpenRouter{
+		completionBody: `{"id":"gen-1","choices":[{"message":{"role":"assistant","content":"Hello there"}}]}`,
+	}
+	provider := newTestOpenRouterProvider(t, fake)
+
+	temperature := 0.3
+	got, err := provider.ChatWithHistory(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+		"Be brief.", "text", "test/model", &temperature, &ChatOptions{})
+	if err != nil {
+		t.Fatalf("ChatWithHistory: %v", err)
+	}
+	if got != "Hello there" {
+		t.Errorf("response = %q, want %q", got, "Hello there")
+	}
+
+	if len(fake.requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(fake.requests))
+	}
+	req := fake.requests[0]
+	if req.Model != "test/model" || req.Stream || req.Temperature == nil || *req.Temperature != temperature {
+		t.Errorf("request = model %q stream %v temperature %v, want test/model, false, %v", req.Model, req.Stream, req.Temperature, temperature)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || !strings.HasSuffix(req.Messages[0].Content, "Be brief.") ||
+		req.Messages[1].Role != "user" || req.Messages[1].Content != "Hi" {
+		t.Errorf("messages = %+v, want the system prompt ending in the custom prompt followed by the user message", req.Messages)
+	}
+	if auth := fake.authHeaders[0]; auth != "Bearer "+testAPIKey {
+		t.Errorf("Authorization = %q, want the API key", auth)
+	}
+}
+
+func TestOpenRouterChatWithHistoryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: "upstream failed", wantErr: "API returned status 500"},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: "invalid key", wantErr: "API returned status 401"},
+		{name: "malformed JSON", status: http.StatusOK, body: `{"choices":[`, wantErr: "error decoding response"},
+		{name: "no choices", status: http.StatusOK, body: `{"id":"gen-1","choices":[]}`, wantErr: "no response from API"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestOpenRouterProvider(t, &fakeOpenRouter{completionStatus: tt.status, completionBody: tt.body})
+
+			_, err := provider.ChatWithHistory(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+				"", "text", "test/model", nil, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenRouterChatRateLimited(t *testing.T) {
+	provider := newTestOpenRouterProvider(t, &fakeOpenRouter{completionStatus: http.StatusTooManyRequests, completionBody: "slow down"})
+
+	_, err := provider.ChatWithHistory(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+		"", "text", "test/model", nil, nil)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("error = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestOpenRouterChatWithHistoryStream(t *testing.T) {
+	fake := &fakeOpenRouter{
+		streamBody: ": OPENROUTER PROCESSING\n\n" +
+			`data: {"id":"gen-42","choices":[{"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n" +
+			`data: {"id":"gen-42","choices":[{"delta":{"content":"lo"}}]}` + "\n\n" +
+			"data: {not json}\n\n" +
+			`data: {"id":"gen-42","choices":[{"delta":{"content":""}}]}` + "\n\n" +
+			`data: {"id":"gen-42","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\n" +
+			"data: [DONE]\n\n",
+	}
+	provider := newTestOpenRouterProvider(t, fake)
+
+	chunks, err := provider.ChatWithHistoryStream(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+		"", "text", "test/model", nil, nil)
+	if err != nil {
+		t.Fatalf("ChatWithHistoryStream: %v", err)
+	}
+
+	var got []StreamChunk
+	for chunk := range chunks {
+		got = append(got, chunk)
+	}
+	want := []StreamChunk{
+		{Content: "Hel"},
+		{Content: "lo"},
+		{
+			Metadata: &StreamMetadata{
+				GenerationID: "gen-42",
+				Usage:        &ResponseUsage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7},
+			},
+			IsDone: true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks = %+v, want %+v", got, want)
+	}
+
+	if !fake.requests[0].Stream {
+		t.Error("request was not sent with stream: true")
+	}
+	if auth := fake.authHeaders[0]; auth != "Bearer "+testAPIKey {
+		t.Errorf("Authorization = %q, want the API key", auth)
+	}
+}
+
+func TestOpenRouterChatWithHistoryStreamCancelled(t *testing.T) {
+	fake := &fakeOpenRouter{
+		streamBody: `data: {"id":"gen-42","choices":[{"delta":{"content":"Hel"}}]}` + "\n\n" +
+			`data: {"id":"gen-42","choices":[{"delta":{"content":"lo"}}]}` + "\n\n",
+		holdStream: true,
+	}
+	provider := newTestOpenRouterProvider(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks, err := provider.ChatWithHistoryStream(ctx, []Message{{Role: "user", Content: "Hi"}},
+		"", "text", "test/model", nil, nil)
+	if err != nil {
+		t.Fatalf("ChatWithHistoryStream: %v", err)
+	}
+
+	for _, want := range []string{"Hel", "lo"} {
+		if chunk := <-chunks; chunk.Content != want {
+			t.Fatalf("chunk = %+v, want %q", chunk, want)
+		}
+	}
+	cancel()
+
+	// The stream goroutine closes the channel without a final chunk once the caller has gone away
+	select {
+	case chunk, ok := <-chunks:
+		if ok {
+			t.Errorf("received %+v after cancelling, want the channel closed", chunk)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream still open after the context was cancelled")
+	}
+}
+
+func TestOpenRouterChatWithHistoryStreamError(t *testing.T) {
+	provider := newTestOpenRouterProvider(t, &fakeOpenRouter{completionStatus: http.StatusBadGateway, completionBody: "bad gateway"})
+
+	chunks, err := provider.ChatWithHistoryStream(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+		"", "text", "test/model", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "API returned status 502") {
+		t.Fatalf("error = %v, want status 502", err)
+	}
+	if chunks != nil {
+		t.Error("a channel was returned with the error")
+	}
+}
+
+func TestOpenRouterFetchGenerationCost(t *testing.T) {
+	fake := &fakeOpenRouter{generationMisses: 1}
+	provider := newTestOpenRouterProvider(t, fake)
+
+	data, err := provider.FetchGenerationCost("gen-42")
+	if err != nil {
+		t.Fatalf("FetchGenerationCost: %v", err)
+	}
+	if fake.generationCalls != 2 {
+		t.Errorf("generation requests = %d, want a retry after the 404", fake.generationCalls)
+	}
+	if data.ID != "gen-42" || data.TotalCost != 0.0015 || data.NativeTokensPrompt != 12 || data.NativeTokensCompletion != 34 {
+		t.Errorf("generation = %+v, want gen-42 costing 0.0015 with 12 prompt and 34 completion tokens", data)
+	}
+	for _, auth := range fake.authHeaders {
+		if auth != "Bearer "+testAPIKey {
+			t.Errorf("Authorization = %q, want the API key", auth)
+		}
+	}
+}
+
+func TestOpenRouterWithoutAPIKey(t *testing.T) {
+	provider := newTestOpenRouterProvider(t, &fakeOpenRouter{})
+	t.Setenv("OPENROUTER_API_KEY", "")
+
+	if _, err := provider.ChatWithHistory(context.Background(), nil, "", "text", "test/model", nil, nil); err == nil {
+		t.Error("ChatWithHistory succeeded without an API key")
+	}
+	if _, err := provider.ChatWithHistoryStream(context.Background(), nil, "", "text", "test/model", nil, nil); err == nil {
+		t.Error("ChatWithHistoryStream succeeded without an API key")
+	}
+}
+
+// newTestGenkitProvider returns a Genkit provider whose OpenAI-compatible plugin talks to a TLS
+// server simulating OpenRouter
+func newTestGenkitProvider(t *testing.T, fake *fakeOpenRouter) *GenkitProvider {
+	t.Helper()
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	capture := &generationIDCapture{base: server.Client().Transport}
+	g := genkit.Init(context.Background(), genkit.WithPlugins(&compat_oai.OpenAICompatible{
+		Provider: "openrouter",
+		APIKey:   testAPIKey,
+		BaseURL:  server.URL + "/api/v1",
+		Opts:     []option.RequestOption{option.WithHTTPClient(&http.Client{Transport: capture})},
+	}))
+	return &GenkitProvider{genkit: g, capture: capture}
+}
+
+// Summarization requests are routed to providers implementing Summarizer
+var _ Summarizer = (*GenkitProvider)(nil)
+
+func TestGenkitChatForSummarizationOmitsDefaultSystemPrompt(t *testing.T) {
+	t.Setenv("OPENROUTER_SYSTEM_PROMPT", "You are a careful travel agent.")
+	fake := &fakeOpenRouter{
+		completionBody: `{"id":"gen-1","object":"chat.completion","created":1,"model":"test/model",` +
+			`"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"A short summary."}}]}`,
+	}
+	provider := newTestGenkitProvider(t, fake)
+	history := []Message{{Role: "user", Content: "Plan a trip"}, {Role: "assistant", Content: "Where to?"}}
+
+	summary, err := provider.ChatForSummarization(context.Background(), history, "Summarize the conversation.", "test/model", nil)
+	if err != nil {
+		t.Fatalf("ChatForSummarization: %v", err)
+	}
+	if summary != "A short summary." {
+		t.Errorf("summary = %q, want %q", summary, "A short summary.")
+	}
+	if _, err := provider.ChatWithHistory(context.Background(), history, "Be brief.", "text", "test/model", nil, nil); err != nil {
+		t.Fatalf("ChatWithHistory: %v", err)
+	}
+
+	if len(fake.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(fake.requests))
+	}
+	want := append([]Message{{Role: "system", Content: "Summarize the conversation."}}, history...)
+	if got := fake.requests[0].Messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("summarization messages = %+v, want only the summarization prompt before the history", got)
+	}
+	// Regular chat requests still start with the default system prompt
+	if got := fake.requests[1].Messages; len(got) != 3 || got[0].Content != GetSystemPrompt()+"\n\nBe brief." {
+		t.Errorf("chat messages = %+v, want the default system prompt with the custom prompt appended", got)
+	}
+}
+
+func TestGenkitChatWithHistoryStreamGenerationID(t *testing.T) {
+	streamBody := `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"test/model","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}` + "\n\n" +
+		`data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"test/model","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "header present", header: "gen-from-header"},
+		{name: "header missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestGenkitProvider(t, &fakeOpenRouter{streamBody: streamBody, generationHeader: tt.header})
+
+			chunks, err := provider.ChatWithHistoryStream(context.Background(), []Message{{Role: "user", Content: "Hi"}},
+				"", "text", "test/model", nil, nil)
+			if err != nil {
+				t.Fatalf("ChatWithHistoryStream: %v", err)
+			}
+
+			var content strings.Builder
+			var metadata *StreamMetadata
+			for chunk := range chunks {
+				content.WriteString(chunk.Content)
+				if chunk.IsDone {
+					metadata = chunk.Metadata
+				}
+			}
+
+			if content.String() != "Hello" {
+				t.Errorf("content = %q, want %q", content.String(), "Hello")
+			}
+			if metadata == nil || metadata.GenerationID != tt.header {
+				t.Errorf("final metadata = %+v, want generation ID %q", metadata, tt.header)
+			}
+			// The captured ID is handed over once and not kept after the stream ends
+			provider.capture.ids.Range(func(nonce, id any) bool {
+				t.Errorf("generation ID %v still stored for nonce %v", id, nonce)
+				return true
+			})
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package llm
+
+import (
+	"bytes"
+	"chat-app/internal/config"
+	"encoding/json"
+	"log"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestChatRequestWireFormat(t *testing.T) {
+	zero, seed := 0, 42
+	presence, frequency, zeroPenalty := 0.5, -1.5, 0.0
+	tests := []struct {
+		name  string
+		req   ChatRequest
+		check func(t *testing.T, fields map[string]json.RawMessage)
+	}{
+		{
+			name: "without stop sequences",
+			req:  ChatRequest{Model: "test/model"},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if stop, ok := fields["stop"]; ok {
+					t.Errorf("stop = %s, want it omitted", stop)
+				}
+			},
+		},
+		{
+			name: "with stop sequences",
+			req:  ChatRequest{Model: "test/model", Stop: []string{"###", "]]"}},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got := string(fields["stop"]); got != `["###","]]"]` {
+					t.Errorf("stop = %s, want [\"###\",\"]]\"]", got)
+				}
+			},
+		},
+		{
+			name: "without seed",
+			req:  ChatRequest{Model: "test/model"},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got, ok := fields["seed"]; ok {
+					t.Errorf("seed = %s, want it omitted", got)
+				}
+			},
+		},
+		{
+			name: "with seed",
+			req:  ChatRequest{Model: "test/model", Seed: &seed},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got := string(fields["seed"]); got != "42" {
+					t.Errorf("seed = %s, want 42", got)
+				}
+			},
+		},
+		{
+			name: "with zero seed",
+			req:  ChatRequest{Model: "test/model", Seed: &zero},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got := string(fields["seed"]); got != "0" {
+					t.Errorf("seed = %s, want 0", got)
+				}
+			},
+		},
+		{
+			name: "without penalties",
+			req:  ChatRequest{Model: "test/model"},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				for _, name := range []string{"presence_penalty", "frequency_penalty"} {
+					if got, ok := fields[name]; ok {
+						t.Errorf("%s = %s, want it omitted", name, got)
+					}
+				}
+			},
+		},
+		{
+			name: "with penalties",
+			req:  ChatRequest{Model: "test/model", PresencePenalty: &presence, FrequencyPenalty: &frequency},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got := string(fields["presence_penalty"]); got != "0.5" {
+					t.Errorf("presence_penalty = %s, want 0.5", got)
+				}
+				if got := string(fields["frequency_penalty"]); got != "-1.5" {
+					t.Errorf("frequency_penalty = %s, want -1.5", got)
+				}
+			},
+		},
+		{
+			name: "with zero penalty",
+			req:  ChatRequest{Model: "test/model", PresencePenalty: &zeroPenalty},
+			check: func(t *testing.T, fields map[string]json.RawMessage) {
+				if got := string(fields["presence_penalty"]); got != "0" {
+					t.Errorf("presence_penalty = %s, want 0", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("error marshaling request: %v", err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("error decoding request: %v", err)
+			}
+			tt.check(t, fields)
+		})
+	}
+}
+
+func TestMergeProviderConfig(t *testing.T) {
+	base := ChatRequest{
+		Model:    "test/model",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Stream:   true,
+		Provider: &Provider{RequireParameters: true},
+	}
+
+	tests := []struct {
+		name         string
+		extra        string
+		want         map[string]string // top-level fields of the merged request, as JSON
+		wantOverride string            // field the warning names, empty for no warning
+	}{
+		{
+			name: "no extra fields",
+			want: map[string]string{"model": `"test/model"`, "stream": "true", "provider": `{"require_parameters":true}`},
+		},
+		{
+			name:  "new fields",
+			extra: `{"reasoning":{"effort":"high"},"safe_prompt":true}`,
+			want:  map[string]string{"model": `"test/model"`, "reasoning": `{"effort":"high"}`, "safe_prompt": "true"},
+		},
+		{
+			name:  "nested object merged",
+			extra: `{"provider":{"order":["anthropic"]}}`,
+			want:  map[string]string{"provider": `{"order":["anthropic"],"require_parameters":true}`},
+		},
+		{
+			name:         "known field overridden",
+			extra:        `{"model":"other/model"}`,
+			want:         map[string]string{"model": `"other/model"`, "messages": `[{"content":"hi","role":"user"}]`},
+			wantOverride: "model",
+		},
+		{
+			name:         "object replaced by a scalar",
+			extra:        `{"provider":"anthropic"}`,
+			want:         map[string]string{"provider": `"anthropic"`},
+			wantOverride: "provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := log.Writer()
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(previous) })
+
+			data, err := (&OpenRouterProvider{}).mergeProviderConfig(base, json.RawMessage(tt.extra))
+			if err != nil {
+				t.Fatalf("mergeProviderConfig() error = %v", err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("error decoding merged request: %v", err)
+			}
+			for key, want := range tt.want {
+				if got := string(fields[key]); got != want {
+					t.Errorf("%s = %s, want %s", key, got, want)
+				}
+			}
+
+			want := "overrides request field"
+			if tt.wantOverride != "" {
+				want += ` "` + tt.wantOverride + `"`
+			}
+			if strings.Contains(logs.String(), want) != (tt.wantOverride != "") {
+				t.Errorf("log = %q, want a warning only for %q", logs.String(), tt.wantOverride)
+			}
+		})
+	}
+
+	for _, extra := range []string{`{"reasoning":`, `["reasoning"]`, `"reasoning"`} {
+		if _, err := (&OpenRouterProvider{}).mergeProviderConfig(base, json.RawMessage(extra)); err == nil {
+			t.Errorf("mergeProviderConfig(%s) succeeded, want an error for a non-object", extra)
+		}
+	}
+}
+
+func TestGenerationDataSplitCost(t *testing.T) {
+	previous := config.GetAvailableModels()
+	t.Cleanup(func() { config.SetModels(previous) })
+	config.SetModels([]config.Model{
+		{ID: "vendor/priced", InputPricePerMToken: 3, OutputPricePerMToken: 15},
+		{ID: "vendor/free", Tier: "free"},
+		{ID: "vendor/unpriced"},
+	})
+
+	tests := []struct {
+		name                  string
+		model                 string
+		wantSplit             bool
+		wantInput, wantOutput float64
+	}{
+		// 1000 prompt tokens at $3/M and 500 completion tokens at $15/M
+		{name: "priced model", model: "vendor/priced", wantSplit: true, wantInput: 0.003, wantOutput: 0.0075},
+		{name: "free model", model: "vendor/free", wantSplit: true},
+		{name: "model without pricing", model: "vendor/unpriced"},
+		{name: "unknown model", model: "vendor/unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GenerationData{Model: tt.model, TotalCost: 0.0105, NativeTokensPrompt: 1000, NativeTokensCompletion: 500}
+			g.splitCost()
+
+			if !tt.wantSplit {
+				if g.InputCostUSD != nil || g.OutputCostUSD != nil {
+					t.Error("split is set, want nil without pricing")
+				}
+				return
+			}
+			if g.InputCostUSD == nil || g.OutputCostUSD == nil {
+				t.Fatal("split = nil, want input and output cost")
+			}
+			if math.Abs(*g.InputCostUSD-tt.wantInput) > 1e-12 || math.Abs(*g.OutputCostUSD-tt.wantOutput) > 1e-12 {
+				t.Errorf("split = %v, %v, want %v, %v", *g.InputCostUSD, *g.OutputCostUSD, tt.wantInput, tt.wantOutput)
+			}
+		})
+	}
+}
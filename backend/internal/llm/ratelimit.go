@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"bytes"
+	"chat-app/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// ErrRateLimited is wrapped by errors returned when OpenRouter kept answering 429 after all retries
+var ErrRateLimited = errors.New("rate limited")
+
+// rateLimitBaseDelay is the wait before the first retry of a rate-limited request; it doubles with each retry
+const rateLimitBaseDelay = 500 * time.Millisecond
+
+// rateLimitDelay returns the exponential backoff before the given retry (1-based) with up to 50% random jitter
+func rateLimitDelay(retry int) time.Duration {
+	delay := rateLimitBaseDelay * time.Duration(1<<uint(retry-1))
+	return delay + time.Duration(rand.Int64N(int64(delay/2)+1))
+}
+
+// postChatCompletion sends a chat completion request to OpenRouter. A 429 response is retried with
+// exponential backoff up to LLM_RATE_LIMIT_RETRIES times; any other response is returned to the caller.
+func (p *OpenRouterProvider) postChatCompletion(ctx context.Context, client *http.Client, apiKey string, jsonData []byte) (*http.Response, error) {
+	maxRetries := config.GetRateLimitRetries()
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", openRouterURL, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("HTTP-Referer", "http://localhost:3000")
+		req.Header.Set("X-Title", "Chat App")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error sending request: %w", err)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if attempt >= maxRetries {
+			return nil, fmt.Errorf("%w after %d retries: API returned status %d: %s", ErrRateLimited, maxRetries, resp.StatusCode, string(body))
+		}
+
+		delay := rateLimitDelay(attempt + 1)
+		log.Printf("[LLM] Rate limited by OpenRouter, retrying in %v (retry %d/%d)", delay, attempt+1, maxRetries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
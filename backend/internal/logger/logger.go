@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const fieldsContextKey contextKey = "log_fields"
+
+// RequestIDHeader carries the correlation ID: a client may set it on a request and it is echoed on every response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps client-supplied correlation IDs
+const maxRequestIDLength = 128
+
+// field is a request-scoped key/value pair included in every log line
+type field struct {
+	key   string
+	value string
+}
+
+// WithField returns a copy of ctx whose logger includes the given field, replacing any previous value
+func WithField(ctx context.Context, key, value string) context.Context {
+	existing, _ := ctx.Value(fieldsContextKey).([]field)
+
+	fields := make([]field, 0, len(existing)+1)
+	for _, f := range existing {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	fields = append(fields, field{key: key, value: value})
+
+	return context.WithValue(ctx, fieldsContextKey, fields)
+}
+
+// FromContext returns a logger pre-populated with the request-scoped fields
+// (correlation_id, trace_id, user_id, conversation_id) stored in ctx
+func FromContext(ctx context.Context) *log.Logger {
+	fields, _ := ctx.Value(fieldsContextKey).([]field)
+	if len(fields) == 0 {
+		return log.Default()
+	}
+
+	var prefix strings.Builder
+	for _, f := range fields {
+		prefix.WriteString(f.key)
+		prefix.WriteString("=")
+		prefix.WriteString(f.value)
+		prefix.WriteString(" ")
+	}
+
+	return log.New(log.Writer(), prefix.String(), log.Flags()|log.Lmsgprefix)
+}
+
+// CorrelationID returns the correlation ID of the request stored in ctx, if any
+func CorrelationID(ctx context.Context) string {
+	fields, _ := ctx.Value(fieldsContextKey).([]field)
+	for _, f := range fields {
+		if f.key == "correlation_id" {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// statusRecorder captures the response status while still supporting SSE flushing
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over to WebSocket upgrades
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// requestID returns the client-supplied correlation ID of a request if it is safe to log, or a new one
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return uuid.New().String()
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return uuid.New().String()
+		}
+	}
+	return id
+}
+
+// RequestLogger assigns a correlation ID to every request, taken from its X-Request-ID header
+// when present, returns it in the X-Request-ID response header, injects it into the request
+// context for FromContext along with the request's trace ID, and logs the request once it completes
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithField(r.Context(), "correlation_id", id)
+		if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+			ctx = WithField(ctx, "trace_id", spanCtx.TraceID().String())
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		FromContext(ctx).Printf("[HTTP] %s %s %d %v", r.Method, r.URL.Path, recorder.status, time.Since(start))
+	})
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger, and so every logger returned by FromContext, to a buffer
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+	return &buf
+}
+
+func TestFromContext(t *testing.T) {
+	buf := captureLog(t)
+
+	ctx := WithField(context.Background(), "correlation_id", "req-1")
+	ctx = WithField(ctx, "user_id", "u1")
+	ctx = WithField(ctx, "conversation_id", "c1")
+	ctx = WithField(ctx, "user_id", "u2")
+	FromContext(ctx).Printf("[CHAT] hello")
+
+	line := buf.String()
+	if !strings.Contains(line, "correlation_id=req-1 conversation_id=c1 user_id=u2 [CHAT] hello") {
+		t.Errorf("log line = %q, want the fields in order with user_id replaced", line)
+	}
+	if CorrelationID(ctx) != "req-1" {
+		t.Errorf("CorrelationID() = %q, want req-1", CorrelationID(ctx))
+	}
+}
+
+func TestFromContextWithoutFields(t *testing.T) {
+	if FromContext(context.Background()) != log.Default() {
+		t.Error("FromContext() without fields did not return the standard logger")
+	}
+	if id := CorrelationID(context.Background()); id != "" {
+		t.Errorf("CorrelationID() = %q, want empty", id)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantKept  bool
+		wantFresh bool
+	}{
+		{name: "client ID", header: "client-req.42_a", wantKept: true},
+		{name: "no ID", wantFresh: true},
+		{name: "unsafe ID", header: "id with spaces\n", wantFresh: true},
+		{name: "overlong ID", header: strings.Repeat("a", maxRequestIDLength+1), wantFresh: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+
+			var handlerID string
+			handler := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID = CorrelationID(r.Context())
+				ctx := WithField(r.Context(), "user_id", "u1")
+				ctx = WithField(ctx, "conversation_id", "c1")
+				FromContext(ctx).Printf("[CHAT] handled")
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/conversations", nil)
+			if tt.header != "" {
+				r.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.wantKept && id != tt.header {
+				t.Errorf("%s = %q, want the client ID %q", RequestIDHeader, id, tt.header)
+			}
+			if tt.wantFresh && (id == "" || id == tt.header) {
+				t.Errorf("%s = %q, want a generated ID", RequestIDHeader, id)
+			}
+			if handlerID != id {
+				t.Errorf("correlation ID in the handler = %q, want %q", handlerID, id)
+			}
+
+			logged := buf.String()
+			if !strings.Contains(logged, "correlation_id="+id+" user_id=u1 conversation_id=c1 [CHAT] handled") {
+				t.Errorf("log = %q, want the handler line with the correlation, user and conversation IDs", logged)
+			}
+			if !strings.Contains(logged, "correlation_id="+id+" [HTTP] GET /api/conversations 418") {
+				t.Errorf("log = %q, want the request line with the correlation ID", logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"unicode/utf8"
+)
+
+const (
+	// maxPayloadLength is the length above which a logged payload is cut down to truncatedPayloadLength
+	maxPayloadLength       = 1000
+	truncatedPayloadLength = 100
+)
+
+var (
+	apiKeyPattern = regexp.MustCompile(`sk-or-v1-[A-Za-z0-9]+`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// secretFieldPattern matches password/token/api_key values in key=value, key: value and JSON forms
+	secretFieldPattern = regexp.MustCompile(`(?i)("?\b(?:password|token|api_key)"?\s*[:=]\s*"?)([^\s",}]+)`)
+
+	// payloadFieldPattern matches the label before a logged message, prompt or response payload,
+	// such as "User input: " or "Raw response body: "; the payload runs to the end of the line
+	payloadFieldPattern = regexp.MustCompile(`(?i)\b(?:input|response|prompt|summary|body|chunk)\b[^:\n]*: `)
+)
+
+// SanitizingWriter redacts API keys, email addresses and secret fields from log lines and
+// truncates overly long payloads before passing them to the underlying writer
+type SanitizingWriter struct {
+	out io.Writer
+}
+
+// NewSanitizingWriter returns a writer that sanitizes each log line written to out
+func NewSanitizingWriter(out io.Writer) *SanitizingWriter {
+	return &SanitizingWriter{out: out}
+}
+
+// InstallSanitizer routes the standard logger, and every logger created by FromContext, through a SanitizingWriter
+func InstallSanitizer() {
+	log.SetOutput(NewSanitizingWriter(os.Stderr))
+}
+
+// Write sanitizes p, which the log package passes as one complete log line
+func (s *SanitizingWriter) Write(p []byte) (int, error) {
+	if _, err := s.out.Write(Sanitize(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sanitize returns a copy of a log line with sensitive values redacted and long payloads truncated
+func Sanitize(line []byte) []byte {
+	line = apiKeyPattern.ReplaceAll(line, []byte("sk-or-v1-[REDACTED]"))
+	line = emailPattern.ReplaceAll(line, []byte("[REDACTED_EMAIL]"))
+	line = secretFieldPattern.ReplaceAll(line, []byte("${1}[REDACTED]"))
+
+	return truncatePayload(line)
+}
+
+// truncatePayload cuts a message, prompt or response payload longer than maxPayloadLength down to
+// truncatedPayloadLength. The rest of the line, and lines without a payload, are kept in full.
+func truncatePayload(line []byte) []byte {
+	loc := payloadFieldPattern.FindIndex(line)
+	if loc == nil {
+		return line
+	}
+
+	payload := line[loc[1]:]
+	newline := len(payload) > 0 && payload[len(payload)-1] == '\n'
+	if newline {
+		payload = payload[:len(payload)-1]
+	}
+	if len(payload) <= maxPayloadLength {
+		return line
+	}
+
+	cut := truncatedPayloadLength
+	for cut > 0 && !utf8.RuneStart(payload[cut]) {
+		cut--
+	}
+	truncated := append([]byte{}, line[:loc[1]+cut]...)
+	truncated = append(truncated, "...[truncated]"...)
+	if newline {
+		truncated = append(truncated, '\n')
+	}
+	return truncated
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	longPayload := strings.Repeat("a", 1001)
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "non-sensitive line",
+			line: "[CHAT] Conversation c1 updated by user 42 at 12:00, model=vendor/large\n",
+			want: "[CHAT] Conversation c1 updated by user 42 at 12:00, model=vendor/large\n",
+		},
+		{
+			name: "API key",
+			line: "[LLM] Using key sk-or-v1-0123456789abcdef for request\n",
+			want: "[LLM] Using key sk-or-v1-[REDACTED] for request\n",
+		},
+		{
+			name: "email address",
+			line: "[AUTH] Registration failed for alice.smith+chat@example.co.uk\n",
+			want: "[AUTH] Registration failed for [REDACTED_EMAIL]\n",
+		},
+		{
+			name: "key=value secrets",
+			line: "[AUTH] login password=hunter2 token=eyJhbGciOi.payload.sig ok\n",
+			want: "[AUTH] login password=[REDACTED] token=[REDACTED] ok\n",
+		},
+		{
+			name: "JSON secrets",
+			line: `[HTTP] {"username":"alice","password":"hunter2","api_key":"abc123"}` + "\n",
+			want: `[HTTP] {"username":"alice","password":"[REDACTED]","api_key":"[REDACTED]"}` + "\n",
+		},
+		{
+			name: "colon-separated secret, any case",
+			line: "[AUTH] Token: abc.def\n",
+			want: "[AUTH] Token: [REDACTED]\n",
+		},
+		{
+			name: "payload at the limit",
+			line: "[CHAT] User input: " + strings.Repeat("a", 1000) + "\n",
+			want: "[CHAT] User input: " + strings.Repeat("a", 1000) + "\n",
+		},
+		{
+			name: "long payload",
+			line: "[CHAT] Full LLM response: " + longPayload + "\n",
+			want: "[CHAT] Full LLM response: " + strings.Repeat("a", 100) + "...[truncated]\n",
+		},
+		{
+			name: "long payload cut on a character boundary",
+			line: "[CHAT] User input: a" + strings.Repeat("é", 600),
+			want: "[CHAT] User input: a" + strings.Repeat("é", 49) + "...[truncated]",
+		},
+		{
+			name: "long line without a payload label",
+			line: "[DB] " + longPayload + "\n",
+			want: "[DB] " + longPayload + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Sanitize([]byte(tt.line))); got != tt.want {
+				t.Errorf("Sanitize(%q)\n got %q\nwant %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(NewSanitizingWriter(&buf))
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	ctx := WithField(context.Background(), "user_id", "u1")
+	FromContext(ctx).Printf("[AUTH] Login for bob@example.com with key sk-or-v1-secret")
+
+	line := buf.String()
+	if strings.Contains(line, "bob@example.com") || strings.Contains(line, "sk-or-v1-secret") {
+		t.Errorf("log line = %q, want the email and key redacted", line)
+	}
+	if !strings.Contains(line, "user_id=u1 [AUTH] Login for [REDACTED_EMAIL] with key sk-or-v1-[REDACTED]") {
+		t.Errorf("log line = %q, want the rest of the line kept", line)
+	}
+
+	// Write reports the length of the original line so the log package sees a complete write
+	p := []byte("password=hunter2\n")
+	if n, err := NewSanitizingWriter(&buf).Write(p); err != nil || n != len(p) {
+		t.Errorf("Write() = %d, %v, want %d, nil", n, err, len(p))
+	}
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	chatRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_requests_total",
+		Help: "Number of chat responses generated, by the model that answered and the response format",
+	}, []string{"model", "format"})
+
+	chatRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_request_duration_seconds",
+		Help:    "Time to serve a chat request, including the whole stream for streaming endpoints",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"route"})
+
+	streamChunks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "llm_stream_chunks_total",
+		Help: "Number of content chunks received from LLM streams",
+	})
+
+	llmTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_tokens_total",
+		Help: "Number of tokens consumed by streamed chat responses, by prompt or completion",
+	}, []string{"type"})
+
+	llmCost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "llm_cost_dollars_total",
+		Help: "Cost in USD of streamed chat responses as reported by the provider",
+	}, []string{"model"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Duration of database operations on the chat request path",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(chatRequests, chatRequestDuration, streamChunks, llmTokens, llmCost, dbQueryDuration)
+}
+
+// Middleware records how long the wrapped chat handler takes, labeled by its route pattern
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		chatRequestDuration.WithLabelValues(r.Pattern).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RecordChatRequest counts a chat response generated by model in the given response format
+func RecordChatRequest(model, format string) {
+	if format == "" {
+		format = "text"
+	}
+	chatRequests.WithLabelValues(model, format).Inc()
+}
+
+// AddStreamChunks counts content chunks received from an LLM stream
+func AddStreamChunks(count int) {
+	streamChunks.Add(float64(count))
+}
+
+// RecordLLMUsage adds the tokens and cost of a response; nil values are unknown and skipped
+func RecordLLMUsage(model string, promptTokens, completionTokens *int, cost *float64) {
+	if promptTokens != nil {
+		llmTokens.WithLabelValues("prompt").Add(float64(*promptTokens))
+	}
+	if completionTokens != nil {
+		llmTokens.WithLabelValues("completion").Add(float64(*completionTokens))
+	}
+	if cost != nil && *cost > 0 {
+		llmCost.WithLabelValues(model).Add(*cost)
+	}
+}
+
+// ObserveDBQuery records the duration of a database operation started at start.
+// Use it as: defer metrics.ObserveDBQuery("operation", time.Now())
+func ObserveDBQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterDBPoolGauges exposes database connection pool statistics as Prometheus gauges.
+// The stats function is sampled on every scrape.
+func RegisterDBPoolGauges(stats func() sql.DBStats) {
+	gauges := []struct {
+		name  string
+		help  string
+		value func(s sql.DBStats) float64
+	}{
+		{"db_pool_open_connections", "Number of established database connections, both in use and idle", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"db_pool_in_use_connections", "Number of database connections currently in use", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"db_pool_idle_connections", "Number of idle database connections", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"db_pool_max_open_connections", "Maximum number of open database connections", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"db_pool_wait_count", "Total number of connections waited for", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"db_pool_wait_duration_seconds", "Total time blocked waiting for a new connection", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	}
+
+	for _, g := range gauges {
+		value := g.value
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: g.name, Help: g.help},
+			func() float64 { return value(stats()) },
+		))
+	}
+}
+
+// RegisterStreamGauge exposes the number of active chat streams as a Prometheus gauge
+func RegisterStreamGauge(active func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{Name: "active_stream_connections", Help: "Number of chat responses currently being streamed"},
+		func() float64 { return float64(active()) },
+	))
+}
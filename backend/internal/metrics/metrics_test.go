@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterDBPoolGauges(t *testing.T) {
+	stats := sql.DBStats{MaxOpenConnections: 25, OpenConnections: 10, InUse: 3, Idle: 7, WaitCount: 4, WaitDuration: 1500 * time.Millisecond}
+	RegisterDBPoolGauges(func() sql.DBStats { return stats })
+
+	want := map[string]float64{
+		"db_pool_open_connections":      10,
+		"db_pool_in_use_connections":    3,
+		"db_pool_idle_connections":      7,
+		"db_pool_max_open_connections":  25,
+		"db_pool_wait_count":            4,
+		"db_pool_wait_duration_seconds": 1.5,
+	}
+
+	// The gauges are sampled on every scrape
+	stats.InUse, stats.Idle = 8, 2
+	want["db_pool_in_use_connections"], want["db_pool_idle_connections"] = 8, 2
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %v", err)
+	}
+	got := make(map[string]float64)
+	for _, family := range families {
+		if _, ok := want[family.GetName()]; ok {
+			got[family.GetName()] = family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+}
+
+func TestRegisterStreamGauge(t *testing.T) {
+	active := 5
+	RegisterStreamGauge(func() int { return active })
+	active = 7
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "active_stream_connections" {
+			if got := family.GetMetric()[0].GetGauge().GetValue(); got != 7 {
+				t.Errorf("active_stream_connections = %v, want 7", got)
+			}
+			return
+		}
+	}
+	t.Error("active_stream_connections not registered")
+}
@@ -0,0 +1,49 @@
+package moderation
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// Moderator checks user content against a blocklist of regular expressions before it reaches the LLM
+type Moderator struct {
+	enabled  bool
+	patterns []*regexp.Regexp
+}
+
+// NewModerator compiles the blocked patterns once so that checks are cheap at request time
+func NewModerator(enabled bool, blockedPatterns []string) (*Moderator, error) {
+	m := &Moderator{enabled: enabled}
+	if !enabled {
+		return m, nil
+	}
+
+	for _, pattern := range blockedPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation pattern %q: %w", pattern, err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+
+	log.Printf("[MODERATION] Loaded %d blocked patterns", len(m.patterns))
+	return m, nil
+}
+
+// Check tests the text against the blocklist. It returns true if the text is blocked,
+// along with the patterns that triggered the block.
+func (m *Moderator) Check(text string) (bool, []string, error) {
+	if m == nil || !m.enabled {
+		return false, nil, nil
+	}
+
+	var triggers []string
+	for _, re := range m.patterns {
+		if re.MatchString(text) {
+			triggers = append(triggers, re.String())
+		}
+	}
+
+	return len(triggers) > 0, triggers, nil
+}
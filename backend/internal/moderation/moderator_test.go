@@ -0,0 +1,84 @@
+package moderation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestModeratorCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		patterns     []string
+		text         string
+		wantBlocked  bool
+		wantTriggers []string
+	}{
+		{
+			name:         "matching pattern",
+			enabled:      true,
+			patterns:     []string{`(?i)\bforbidden\b`, `secret-\d+`},
+			text:         "This is FORBIDDEN talk",
+			wantBlocked:  true,
+			wantTriggers: []string{`(?i)\bforbidden\b`},
+		},
+		{
+			name:         "several matching patterns",
+			enabled:      true,
+			patterns:     []string{`(?i)\bforbidden\b`, `secret-\d+`},
+			text:         "forbidden secret-42",
+			wantBlocked:  true,
+			wantTriggers: []string{`(?i)\bforbidden\b`, `secret-\d+`},
+		},
+		{
+			name:     "no matching pattern",
+			enabled:  true,
+			patterns: []string{`(?i)\bforbidden\b`, `secret-\d+`},
+			text:     "forbiddenness and secret-x",
+		},
+		{
+			name:    "empty blocklist",
+			enabled: true,
+			text:    "anything goes",
+		},
+		{
+			name:     "disabled",
+			patterns: []string{`.*`},
+			text:     "anything goes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewModerator(tt.enabled, tt.patterns)
+			if err != nil {
+				t.Fatalf("NewModerator() error = %v", err)
+			}
+
+			blocked, triggers, err := m.Check(tt.text)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if blocked != tt.wantBlocked || !slices.Equal(triggers, tt.wantTriggers) {
+				t.Errorf("Check(%q) = %v %q, want %v %q", tt.text, blocked, triggers, tt.wantBlocked, tt.wantTriggers)
+			}
+		})
+	}
+}
+
+func TestNewModeratorInvalidPattern(t *testing.T) {
+	if _, err := NewModerator(true, []string{`(unclosed`}); err == nil {
+		t.Error("NewModerator() accepted an invalid pattern")
+	}
+	// Patterns are not compiled while moderation is disabled
+	if _, err := NewModerator(false, []string{`(unclosed`}); err != nil {
+		t.Errorf("NewModerator() with moderation disabled error = %v", err)
+	}
+}
+
+func TestNilModeratorPassesThrough(t *testing.T) {
+	var m *Moderator
+	if blocked, _, err := m.Check("anything"); blocked || err != nil {
+		t.Errorf("Check() = %v, %v, want a pass", blocked, err)
+	}
+}
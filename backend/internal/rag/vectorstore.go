@@ -0,0 +1,71 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Passage is a stored text fragment returned by a similarity search
+type Passage struct {
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`            // Similarity to the query, higher is closer
+	Source string  `json:"source,omitempty"` // Document the passage was taken from
+}
+
+// VectorStore retrieves the passages most similar to a piece of text
+type VectorStore interface {
+	Query(text string, k int) ([]Passage, error)
+}
+
+// HTTPVectorStore queries a vector store over HTTP. It posts {"query": ..., "top_k": ...} to the
+// configured URL and expects {"results": [{"text", "score", "source"}]} back, so Chroma or Qdrant
+// can be used behind a thin adapter that embeds the query text.
+type HTTPVectorStore struct {
+	url    string
+	client *http.Client
+}
+
+type queryRequest struct {
+	Query string `json:"query"`
+	TopK  int    `json:"top_k"`
+}
+
+type queryResponse struct {
+	Results []Passage `json:"results"`
+}
+
+func NewHTTPVectorStore(url string) *HTTPVectorStore {
+	return &HTTPVectorStore{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *HTTPVectorStore) Query(text string, k int) ([]Passage, error) {
+	body, err := json.Marshal(queryRequest{Query: text, TopK: k})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("vector store request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vector store returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode vector store response: %w", err)
+	}
+
+	return result.Results, nil
+}
@@ -0,0 +1,69 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPVectorStoreQuery(t *testing.T) {
+	t.Run("passages returned", func(t *testing.T) {
+		var got queryRequest
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("request = %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			w.Write([]byte(`{"results":[{"text":"Paris is in France.","score":0.9,"source":"atlas.md"},{"text":"Rome is in Italy.","score":0.4}]}`))
+		}))
+		defer server.Close()
+
+		passages, err := NewHTTPVectorStore(server.URL).Query("Where is Paris?", 2)
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if got.Query != "Where is Paris?" || got.TopK != 2 {
+			t.Errorf("request = %+v, want the query text and top_k 2", got)
+		}
+		want := []Passage{{Text: "Paris is in France.", Score: 0.9, Source: "atlas.md"}, {Text: "Rome is in Italy.", Score: 0.4}}
+		if len(passages) != len(want) || passages[0] != want[0] || passages[1] != want[1] {
+			t.Errorf("Query() = %+v, want %+v", passages, want)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "error status", status: http.StatusServiceUnavailable, body: "collection not loaded", wantErr: "status 503: collection not loaded"},
+		{name: "malformed response", status: http.StatusOK, body: `{"results":`, wantErr: "failed to decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewHTTPVectorStore(server.URL).Query("Where is Paris?", 3)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unreachable store", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		if _, err := NewHTTPVectorStore(server.URL).Query("Where is Paris?", 3); err == nil {
+			t.Error("Query() succeeded against a closed server")
+		}
+	})
+}
@@ -0,0 +1,178 @@
+// Package testutil provides helpers for tests that exercise handlers against a mocked database
+package testutil
+
+import (
+	"chat-app/internal/db"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// NewMockDB installs a sqlmock connection as the database for the duration of the test and returns
+// the mock to set expectations on. The query cache is disabled so every lookup reaches the mock,
+// and unmet expectations fail the test.
+func NewMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	t.Setenv("QUERY_CACHE_ENABLED", "false")
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating mock database: %v", err)
+	}
+
+	previous := db.GetDB()
+	db.SetDB(conn)
+	t.Cleanup(func() {
+		db.SetDB(previous)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet database expectations: %v", err)
+		}
+		conn.Close()
+	})
+	return mock
+}
+
+// ExpectUser expects a user lookup by username returning a user with the given ID
+func ExpectUser(mock sqlmock.Sqlmock, id, username string) {
+	expectUserRow(mock, id, username, false)
+}
+
+// ExpectAdmin expects a user lookup by username returning an admin with the given ID
+func ExpectAdmin(mock sqlmock.Sqlmock, id, username string) {
+	expectUserRow(mock, id, username, true)
+}
+
+func expectUserRow(mock sqlmock.Sqlmock, id, username string, isAdmin bool) {
+	mock.ExpectQuery(`FROM users WHERE username = \$1`).
+		WithArgs(username).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "is_admin", "webhook_url", "created_at"}).
+			AddRow(id, username, username+"@example.com", "hash", isAdmin, "", time.Now()))
+}
+
+// ExpectNoUser expects a user lookup by username that finds nothing
+func ExpectNoUser(mock sqlmock.Sqlmock, username string) {
+	mock.ExpectQuery(`FROM users WHERE username = \$1`).
+		WithArgs(username).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// Conversation describes a conversation row returned by ExpectConversation
+type Conversation struct {
+	ID               string
+	UserID           string
+	Title            string
+	ResponseFormat   string
+	ResponseSchema   string
+	ActiveSummaryID  *string
+	TitleGeneratedAt *time.Time
+	ArchivedAt       *time.Time
+	Color            string
+	UpdatedAt        time.Time
+}
+
+// ExpectConversation expects a conversation lookup by ID returning conv
+func ExpectConversation(mock sqlmock.Sqlmock, conv Conversation) {
+	format := conv.ResponseFormat
+	if format == "" {
+		format = "text"
+	}
+	updatedAt := conv.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	mock.ExpectQuery(`FROM conversations\s+WHERE id = \$1`).
+		WithArgs(conv.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "response_format", "response_schema", "active_summary_id",
+			"starred_at", "title_generated_at", "color", "archived_at", "created_at", "updated_at"}).
+			AddRow(conv.ID, conv.UserID, conv.Title, format, conv.ResponseSchema, conv.ActiveSummaryID,
+				nil, conv.TitleGeneratedAt, conv.Color, conv.ArchivedAt, updatedAt, updatedAt))
+}
+
+// ExpectNoConversation expects a conversation lookup by ID that finds nothing
+func ExpectNoConversation(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectQuery(`FROM conversations\s+WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// MessageColumns are the columns selected for a message with its full details
+var MessageColumns = []string{"id", "conversation_id", "role", "content", "model", "temperature", "seed", "provider",
+	"generation_id", "prompt_tokens", "completion_tokens", "total_tokens", "total_cost", "input_cost_usd", "output_cost_usd", "latency", "generation_time",
+	"response_time_ms", "parent_message_id", "partial", "system_prompt_hash", "edited_at", "created_at"}
+
+// MessageRow returns the MessageColumns values of a message without usage data
+func MessageRow(id, convID, role, content string) []driver.Value {
+	return []driver.Value{id, convID, role, content, "", nil, nil, "",
+		"", nil, nil, nil, nil, nil, nil, nil, nil,
+		nil, nil, false, "", nil, time.Now()}
+}
+
+// ExpectMessage expects a message lookup by ID returning a message of conversation convID
+func ExpectMessage(mock sqlmock.Sqlmock, id, convID, role, content string) {
+	mock.ExpectQuery(`FROM messages\s+WHERE id = \$1`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(MessageColumns).AddRow(MessageRow(id, convID, role, content)...))
+}
+
+// ExpectAddMessage expects a message to be inserted into a conversation, followed by the update of
+// the conversation's timestamp
+func ExpectAddMessage(mock sqlmock.Sqlmock, convID string) {
+	mock.ExpectQuery(`INSERT INTO messages`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("00000000-0000-0000-0000-00000000aaaa", time.Now()))
+	mock.ExpectExec(`UPDATE conversations SET updated_at`).
+		WithArgs(convID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// ExpectNoActiveSummary expects an active summary lookup for a conversation that has none
+func ExpectNoActiveSummary(mock sqlmock.Sqlmock, convID string) {
+	mock.ExpectQuery(`JOIN conversation_summaries s ON s.id = c.active_summary_id`).
+		WithArgs(convID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+// ExpectHistory expects the role and content of a conversation's messages to be read, returning
+// the given contents as alternating user and assistant messages
+func ExpectHistory(mock sqlmock.Sqlmock, convID string, contents ...string) {
+	rows := sqlmock.NewRows([]string{"role", "content"})
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		rows.AddRow(role, content)
+	}
+	mock.ExpectQuery(`SELECT role, content\s+FROM messages`).
+		WithArgs(convID).
+		WillReturnRows(rows)
+}
+
+// ExpectSummarySaved expects content to be stored as a new summary of a conversation up to
+// lastMessageID and made the conversation's active summary in one transaction
+func ExpectSummarySaved(mock sqlmock.Sqlmock, convID, content, lastMessageID string) {
+	summaryID := &SameArg{}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO conversation_summaries \(id, conversation_id, summary_content, summarized_up_to_message_id, usage_count\)`).
+		WithArgs(summaryID, convID, content, lastMessageID).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectExec(`UPDATE conversations SET active_summary_id = \$1 WHERE id = \$2`).
+		WithArgs(summaryID, convID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// SameArg is an argument matcher that matches any value the first time and only that value afterwards,
+// for IDs generated by the code under test that several statements must agree on
+type SameArg struct {
+	value driver.Value
+	set   bool
+}
+
+func (a *SameArg) Match(v driver.Value) bool {
+	if !a.set {
+		a.value, a.set = v, true
+	}
+	return v == a.value
+}
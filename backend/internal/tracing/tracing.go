@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"chat-app/internal/config"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this service's own instrumentation
+const tracerName = "chat-app"
+
+// provider is the tracer provider installed by Init, nil while export is disabled
+var provider *sdktrace.TracerProvider
+
+// Init installs the W3C trace context propagator and, when an OTLP endpoint is configured,
+// a tracer provider exporting spans to it. Without an endpoint spans are not recorded but
+// incoming trace IDs are still propagated to outgoing requests and logs.
+func Init(cfg config.TracingConfig) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg.OTLPEndpoint == "" {
+		log.Printf("[TRACE] Tracing export disabled (OTEL_EXPORTER_OTLP_ENDPOINT not set)")
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return fmt.Errorf("error creating OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Printf("[TRACE] Exporting traces for service %s to %s", cfg.ServiceName, cfg.OTLPEndpoint)
+	return nil
+}
+
+// Shutdown exports the spans still buffered and stops the tracer provider installed by Init, if any
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start starts a span as a child of the span in ctx, if any
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request, continuing the trace of an incoming traceparent header.
+// Spans are named after the method only, since raw paths contain IDs; Route adds the matched route.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+}
+
+// Route records the route matched by mux, such as /api/conversations/{id}, on the request's server span.
+// It must wrap the mux directly, as the pattern is only set on the request the mux receives.
+func Route(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		// Patterns are "[METHOD ][HOST]/PATH"; the route is the path part
+		if i := strings.Index(r.Pattern, "/"); i >= 0 {
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.HTTPRoute(r.Pattern[i:]))
+		}
+	})
+}
+
+// Transport wraps base so outgoing requests get a client span and carry the trace context
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,137 @@
+package validation
+
+import (
+	"chat-app/internal/config"
+	"chat-app/internal/llm"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+const (
+	// MaxMessageLengthBytes is the maximum size of a single chat message in bytes
+	MaxMessageLengthBytes = 32 * 1024
+	// MaxHistoryMessages is the maximum number of messages in a client-supplied history
+	MaxHistoryMessages = 100
+
+	// MaxStopSequences is the maximum number of stop sequences per request
+	MaxStopSequences = 4
+	// MaxStopSequenceLength is the maximum length of a single stop sequence in characters
+	MaxStopSequenceLength = 100
+
+	// MinPenalty and MaxPenalty bound the presence and frequency penalties
+	MinPenalty = -2.0
+	MaxPenalty = 2.0
+)
+
+// ValidateSystemPromptLength checks the size of a user-supplied system prompt against the configured limit.
+// The limit is in bytes rather than characters to match what is stored.
+func ValidateSystemPromptLength(prompt string) error {
+	if maxBytes := config.GetMaxSystemPromptLengthBytes(); maxBytes > 0 && len(prompt) > maxBytes {
+		return fmt.Errorf("system_prompt exceeds maximum length of %d bytes", maxBytes)
+	}
+	return nil
+}
+
+// ValidateMessage checks that a chat message is not empty and fits the message size limit
+func ValidateMessage(content string) error {
+	if content == "" {
+		return fmt.Errorf("content cannot be empty")
+	}
+	if len(content) > MaxMessageLengthBytes {
+		return fmt.Errorf("content must be at most %d bytes", MaxMessageLengthBytes)
+	}
+	return nil
+}
+
+// ValidateStopSequences checks the number and length of custom stop sequences
+func ValidateStopSequences(stops []string) error {
+	if len(stops) > MaxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", MaxStopSequences)
+	}
+	for _, stop := range stops {
+		if stop == "" {
+			return fmt.Errorf("stop sequences cannot be empty")
+		}
+		if len([]rune(stop)) > MaxStopSequenceLength {
+			return fmt.Errorf("stop sequences must be at most %d characters", MaxStopSequenceLength)
+		}
+	}
+	return nil
+}
+
+// ValidateSeed checks that a sampling seed, if given, is non-negative
+func ValidateSeed(seed *int) error {
+	if seed != nil && *seed < 0 {
+		return fmt.Errorf("seed must be a non-negative integer")
+	}
+	return nil
+}
+
+// ValidatePresencePenalty checks that a presence penalty, if given, lies within [-2, 2]
+func ValidatePresencePenalty(v *float64) error {
+	return validatePenalty("presence_penalty", v)
+}
+
+// ValidateFrequencyPenalty checks that a frequency penalty, if given, lies within [-2, 2]
+func ValidateFrequencyPenalty(v *float64) error {
+	return validatePenalty("frequency_penalty", v)
+}
+
+func validatePenalty(name string, v *float64) error {
+	if v != nil && (math.IsNaN(*v) || *v < MinPenalty || *v > MaxPenalty) {
+		return fmt.Errorf("%s must be between %g and %g", name, MinPenalty, MaxPenalty)
+	}
+	return nil
+}
+
+// ValidateProviderConfig checks that provider-specific config, if given, is a JSON object that
+// does not replace the model, messages, token limit or streaming mode chosen by the server
+func ValidateProviderConfig(raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("provider_specific_config must be a JSON object")
+	}
+	for _, reserved := range []string{"model", "messages", "max_tokens", "stream"} {
+		if _, ok := fields[reserved]; ok {
+			return fmt.Errorf("provider_specific_config cannot set %q", reserved)
+		}
+	}
+	return nil
+}
+
+// ValidateChatHistory checks a client-supplied conversation history: user and assistant
+// messages only, strictly alternating, starting and ending with a user message
+func ValidateChatHistory(messages []llm.Message) error {
+	if len(messages) == 0 {
+		return fmt.Errorf("messages cannot be empty")
+	}
+	if len(messages) > MaxHistoryMessages {
+		return fmt.Errorf("at most %d messages are allowed", MaxHistoryMessages)
+	}
+
+	for i, msg := range messages {
+		expectedRole := "user"
+		if i%2 == 1 {
+			expectedRole = "assistant"
+		}
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return fmt.Errorf("message %d: role must be user or assistant", i)
+		}
+		if msg.Role != expectedRole {
+			return fmt.Errorf("message %d: roles must alternate starting with user", i)
+		}
+		if err := ValidateMessage(msg.Content); err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+	}
+
+	if messages[len(messages)-1].Role != "user" {
+		return fmt.Errorf("the last message must be from the user")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidateColor checks that color is a hex color of the form #rrggbb
+func ValidateColor(color string) error {
+	if !colorPattern.MatchString(color) {
+		return fmt.Errorf("color must be a hex color like #ff5733")
+	}
+	return nil
+}
+
+// maxTitleLength is the longest conversation title in characters, matching titles taken from a first message
+const maxTitleLength = 100
+
+// ValidateTitle checks that a conversation title is non-blank and at most 100 characters
+func ValidateTitle(title string) error {
+	if strings.TrimSpace(title) == "" {
+		return fmt.Errorf("title must not be empty")
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return fmt.Errorf("title must be at most %d characters", maxTitleLength)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package validation
+
+import "testing"
+
+func TestValidateColor(t *testing.T) {
+	tests := []struct {
+		color   string
+		wantErr bool
+	}{
+		{color: "#ff5733"},
+		{color: "#FF5733"},
+		{color: "#000000"},
+		{color: "#aBcDeF"},
+		{color: "", wantErr: true},
+		{color: "ff5733", wantErr: true},
+		{color: "#fff", wantErr: true},
+		{color: "#ff57331", wantErr: true},
+		{color: "#gg5733", wantErr: true},
+		{color: "red", wantErr: true},
+		{color: " #ff5733", wantErr: true},
+		{color: "#ff5733\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateColor(tt.color); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateColor(%q) error = %v, want error %v", tt.color, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package validation
+
+import "fmt"
+
+// MaxFeedbackCommentLength is the maximum length of a feedback comment in characters
+const MaxFeedbackCommentLength = 2000
+
+// validFeedbackTypes lists the accepted feedback categories
+var validFeedbackTypes = map[string]bool{
+	"helpful":   true,
+	"harmful":   true,
+	"incorrect": true,
+	"other":     true,
+}
+
+// ValidateFeedback checks the rating range, comment length and feedback type of message feedback
+func ValidateFeedback(rating int, comment, feedbackType string) error {
+	if rating < 1 || rating > 5 {
+		return fmt.Errorf("rating must be between 1 and 5")
+	}
+	if len([]rune(comment)) > MaxFeedbackCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", MaxFeedbackCommentLength)
+	}
+	if !validFeedbackTypes[feedbackType] {
+		return fmt.Errorf("feedback_type must be one of helpful, harmful, incorrect, other")
+	}
+	return nil
+}
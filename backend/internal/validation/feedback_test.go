@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFeedback(t *testing.T) {
+	tests := []struct {
+		name         string
+		rating       int
+		comment      string
+		feedbackType string
+		wantErr      bool
+	}{
+		{name: "lowest rating", rating: 1, feedbackType: "helpful"},
+		{name: "highest rating with comment", rating: 5, comment: "Clear and correct", feedbackType: "other"},
+		{name: "longest comment", rating: 3, comment: strings.Repeat("é", MaxFeedbackCommentLength), feedbackType: "incorrect"},
+		{name: "rating too low", rating: 0, feedbackType: "helpful", wantErr: true},
+		{name: "rating too high", rating: 6, feedbackType: "helpful", wantErr: true},
+		{name: "comment too long", rating: 3, comment: strings.Repeat("x", MaxFeedbackCommentLength+1), feedbackType: "harmful", wantErr: true},
+		{name: "unknown type", rating: 3, feedbackType: "funny", wantErr: true},
+		{name: "missing type", rating: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFeedback(tt.rating, tt.comment, tt.feedbackType); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFeedback() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
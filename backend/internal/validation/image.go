@@ -0,0 +1,41 @@
+package validation
+
+import (
+	"chat-app/internal/config"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// MaxImageURLs is the maximum number of images attached to a single chat message
+const MaxImageURLs = 5
+
+// ValidateImageURLs checks that image URLs are absolute HTTP(S) URLs. In production mode
+// URLs pointing at localhost or loopback addresses are rejected.
+func ValidateImageURLs(urls []string) error {
+	if len(urls) > MaxImageURLs {
+		return fmt.Errorf("at most %d images are allowed", MaxImageURLs)
+	}
+
+	for i, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("image %d: must be an http or https URL", i)
+		}
+		if config.IsProduction() && isLocalHost(u.Hostname()) {
+			return fmt.Errorf("image %d: localhost URLs are not allowed", i)
+		}
+	}
+	return nil
+}
+
+// isLocalHost reports whether a host name refers to the local machine
+func isLocalHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateImageURLs(t *testing.T) {
+	tests := []struct {
+		name       string
+		urls       []string
+		production bool
+		wantErr    bool
+	}{
+		{name: "none"},
+		{name: "http and https", urls: []string{"http://example.com/a.png", "https://cdn.example.com/b.jpg?size=large"}},
+		{name: "most images", urls: slices.Repeat([]string{"https://example.com/a.png"}, MaxImageURLs)},
+		{name: "too many images", urls: slices.Repeat([]string{"https://example.com/a.png"}, MaxImageURLs+1), wantErr: true},
+		{name: "other scheme", urls: []string{"ftp://example.com/a.png"}, wantErr: true},
+		{name: "data URL", urls: []string{"data:image/png;base64,iVBORw0KGgo="}, wantErr: true},
+		{name: "relative URL", urls: []string{"/uploads/a.png"}, wantErr: true},
+		{name: "missing host", urls: []string{"https:///a.png"}, wantErr: true},
+		{name: "localhost in development", urls: []string{"http://localhost:8080/a.png", "http://127.0.0.1/b.png"}},
+		{name: "localhost in production", urls: []string{"http://localhost:8080/a.png"}, production: true, wantErr: true},
+		{name: "localhost subdomain in production", urls: []string{"http://images.LOCALHOST/a.png"}, production: true, wantErr: true},
+		{name: "loopback address in production", urls: []string{"http://127.0.0.2/a.png"}, production: true, wantErr: true},
+		{name: "IPv6 loopback in production", urls: []string{"http://[::1]/a.png"}, production: true, wantErr: true},
+		{name: "unspecified address in production", urls: []string{"http://0.0.0.0/a.png"}, production: true, wantErr: true},
+		{name: "public host in production", urls: []string{"https://example.com/a.png"}, production: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.production {
+				t.Setenv("APP_ENV", "production")
+			} else {
+				t.Setenv("APP_ENV", "development")
+			}
+			if err := ValidateImageURLs(tt.urls); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateImageURLs(%q) error = %v, want error %v", tt.urls, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidateResponseFormat checks that format is one of the supported response formats
+func ValidateResponseFormat(format string) error {
+	switch format {
+	case "text", "json", "xml":
+		return nil
+	}
+	return fmt.Errorf("response_format must be one of text, json, xml")
+}
+
+// ValidateResponseSchema checks that a response schema is well-formed for the given response format.
+// An empty schema is always accepted.
+func ValidateResponseSchema(format, schema string) error {
+	if strings.TrimSpace(schema) == "" {
+		return nil
+	}
+
+	switch format {
+	case "json":
+		return ValidateJSONSchema(schema)
+	case "xml":
+		return ValidateXMLSchema(schema)
+	}
+	return nil
+}
+
+// ValidateJSONSchema checks that schema is a JSON object with a "type" key that compiles as a JSON Schema
+func ValidateJSONSchema(schema string) error {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(schema), &parsed); err != nil {
+		return fmt.Errorf("response schema is not a valid JSON object: %w", err)
+	}
+
+	if _, ok := parsed["type"]; !ok {
+		return fmt.Errorf("response schema must have a top-level \"type\" key")
+	}
+
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema)); err != nil {
+		return fmt.Errorf("response schema is not a valid JSON Schema: %w", err)
+	}
+	return nil
+}
+
+// ValidateXMLSchema checks that schema is well-formed XML
+func ValidateXMLSchema(schema string) error {
+	decoder := xml.NewDecoder(strings.NewReader(schema))
+	sawElement := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("response schema is not well-formed XML: %w", err)
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			sawElement = true
+		}
+	}
+
+	if !sawElement {
+		return fmt.Errorf("response schema must contain at least one XML element")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package validation
+
+import "testing"
+
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{name: "valid schema", schema: `{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`},
+		{name: "malformed JSON", schema: `{"type":"object"`, wantErr: true},
+		{name: "JSON array", schema: `[{"type":"object"}]`, wantErr: true},
+		{name: "object without type", schema: `{"properties":{"name":{"type":"string"}}}`, wantErr: true},
+		{name: "invalid type", schema: `{"type":"person"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateJSONSchema(tt.schema); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJSONSchema(%s) error = %v, want error %v", tt.schema, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateResponseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		schema  string
+		wantErr bool
+	}{
+		{name: "empty schema", format: "json", schema: "  "},
+		{name: "text ignores the schema", format: "text", schema: "not a schema"},
+		{name: "JSON schema", format: "json", schema: `{"type":"string"}`},
+		{name: "invalid JSON schema", format: "json", schema: `{"type":`, wantErr: true},
+		{name: "XML schema", format: "xml", schema: `<person><name/></person>`},
+		{name: "malformed XML", format: "xml", schema: `<person><name></person>`, wantErr: true},
+		{name: "XML without elements", format: "xml", schema: `just text`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateResponseSchema(tt.format, tt.schema); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateResponseSchema(%q, %q) error = %v, want error %v", tt.format, tt.schema, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateResponseFormat(t *testing.T) {
+	for _, format := range []string{"text", "json", "xml"} {
+		if err := ValidateResponseFormat(format); err != nil {
+			t.Errorf("ValidateResponseFormat(%q) error = %v", format, err)
+		}
+	}
+	if err := ValidateResponseFormat("yaml"); err == nil {
+		t.Error("ValidateResponseFormat(\"yaml\") succeeded, want an error")
+	}
+}
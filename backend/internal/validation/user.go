@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"chat-app/internal/config"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"unicode"
+)
+
+const (
+	// MinUsernameLength is the minimum length of a username
+	MinUsernameLength = 3
+	// MaxUsernameLength is the maximum length of a username
+	MaxUsernameLength = 64
+	// MinPasswordLength is the minimum length of a password
+	MinPasswordLength = 8
+	// maxEmailLength is the maximum length of an email address (RFC 5321)
+	maxEmailLength = 254
+)
+
+var (
+	// emailPattern is a simplified RFC 5322 address: dot-atom local part, dotted domain with a TLD
+	emailPattern    = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+/=?^_` + "`" + `{|}~-]+(\.[A-Za-z0-9!#$%&'*+/=?^_` + "`" + `{|}~-]+)*@([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,}$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// ValidateEmail checks that email is a syntactically valid address
+func ValidateEmail(email string) error {
+	if email == "" {
+		return fmt.Errorf("email is required")
+	}
+	if len(email) > maxEmailLength || !emailPattern.MatchString(email) {
+		return fmt.Errorf("email is not a valid address")
+	}
+	return nil
+}
+
+// ValidateUsername checks the length and allowed characters of a username
+func ValidateUsername(username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength {
+		return fmt.Errorf("username must be between %d and %d characters", MinUsernameLength, MaxUsernameLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("username may only contain letters, digits, underscores and hyphens")
+	}
+	return nil
+}
+
+// ValidatePassword checks that a password is long enough and mixes letters and digits
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("password must contain at least one letter and one digit")
+	}
+	return nil
+}
+
+// ValidateWebhookURL checks that a user's webhook is an absolute HTTP(S) URL. Unless private webhooks
+// are allowed, URLs pointing at localhost or at a non-public IP address are rejected; host names are
+// checked again when the webhook is called, since they may resolve to a different address by then.
+func ValidateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook_url must be an http or https URL")
+	}
+	if !config.AllowPrivateWebhooks() {
+		if isLocalHost(u.Hostname()) {
+			return fmt.Errorf("webhook_url must not point at localhost")
+		}
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !IsPublicIP(ip) {
+			return fmt.Errorf("webhook_url must not point at a private address")
+		}
+	}
+	return nil
+}
+
+// IsPublicIP reports whether ip is publicly routable: not private, loopback, link-local or unspecified
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
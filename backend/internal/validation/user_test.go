@@ -0,0 +1,115 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{name: "public https URL", url: "https://hooks.example.com/export"},
+		{name: "not a URL", url: "hooks", wantErr: true},
+		{name: "unsupported scheme", url: "ftp://hooks.example.com", wantErr: true},
+		{name: "localhost", url: "http://localhost:8080/hook", wantErr: true},
+		{name: "loopback address", url: "http://127.0.0.1/hook", wantErr: true},
+		{name: "private address", url: "http://10.0.0.5/hook", wantErr: true},
+		{name: "metadata address", url: "http://169.254.169.254/latest", wantErr: true},
+		{name: "localhost when private webhooks are allowed", url: "http://localhost:8080/hook", allowPrivate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.allowPrivate {
+				t.Setenv("ALLOW_PRIVATE_WEBHOOKS", "true")
+			}
+			if err := ValidateWebhookURL(tt.url); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWebhookURL(%q) = %v, want error %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	domain := "@example.com"
+	tests := []struct {
+		name    string
+		email   string
+		wantErr bool
+	}{
+		{name: "simple address", email: "alice@example.com"},
+		{name: "dotted local part with tag", email: "alice.smith+chat@mail.example.co"},
+		{name: "maximum length", email: strings.Repeat("a", maxEmailLength-len(domain)) + domain},
+		{name: "too long", email: strings.Repeat("a", maxEmailLength-len(domain)+1) + domain, wantErr: true},
+		{name: "empty", email: "", wantErr: true},
+		{name: "missing at sign", email: "alice.example.com", wantErr: true},
+		{name: "missing local part", email: "@example.com", wantErr: true},
+		{name: "missing top-level domain", email: "alice@example", wantErr: true},
+		{name: "one-letter top-level domain", email: "alice@example.c", wantErr: true},
+		{name: "consecutive dots", email: "alice..smith@example.com", wantErr: true},
+		{name: "domain label starting with a hyphen", email: "alice@-example.com", wantErr: true},
+		{name: "whitespace", email: "alice @example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateEmail(tt.email); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateEmail(%q) = %v, want error %v", tt.email, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		wantErr  bool
+	}{
+		{name: "minimum length", username: strings.Repeat("a", MinUsernameLength)},
+		{name: "maximum length", username: strings.Repeat("a", MaxUsernameLength)},
+		{name: "digits, underscores and hyphens", username: "alice_smith-42"},
+		{name: "too short", username: strings.Repeat("a", MinUsernameLength-1), wantErr: true},
+		{name: "too long", username: strings.Repeat("a", MaxUsernameLength+1), wantErr: true},
+		{name: "empty", username: "", wantErr: true},
+		{name: "space", username: "alice smith", wantErr: true},
+		{name: "punctuation", username: "alice.smith", wantErr: true},
+		{name: "non-ASCII letters", username: "zoë", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateUsername(tt.username); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUsername(%q) = %v, want error %v", tt.username, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "minimum length", password: "abcdefg1"},
+		{name: "minimum length in runes", password: "ééééééé1"},
+		{name: "too short", password: "abcdef1", wantErr: true},
+		{name: "empty", password: "", wantErr: true},
+		{name: "letters only", password: "abcdefgh", wantErr: true},
+		{name: "digits only", password: "12345678", wantErr: true},
+		{name: "symbols and digits only", password: "!!!!!!!1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePassword(tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePassword(%q) = %v, want error %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -56,8 +56,13 @@ export const Login: React.FC<LoginProps> = ({ onLogin }) => {
       return;
     }
 
-    if (regPassword.length < 6) {
-      setError('Password must be at least 6 characters');
+    if (regPassword.length < 8) {
+      setError('Password must be at least 8 characters');
+      return;
+    }
+
+    if (!/[A-Za-z]/.test(regPassword) || !/[0-9]/.test(regPassword)) {
+      setError('Password must contain at least one letter and one digit');
       return;
     }
 
@@ -247,7 +252,7 @@ export const Login: React.FC<LoginProps> = ({ onLogin }) => {
               />
               <input
                 type="password"
-                placeholder="Password (min 6 characters)"
+                placeholder="Password (min 8 characters, letters and digits)"
                 value={regPassword}
                 onChange={(e) => setRegPassword(e.target.value)}
                 style={styles.input}
@@ -13,15 +13,26 @@ export interface RegisterCredentials {
 
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number; // Access token lifetime in seconds
 }
 
-export interface RegisterResponse {
+export interface RegisterResponse extends LoginResponse {
   message: string;
-  token: string;
 }
 
+// Refresh the access token this long before it expires
+const REFRESH_MARGIN_MS = 60 * 1000;
+
+// Name of the Web Lock that lets one tab at a time exchange the shared refresh token
+const REFRESH_LOCK_NAME = 'auth_refresh';
+
 export class AuthService {
   private static TOKEN_KEY = 'auth_token';
+  private static REFRESH_TOKEN_KEY = 'auth_refresh_token';
+  private static EXPIRES_AT_KEY = 'auth_expires_at';
+  private static refreshTimer: ReturnType<typeof setTimeout> | null = null;
+  private static refreshPromise: Promise<boolean> | null = null;
 
   static async login(credentials: LoginCredentials): Promise<string> {
     const response = await fetch(`${API_URL}/api/login`, {
@@ -38,7 +49,7 @@ export class AuthService {
     }
 
     const data: LoginResponse = await response.json();
-    this.setToken(data.token);
+    this.setTokens(data);
     return data.token;
   }
 
@@ -57,7 +68,7 @@ export class AuthService {
     }
 
     const data: RegisterResponse = await response.json();
-    this.setToken(data.token);
+    this.setTokens(data);
     return data.token;
   }
 
@@ -65,12 +76,118 @@ export class AuthService {
     localStorage.setItem(this.TOKEN_KEY, token);
   }
 
+  // Stores a token pair and schedules the next refresh
+  static setTokens(data: LoginResponse): void {
+    this.setToken(data.token);
+    localStorage.setItem(this.REFRESH_TOKEN_KEY, data.refresh_token);
+    localStorage.setItem(this.EXPIRES_AT_KEY, String(Date.now() + data.expires_in * 1000));
+    this.scheduleRefresh();
+  }
+
   static getToken(): string | null {
     return localStorage.getItem(this.TOKEN_KEY);
   }
 
-  static logout(): void {
+  // Exchanges the refresh token for a new token pair, unless staleToken has already been replaced.
+  // Returns false if the session has ended. Concurrent calls share one request, and tabs take turns
+  // through a lock so a rotated refresh token is never presented twice.
+  static refresh(staleToken: string | null = this.getToken()): Promise<boolean> {
+    if (!this.refreshPromise) {
+      this.refreshPromise = this.withRefreshLock(() => this.refreshTokens(staleToken)).finally(() => {
+        this.refreshPromise = null;
+      });
+    }
+    return this.refreshPromise;
+  }
+
+  // Runs fn while holding a lock shared by all tabs, where the Web Locks API is available
+  private static withRefreshLock(fn: () => Promise<boolean>): Promise<boolean> {
+    if ('locks' in navigator) {
+      return navigator.locks.request(REFRESH_LOCK_NAME, fn);
+    }
+    return fn();
+  }
+
+  private static async refreshTokens(staleToken: string | null): Promise<boolean> {
+    // Another tab may have refreshed or logged out while this one waited; re-read its tokens from storage
+    const token = this.getToken();
+    if (token !== staleToken) {
+      this.scheduleRefresh();
+      return token !== null;
+    }
+
+    const refreshToken = localStorage.getItem(this.REFRESH_TOKEN_KEY);
+    if (!refreshToken) {
+      return false;
+    }
+
+    try {
+      const response = await fetch(`${API_URL}/api/auth/refresh`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      });
+
+      if (!response.ok) {
+        if (response.status === 401) {
+          this.clearTokens();
+        }
+        return false;
+      }
+
+      const data: LoginResponse = await response.json();
+      this.setTokens(data);
+      return true;
+    } catch (error) {
+      console.error('Token refresh failed:', error);
+      return false;
+    }
+  }
+
+  // Refreshes the access token shortly before it expires
+  static scheduleRefresh(): void {
+    if (this.refreshTimer) {
+      clearTimeout(this.refreshTimer);
+      this.refreshTimer = null;
+    }
+
+    const expiresAt = Number(localStorage.getItem(this.EXPIRES_AT_KEY));
+    if (!expiresAt || !localStorage.getItem(this.REFRESH_TOKEN_KEY)) {
+      return;
+    }
+
+    const delay = Math.max(expiresAt - Date.now() - REFRESH_MARGIN_MS, 0);
+    this.refreshTimer = setTimeout(() => {
+      this.refresh();
+    }, delay);
+  }
+
+  private static clearTokens(): void {
+    if (this.refreshTimer) {
+      clearTimeout(this.refreshTimer);
+      this.refreshTimer = null;
+    }
     localStorage.removeItem(this.TOKEN_KEY);
+    localStorage.removeItem(this.REFRESH_TOKEN_KEY);
+    localStorage.removeItem(this.EXPIRES_AT_KEY);
+  }
+
+  static logout(): void {
+    const refreshToken = localStorage.getItem(this.REFRESH_TOKEN_KEY);
+    this.clearTokens();
+
+    if (refreshToken) {
+      // Revoke the refresh token; the local session is already gone if this fails
+      fetch(`${API_URL}/api/auth/logout`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      }).catch((error) => console.error('Logout request failed:', error));
+    }
   }
 
   static isAuthenticated(): boolean {
@@ -81,4 +198,30 @@ export class AuthService {
     const token = this.getToken();
     return token ? { Authorization: `Bearer ${token}` } : {};
   }
+
+  // Sends an authenticated request. A 401 response is retried once after refreshing the access token.
+  static async authFetch(url: string, init: RequestInit & { headers?: Record<string, string> } = {}): Promise<Response> {
+    const send = (token: string | null) =>
+      fetch(url, { ...init, headers: { ...init.headers, ...(token ? { Authorization: `Bearer ${token}` } : {}) } });
+
+    const token = this.getToken();
+    const response = await send(token);
+    if (response.status !== 401 || !(await this.refresh(token))) {
+      return response;
+    }
+    return send(this.getToken());
+  }
+
+  // Follows refreshes and logouts made in other tabs, which share the tokens in storage
+  static watchOtherTabs(): void {
+    window.addEventListener('storage', (event) => {
+      if (event.key === null || event.key === this.EXPIRES_AT_KEY) {
+        this.scheduleRefresh();
+      }
+    });
+  }
 }
+
+// Resume refreshing a session restored from storage
+AuthService.scheduleRefresh();
+AuthService.watchOtherTabs();
@@ -106,11 +106,10 @@ export class ChatService {
       payload.war_and_peace_percent = warAndPeacePercent;
     }
 
-    const response = await fetch(`${API_URL}/api/chat/stream`, {
+    const response = await AuthService.authFetch(`${API_URL}/api/chat/stream`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
       },
       body: JSON.stringify(payload),
     });
@@ -125,6 +124,8 @@ export class ChatService {
 
     const reader = response.body.getReader();
     const decoder = new TextDecoder();
+    // Named event of the frame being parsed ("event: <type>" precedes its "data:" line)
+    let eventType = '';
 
     try {
       while (true) {
@@ -135,49 +136,60 @@ export class ChatService {
         const lines = chunk.split('\n');
 
         for (const line of lines) {
+          if (line === '') {
+            eventType = '';
+            continue;
+          }
+          if (line.startsWith('event: ')) {
+            eventType = line.slice(7);
+            continue;
+          }
           // Parse SSE format: "data: content"
-          if (line.startsWith('data: ')) {
-            const content = line.slice(6);
-
-            // Check for conversation ID metadata
-            if (content.startsWith('CONV_ID:')) {
-              const convId = content.slice(8);
-              if (convId && onConversation) {
-                onConversation(convId);
+          if (!line.startsWith('data: ')) {
+            continue;
+          }
+          const content = line.slice(6);
+
+          switch (eventType) {
+            case 'conv_id':
+              if (content && onConversation) {
+                onConversation(content);
               }
-            }
-            // Check for model metadata
-            else if (content.startsWith('MODEL:')) {
-              const model = content.slice(6);
-              if (model && onModel) {
-                onModel(model);
+              break;
+            case 'model':
+              if (content && onModel) {
+                onModel(content);
               }
-            }
-            // Check for temperature metadata
-            else if (content.startsWith('TEMPERATURE:')) {
-              const temp = parseFloat(content.slice(12));
+              break;
+            case 'temperature': {
+              const temp = parseFloat(content);
               if (!isNaN(temp) && onTemperature) {
                 onTemperature(temp);
               }
+              break;
             }
-            // Check for usage metadata
-            else if (content.startsWith('USAGE:')) {
+            case 'usage':
               try {
-                const usageJson = content.slice(6);
-                const usage: UsageInfo = JSON.parse(usageJson);
+                const usage: UsageInfo = JSON.parse(content);
                 if (onUsage) {
                   onUsage(usage);
                 }
               } catch (e) {
                 console.error('Error parsing usage data:', e);
               }
-            }
-            // Skip [DONE] and empty events
-            else if (content && content !== '[DONE]') {
-              // Unescape newlines from SSE format
-              const unescapedContent = content.replace(/\\n/g, '\n');
-              onChunk(unescapedContent);
-            }
+              break;
+            case 'error':
+              console.error('Stream error:', content);
+              break;
+            case 'content':
+              if (content) {
+                // Unescape newlines from SSE format
+                onChunk(content.replace(/\\n/g, '\n'));
+              }
+              break;
+            // Checksum of the full response is sent for integrity checks and done marks the end; neither is content
+            default:
+              break;
           }
         }
       }
@@ -186,29 +198,41 @@ export class ChatService {
     }
   }
 
+  // Fetches every conversation, following next_cursor until the last page
   async getConversations(): Promise<Conversation[]> {
-    const response = await fetch(`${API_URL}/api/conversations`, {
-      method: 'GET',
-      headers: {
-        'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
-      },
-    });
+    const conversations: Conversation[] = [];
+    let cursor: string | undefined;
 
-    if (!response.ok) {
-      throw new Error('Failed to fetch conversations');
-    }
+    do {
+      const params = new URLSearchParams({ limit: '100' });
+      if (cursor) {
+        params.set('before', cursor);
+      }
 
-    const data = await response.json();
-    return data.conversations || [];
+      const response = await AuthService.authFetch(`${API_URL}/api/conversations?${params}`, {
+        method: 'GET',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+      });
+
+      if (!response.ok) {
+        throw new Error('Failed to fetch conversations');
+      }
+
+      const data = await response.json();
+      conversations.push(...(data.conversations || []));
+      cursor = data.next_cursor || undefined;
+    } while (cursor);
+
+    return conversations;
   }
 
   async getConversationMessages(conversationId: string): Promise<ConversationMessage[]> {
-    const response = await fetch(`${API_URL}/api/conversations/${conversationId}/messages`, {
+    const response = await AuthService.authFetch(`${API_URL}/api/conversations/${conversationId}/messages`, {
       method: 'GET',
       headers: {
         'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
       },
     });
 
@@ -221,11 +245,10 @@ export class ChatService {
   }
 
   async deleteConversation(conversationId: string): Promise<void> {
-    const response = await fetch(`${API_URL}/api/conversations/${conversationId}`, {
+    const response = await AuthService.authFetch(`${API_URL}/api/conversations/${conversationId}`, {
       method: 'DELETE',
       headers: {
         'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
       },
     });
 
@@ -259,11 +282,10 @@ export class ChatService {
       payload.temperature = temperature;
     }
 
-    const response = await fetch(`${API_URL}/api/conversations/${conversationId}/summarize`, {
+    const response = await AuthService.authFetch(`${API_URL}/api/conversations/${conversationId}/summarize`, {
       method: 'POST',
       headers: {
         'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
       },
       body: JSON.stringify(payload),
     });
@@ -280,11 +302,10 @@ export class ChatService {
   }
 
   async getConversationSummaries(conversationId: string): Promise<Array<{ upToMessageId: string; content: string }>> {
-    const response = await fetch(`${API_URL}/api/conversations/${conversationId}/summaries`, {
+    const response = await AuthService.authFetch(`${API_URL}/api/conversations/${conversationId}/summaries`, {
       method: 'GET',
       headers: {
         'Content-Type': 'application/json',
-        ...AuthService.getAuthHeader(),
       },
     });
 